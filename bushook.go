@@ -0,0 +1,75 @@
+// Bus instrumentation.
+
+package embd
+
+import (
+	"sync"
+	"time"
+)
+
+// BusTransaction describes a transaction on an I²C or SPI bus.
+type BusTransaction struct {
+	// Bus is "i2c" or "spi".
+	Bus string
+	// Num is the number of the bus, e.g. 1 for /dev/i2c-1 or 0 for
+	// /dev/spidev0.1.
+	Num byte
+	// Channel is the chip select of the SPI device, e.g. 1 for
+	// /dev/spidev0.1.
+	Channel byte
+	// Op is the name of the bus method, e.g. "ReadFromReg".
+	Op string
+	// Addr is the address of the I²C device.
+	Addr byte
+	// Len is the number of bytes transferred, the register excluded.
+	Len int
+
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// BusHook is called after every transaction on the buses of the host.
+type BusHook func(t BusTransaction)
+
+var busHooks struct {
+	sync.RWMutex
+	next  int
+	hooks map[int]BusHook
+}
+
+// AddBusHook registers a hook, e.g. to collect metrics about the buses,
+// and returns a func removing it. Hooks are called synchronously by the
+// bus which ran the transaction, so they must be fast.
+func AddBusHook(h BusHook) (remove func()) {
+	busHooks.Lock()
+	defer busHooks.Unlock()
+
+	if busHooks.hooks == nil {
+		busHooks.hooks = make(map[int]BusHook)
+	}
+	id := busHooks.next
+	busHooks.next++
+	busHooks.hooks[id] = h
+
+	return func() {
+		busHooks.Lock()
+		defer busHooks.Unlock()
+		delete(busHooks.hooks, id)
+	}
+}
+
+// ObserveBus reports a transaction which started at start to the hooks. It
+// is meant for the bus implementations of the hosts.
+func ObserveBus(t BusTransaction, start time.Time) {
+	busHooks.RLock()
+	defer busHooks.RUnlock()
+
+	if len(busHooks.hooks) == 0 {
+		return
+	}
+	t.Start, t.Duration = start, time.Since(start)
+	for _, h := range busHooks.hooks {
+		h(t)
+	}
+}
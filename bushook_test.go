@@ -0,0 +1,23 @@
+package embd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusHooks(t *testing.T) {
+	var got []BusTransaction
+	remove := AddBusHook(func(tr BusTransaction) { got = append(got, tr) })
+
+	start := time.Now()
+	ObserveBus(BusTransaction{Bus: "i2c", Num: 1, Op: "ReadFromReg", Addr: 0x77, Len: 2}, start)
+	remove()
+	ObserveBus(BusTransaction{Bus: "i2c", Num: 1}, start)
+
+	if len(got) != 1 {
+		t.Fatalf("got %v transactions, want 1", len(got))
+	}
+	if tr := got[0]; tr.Op != "ReadFromReg" || tr.Addr != 0x77 || tr.Start != start || tr.Duration < 0 {
+		t.Errorf("unexpected transaction %+v", tr)
+	}
+}
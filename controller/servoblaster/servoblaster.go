@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"github.com/golang/glog"
+	"github.com/kidoman/embd"
 )
 
 // ServoBlaster represents a software RPi PWM/PCM based servo control module.
@@ -26,7 +27,7 @@ func (d *ServoBlaster) setup() error {
 		return nil
 	}
 	var err error
-	if d.fd, err = os.OpenFile("/dev/servoblaster", os.O_WRONLY, os.ModeExclusive); err != nil {
+	if d.fd, err = os.OpenFile(embd.FSPath("/dev/servoblaster"), os.O_WRONLY, os.ModeExclusive); err != nil {
 		return err
 	}
 	d.initialized = true
@@ -0,0 +1,140 @@
+// Package datalog samples sensors on a schedule and records the readings to
+// rotating files or to an HTTP endpoint.
+//
+// A Logger samples every Source in its own loop and hands the records to
+// each Sink. FileSink writes them to files which are rotated by size or
+// age, and HTTPSink posts them in batches, keeping them in memory while
+// the endpoint cannot be reached. Both encode the records in one of these
+// formats:
+//
+//	csv     a time,sensor,name,value,unit row per value, after a header
+//	jsonl   a JSON object per record and line
+//	influx  the InfluxDB line protocol, a line per record
+package datalog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd/sensor"
+)
+
+// Value is a quantity measured by a sensor, e.g. the temperature.
+type Value struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+}
+
+// Record is the set of values sampled from a sensor at a given time.
+type Record struct {
+	Sensor string            `json:"sensor"`
+	Time   time.Time         `json:"time"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	Values []Value           `json:"values"`
+}
+
+// Source is a sensor to log.
+type Source struct {
+	// Name identifies the sensor in the records.
+	Name string
+
+	// Interval is the sampling interval of the sensor. Defaults to
+	// Config.Interval.
+	Interval time.Duration
+
+	// Sample reads the values of the sensor.
+	Sample func() ([]Value, error)
+}
+
+// Sink records the samples.
+type Sink interface {
+	Write(recs []Record) error
+	Close() error
+}
+
+// Config describes what the logger samples and where it records it.
+type Config struct {
+	// Interval is the sampling interval of the sources which do not have
+	// their own. Defaults to 10s.
+	Interval time.Duration
+
+	// Tags are added to every record, e.g. the host name.
+	Tags map[string]string
+
+	Sources []Source
+	Sinks   []Sink
+}
+
+// Logger samples sensors and records their values.
+type Logger struct {
+	cfg Config
+}
+
+// New returns a logger. Call Run to start sampling.
+func New(cfg Config) *Logger {
+	if cfg.Interval == 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	return &Logger{cfg: cfg}
+}
+
+// Run samples the sources until ctx is done, then closes the sinks. A
+// failed sample or write is logged and does not stop the logger.
+func (l *Logger) Run(ctx context.Context) error {
+	if len(l.cfg.Sources) == 0 {
+		return errors.New("datalog: no sources")
+	}
+
+	records := make(chan Record)
+	var wg sync.WaitGroup
+	for _, src := range l.cfg.Sources {
+		period := src.Interval
+		if period <= 0 {
+			period = l.cfg.Interval
+		}
+		sample := src.Sample
+		readings := sensor.Sample(ctx, period, func() (interface{}, error) {
+			return sample()
+		})
+
+		wg.Add(1)
+		go func(name string, readings <-chan sensor.Reading) {
+			defer wg.Done()
+			for r := range readings {
+				if r.Err != nil {
+					glog.Errorf("datalog: sampling %v: %v", name, r.Err)
+					continue
+				}
+				rec := Record{Sensor: name, Time: r.Time, Tags: l.cfg.Tags, Values: r.Value.([]Value)}
+				select {
+				case records <- rec:
+				case <-ctx.Done():
+				}
+			}
+		}(src.Name, readings)
+	}
+	go func() {
+		wg.Wait()
+		close(records)
+	}()
+
+	for rec := range records {
+		for _, s := range l.cfg.Sinks {
+			if err := s.Write([]Record{rec}); err != nil {
+				glog.Errorf("datalog: %v", err)
+			}
+		}
+	}
+
+	var err error
+	for _, s := range l.cfg.Sinks {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
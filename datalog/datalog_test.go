@@ -0,0 +1,158 @@
+package datalog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testTime = time.Date(2015, 3, 14, 9, 26, 53, 589000000, time.UTC)
+
+	testRecords = []Record{
+		{Sensor: "bmp180", Time: testTime, Tags: map[string]string{"host": "pi", "room": "living room"}, Values: []Value{
+			{Name: "temperature", Value: 21.5, Unit: "°C"},
+			{Name: "pressure", Value: 101325, Unit: "Pa"},
+		}},
+		{Sensor: "ir, 1", Time: testTime.Add(time.Second), Values: []Value{
+			{Name: "temp c", Value: -3.25},
+		}},
+	}
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Format
+		ok   bool
+	}{
+		{"csv", CSV, true},
+		{"JSONL", JSONLines, true},
+		{"influx", Influx, true},
+		{"xml", 0, false},
+	}
+	for _, test := range tests {
+		f, err := ParseFormat(test.s)
+		if (err == nil) != test.ok || f != test.want {
+			t.Errorf("ParseFormat(%q): got %v, %v", test.s, f, err)
+		}
+		if test.ok && f.String() != formatNames[f] {
+			t.Errorf("String: got %q", f.String())
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{CSV, "2015-03-14T09:26:53.589Z,bmp180,temperature,21.5,°C\n" +
+			"2015-03-14T09:26:53.589Z,bmp180,pressure,101325,Pa\n" +
+			"2015-03-14T09:26:54.589Z,\"ir, 1\",temp c,-3.25,\n"},
+		{JSONLines, `{"sensor":"bmp180","time":"2015-03-14T09:26:53.589Z","tags":{"host":"pi","room":"living room"},"values":[{"name":"temperature","value":21.5,"unit":"°C"},{"name":"pressure","value":101325,"unit":"Pa"}]}` + "\n" +
+			`{"sensor":"ir, 1","time":"2015-03-14T09:26:54.589Z","values":[{"name":"temp c","value":-3.25}]}` + "\n"},
+		{Influx, `bmp180,host=pi,room=living\ room temperature=21.5,pressure=101325 1426325213589000000` + "\n" +
+			`ir\,\ 1 temp\ c=-3.25 1426325214589000000` + "\n"},
+	}
+	for _, test := range tests {
+		b, err := test.format.encode(testRecords)
+		if err != nil {
+			t.Errorf("%v: %v", test.format, err)
+			continue
+		}
+		if string(b) != test.want {
+			t.Errorf("%v: got\n%s\nwant\n%s", test.format, b, test.want)
+		}
+	}
+}
+
+type memSink struct {
+	mu     sync.Mutex
+	recs   []Record
+	closed bool
+}
+
+func (s *memSink) Write(recs []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recs = append(s.recs, recs...)
+	return nil
+}
+
+func (s *memSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *memSink) count(sensor string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, r := range s.recs {
+		if r.Sensor == sensor {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLogger(t *testing.T) {
+	var calls int
+	sink := &memSink{}
+	l := New(Config{
+		Interval: time.Millisecond,
+		Tags:     map[string]string{"host": "pi"},
+		Sources: []Source{
+			{Name: "fast", Sample: func() ([]Value, error) {
+				return []Value{{Name: "v", Value: 1}}, nil
+			}},
+			{Name: "flaky", Sample: func() ([]Value, error) {
+				if calls++; calls%2 == 0 {
+					return nil, errors.New("failed")
+				}
+				return []Value{{Name: "v", Value: 2}}, nil
+			}},
+			{Name: "slow", Interval: time.Hour, Sample: func() ([]Value, error) {
+				return []Value{{Name: "v", Value: 3}}, nil
+			}},
+		},
+		Sinks: []Sink{sink},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Run(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for sink.count("fast") < 5 || sink.count("flaky") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("no records after 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if n := sink.count("slow"); n != 1 {
+		t.Errorf("got %v records of the slow source, want 1", n)
+	}
+	if !sink.closed {
+		t.Error("sink not closed")
+	}
+	for _, r := range sink.recs {
+		if r.Tags["host"] != "pi" || r.Time.IsZero() || len(r.Values) != 1 {
+			t.Errorf("unexpected record %+v", r)
+		}
+	}
+}
+
+func TestLoggerNoSources(t *testing.T) {
+	if err := New(Config{}).Run(context.Background()); err == nil {
+		t.Error("expected an error without sources")
+	}
+}
@@ -0,0 +1,186 @@
+package datalog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// FileConfig describes where a FileSink writes and when it rotates.
+type FileConfig struct {
+	// Dir is the directory of the files. Defaults to the current one.
+	Dir string
+
+	// Prefix starts the file names, which go on with the time the file was
+	// opened and the extension of the format, e.g.
+	// embd-20060102T150405.000.csv. Defaults to "embd".
+	Prefix string
+
+	Format Format
+
+	// MaxSize rotates the file before it grows past MaxSize bytes. Zero
+	// means no limit.
+	MaxSize int64
+
+	// MaxAge rotates the file once it has been open for MaxAge. Zero means
+	// no limit.
+	MaxAge time.Duration
+
+	// Keep is the number of files to keep, the current one included. The
+	// oldest files are removed on rotation. Zero keeps them all.
+	Keep int
+}
+
+const fileTimeLayout = "20060102T150405.000"
+
+// FileSink writes the records to rotating files.
+type FileSink struct {
+	cfg FileConfig
+	now func() time.Time
+
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+// NewFileSink returns a sink writing to files in cfg.Dir, which is created
+// if needed. The first file is opened on the first write.
+func NewFileSink(cfg FileConfig) (*FileSink, error) {
+	if cfg.Dir == "" {
+		cfg.Dir = "."
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "embd"
+	}
+	if cfg.MaxSize < 0 || cfg.MaxAge < 0 || cfg.Keep < 0 {
+		return nil, fmt.Errorf("datalog: invalid rotation %v/%v/%v", cfg.MaxSize, cfg.MaxAge, cfg.Keep)
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileSink{cfg: cfg, now: time.Now}, nil
+}
+
+// Write appends the records to the current file, rotating it first if the
+// records would make it too big or if it is too old.
+func (s *FileSink) Write(recs []Record) error {
+	b, err := s.cfg.Format.encode(recs)
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 {
+		return nil
+	}
+
+	if s.f != nil && s.expired(int64(len(b))) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.f.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+// expired tells whether the current file must be rotated before writing n
+// more bytes to it. A file is never rotated while it only has a header, so
+// that records bigger than MaxSize still get written.
+func (s *FileSink) expired(n int64) bool {
+	if s.cfg.MaxAge > 0 && s.now().Sub(s.opened) >= s.cfg.MaxAge {
+		return true
+	}
+	return s.cfg.MaxSize > 0 && s.size > int64(len(s.cfg.Format.header())) && s.size+n > s.cfg.MaxSize
+}
+
+// open creates a new file named after the current time. The time is bumped
+// by a millisecond until the name is free.
+func (s *FileSink) open() error {
+	t := s.now()
+	for {
+		name := filepath.Join(s.cfg.Dir, s.cfg.Prefix+"-"+t.UTC().Format(fileTimeLayout)+s.cfg.Format.Ext())
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			t = t.Add(time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		glog.V(1).Infof("datalog: writing to %v", name)
+
+		n, err := f.Write(s.cfg.Format.header())
+		if err != nil {
+			f.Close()
+			return err
+		}
+		s.f, s.size, s.opened = f, int64(n), s.now()
+		return nil
+	}
+}
+
+// rotate closes the current file and removes the oldest ones beyond Keep,
+// leaving room for the next file.
+func (s *FileSink) rotate() error {
+	err := s.f.Close()
+	s.f = nil
+	if err != nil {
+		return err
+	}
+	if s.cfg.Keep == 0 {
+		return nil
+	}
+
+	files, err := s.Files()
+	if err != nil {
+		return err
+	}
+	for len(files) > s.cfg.Keep-1 {
+		glog.V(1).Infof("datalog: removing %v", files[0])
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// Files returns the paths of the files written with the prefix and the
+// format of the sink, oldest first.
+func (s *FileSink) Files() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, fi := range infos {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasPrefix(name, s.cfg.Prefix+"-") || !strings.HasSuffix(name, s.cfg.Format.Ext()) {
+			continue
+		}
+		files = append(files, filepath.Join(s.cfg.Dir, name))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Close closes the current file.
+func (s *FileSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
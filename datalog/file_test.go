@@ -0,0 +1,97 @@
+package datalog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "datalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The header takes 28 bytes and a row 33.
+	s, err := NewFileSink(FileConfig{Dir: dir, Format: CSV, MaxSize: 100, MaxAge: time.Hour, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := testTime
+	s.now = func() time.Time { return now }
+
+	rec := Record{Sensor: "s", Time: testTime, Values: []Value{{Name: "v", Value: 1}}}
+	write := func() {
+		if err := s.Write([]Record{rec}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write()
+	write()
+	write() // over MaxSize, the new file has the next free name
+	now = now.Add(time.Second)
+	write()
+	now = now.Add(time.Hour) // over MaxAge, the first file is removed
+	write()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := s.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "embd-20150314T092653.590.csv"),
+		filepath.Join(dir, "embd-20150314T102654.589.csv"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("got files %v, want %v", files, want)
+	}
+
+	row := "2015-03-14T09:26:53.589Z,s,v,1,\n"
+	for i, want := range []string{"time,sensor,name,value,unit\n" + row + row, "time,sensor,name,value,unit\n" + row} {
+		b, err := ioutil.ReadFile(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%v: got\n%s\nwant\n%s", files[i], b, want)
+		}
+	}
+}
+
+func TestFileSinkSameTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "datalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileSink(FileConfig{Dir: dir, Prefix: "x", Format: Influx, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return testTime }
+	for i := 0; i < 3; i++ {
+		if err := s.Write(testRecords[:1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	files, _ := s.Files()
+	want := []string{
+		filepath.Join(dir, "x-20150314T092653.589.lp"),
+		filepath.Join(dir, "x-20150314T092653.590.lp"),
+		filepath.Join(dir, "x-20150314T092653.591.lp"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got files %v, want %v", files, want)
+	}
+}
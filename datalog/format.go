@@ -0,0 +1,151 @@
+package datalog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is an encoding of the records.
+type Format int
+
+const (
+	// CSV writes a time,sensor,name,value,unit row per value.
+	CSV Format = iota
+
+	// JSONLines writes a JSON object per record and line.
+	JSONLines
+
+	// Influx writes the InfluxDB line protocol: the sensor name is the
+	// measurement, the tags are the record tags and the fields are the
+	// values, with a timestamp in nanoseconds.
+	Influx
+)
+
+var formatNames = []string{"csv", "jsonl", "influx"}
+
+// ParseFormat returns the format named s: csv, jsonl or influx.
+func ParseFormat(s string) (Format, error) {
+	for i, name := range formatNames {
+		if strings.ToLower(s) == name {
+			return Format(i), nil
+		}
+	}
+	return 0, fmt.Errorf("datalog: unknown format %q, expected one of %v", s, strings.Join(formatNames, ", "))
+}
+
+func (f Format) String() string {
+	if f < 0 || int(f) >= len(formatNames) {
+		return "Format(" + strconv.Itoa(int(f)) + ")"
+	}
+	return formatNames[f]
+}
+
+// Ext returns the file name extension of the format.
+func (f Format) Ext() string {
+	switch f {
+	case JSONLines:
+		return ".jsonl"
+	case Influx:
+		return ".lp"
+	}
+	return ".csv"
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case JSONLines:
+		return "application/x-ndjson"
+	case Influx:
+		return "text/plain; charset=utf-8"
+	}
+	return "text/csv"
+}
+
+// header returns what starts a file or a request body.
+func (f Format) header() []byte {
+	if f == CSV {
+		return []byte("time,sensor,name,value,unit\n")
+	}
+	return nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// encode encodes the records, without the header.
+func (f Format) encode(recs []Record) ([]byte, error) {
+	var b bytes.Buffer
+	switch f {
+	case CSV:
+		w := csv.NewWriter(&b)
+		for _, rec := range recs {
+			t := rec.Time.UTC().Format(time.RFC3339Nano)
+			for _, v := range rec.Values {
+				if err := w.Write([]string{t, rec.Sensor, v.Name, formatFloat(v.Value), v.Unit}); err != nil {
+					return nil, err
+				}
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	case JSONLines:
+		enc := json.NewEncoder(&b)
+		for _, rec := range recs {
+			if err := enc.Encode(rec); err != nil {
+				return nil, err
+			}
+		}
+	case Influx:
+		for _, rec := range recs {
+			writeLine(&b, rec)
+		}
+	default:
+		return nil, fmt.Errorf("datalog: unknown format %v", f)
+	}
+	return b.Bytes(), nil
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// writeLine writes rec in the line protocol. Records without values have no
+// line, as a line needs at least one field.
+func writeLine(b *bytes.Buffer, rec Record) {
+	if len(rec.Values) == 0 {
+		return
+	}
+	b.WriteString(measurementEscaper.Replace(rec.Sensor))
+
+	keys := make([]string, 0, len(rec.Tags))
+	for k := range rec.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if rec.Tags[k] == "" {
+			continue
+		}
+		fmt.Fprintf(b, ",%v=%v", keyEscaper.Replace(k), keyEscaper.Replace(rec.Tags[k]))
+	}
+
+	for i, v := range rec.Values {
+		sep := ","
+		if i == 0 {
+			sep = " "
+		}
+		fmt.Fprintf(b, "%v%v=%v", sep, keyEscaper.Replace(v.Name), formatFloat(v.Value))
+	}
+	fmt.Fprintf(b, " %d\n", rec.Time.UnixNano())
+}
@@ -0,0 +1,250 @@
+package datalog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// HTTPConfig describes where and how an HTTPSink posts the records.
+type HTTPConfig struct {
+	// URL is the endpoint, e.g. http://influx:8086/write?db=embd for the
+	// Influx format.
+	URL string
+
+	Format Format
+
+	// Header is added to every request, e.g. for an Authorization.
+	Header http.Header
+
+	// MaxBuffer is the number of records kept while the endpoint cannot
+	// be reached. The oldest are dropped beyond it. Defaults to 10000.
+	MaxBuffer int
+
+	// Retry is the delay before posting again after a failure. It doubles
+	// with every failure, up to MaxRetry. Defaults to 1s and 1m.
+	Retry    time.Duration
+	MaxRetry time.Duration
+
+	// Client posts the records. Defaults to a client with a 10s timeout.
+	Client *http.Client
+}
+
+// HTTPSink posts the records to an HTTP endpoint in the background. The
+// records written while a post is in flight or failing are buffered and go
+// in the next one. Posts are retried on network errors and 5xx responses
+// only: the records which cannot be encoded (e.g. a NaN value in JSON) and
+// those of a post rejected with another status are dropped.
+type HTTPSink struct {
+	cfg HTTPConfig
+
+	mu      sync.Mutex
+	buf     []Record
+	sending int // records of the post in flight
+	dropped int
+
+	wake chan struct{}
+	quit chan struct{}
+	done chan struct{}
+}
+
+// NewHTTPSink returns a sink posting to cfg.URL.
+func NewHTTPSink(cfg HTTPConfig) *HTTPSink {
+	if cfg.MaxBuffer <= 0 {
+		cfg.MaxBuffer = 10000
+	}
+	if cfg.Retry <= 0 {
+		cfg.Retry = time.Second
+	}
+	if cfg.MaxRetry <= 0 {
+		cfg.MaxRetry = time.Minute
+	}
+	if cfg.MaxRetry < cfg.Retry {
+		cfg.MaxRetry = cfg.Retry
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	s := &HTTPSink{
+		cfg:  cfg,
+		wake: make(chan struct{}, 1),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+// Write buffers the records and returns right away.
+func (s *HTTPSink) Write(recs []Record) error {
+	s.mu.Lock()
+	s.buf = append(s.buf, recs...)
+	s.trim()
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// trim drops the oldest records beyond MaxBuffer. s.mu must be held.
+func (s *HTTPSink) trim() {
+	if n := len(s.buf) - s.cfg.MaxBuffer; n > 0 {
+		s.buf = append([]Record(nil), s.buf[n:]...)
+		s.dropped += n
+		glog.Warningf("datalog: buffer full, dropped %v records for %v", n, s.cfg.URL)
+	}
+}
+
+// Buffered returns the number of records waiting to be posted.
+func (s *HTTPSink) Buffered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buf) + s.sending
+}
+
+// Dropped returns the number of records dropped because the buffer was
+// full, they could not be encoded or the endpoint rejected them.
+func (s *HTTPSink) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *HTTPSink) loop() {
+	defer close(s.done)
+
+	delay := s.cfg.Retry
+	for {
+		select {
+		case <-s.wake:
+		case <-s.quit:
+			if err := s.flush(); err != nil {
+				glog.Errorf("datalog: posting to %v: %v", s.cfg.URL, err)
+			}
+			return
+		}
+
+		for {
+			err := s.flush()
+			if err == nil {
+				delay = s.cfg.Retry
+				break
+			}
+			glog.Warningf("datalog: posting to %v: %v, retrying in %v", s.cfg.URL, err, delay)
+			select {
+			case <-time.After(delay):
+			case <-s.quit:
+				return
+			}
+			if delay *= 2; delay > s.cfg.MaxRetry {
+				delay = s.cfg.MaxRetry
+			}
+		}
+	}
+}
+
+// permanentError is a failed post which would fail again.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// flush posts the buffered records. Those which could be encoded are put
+// back in front of the buffer if the post fails and may succeed later, and
+// dropped otherwise.
+func (s *HTTPSink) flush() error {
+	s.mu.Lock()
+	batch := s.buf
+	s.buf, s.sending = nil, len(batch)
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	body, encoded := s.encode(batch)
+	var err error
+	if len(encoded) > 0 {
+		err = s.post(body)
+	}
+	s.mu.Lock()
+	s.dropped += len(batch) - len(encoded)
+	if _, ok := err.(*permanentError); ok {
+		glog.Errorf("datalog: posting to %v: %v, dropped %v records", s.cfg.URL, err, len(encoded))
+		s.dropped += len(encoded)
+		err = nil
+	} else if err != nil {
+		s.buf = append(encoded, s.buf...)
+		s.trim()
+	}
+	s.sending = 0
+	s.mu.Unlock()
+	return err
+}
+
+// encode encodes the records one by one, skipping those which cannot be,
+// and returns the body along with the records it holds.
+func (s *HTTPSink) encode(recs []Record) ([]byte, []Record) {
+	body := s.cfg.Format.header()
+	var encoded []Record
+	for _, rec := range recs {
+		b, err := s.cfg.Format.encode([]Record{rec})
+		if err != nil {
+			glog.Errorf("datalog: dropping a record of %v for %v: %v", rec.Sensor, s.cfg.URL, err)
+			continue
+		}
+		body = append(body, b...)
+		encoded = append(encoded, rec)
+	}
+	return body, encoded
+}
+
+func (s *HTTPSink) post(body []byte) error {
+	req, err := http.NewRequest("POST", s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range s.cfg.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", s.cfg.Format.ContentType())
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode/100 == 5, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return &permanentError{fmt.Errorf("unexpected status %v", resp.Status)}
+}
+
+// Close makes a last attempt at posting the buffered records, unless the
+// endpoint is already failing, and stops the sink. It reports the records
+// which could not be delivered.
+func (s *HTTPSink) Close() error {
+	close(s.quit)
+	<-s.done
+
+	if n := s.Buffered(); n > 0 {
+		return fmt.Errorf("datalog: %v records not delivered to %v", n, s.cfg.URL)
+	}
+	return nil
+}
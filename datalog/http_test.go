@@ -0,0 +1,183 @@
+package datalog
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type endpoint struct {
+	mu     sync.Mutex
+	online bool
+	status int // of the replies when set
+	posts  int
+	lines  []string
+	header http.Header
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.posts++
+	if e.status != 0 {
+		http.Error(w, http.StatusText(e.status), e.status)
+		return
+	}
+	if !e.online {
+		http.Error(w, "offline", http.StatusServiceUnavailable)
+		return
+	}
+	b, _ := ioutil.ReadAll(r.Body)
+	e.lines = append(e.lines, strings.Split(strings.TrimSpace(string(b)), "\n")...)
+	e.header = r.Header
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *endpoint) setOnline(online bool) {
+	e.mu.Lock()
+	e.online = online
+	e.mu.Unlock()
+}
+
+func (e *endpoint) received() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.lines...)
+}
+
+func record(v float64) Record {
+	return Record{Sensor: "s", Time: time.Unix(0, int64(v)), Values: []Value{{Name: "v", Value: v}}}
+}
+
+func TestHTTPSink(t *testing.T) {
+	e := &endpoint{}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	s := NewHTTPSink(HTTPConfig{
+		URL:       ts.URL,
+		Format:    Influx,
+		Header:    http.Header{"Authorization": {"Token secret"}},
+		MaxBuffer: 3,
+		Retry:     time.Millisecond,
+		MaxRetry:  5 * time.Millisecond,
+	})
+	for v := 1; v <= 4; v++ {
+		s.Write([]Record{record(float64(v))})
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := s.Buffered(); n != 3 {
+		t.Errorf("Buffered: got %v while offline, want 3", n)
+	}
+	if n := s.Dropped(); n != 1 {
+		t.Errorf("Dropped: got %v, want 1", n)
+	}
+
+	e.setOnline(true)
+	deadline := time.Now().Add(time.Second)
+	for s.Buffered() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("records still buffered 1s after going online")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Write([]Record{record(5)})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"s v=2 2", "s v=3 3", "s v=4 4", "s v=5 5"}
+	if got := e.received(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if e.header.Get("Authorization") != "Token secret" || e.header.Get("Content-Type") != Influx.ContentType() {
+		t.Errorf("unexpected headers %v", e.header)
+	}
+}
+
+func TestHTTPSinkCloseOffline(t *testing.T) {
+	e := &endpoint{}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	s := NewHTTPSink(HTTPConfig{URL: ts.URL, Retry: time.Millisecond})
+	s.Write([]Record{record(1)})
+	if err := s.Close(); err == nil {
+		t.Error("Close: expected an error for the undelivered record")
+	}
+}
+
+func TestHTTPSinkUnencodable(t *testing.T) {
+	e := &endpoint{online: true}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	s := NewHTTPSink(HTTPConfig{URL: ts.URL, Format: JSONLines, Retry: time.Millisecond})
+	s.Write([]Record{record(math.NaN()), record(2)})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.received(); len(got) != 1 || !strings.Contains(got[0], `"value":2`) {
+		t.Errorf("got %q, want the valid record", got)
+	}
+	if n := s.Dropped(); n != 1 {
+		t.Errorf("Dropped: got %v, want 1", n)
+	}
+}
+
+func TestHTTPSinkUnencodableOffline(t *testing.T) {
+	e := &endpoint{}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	s := NewHTTPSink(HTTPConfig{URL: ts.URL, Format: JSONLines, Retry: time.Millisecond, MaxRetry: time.Millisecond})
+	s.Write([]Record{record(math.NaN()), record(2)})
+	time.Sleep(20 * time.Millisecond)
+	if n := s.Buffered(); n != 1 {
+		t.Errorf("Buffered: got %v while offline, want the valid record only", n)
+	}
+
+	e.setOnline(true)
+	deadline := time.Now().Add(time.Second)
+	for s.Buffered() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("records still buffered 1s after going online")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.received(); len(got) != 1 || !strings.Contains(got[0], `"value":2`) {
+		t.Errorf("got %q, want the valid record", got)
+	}
+	if n := s.Dropped(); n != 1 {
+		t.Errorf("Dropped: got %v, want the unencodable record counted once", n)
+	}
+}
+
+func TestHTTPSinkRejected(t *testing.T) {
+	e := &endpoint{status: http.StatusBadRequest}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	s := NewHTTPSink(HTTPConfig{URL: ts.URL, Retry: time.Millisecond})
+	s.Write([]Record{record(1), record(2)})
+	time.Sleep(20 * time.Millisecond)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.posts != 1 {
+		t.Errorf("posted %v times, want a single post", e.posts)
+	}
+	if n := s.Dropped(); n != 2 {
+		t.Errorf("Dropped: got %v, want 2", n)
+	}
+}
@@ -5,6 +5,7 @@ package embd
 import (
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/golang/glog"
 )
@@ -51,16 +52,26 @@ func SetHost(host Host, rev int) {
 }
 
 // DescribeHost returns the detected host descriptor.
-// Can be overriden by calling SetHost though.
+// Can be overriden by calling SetHost though. Hosts which are not detected
+// fall back to HostGeneric when its describer is registered. When the
+// EMBD_REMOTE environment variable is set, HostRemote is used instead of the
+// local host.
 func DescribeHost() (*Descriptor, error) {
 	var host Host
 	var rev int
 
-	if hostOverriden {
+	switch {
+	case hostOverriden:
 		host, rev = hostOverride, hostRevOverride
-	} else {
+	case os.Getenv("EMBD_REMOTE") != "" && describers[HostRemote] != nil:
+		host = HostRemote
+	default:
 		var err error
 		host, rev, err = DetectHost()
+		if IsUnsupportedHost(err) && describers[HostGeneric] != nil {
+			glog.V(1).Infof("embd: falling back to %v: %v", HostGeneric, err)
+			host, err = HostGeneric, nil
+		}
 		if err != nil {
 			return nil, err
 		}
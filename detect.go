@@ -34,8 +34,36 @@ const (
 
 	// HostCHIP represents the NextThing C.H.I.P.
 	HostCHIP = "CHIP"
+
+	// HostOrangePi represents the Allwinner H3/H5 based Orange Pi boards.
+	HostOrangePi = "Orange Pi"
+
+	// HostGeneric represents any Linux host, described by enumerating the
+	// devices exposed by the kernel.
+	HostGeneric = "Generic Linux"
+
+	// HostRemote represents a host reached over the network through an
+	// embd agent, see host/remote.
+	HostRemote = "Remote"
 )
 
+// unsupportedHostError is returned by DetectHost when the host is not one of
+// the known boards.
+type unsupportedHostError struct {
+	model, hardware string
+}
+
+func (e *unsupportedHostError) Error() string {
+	return fmt.Sprintf(`embd: your host "%v:%v" is not supported at this moment. request support at https://github.com/kidoman/embd/issues`, e.hardware, e.model)
+}
+
+// IsUnsupportedHost reports whether err is the error of DetectHost for a
+// host which is not one of the known boards.
+func IsUnsupportedHost(err error) bool {
+	_, ok := err.(*unsupportedHostError)
+	return ok
+}
+
 func execOutput(name string, arg ...string) (output string, err error) {
 	var out []byte
 	if out, err = exec.Command(name, arg...).Output(); err != nil {
@@ -68,22 +96,29 @@ func parseVersion(str string) (major, minor, patch int, err error) {
 }
 
 func kernelVersion() (major, minor, patch int, err error) {
-	output, err := execOutput("uname", "-r")
-	if err != nil {
+	var output string
+	if release, err := ioutil.ReadFile(FSPath("/proc/sys/kernel/osrelease")); err == nil {
+		output = strings.TrimSpace(string(release))
+	} else if output, err = execOutput("uname", "-r"); err != nil {
 		return 0, 0, 0, err
 	}
 
 	return parseVersion(output)
 }
 
-func cpuInfo() (model, hardware string, revision int, err error) {
-	output, err := ioutil.ReadFile("/proc/cpuinfo")
+func cpuInfo() (model, hardware, board string, revision int, err error) {
+	output, err := ioutil.ReadFile(FSPath("/proc/cpuinfo"))
 	if err != nil {
-		return "", "", 0, err
+		return "", "", "", 0, err
 	}
-	for _, line := range strings.Split(string(output), "\n") {
-		fields := strings.Split(line, ":")
-		if len(fields) < 1 {
+	model, hardware, board, revision = parseCPUInfo(string(output))
+	return model, hardware, board, revision, nil
+}
+
+func parseCPUInfo(cpuinfo string) (model, hardware, board string, revision int) {
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) < 2 {
 			continue
 		}
 		switch {
@@ -98,9 +133,69 @@ func cpuInfo() (model, hardware string, revision int, err error) {
 			hardware = strings.TrimSpace(fields[1])
 		case strings.HasPrefix(fields[0], "model name"):
 			model = fields[1]
+		case strings.HasPrefix(fields[0], "Model"):
+			board = strings.TrimSpace(fields[1])
+		}
+	}
+	return model, hardware, board, revision
+}
+
+// deviceTreeCompatible returns the compatible strings of the device tree
+// root node, most specific first. It returns nil on hosts without a device
+// tree.
+func deviceTreeCompatible() []string {
+	data, err := ioutil.ReadFile(FSPath("/proc/device-tree/compatible"))
+	if err != nil {
+		return nil
+	}
+	var compat []string
+	for _, c := range strings.Split(string(data), "\x00") {
+		if c != "" {
+			compat = append(compat, c)
 		}
 	}
-	return model, hardware, revision, nil
+	return compat
+}
+
+func isCompatible(compat []string, names ...string) bool {
+	for _, c := range compat {
+		for _, name := range names {
+			if c == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isOrangePi tells whether the board is an H3/H5 Orange Pi with a 40-pin
+// header. The other boards built around these SoCs (NanoPi, Banana Pi M2+...)
+// have other pin maps, as do the Orange Pi Zero boards with a 26-pin header,
+// and are left to the generic host.
+func isOrangePi(compat []string) bool {
+	if !isCompatible(compat, "allwinner,sun8i-h3", "allwinner,sun50i-h5") {
+		return false
+	}
+	for _, c := range compat {
+		if strings.HasPrefix(c, "xunlong,orangepi-") && !strings.HasPrefix(c, "xunlong,orangepi-zero") {
+			return true
+		}
+	}
+	return false
+}
+
+// rpiHardware lists the SoC names reported by the various Raspberry Pi
+// kernels. Newer kernels report BCM2835 regardless of the actual SoC.
+var rpiHardware = []string{"BCM2708", "BCM2709", "BCM2710", "BCM2835", "BCM2836", "BCM2837", "BCM2711"}
+
+func isRPi(hardware, board string) bool {
+	for _, h := range rpiHardware {
+		if strings.Contains(hardware, h) {
+			return true
+		}
+	}
+	// 64 bit kernels do not report the hardware at all, only the board.
+	return strings.HasPrefix(board, "Raspberry Pi")
 }
 
 // DetectHost returns the detected host and its revision number.
@@ -116,24 +211,28 @@ func DetectHost() (host Host, rev int, err error) {
 				"you have %v.%v.%v", major, minor, patch)
 	}
 
-	model, hardware, rev, err := cpuInfo()
+	model, hardware, board, rev, err := cpuInfo()
 	if err != nil {
 		return HostNull, 0, err
 	}
 
+	compat := deviceTreeCompatible()
+
 	switch {
 	case strings.Contains(model, "ARMv7") && (strings.Contains(hardware, "AM33XX") || strings.Contains(hardware, "AM335X")):
 		return HostBBB, rev, nil
-	case strings.Contains(hardware, "BCM2708") || strings.Contains(hardware, "BCM2709"):
+	case isRPi(hardware, board):
 		return HostRPi, rev, nil
-	case hardware == "Allwinner sun4i/sun5i Families":
+	case hardware == "Allwinner sun4i/sun5i Families" || isCompatible(compat, "nextthing,chip"):
 		if major < 4 || (major == 4 && minor < 4) {
 			return HostNull, 0, fmt.Errorf(
 				"embd: linux kernel version 4.4+ required, you have %v.%v",
 				major, minor)
 		}
 		return HostCHIP, rev, nil
+	case isOrangePi(compat):
+		return HostOrangePi, rev, nil
 	default:
-		return HostNull, 0, fmt.Errorf(`embd: your host "%v:%v" is not supported at this moment. request support at https://github.com/kidoman/embd/issues`, host, model)
+		return HostNull, 0, &unsupportedHostError{model: model, hardware: hardware}
 	}
 }
@@ -1,6 +1,12 @@
 package embd
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestKernelVersionParse(t *testing.T) {
 	var tests = []struct {
@@ -27,3 +33,165 @@ func TestKernelVersionParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParseCPUInfo(t *testing.T) {
+	var tests = []struct {
+		sample   string
+		hardware string
+		board    string
+		revision int
+		rpi      bool
+	}{
+		{"rpi1b", "BCM2708", "", 0x000e, true},
+		{"rpi2b", "BCM2709", "", 0xa01041, true},
+		{"rpi3b", "BCM2835", "Raspberry Pi 3 Model B Rev 1.2", 0xa02082, true},
+		{"rpi4b", "BCM2711", "Raspberry Pi 4 Model B Rev 1.1", 0xc03111, true},
+		{"rpi4b-arm64", "", "Raspberry Pi 4 Model B Rev 1.4", 0xd03114, true},
+		{"rpizerow", "BCM2835", "Raspberry Pi Zero W Rev 1.1", 0x9000c1, true},
+		{"bbb", "Generic AM33XX (Flattened Device Tree)", "", 0, false},
+	}
+	for _, test := range tests {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "cpuinfo", test.sample+".txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, hardware, board, revision := parseCPUInfo(string(data))
+		if hardware != test.hardware || board != test.board || revision != test.revision {
+			t.Errorf("Parse of %v: got (%q, %q, %#x) want (%q, %q, %#x)", test.sample, hardware, board, revision, test.hardware, test.board, test.revision)
+		}
+		if rpi := isRPi(hardware, board); rpi != test.rpi {
+			t.Errorf("Detecting %v: got rpi = %v, want %v", test.sample, rpi, test.rpi)
+		}
+	}
+}
+
+// withProc points the filesystem root at a temp dir holding the given
+// cpuinfo sample, kernel release and device tree compatible strings.
+func withProc(t *testing.T, sample, release string, compat ...string) func() {
+	root, err := ioutil.TempDir("", "embd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpuinfo, err := ioutil.ReadFile(filepath.Join("testdata", "cpuinfo", sample+".txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "proc", "sys", "kernel"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "proc", "cpuinfo"), cpuinfo, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "proc", "sys", "kernel", "osrelease"), []byte(release+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if len(compat) > 0 {
+		if err := os.MkdirAll(filepath.Join(root, "proc", "device-tree"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := []byte(strings.Join(compat, "\x00") + "\x00")
+		if err := ioutil.WriteFile(filepath.Join(root, "proc", "device-tree", "compatible"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := FSRoot()
+	SetFSRoot(root)
+	return func() {
+		SetFSRoot(old)
+		os.RemoveAll(root)
+	}
+}
+
+func TestDetectHost(t *testing.T) {
+	var tests = []struct {
+		sample  string
+		release string
+		compat  []string
+		host    Host
+		rev     int
+		ok      bool
+	}{
+		{"rpi3b", "4.19.66-v7+", nil, HostRPi, 0xa02082, true},
+		{"rpi4b-arm64", "5.10.17-v8+", nil, HostRPi, 0xd03114, true},
+		{"bbb", "4.14.108-ti-r113", nil, HostBBB, 0, true},
+		{"bbb", "3.2.0", nil, HostNull, 0, false},
+		{"orangepipc", "5.10.60-sunxi", []string{"xunlong,orangepi-pc", "allwinner,sun8i-h3"}, HostOrangePi, 0, true},
+		{"orangepipc2", "5.10.60-sunxi64", []string{"xunlong,orangepi-pc2", "allwinner,sun50i-h5"}, HostOrangePi, 0, true},
+		{"orangepipc2", "4.4.0", []string{"nextthing,chip", "allwinner,sun5i-r8"}, HostCHIP, 0, true},
+		{"orangepipc", "5.10.60-sunxi", []string{"allwinner,sun8i-a33"}, HostNull, 0, false},
+		{"orangepipc", "5.10.60-sunxi", []string{"friendlyarm,nanopi-neo", "allwinner,sun8i-h3"}, HostNull, 0, false},
+		{"orangepipc", "5.10.60-sunxi", []string{"sinovoip,bpi-m2-plus", "allwinner,sun8i-h3"}, HostNull, 0, false},
+		{"orangepipc2", "5.10.60-sunxi64", []string{"xunlong,orangepi-zero-plus", "allwinner,sun50i-h5"}, HostNull, 0, false},
+		{"x86", "5.4.0-42-generic", nil, HostNull, 0, false},
+	}
+	for _, test := range tests {
+		restore := withProc(t, test.sample, test.release, test.compat...)
+		host, rev, err := DetectHost()
+		restore()
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("Detecting %v on %v: got err %v, want ok = %v", test.sample, test.release, err, test.ok)
+			continue
+		}
+		if host != test.host || rev != test.rev {
+			t.Errorf("Detecting %v on %v: got (%q, %#x), want (%q, %#x)", test.sample, test.release, host, rev, test.host, test.rev)
+		}
+	}
+}
+
+func TestIsUnsupportedHost(t *testing.T) {
+	var tests = []struct {
+		sample, release string
+		unsupported     bool
+	}{
+		{"x86", "5.4.0-42-generic", true},
+		{"bbb", "3.2.0", false},
+	}
+	for _, test := range tests {
+		restore := withProc(t, test.sample, test.release)
+		_, _, err := DetectHost()
+		restore()
+		if got := IsUnsupportedHost(err); got != test.unsupported {
+			t.Errorf("Detecting %v on %v: got err %v, want unsupported = %v", test.sample, test.release, err, test.unsupported)
+		}
+	}
+}
+
+func TestDescribeHostFallback(t *testing.T) {
+	defer withProc(t, "x86", "5.4.0-42-generic")()
+
+	if _, err := DescribeHost(); err == nil {
+		t.Fatal("Describing an unknown host without a generic describer: got no error")
+	}
+
+	want := &Descriptor{}
+	describers[HostGeneric] = func(rev int) *Descriptor { return want }
+	defer delete(describers, HostGeneric)
+
+	desc, err := DescribeHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc != want {
+		t.Error("Describing an unknown host: did not fall back to the generic describer")
+	}
+}
+
+func TestDescribeHostRemote(t *testing.T) {
+	defer withProc(t, "x86", "5.4.0-42-generic")()
+
+	want := &Descriptor{}
+	describers[HostRemote] = func(rev int) *Descriptor { return want }
+	defer delete(describers, HostRemote)
+
+	os.Setenv("EMBD_REMOTE", "localhost:7070")
+	defer os.Unsetenv("EMBD_REMOTE")
+
+	desc, err := DescribeHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc != want {
+		t.Error("Describing with EMBD_REMOTE set: did not use the remote describer")
+	}
+}
@@ -90,6 +90,18 @@ Could also do:
 	pin.SetDirection(embd.Out)
 	pin.Write(embd.High)
 
+Drive a group of pins as one word (in a single syscall where the host allows it):
+
+	import "github.com/kidoman/embd"
+	...
+	embd.InitGPIO()
+	defer embd.CloseGPIO()
+	...
+	port, err := embd.NewDigitalPort(17, 18, 27, 22)
+	...
+	port.SetDirection(embd.Out)
+	port.WriteWord(0xA)
+
 Or read data from the Bosch BMP085 barometric sensor:
 
 	import "github.com/kidoman/embd"
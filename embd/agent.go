@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/host/remote"
+)
+
+func agent(c *cli.Context) {
+	desc, err := embd.DescribeHost()
+	if err != nil {
+		die(err)
+	}
+
+	l, err := net.Listen("tcp", c.String("addr"))
+	if err != nil {
+		die(err)
+	}
+	fmt.Printf("agent listening on %v\n", l.Addr())
+
+	a := remote.NewAgent(desc)
+	a.Token = c.String("token")
+	defer a.Close()
+	if err := a.Serve(l); err != nil {
+		die(err)
+	}
+}
+
+var agentCmd = cli.Command{
+	Name:   "agent",
+	Usage:  "give remote hosts access to the pins, leds and buses of this host",
+	Action: agent,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "addr", Value: "localhost:7070", Usage: "address to listen on"},
+		cli.StringFlag{Name: "token", Usage: "token clients must present", EnvVar: "EMBD_TOKEN"},
+	},
+}
+
+func init() {
+	registerCommand(agentCmd)
+}
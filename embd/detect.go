@@ -2,19 +2,52 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/codegangsta/cli"
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/host/linux"
+	"github.com/kidoman/embd/host/rpi"
 )
 
 func detect(c *cli.Context) {
 	host, rev, err := embd.DetectHost()
 	if err != nil {
+		if !embd.IsUnsupportedHost(err) {
+			die(err)
+		}
 		fmt.Println(err)
-		os.Exit(1)
+		devices, err := linux.Scan()
+		if err != nil {
+			die(err)
+		}
+		fmt.Printf("falling back to %v\n", embd.HostGeneric)
+		printDevices(devices)
+		return
 	}
 	fmt.Printf("detected host %v (rev %#x)\n", host, rev)
+	if host == embd.HostRPi {
+		if board, err := rpi.DecodeRevision(rev); err == nil {
+			fmt.Printf("board: %v\n", board)
+		}
+	}
+}
+
+func printDevices(d *linux.Devices) {
+	for _, c := range d.GPIOChips {
+		fmt.Printf("gpio chip: %v [%v] (%v lines, base %v)\n", c.Name, c.Label, len(c.Lines), c.Base)
+	}
+	for _, c := range d.PWMChips {
+		fmt.Printf("pwm chip: pwmchip%v (%v channels)\n", c.N, c.Channels)
+	}
+	for _, b := range d.I2CBuses {
+		fmt.Printf("i2c bus: %v\n", b)
+	}
+	for _, s := range d.SPIDevices {
+		fmt.Printf("spi device: %v.%v\n", s.Bus, s.ChipSelect)
+	}
+	for _, l := range d.LEDs {
+		fmt.Printf("led: %v\n", l)
+	}
 }
 
 var detectCmd = cli.Command{
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/metrics"
+)
+
+// newMetricsSensor creates an exported sensor from a "driver[@addr][=name]"
+// flag value.
+func newMetricsSensor(spec string, bus embd.I2CBus) (metrics.Sensor, error) {
+	driver, addr, name, err := parseSensorSpec(spec)
+	if err != nil {
+		return metrics.Sensor{}, err
+	}
+	d, err := openSensor(driver, sensorConfig{
+		Bus:  func() embd.I2CBus { return bus },
+		Addr: addr,
+	})
+	if err != nil {
+		return metrics.Sensor{}, err
+	}
+	return metrics.Sensor{
+		Name: name,
+		Read: func() ([]metrics.SensorValue, error) {
+			values, err := d.Sample()
+			if err != nil {
+				return nil, err
+			}
+			vs := make([]metrics.SensorValue, len(values))
+			for i, q := range d.Quantities {
+				vs[i] = metrics.SensorValue{Name: q.Name, Unit: q.Unit, Value: values[i]}
+			}
+			return vs, nil
+		},
+	}, nil
+}
+
+func export(c *cli.Context) {
+	reg := metrics.NewRegistry()
+	buses := metrics.NewBusCollector(nil)
+	defer buses.Close()
+	reg.Register(buses)
+
+	if specs := c.StringSlice("sensor"); len(specs) > 0 {
+		if err := embd.InitI2C(); err != nil {
+			die(err)
+		}
+		defer embd.CloseI2C()
+		bus := embd.NewI2CBus(byte(c.Int("i2c-bus")))
+		var sensors []metrics.Sensor
+		for _, spec := range specs {
+			s, err := newMetricsSensor(spec, bus)
+			if err != nil {
+				die(err)
+			}
+			sensors = append(sensors, s)
+		}
+		reg.Register(metrics.NewSensorCollector(sensors...))
+	}
+
+	if items := parseItems(c.StringSlice("input")); len(items) > 0 {
+		if err := embd.InitGPIO(); err != nil {
+			die(err)
+		}
+		defer embd.CloseGPIO()
+		var inputs []metrics.Input
+		for _, it := range items {
+			pin, err := embd.NewDigitalPin(it.Key)
+			if err != nil {
+				die(err)
+			}
+			if err := pin.SetDirection(embd.In); err != nil {
+				die(err)
+			}
+			name := it.Name
+			if name == "" {
+				name = it.Key
+			}
+			inputs = append(inputs, metrics.Input{Name: name, Pin: pin})
+		}
+		collector := metrics.NewInputCollector(inputs...)
+		defer collector.Close()
+		reg.Register(collector)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(c.String("path"), reg)
+	fmt.Printf("serving metrics on %v%v\n", c.String("addr"), c.String("path"))
+	if err := http.ListenAndServe(c.String("addr"), mux); err != nil {
+		fmt.Println(err)
+	}
+}
+
+var exporterCmd = cli.Command{
+	Name:  "exporter",
+	Usage: "serve sensor readings, inputs and bus health as prometheus metrics",
+	Description: `Serves the metrics in the Prometheus text format. The sensors and inputs
+   are read on every scrape. The transactions, errors, bytes and latency of
+   the I2C and SPI buses are those of this process, i.e. of the sensors.
+   For example:
+
+   embd exporter --sensor bmp180 --sensor tmp006@0x41=ir --input 17=door`,
+	Action: export,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "addr", Value: ":9110", Usage: "address to listen on"},
+		cli.StringFlag{Name: "path", Value: "/metrics", Usage: "path of the metrics"},
+		cli.StringSliceFlag{Name: "sensor", Value: &cli.StringSlice{}, Usage: "i2c sensor to export, as driver[@addr][=name]"},
+		cli.IntFlag{Name: "i2c-bus", Value: 1, Usage: "i2c bus of the sensors"},
+		cli.StringSliceFlag{Name: "input", Value: &cli.StringSlice{}, Usage: "digital input to export, as pin[=name]"},
+	},
+}
+
+func init() {
+	registerCommand(exporterCmd)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+)
+
+// The pins are not closed by the one-shot commands: closing would unexport
+// them from sysfs, losing the direction and active low settings.
+
+func digitalPin(key string) embd.DigitalPin {
+	if err := embd.InitGPIO(); err != nil {
+		die(err)
+	}
+	pin, err := embd.NewDigitalPin(key)
+	if err != nil {
+		die(err)
+	}
+	return pin
+}
+
+type pinValue struct {
+	Pin   string     `json:"pin"`
+	Value int        `json:"value"`
+	Time  *time.Time `json:"time,omitempty"`
+	Edge  string     `json:"edge,omitempty"`
+}
+
+func parseLevel(s string) (int, error) {
+	switch s {
+	case "0", "low":
+		return embd.Low, nil
+	case "1", "high":
+		return embd.High, nil
+	}
+	return 0, fmt.Errorf("invalid level %q", s)
+}
+
+func gpioRead(c *cli.Context) {
+	checkArgs(c, 1)
+	key := c.Args().First()
+
+	val, err := digitalPin(key).Read()
+	if err != nil {
+		die(err)
+	}
+	if c.Bool("json") {
+		printJSON(pinValue{Pin: key, Value: val})
+		return
+	}
+	fmt.Println(val)
+}
+
+func gpioWrite(c *cli.Context) {
+	checkArgs(c, 2)
+	val, err := parseLevel(c.Args().Get(1))
+	if err != nil {
+		die(err)
+	}
+
+	pin := digitalPin(c.Args().First())
+	if err := pin.SetDirection(embd.Out); err != nil {
+		die(err)
+	}
+	if err := pin.Write(val); err != nil {
+		die(err)
+	}
+}
+
+func gpioDirection(c *cli.Context) {
+	checkArgs(c, 2)
+	var dir embd.Direction
+	switch d := c.Args().Get(1); d {
+	case "in":
+		dir = embd.In
+	case "out":
+		dir = embd.Out
+	default:
+		die(fmt.Errorf("invalid direction %q", d))
+	}
+
+	if err := digitalPin(c.Args().First()).SetDirection(dir); err != nil {
+		die(err)
+	}
+}
+
+func gpioActiveLow(c *cli.Context) {
+	checkArgs(c, 2)
+	b, err := strconv.ParseBool(c.Args().Get(1))
+	if err != nil {
+		die(fmt.Errorf("invalid active low setting %q", c.Args().Get(1)))
+	}
+
+	if err := digitalPin(c.Args().First()).ActiveLow(b); err != nil {
+		die(err)
+	}
+}
+
+func gpioPulse(c *cli.Context) {
+	checkArgs(c, 1)
+	key := c.Args().First()
+	state, err := parseLevel(c.String("state"))
+	if err != nil {
+		die(err)
+	}
+
+	pin := digitalPin(key)
+	if err := pin.SetDirection(embd.In); err != nil {
+		die(err)
+	}
+	d, err := pin.TimePulse(state)
+	if err != nil {
+		die(err)
+	}
+	if c.Bool("json") {
+		printJSON(struct {
+			Pin      string `json:"pin"`
+			State    int    `json:"state"`
+			Duration int64  `json:"duration_ns"`
+		}{key, state, d.Nanoseconds()})
+		return
+	}
+	fmt.Println(d)
+}
+
+func gpioWatch(c *cli.Context) {
+	checkArgs(c, 1)
+	key := c.Args().First()
+	edge := embd.Edge(c.String("edge"))
+	switch edge {
+	case embd.EdgeRising, embd.EdgeFalling, embd.EdgeBoth:
+	default:
+		die(fmt.Errorf("invalid edge %q", edge))
+	}
+
+	pin := digitalPin(key)
+	if err := pin.SetDirection(embd.In); err != nil {
+		die(err)
+	}
+
+	json := c.Bool("json")
+	err := pin.Watch(edge, func(p embd.DigitalPin) {
+		now := time.Now()
+		val, err := p.Read()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		e := "falling"
+		if val == embd.High {
+			e = "rising"
+		}
+		if json {
+			printJSON(pinValue{Pin: key, Value: val, Time: &now, Edge: e})
+			return
+		}
+		fmt.Printf("%v %v %v %v\n", now.Format(time.RFC3339Nano), key, e, val)
+	})
+	if err != nil {
+		die(err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	if err := pin.StopWatching(); err != nil {
+		die(err)
+	}
+}
+
+var gpioCmd = cli.Command{
+	Name:  "gpio",
+	Usage: "read, write and watch digital pins",
+	Subcommands: []cli.Command{
+		{
+			Name:      "read",
+			Usage:     "print the level of a pin",
+			ArgsUsage: "<pin>",
+			Action:    gpioRead,
+			Flags:     []cli.Flag{jsonFlag},
+		},
+		{
+			Name:      "write",
+			Usage:     "make a pin an output and set its level",
+			ArgsUsage: "<pin> <0|1>",
+			Action:    gpioWrite,
+		},
+		{
+			Name:      "direction",
+			Usage:     "set the direction of a pin",
+			ArgsUsage: "<pin> <in|out>",
+			Action:    gpioDirection,
+		},
+		{
+			Name:      "activelow",
+			Usage:     "invert the logic of a pin",
+			ArgsUsage: "<pin> <true|false>",
+			Action:    gpioActiveLow,
+		},
+		{
+			Name:      "pulse",
+			Usage:     "measure the length of the next pulse on a pin",
+			ArgsUsage: "<pin>",
+			Action:    gpioPulse,
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "state", Value: "high", Usage: "level of the pulse (high or low)"},
+				jsonFlag,
+			},
+		},
+		{
+			Name:      "watch",
+			Usage:     "print the edges of a pin until interrupted",
+			ArgsUsage: "<pin>",
+			Action:    gpioWatch,
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "edge", Value: "both", Usage: "edges to report (rising, falling or both)"},
+				jsonFlag,
+			},
+		},
+	},
+}
+
+func init() {
+	registerCommand(gpioCmd)
+}
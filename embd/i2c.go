@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+)
+
+func i2cBus(s string) embd.I2CBus {
+	l, err := parseByte(s)
+	if err != nil {
+		die(err)
+	}
+	if err := embd.InitI2C(); err != nil {
+		die(err)
+	}
+	return embd.NewI2CBus(l)
+}
+
+// parseBytes parses all of args with parseByte.
+func parseBytes(args []string) ([]byte, error) {
+	data := make([]byte, len(args))
+	for i, a := range args {
+		b, err := parseByte(a)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = b
+	}
+	return data, nil
+}
+
+func parseMode(c *cli.Context, args []string) (word bool) {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "b":
+		return false
+	case "w":
+		return true
+	}
+	cli.ShowSubcommandHelp(c)
+	die(fmt.Errorf("invalid mode %q", args[0]))
+	return false
+}
+
+func i2cGet(c *cli.Context) {
+	args := c.Args()
+	if len(args) != 3 && len(args) != 4 {
+		checkArgs(c, 3)
+	}
+	word := parseMode(c, args[3:])
+	addrReg, err := parseBytes(args[1:3])
+	if err != nil {
+		die(err)
+	}
+	bus := i2cBus(args[0])
+
+	var val uint16
+	if word {
+		val, err = bus.ReadWordFromReg(addrReg[0], addrReg[1])
+	} else {
+		var b byte
+		b, err = bus.ReadByteFromReg(addrReg[0], addrReg[1])
+		val = uint16(b)
+	}
+	if err != nil {
+		die(err)
+	}
+
+	if c.Bool("json") {
+		printJSON(struct {
+			Value uint16 `json:"value"`
+		}{val})
+		return
+	}
+	if word {
+		fmt.Printf("0x%04x\n", val)
+	} else {
+		fmt.Printf("0x%02x\n", val)
+	}
+}
+
+func i2cSet(c *cli.Context) {
+	args := c.Args()
+	if len(args) != 4 && len(args) != 5 {
+		checkArgs(c, 4)
+	}
+	word := parseMode(c, args[4:])
+	addrReg, err := parseBytes(args[1:3])
+	if err != nil {
+		die(err)
+	}
+	bits := 8
+	if word {
+		bits = 16
+	}
+	val, err := strconv.ParseUint(args[3], 0, bits)
+	if err != nil {
+		die(fmt.Errorf("invalid value %q", args[3]))
+	}
+	bus := i2cBus(args[0])
+
+	if word {
+		err = bus.WriteWordToReg(addrReg[0], addrReg[1], uint16(val))
+	} else {
+		err = bus.WriteByteToReg(addrReg[0], addrReg[1], byte(val))
+	}
+	if err != nil {
+		die(err)
+	}
+}
+
+// formatDump renders the registers from first to last as an i2cdump style
+// hex table. Registers which could not be read are shown as XX.
+func formatDump(regs []int, first, last int) string {
+	var buf bytes.Buffer
+	buf.WriteString("     0  1  2  3  4  5  6  7  8  9  a  b  c  d  e  f    0123456789abcdef\n")
+	for row := first &^ 0xF; row <= last; row += 16 {
+		fmt.Fprintf(&buf, "%02x: ", row)
+		var ascii bytes.Buffer
+		for reg := row; reg < row+16; reg++ {
+			switch {
+			case reg < first || reg > last:
+				buf.WriteString("   ")
+				ascii.WriteByte(' ')
+			case regs[reg] < 0:
+				buf.WriteString("XX ")
+				ascii.WriteByte('X')
+			default:
+				fmt.Fprintf(&buf, "%02x ", regs[reg])
+				if v := regs[reg]; v >= 0x20 && v < 0x7F {
+					ascii.WriteByte(byte(v))
+				} else {
+					ascii.WriteByte('.')
+				}
+			}
+		}
+		buf.WriteString("   ")
+		buf.Write(bytes.TrimRight(ascii.Bytes(), " "))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+func i2cDump(c *cli.Context) {
+	checkArgs(c, 2)
+	addr, err := parseByte(c.Args().Get(1))
+	if err != nil {
+		die(err)
+	}
+	first, err := parseByte(c.String("first"))
+	if err != nil {
+		die(err)
+	}
+	last, err := parseByte(c.String("last"))
+	if err != nil {
+		die(err)
+	}
+	if first > last {
+		die(fmt.Errorf("first register 0x%02x is after the last one 0x%02x", first, last))
+	}
+	bus := i2cBus(c.Args().First())
+
+	regs := make([]int, 256)
+	for i := range regs {
+		regs[i] = -1
+	}
+	for reg := int(first); reg <= int(last); reg++ {
+		if b, err := bus.ReadByteFromReg(addr, byte(reg)); err == nil {
+			regs[reg] = int(b)
+		}
+	}
+
+	if c.Bool("json") {
+		dump := make(map[string]int)
+		for reg := int(first); reg <= int(last); reg++ {
+			if regs[reg] >= 0 {
+				dump[fmt.Sprintf("0x%02x", reg)] = regs[reg]
+			}
+		}
+		printJSON(dump)
+		return
+	}
+	fmt.Print(formatDump(regs, int(first), int(last)))
+}
+
+// i2cMsg is a message of a transfer: Data is written to Addr, or Len bytes
+// are read from it.
+type i2cMsg struct {
+	Read bool
+	Addr byte
+	Len  int
+	Data []byte
+}
+
+var msgRE = regexp.MustCompile(`^([rw])(\d+)@(0x[0-9a-fA-F]+|\d+)$`)
+
+// parseTransfer parses i2ctransfer style arguments: every message starts
+// with {r|w}<length>@<addr>, followed by the bytes to write for writes.
+func parseTransfer(args []string) ([]i2cMsg, error) {
+	var msgs []i2cMsg
+	for i := 0; i < len(args); i++ {
+		m := msgRE.FindStringSubmatch(args[i])
+		if m == nil {
+			return nil, fmt.Errorf("invalid message %q, expected {r|w}<length>@<addr>", args[i])
+		}
+		n, err := strconv.Atoi(m[2])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid length in %q", args[i])
+		}
+		addr, err := parseByte(m[3])
+		if err != nil {
+			return nil, err
+		}
+		msg := i2cMsg{Read: m[1] == "r", Addr: addr, Len: n}
+		if !msg.Read {
+			if i+n >= len(args) {
+				return nil, fmt.Errorf("%v needs %v bytes", args[i], n)
+			}
+			if msg.Data, err = parseBytes(args[i+1 : i+1+n]); err != nil {
+				return nil, err
+			}
+			i += n
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("no messages")
+	}
+	return msgs, nil
+}
+
+// transfer performs the messages and returns the data of the reads. A
+// single byte write followed by a read of the same device is done with a
+// repeated start, as a register read.
+func transfer(bus embd.I2CBus, msgs []i2cMsg) ([][]byte, error) {
+	var reads [][]byte
+	for i := 0; i < len(msgs); i++ {
+		msg := msgs[i]
+		if !msg.Read {
+			if msg.Len == 1 && i+1 < len(msgs) && msgs[i+1].Read && msgs[i+1].Addr == msg.Addr {
+				data := make([]byte, msgs[i+1].Len)
+				if err := bus.ReadFromReg(msg.Addr, msg.Data[0], data); err != nil {
+					return nil, err
+				}
+				reads = append(reads, data)
+				i++
+				continue
+			}
+			if err := bus.WriteBytes(msg.Addr, msg.Data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data, err := bus.ReadBytes(msg.Addr, msg.Len)
+		if err != nil {
+			return nil, err
+		}
+		reads = append(reads, data)
+	}
+	return reads, nil
+}
+
+func i2cTransfer(c *cli.Context) {
+	args := c.Args()
+	if len(args) < 2 {
+		checkArgs(c, 2)
+	}
+	msgs, err := parseTransfer(args[1:])
+	if err != nil {
+		die(err)
+	}
+
+	reads, err := transfer(i2cBus(args[0]), msgs)
+	if err != nil {
+		die(err)
+	}
+
+	if c.Bool("json") {
+		out := make([][]int, len(reads))
+		for i, data := range reads {
+			out[i] = make([]int, len(data))
+			for j, b := range data {
+				out[i][j] = int(b)
+			}
+		}
+		printJSON(out)
+		return
+	}
+	for _, data := range reads {
+		for j, b := range data {
+			if j > 0 {
+				fmt.Print(" ")
+			}
+			fmt.Printf("0x%02x", b)
+		}
+		fmt.Println()
+	}
+}
+
+var i2cCmd = cli.Command{
+	Name:  "i2c",
+	Usage: "access devices on an i2c bus",
+	Subcommands: []cli.Command{
+		{
+			Name:      "get",
+			Usage:     "read a register as a byte (b) or a word (w)",
+			ArgsUsage: "<bus> <addr> <reg> [b|w]",
+			Action:    i2cGet,
+			Flags:     []cli.Flag{jsonFlag},
+		},
+		{
+			Name:      "set",
+			Usage:     "write a register as a byte (b) or a word (w)",
+			ArgsUsage: "<bus> <addr> <reg> <value> [b|w]",
+			Action:    i2cSet,
+		},
+		{
+			Name:      "dump",
+			Usage:     "print the registers of a device as a hex table",
+			ArgsUsage: "<bus> <addr>",
+			Action:    i2cDump,
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "first", Value: "0x00", Usage: "first register"},
+				cli.StringFlag{Name: "last", Value: "0xff", Usage: "last register"},
+				jsonFlag,
+			},
+		},
+		{
+			Name:      "transfer",
+			Usage:     "send and receive raw messages, e.g. w1@0x77 0xd0 r1@0x77",
+			ArgsUsage: "<bus> {r|w}<length>@<addr> [bytes...]...",
+			Action:    i2cTransfer,
+			Flags:     []cli.Flag{jsonFlag},
+		},
+	},
+}
+
+func init() {
+	registerCommand(i2cCmd)
+}
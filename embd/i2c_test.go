@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kidoman/embd"
+)
+
+func TestParseTransfer(t *testing.T) {
+	var tests = []struct {
+		args []string
+		msgs []i2cMsg
+		err  bool
+	}{
+		{
+			[]string{"w1@0x77", "0xd0", "r2@0x77"},
+			[]i2cMsg{{Addr: 0x77, Len: 1, Data: []byte{0xd0}}, {Read: true, Addr: 0x77, Len: 2}},
+			false,
+		},
+		{
+			[]string{"w3@64", "1", "2", "0x3"},
+			[]i2cMsg{{Addr: 0x40, Len: 3, Data: []byte{1, 2, 3}}},
+			false,
+		},
+		{[]string{"w2@0x77", "0xd0"}, nil, true},
+		{[]string{"w1@0x77", "256"}, nil, true},
+		{[]string{"x1@0x77"}, nil, true},
+		{[]string{"r0@0x77"}, nil, true},
+		{nil, nil, true},
+	}
+	for _, test := range tests {
+		msgs, err := parseTransfer(test.args)
+		if (err != nil) != test.err {
+			t.Errorf("%v: got error %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(msgs, test.msgs) {
+			t.Errorf("%v: got %+v, want %+v", test.args, msgs, test.msgs)
+		}
+	}
+}
+
+type fakeI2CBus struct {
+	embd.I2CBus
+	calls []string
+}
+
+func (b *fakeI2CBus) ReadFromReg(addr, reg byte, value []byte) error {
+	b.calls = append(b.calls, "readreg")
+	for i := range value {
+		value[i] = reg + byte(i)
+	}
+	return nil
+}
+
+func (b *fakeI2CBus) ReadBytes(addr byte, num int) ([]byte, error) {
+	b.calls = append(b.calls, "read")
+	return make([]byte, num), nil
+}
+
+func (b *fakeI2CBus) WriteBytes(addr byte, value []byte) error {
+	b.calls = append(b.calls, "write")
+	return nil
+}
+
+func TestTransfer(t *testing.T) {
+	bus := &fakeI2CBus{}
+	msgs := []i2cMsg{
+		{Addr: 0x77, Len: 1, Data: []byte{0xd0}},
+		{Read: true, Addr: 0x77, Len: 2},
+		{Addr: 0x77, Len: 2, Data: []byte{0xf4, 0x2e}},
+		{Read: true, Addr: 0x77, Len: 1},
+	}
+	reads, err := transfer(bus, msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]byte{{0xd0, 0xd1}, {0}}; !reflect.DeepEqual(reads, want) {
+		t.Errorf("reads: got %v, want %v", reads, want)
+	}
+	if want := []string{"readreg", "write", "read"}; !reflect.DeepEqual(bus.calls, want) {
+		t.Errorf("calls: got %v, want %v", bus.calls, want)
+	}
+}
+
+func TestFormatDump(t *testing.T) {
+	regs := make([]int, 256)
+	for i := range regs {
+		regs[i] = -1
+	}
+	regs[0x0e], regs[0x0f], regs[0x10], regs[0x11] = 0x41, 0x00, 0x7a, 0xff
+	regs[0x12] = -1
+
+	want := "" +
+		"     0  1  2  3  4  5  6  7  8  9  a  b  c  d  e  f    0123456789abcdef\n" +
+		"00:                                           41 00                  A.\n" +
+		"10: 7a ff XX                                           z.X\n"
+	if got := formatDump(regs, 0x0e, 0x12); got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
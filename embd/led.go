@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+)
+
+func led(c *cli.Context) embd.LED {
+	checkArgs(c, 1)
+	if err := embd.InitLED(); err != nil {
+		die(err)
+	}
+	l, err := embd.NewLED(c.Args().First())
+	if err != nil {
+		die(err)
+	}
+	return l
+}
+
+func ledAction(set func(embd.LED) error) func(c *cli.Context) {
+	return func(c *cli.Context) {
+		if err := set(led(c)); err != nil {
+			die(err)
+		}
+	}
+}
+
+func ledBlink(c *cli.Context) {
+	l := led(c)
+	interval, count := c.Duration("interval"), c.Int("count")
+	if interval <= 0 {
+		die(fmt.Errorf("invalid interval %v", interval))
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Each blink is an on and an off half period; the led is left off.
+	for i := 0; count <= 0 || i < 2*count; i++ {
+		if err := l.Toggle(); err != nil {
+			die(err)
+		}
+		select {
+		case <-ticker.C:
+		case <-quit:
+			l.Off()
+			return
+		}
+	}
+	if err := l.Off(); err != nil {
+		die(err)
+	}
+}
+
+var ledCmd = cli.Command{
+	Name:  "led",
+	Usage: "control the leds on the board",
+	Subcommands: []cli.Command{
+		{
+			Name:      "on",
+			Usage:     "switch a led on",
+			ArgsUsage: "<led>",
+			Action:    ledAction(embd.LED.On),
+		},
+		{
+			Name:      "off",
+			Usage:     "switch a led off",
+			ArgsUsage: "<led>",
+			Action:    ledAction(embd.LED.Off),
+		},
+		{
+			Name:      "toggle",
+			Usage:     "toggle a led",
+			ArgsUsage: "<led>",
+			Action:    ledAction(embd.LED.Toggle),
+		},
+		{
+			Name:      "blink",
+			Usage:     "blink a led until interrupted or count blinks are done",
+			ArgsUsage: "<led>",
+			Action:    ledBlink,
+			Flags: []cli.Flag{
+				cli.DurationFlag{Name: "interval", Value: 500 * time.Millisecond, Usage: "half period of a blink"},
+				cli.IntFlag{Name: "count", Usage: "number of blinks, 0 for no limit"},
+			},
+		},
+	},
+}
+
+func init() {
+	registerCommand(ledCmd)
+}
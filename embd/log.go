@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/datalog"
+)
+
+// parseSize parses a size in bytes, with an optional K, M or G suffix.
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	n, err := strconv.ParseInt(strings.TrimRight(s, "KMG"), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// parsePairs parses the "key<sep>value" flag values.
+func parsePairs(values []string, sep string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, v := range values {
+		i := strings.Index(v, sep)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid value %q, expected key%vvalue", v, sep)
+		}
+		m[strings.TrimSpace(v[:i])] = strings.TrimSpace(v[i+len(sep):])
+	}
+	return m, nil
+}
+
+// newSource creates a logged sensor from a "driver[@addr][=name]" flag
+// value.
+func newSource(spec string, bus embd.I2CBus) (datalog.Source, *sensorDevice, error) {
+	driver, addr, name, err := parseSensorSpec(spec)
+	if err != nil {
+		return datalog.Source{}, nil, err
+	}
+	d, err := openSensor(driver, sensorConfig{
+		Bus:  func() embd.I2CBus { return bus },
+		Addr: addr,
+	})
+	if err != nil {
+		return datalog.Source{}, nil, err
+	}
+	return datalog.Source{
+		Name: name,
+		Sample: func() ([]datalog.Value, error) {
+			values, err := d.Sample()
+			if err != nil {
+				return nil, err
+			}
+			vs := make([]datalog.Value, len(values))
+			for i, q := range d.Quantities {
+				vs[i] = datalog.Value{Name: q.Name, Value: values[i], Unit: q.Unit}
+			}
+			return vs, nil
+		},
+	}, d, nil
+}
+
+func logSensors(c *cli.Context) {
+	specs := c.StringSlice("sensor")
+	if len(specs) == 0 {
+		cli.ShowSubcommandHelp(c)
+		os.Exit(1)
+	}
+	format, err := datalog.ParseFormat(c.String("format"))
+	if err != nil {
+		die(err)
+	}
+	tags, err := parsePairs(c.StringSlice("tag"), "=")
+	if err != nil {
+		die(err)
+	}
+	cfg := datalog.Config{Interval: c.Duration("interval"), Tags: tags}
+
+	if err := embd.InitI2C(); err != nil {
+		die(err)
+	}
+	defer embd.CloseI2C()
+	bus := embd.NewI2CBus(byte(c.Int("i2c-bus")))
+	for _, spec := range specs {
+		src, d, err := newSource(spec, bus)
+		if err != nil {
+			die(err)
+		}
+		defer d.Close()
+		cfg.Sources = append(cfg.Sources, src)
+	}
+
+	url := c.String("url")
+	if url == "" || c.IsSet("dir") {
+		maxSize, err := parseSize(c.String("max-size"))
+		if err != nil {
+			die(err)
+		}
+		s, err := datalog.NewFileSink(datalog.FileConfig{
+			Dir:     c.String("dir"),
+			Prefix:  c.String("prefix"),
+			Format:  format,
+			MaxSize: maxSize,
+			MaxAge:  c.Duration("max-age"),
+			Keep:    c.Int("keep"),
+		})
+		if err != nil {
+			die(err)
+		}
+		cfg.Sinks = append(cfg.Sinks, s)
+	}
+	if url != "" {
+		headers, err := parsePairs(c.StringSlice("header"), ":")
+		if err != nil {
+			die(err)
+		}
+		h := make(http.Header)
+		for k, v := range headers {
+			h.Set(k, v)
+		}
+		cfg.Sinks = append(cfg.Sinks, datalog.NewHTTPSink(datalog.HTTPConfig{
+			URL:       url,
+			Format:    format,
+			Header:    h,
+			MaxBuffer: c.Int("buffer"),
+		}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		cancel()
+	}()
+
+	if err := datalog.New(cfg).Run(ctx); err != nil {
+		fmt.Println(err)
+	}
+}
+
+var logCmd = cli.Command{
+	Name:  "log",
+	Usage: "log sensor readings to rotating files or an http endpoint",
+	Description: `Samples the sensors every --interval and writes the readings in csv, jsonl
+   or influx line protocol to files in --dir, rotated by --max-size and
+   --max-age. With --url the readings are also posted there, and kept in
+   memory while the endpoint cannot be reached; the files are then only
+   written when --dir is given. For example:
+
+   embd log --sensor bmp180 --sensor tmp006@0x41=ir --interval 1m --dir /var/log/embd
+   embd log --sensor bmp180 --format influx --url 'http://nas:8086/write?db=embd' --tag host=pi`,
+	Action: logSensors,
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{Name: "sensor", Value: &cli.StringSlice{}, Usage: "i2c sensor to sample, as driver[@addr][=name]"},
+		cli.IntFlag{Name: "i2c-bus", Value: 1, Usage: "i2c bus of the sensors"},
+		cli.DurationFlag{Name: "interval", Value: 10 * time.Second, Usage: "sampling interval"},
+		cli.StringFlag{Name: "format", Value: "csv", Usage: "csv, jsonl or influx"},
+		cli.StringSliceFlag{Name: "tag", Value: &cli.StringSlice{}, Usage: "tag added to every record, as key=value"},
+		cli.StringFlag{Name: "dir", Value: ".", Usage: "directory of the files"},
+		cli.StringFlag{Name: "prefix", Value: "embd", Usage: "start of the file names"},
+		cli.StringFlag{Name: "max-size", Value: "0", Usage: "rotate the files before they grow past this size, e.g. 10M (0 for no limit)"},
+		cli.DurationFlag{Name: "max-age", Value: 24 * time.Hour, Usage: "rotate the files once they are this old (0 for no limit)"},
+		cli.IntFlag{Name: "keep", Usage: "number of files to keep (0 to keep them all)"},
+		cli.StringFlag{Name: "url", Usage: "http endpoint to post the readings to"},
+		cli.StringSliceFlag{Name: "header", Value: &cli.StringSlice{}, Usage: "http header of the posts, as 'name: value'"},
+		cli.IntFlag{Name: "buffer", Value: 10000, Usage: "readings kept while the endpoint cannot be reached"},
+	},
+}
+
+func init() {
+	registerCommand(logCmd)
+}
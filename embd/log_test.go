@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"512", 512, true},
+		{"4K", 4096, true},
+		{"10M", 10 << 20, true},
+		{"1G", 1 << 30, true},
+		{"", 0, false},
+		{"M", 0, false},
+		{"-1", 0, false},
+		{"1.5M", 0, false},
+	}
+	for _, test := range tests {
+		n, err := parseSize(test.s)
+		if (err == nil) != test.ok || n != test.want {
+			t.Errorf("parseSize(%q): got %v, %v", test.s, n, err)
+		}
+	}
+}
+
+func TestParseSensorSpec(t *testing.T) {
+	tests := []struct {
+		spec, driver string
+		addr         byte
+		name         string
+		ok           bool
+	}{
+		{"bmp180", "bmp180", 0, "bmp180", true},
+		{"tmp006@0x41", "tmp006", 0x41, "tmp006", true},
+		{"tmp006@0x41=ir", "tmp006", 0x41, "ir", true},
+		{"bh1750fvi=light", "bh1750fvi", 0, "light", true},
+		{"tmp006@x", "", 0, "", false},
+	}
+	for _, test := range tests {
+		driver, addr, name, err := parseSensorSpec(test.spec)
+		if (err == nil) != test.ok || driver != test.driver || addr != test.addr || name != test.name {
+			t.Errorf("parseSensorSpec(%q): got %v, %#x, %v, %v", test.spec, driver, addr, name, err)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/codegangsta/cli"
 	_ "github.com/kidoman/embd/host/all"
@@ -15,6 +18,39 @@ func registerCommand(cmd cli.Command) {
 	commands = append(commands, cmd)
 }
 
+// die prints err and exits with a failure status.
+func die(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+// checkArgs shows the help of the command and exits unless it was given n
+// arguments.
+func checkArgs(c *cli.Context, n int) {
+	if len(c.Args()) != n {
+		cli.ShowSubcommandHelp(c)
+		os.Exit(1)
+	}
+}
+
+// parseByte parses a bus number, an address, a register or a value, in
+// decimal or in hex with a 0x prefix.
+func parseByte(s string) (byte, error) {
+	n, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte %q", s)
+	}
+	return byte(n), nil
+}
+
+var jsonFlag = cli.BoolFlag{Name: "json", Usage: "print the output as json"}
+
+func printJSON(v interface{}) {
+	if err := json.NewEncoder(os.Stdout).Encode(v); err != nil {
+		die(err)
+	}
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "embd"
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/mqtt"
+)
+
+// parseItems parses "key[=name]" flag values.
+func parseItems(values []string) []mqtt.Item {
+	var items []mqtt.Item
+	for _, v := range values {
+		key, name := v, ""
+		if i := strings.Index(v, "="); i >= 0 {
+			key, name = v[:i], v[i+1:]
+		}
+		items = append(items, mqtt.Item{Key: key, Name: name})
+	}
+	return items
+}
+
+// newSensor creates a sensor from a "driver[@addr][=name]" flag value.
+func newSensor(spec string, bus embd.I2CBus) (mqtt.Sensor, error) {
+	driver, addr, name, err := parseSensorSpec(spec)
+	if err != nil {
+		return mqtt.Sensor{}, err
+	}
+
+	d, err := openSensor(driver, sensorConfig{
+		Bus:  func() embd.I2CBus { return bus },
+		Addr: addr,
+	})
+	if err != nil {
+		return mqtt.Sensor{}, err
+	}
+	s := mqtt.Sensor{Name: name, Sample: d.Sample}
+	for _, q := range d.Quantities {
+		s.Readings = append(s.Readings, mqtt.Reading{
+			Name:        q.Name,
+			Unit:        q.Unit,
+			DeviceClass: q.Class,
+		})
+	}
+	return s, nil
+}
+
+func bridge(c *cli.Context) {
+	cfg := mqtt.Config{
+		Prefix:          c.String("prefix"),
+		NodeID:          c.String("node-id"),
+		QoS:             byte(c.Int("qos")),
+		Retain:          !c.Bool("no-retain"),
+		Discovery:       c.Bool("discovery"),
+		DiscoveryPrefix: c.String("discovery-prefix"),
+		Interval:        c.Duration("interval"),
+		Inputs:          parseItems(c.StringSlice("input")),
+		Outputs:         parseItems(c.StringSlice("output")),
+		Analogs:         parseItems(c.StringSlice("analog")),
+		PWMs:            parseItems(c.StringSlice("pwm")),
+		LEDs:            parseItems(c.StringSlice("led")),
+	}
+
+	if specs := c.StringSlice("sensor"); len(specs) > 0 {
+		if err := embd.InitI2C(); err != nil {
+			die(err)
+		}
+		defer embd.CloseI2C()
+		bus := embd.NewI2CBus(byte(c.Int("i2c-bus")))
+		for _, spec := range specs {
+			s, err := newSensor(spec, bus)
+			if err != nil {
+				die(err)
+			}
+			cfg.Sensors = append(cfg.Sensors, s)
+		}
+	}
+
+	client := mqtt.NewPahoClient(mqtt.Options{
+		Broker:   c.String("broker"),
+		ClientID: c.String("client-id"),
+		Username: c.String("username"),
+		Password: c.String("password"),
+	})
+	b := mqtt.New(client, cfg)
+	if err := b.Start(); err != nil {
+		die(err)
+	}
+	fmt.Printf("bridging to %v\n", c.String("broker"))
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	if err := b.Close(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+var mqttCmd = cli.Command{
+	Name:   "mqtt",
+	Usage:  "bridge pins, leds and sensors to an mqtt broker",
+	Action: bridge,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "broker", Value: "tcp://localhost:1883", Usage: "url of the broker"},
+		cli.StringFlag{Name: "client-id", Value: "embd", Usage: "mqtt client id"},
+		cli.StringFlag{Name: "username", Usage: "username for the broker"},
+		cli.StringFlag{Name: "password", Usage: "password for the broker", EnvVar: "EMBD_MQTT_PASSWORD"},
+		cli.StringFlag{Name: "prefix", Usage: "topic prefix (default embd/<node-id>)"},
+		cli.StringFlag{Name: "node-id", Usage: "id of the host (default the hostname)"},
+		cli.IntFlag{Name: "qos", Usage: "quality of service (0, 1 or 2)"},
+		cli.BoolFlag{Name: "no-retain", Usage: "do not retain the state messages"},
+		cli.BoolFlag{Name: "discovery", Usage: "publish home assistant discovery payloads"},
+		cli.StringFlag{Name: "discovery-prefix", Value: "homeassistant", Usage: "home assistant discovery prefix"},
+		cli.DurationFlag{Name: "interval", Value: 10 * time.Second, Usage: "sampling interval of the analog inputs and sensors"},
+		cli.StringSliceFlag{Name: "input", Value: &cli.StringSlice{}, Usage: "digital input to publish, as pin[=name]"},
+		cli.StringSliceFlag{Name: "output", Value: &cli.StringSlice{}, Usage: "digital output to control, as pin[=name]"},
+		cli.StringSliceFlag{Name: "analog", Value: &cli.StringSlice{}, Usage: "analog input to sample, as pin[=name]"},
+		cli.StringSliceFlag{Name: "pwm", Value: &cli.StringSlice{}, Usage: "pwm output to control, as pin[=name]"},
+		cli.StringSliceFlag{Name: "led", Value: &cli.StringSlice{}, Usage: "led to control, as led[=name]"},
+		cli.StringSliceFlag{Name: "sensor", Value: &cli.StringSlice{}, Usage: "i2c sensor to sample: bmp085, bmp180, bme280, bh1750fvi, htu21d, l3gd20, lsm303, mpu6050, mpu9250, sht3x, si7021 or tmp006, as driver[@addr][=name]"},
+		cli.IntFlag{Name: "i2c-bus", Value: 1, Usage: "i2c bus of the sensors"},
+	},
+}
+
+func init() {
+	registerCommand(mqttCmd)
+}
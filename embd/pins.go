@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+)
+
+var capNames = []struct {
+	cap  int
+	name string
+}{
+	{embd.CapDigital, "digital"},
+	{embd.CapI2C, "i2c"},
+	{embd.CapUART, "uart"},
+	{embd.CapSPI, "spi"},
+	{embd.CapGPMC, "gpmc"},
+	{embd.CapLCD, "lcd"},
+	{embd.CapPWM, "pwm"},
+	{embd.CapAnalog, "analog"},
+}
+
+func parseCaps(names []string) (int, error) {
+	var caps int
+	for _, list := range names {
+		for _, name := range strings.Split(list, ",") {
+			found := false
+			for _, c := range capNames {
+				if c.name == name {
+					caps |= c.cap
+					found = true
+				}
+			}
+			if !found {
+				return 0, fmt.Errorf("invalid capability %q", name)
+			}
+		}
+	}
+	return caps, nil
+}
+
+func capList(caps int) []string {
+	var names []string
+	for _, c := range capNames {
+		if caps&c.cap != 0 {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+type pinInfo struct {
+	ID        string   `json:"id"`
+	Aliases   []string `json:"aliases"`
+	Caps      []string `json:"caps"`
+	Digital   *int     `json:"digital,omitempty"`
+	Analog    *int     `json:"analog,omitempty"`
+	Direction string   `json:"direction,omitempty"`
+	Value     *int     `json:"value,omitempty"`
+}
+
+// describePins lists the pins having any of caps, all of them when caps is
+// 0. With live set, the direction and level of the gpios exported in sysfs
+// are read too; the pins are not exported for that.
+func describePins(pins embd.PinMap, caps int, live bool) []pinInfo {
+	var infos []pinInfo
+	for _, pd := range pins {
+		if caps != 0 && pd.Caps&caps == 0 {
+			continue
+		}
+		info := pinInfo{ID: pd.ID, Aliases: []string{}, Caps: capList(pd.Caps)}
+		for _, a := range pd.Aliases {
+			info.Aliases = append(info.Aliases, strings.TrimSpace(a))
+		}
+		if pd.Caps&embd.CapDigital != 0 {
+			n := pd.DigitalLogical
+			info.Digital = &n
+			if live {
+				info.Direction, info.Value = gpioState(n)
+			}
+		}
+		if pd.Caps&embd.CapAnalog != 0 {
+			n := pd.AnalogLogical
+			info.Analog = &n
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func gpioState(n int) (string, *int) {
+	dir := embd.FSPath(fmt.Sprintf("/sys/class/gpio/gpio%v", n))
+	direction, err := ioutil.ReadFile(path.Join(dir, "direction"))
+	if err != nil {
+		return "", nil
+	}
+	value, err := ioutil.ReadFile(path.Join(dir, "value"))
+	if err != nil {
+		return strings.TrimSpace(string(direction)), nil
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(value)))
+	if err != nil {
+		return strings.TrimSpace(string(direction)), nil
+	}
+	return strings.TrimSpace(string(direction)), &v
+}
+
+func optInt(n *int) string {
+	if n == nil {
+		return "-"
+	}
+	return strconv.Itoa(*n)
+}
+
+func formatTable(infos []pinInfo, live bool) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprint(w, "ID\tDIGITAL\tANALOG\tCAPS\tALIASES")
+	if live {
+		fmt.Fprint(w, "\tDIR\tVALUE")
+	}
+	fmt.Fprintln(w)
+	for _, p := range infos {
+		aliases := strings.Join(p.Aliases, ",")
+		if aliases == "" {
+			aliases = "-"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v", p.ID, optInt(p.Digital), optInt(p.Analog), strings.Join(p.Caps, ","), aliases)
+		if live {
+			dir := p.Direction
+			if dir == "" {
+				dir = "-"
+			}
+			fmt.Fprintf(w, "\t%v\t%v", dir, optInt(p.Value))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// headerPin matches the IDs of header pins, e.g. P1_3 or P9_12.
+var headerPin = regexp.MustCompile(`^([A-Z]+[0-9]+)_([0-9]+)$`)
+
+// pinLabel names a pin by its first alias which is not a bare number.
+func pinLabel(p pinInfo) string {
+	label := p.ID
+	for _, a := range p.Aliases {
+		if _, err := strconv.Atoi(a); err != nil && a != "" {
+			label = a
+			break
+		}
+	}
+	if p.Direction != "" {
+		label += fmt.Sprintf(" [%v %v]", p.Direction, optInt(p.Value))
+	}
+	return label
+}
+
+// formatDiagram draws the two column headers of the board, odd pins on the
+// left. Header positions without a pin in the map (power, ground, or pins
+// filtered out) are shown as "-". Pins which are not on a header are
+// listed after the diagrams.
+func formatDiagram(infos []pinInfo, live bool) string {
+	var headers []string
+	pins := make(map[string]map[int]pinInfo)
+	last := make(map[string]int)
+	var others []pinInfo
+	for _, p := range infos {
+		m := headerPin.FindStringSubmatch(p.ID)
+		if m == nil {
+			others = append(others, p)
+			continue
+		}
+		header := m[1]
+		n, _ := strconv.Atoi(m[2])
+		if pins[header] == nil {
+			pins[header] = make(map[int]pinInfo)
+			headers = append(headers, header)
+		}
+		if _, dup := pins[header][n]; !dup {
+			pins[header][n] = p
+		}
+		if n > last[header] {
+			last[header] = n
+		}
+	}
+
+	var b strings.Builder
+	for i, header := range headers {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		label := func(n int) string {
+			if p, ok := pins[header][n]; ok {
+				return pinLabel(p)
+			}
+			return "-"
+		}
+		width := 0
+		for n := 1; n <= last[header]; n += 2 {
+			if l := len(label(n)); l > width {
+				width = l
+			}
+		}
+		fmt.Fprintf(&b, "%v\n", header)
+		for n := 1; n <= last[header]; n += 2 {
+			fmt.Fprintf(&b, "%*v %2d | %-2d %v\n", width, label(n), n, n+1, label(n+1))
+		}
+	}
+	if len(others) > 0 {
+		if len(headers) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(formatTable(others, live))
+	}
+	return b.String()
+}
+
+// hostPinMap returns the pin map of the host, without opening any pin.
+func hostPinMap() (embd.PinMap, error) {
+	desc, err := embd.DescribeHost()
+	if err != nil {
+		return nil, err
+	}
+	if desc.GPIODriver == nil {
+		return nil, embd.ErrFeatureNotSupported
+	}
+	drv := desc.GPIODriver()
+	defer drv.Close()
+	return drv.PinMap(), nil
+}
+
+func pins(c *cli.Context) {
+	checkArgs(c, 0)
+	caps, err := parseCaps(c.StringSlice("cap"))
+	if err != nil {
+		die(err)
+	}
+	pinMap, err := hostPinMap()
+	if err != nil {
+		die(err)
+	}
+
+	live := c.Bool("live")
+	infos := describePins(pinMap, caps, live)
+
+	switch {
+	case c.Bool("json"):
+		printJSON(infos)
+	case c.Bool("diagram"):
+		fmt.Print(formatDiagram(infos, live))
+	default:
+		fmt.Print(formatTable(infos, live))
+	}
+}
+
+var pinsCmd = cli.Command{
+	Name:   "pins",
+	Usage:  "print the pin map of the host",
+	Action: pins,
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "cap",
+			Value: &cli.StringSlice{},
+			Usage: "only show pins with any of these capabilities (digital, i2c, uart, spi, gpmc, lcd, pwm, analog)",
+		},
+		cli.BoolFlag{Name: "live", Usage: "show the direction and level of the gpios exported in sysfs"},
+		cli.BoolFlag{Name: "diagram", Usage: "draw the board headers instead of a table"},
+		jsonFlag,
+	},
+}
+
+func init() {
+	registerCommand(pinsCmd)
+}
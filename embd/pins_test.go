@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakefs"
+)
+
+var testPins = embd.PinMap{
+	&embd.PinDesc{ID: "P1_1", Aliases: []string{"1", "AIN1"}, Caps: embd.CapAnalog, AnalogLogical: 1},
+	&embd.PinDesc{ID: "P1_3", Aliases: []string{"2", "GPIO_2", "SDA"}, Caps: embd.CapDigital | embd.CapI2C, DigitalLogical: 2},
+	&embd.PinDesc{ID: "P1_4", Aliases: []string{"17", "GPIO_17 "}, Caps: embd.CapDigital, DigitalLogical: 17},
+	&embd.PinDesc{ID: "pwmchip0:0", Caps: embd.CapPWM},
+}
+
+func TestParseCaps(t *testing.T) {
+	caps, err := parseCaps([]string{"i2c,spi", "pwm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := embd.CapI2C | embd.CapSPI | embd.CapPWM; caps != want {
+		t.Errorf("got %b, want %b", caps, want)
+	}
+	if _, err := parseCaps([]string{"can"}); err == nil {
+		t.Error("expected an error for an unknown capability")
+	}
+}
+
+func TestDescribePins(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/gpio/gpio17/direction": "out\n",
+		"sys/class/gpio/gpio17/value":     "1\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	infos := describePins(testPins, embd.CapDigital, true)
+	if len(infos) != 2 {
+		t.Fatalf("got %v pins, want 2", len(infos))
+	}
+	if p := infos[0]; p.ID != "P1_3" || p.Direction != "" || p.Value != nil {
+		t.Errorf("unexported pin: got %+v", p)
+	}
+	p := infos[1]
+	if p.Direction != "out" || p.Value == nil || *p.Value != 1 {
+		t.Errorf("exported pin: got %+v", p)
+	}
+	if p.Aliases[1] != "GPIO_17" {
+		t.Errorf("aliases are not trimmed: %q", p.Aliases)
+	}
+}
+
+func TestFormatDiagram(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/gpio/gpio17/direction": "in\n",
+		"sys/class/gpio/gpio17/value":     "0\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	got := formatDiagram(describePins(testPins, 0, true), true)
+	want := "P1\n" +
+		"  AIN1  1 | 2  -\n" +
+		"GPIO_2  3 | 4  GPIO_17 [in 0]\n" +
+		"\n" +
+		"ID          DIGITAL  ANALOG  CAPS  ALIASES  DIR  VALUE\n" +
+		"pwmchip0:0  -        -       pwm   -        -    -\n"
+	if got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+)
+
+func parsePolarity(s string) (embd.Polarity, error) {
+	switch s {
+	case "positive", "normal":
+		return embd.Positive, nil
+	case "negative", "inversed":
+		return embd.Negative, nil
+	}
+	return 0, fmt.Errorf("invalid polarity %q", s)
+}
+
+func pwmSet(c *cli.Context) {
+	checkArgs(c, 1)
+	if c.IsSet("us") && (c.IsSet("period") || c.IsSet("duty")) {
+		die(fmt.Errorf("--us cannot be combined with --period or --duty"))
+	}
+	if !c.IsSet("us") && !c.IsSet("period") && !c.IsSet("duty") && !c.IsSet("polarity") {
+		die(fmt.Errorf("nothing to set: give --period, --duty, --polarity or --us"))
+	}
+
+	if err := embd.InitGPIO(); err != nil {
+		die(err)
+	}
+	// The pin is not closed: closing would stop the pwm output.
+	pin, err := embd.NewPWMPin(c.Args().First())
+	if err != nil {
+		die(err)
+	}
+
+	if c.IsSet("polarity") {
+		pol, err := parsePolarity(c.String("polarity"))
+		if err != nil {
+			die(err)
+		}
+		if err := pin.SetPolarity(pol); err != nil {
+			die(err)
+		}
+	}
+	if c.IsSet("us") {
+		if err := pin.SetMicroseconds(c.Int("us")); err != nil {
+			die(err)
+		}
+		return
+	}
+	if c.IsSet("period") {
+		if err := pin.SetPeriod(c.Int("period")); err != nil {
+			die(err)
+		}
+	}
+	if c.IsSet("duty") {
+		if err := pin.SetDuty(c.Int("duty")); err != nil {
+			die(err)
+		}
+	}
+}
+
+var pwmCmd = cli.Command{
+	Name:  "pwm",
+	Usage: "generate pwm signals",
+	Subcommands: []cli.Command{
+		{
+			Name:      "set",
+			Usage:     "set the period, duty and polarity of a pin, or a servo pulse width",
+			ArgsUsage: "<pin>",
+			Action:    pwmSet,
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "period", Usage: "period in ns"},
+				cli.IntFlag{Name: "duty", Usage: "duty in ns"},
+				cli.StringFlag{Name: "polarity", Usage: "positive or negative"},
+				cli.IntFlag{Name: "us", Usage: "pulse width in µs, for servos"},
+			},
+		},
+	},
+}
+
+func init() {
+	registerCommand(pwmCmd)
+}
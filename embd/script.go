@@ -0,0 +1,496 @@
+package main
+
+// The shell language: statements are separated by newlines or semicolons,
+// # starts a comment, words can be quoted with "..." (variables expanded) or
+// '...' (taken literally), $name and ${name} expand variables, and commands
+// such as repeat take a { } block. The output of every command is also
+// stored in $_.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type wordPart struct {
+	text   string
+	expand bool
+}
+
+type word []wordPart
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	sepToken
+	openToken
+	closeToken
+)
+
+type token struct {
+	kind tokenKind
+	word word
+	line int
+}
+
+func isSep(c byte) bool {
+	return c == ';' || c == '\n'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+// lex splits src into tokens. Braces are only special at the start of a
+// word, so that ${name} stays a single word.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case isSpace(c):
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case isSep(c):
+			tokens = append(tokens, token{kind: sepToken, line: line})
+			if c == '\n' {
+				line++
+			}
+			i++
+		case c == '{':
+			tokens = append(tokens, token{kind: openToken, line: line})
+			i++
+		case c == '}':
+			tokens = append(tokens, token{kind: closeToken, line: line})
+			i++
+		default:
+			var w word
+			start := line
+			for i < len(src) && !isSpace(src[i]) && !isSep(src[i]) {
+				switch q := src[i]; q {
+				case '"', '\'':
+					end := strings.IndexByte(src[i+1:], q)
+					if end < 0 {
+						return nil, fmt.Errorf("line %v: unterminated %c", line, q)
+					}
+					text := src[i+1 : i+1+end]
+					line += strings.Count(text, "\n")
+					w = append(w, wordPart{text: text, expand: q == '"'})
+					i += end + 2
+				default:
+					j := i
+					for j < len(src) && !isSpace(src[j]) && !isSep(src[j]) && src[j] != '"' && src[j] != '\'' {
+						j++
+					}
+					w = append(w, wordPart{text: src[i:j], expand: true})
+					i = j
+				}
+			}
+			tokens = append(tokens, token{kind: wordToken, word: w, line: start})
+		}
+	}
+	return tokens, nil
+}
+
+type stmt struct {
+	line  int
+	words []word
+
+	// hasBody is set for the statements followed by a { } block.
+	hasBody bool
+	body    []stmt
+}
+
+// errIncomplete is returned by parse when a block is not closed yet, so that
+// the interactive shell can ask for more lines.
+var errIncomplete = errors.New("missing }")
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) ([]stmt, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	stmts, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("line %v: unexpected }", p.tokens[p.pos].line)
+	}
+	return stmts, nil
+}
+
+// block parses statements up to the closing brace of the block, which is
+// left to the caller, or the end of the input.
+func (p *parser) block() ([]stmt, error) {
+	var stmts []stmt
+	var cur *stmt
+	end := func() {
+		if cur != nil {
+			stmts = append(stmts, *cur)
+			cur = nil
+		}
+	}
+	for p.pos < len(p.tokens) {
+		t := p.tokens[p.pos]
+		switch t.kind {
+		case closeToken:
+			end()
+			return stmts, nil
+		case sepToken:
+			p.pos++
+			end()
+		case wordToken:
+			p.pos++
+			if cur == nil {
+				cur = &stmt{line: t.line}
+			}
+			cur.words = append(cur.words, t.word)
+		case openToken:
+			p.pos++
+			if cur == nil {
+				return nil, fmt.Errorf("line %v: block without a command", t.line)
+			}
+			body, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			if p.pos == len(p.tokens) {
+				return nil, errIncomplete
+			}
+			p.pos++
+			cur.hasBody, cur.body = true, body
+			end()
+		}
+	}
+	end()
+	return stmts, nil
+}
+
+// builtin is a shell command. It returns the output of the command, if any.
+type builtin struct {
+	usage    string
+	help     string
+	min, max int // number of arguments, max < 0 for no limit
+	block    bool
+	run      func(sh *shell, args []string, body []stmt) (string, error)
+}
+
+// builtins is filled by the init funcs, as help refers back to it.
+var builtins = make(map[string]*builtin)
+
+// exitError stops the shell with the given status.
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit %v", int(e))
+}
+
+type shell struct {
+	out  io.Writer
+	vars map[string]string
+
+	hw hardware
+}
+
+func newShell(out io.Writer) *shell {
+	return &shell{out: out, vars: make(map[string]string)}
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func (sh *shell) lookup(name string) (string, error) {
+	v, ok := sh.vars[name]
+	if !ok {
+		return "", fmt.Errorf("undefined variable %v", name)
+	}
+	return v, nil
+}
+
+func (sh *shell) expand(w word) (string, error) {
+	var b strings.Builder
+	for _, p := range w {
+		if !p.expand {
+			b.WriteString(p.text)
+			continue
+		}
+		s := p.text
+		for i := 0; i < len(s); i++ {
+			if s[i] != '$' || i+1 == len(s) {
+				b.WriteByte(s[i])
+				continue
+			}
+			var name string
+			if s[i+1] == '{' {
+				end := strings.IndexByte(s[i:], '}')
+				if end < 0 {
+					return "", fmt.Errorf("missing } in %q", s)
+				}
+				name, i = s[i+2:i+end], i+end
+			} else {
+				j := i + 1
+				for j < len(s) && isNameChar(s[j]) {
+					j++
+				}
+				if j == i+1 {
+					b.WriteByte('$')
+					continue
+				}
+				name, i = s[i+1:j], j-1
+			}
+			v, err := sh.lookup(name)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+		}
+	}
+	return b.String(), nil
+}
+
+// run executes the statements, stopping at the first error.
+func (sh *shell) run(stmts []stmt) error {
+	for _, s := range stmts {
+		if err := sh.exec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lineError reports the line of the statement which failed. Errors of
+// nested statements are not wrapped again.
+type lineError struct {
+	line int
+	err  error
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %v: %v", e.line, e.err)
+}
+
+func (sh *shell) exec(s stmt) error {
+	args := make([]string, len(s.words))
+	for i, w := range s.words {
+		a, err := sh.expand(w)
+		if err != nil {
+			return &lineError{s.line, err}
+		}
+		args[i] = a
+	}
+	b, ok := builtins[args[0]]
+	if !ok {
+		return &lineError{s.line, fmt.Errorf("unknown command %q, try help", args[0])}
+	}
+	n := len(args) - 1
+	if n < b.min || b.max >= 0 && n > b.max || b.block != s.hasBody {
+		return &lineError{s.line, fmt.Errorf("usage: %v", b.usage)}
+	}
+	out, err := b.run(sh, args[1:], s.body)
+	switch err.(type) {
+	case nil:
+	case *lineError, exitError:
+		return err
+	default:
+		return &lineError{s.line, err}
+	}
+	if out != "" {
+		fmt.Fprintln(sh.out, out)
+		sh.vars["_"] = out
+	}
+	return nil
+}
+
+// compare evaluates a op b, numerically when both are numbers.
+func compare(a, op, b string) (bool, error) {
+	x, errx := parseNumber(a)
+	y, erry := parseNumber(b)
+	numeric := errx == nil && erry == nil
+	var c int
+	switch {
+	case numeric && x < y, !numeric && a < b:
+		c = -1
+	case numeric && x > y, !numeric && a > b:
+		c = 1
+	}
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("invalid operator %q", op)
+}
+
+func parseNumber(s string) (float64, error) {
+	if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return float64(n), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func init() {
+	builtins["echo"] = &builtin{
+		usage: "echo [word...]",
+		help:  "print the words",
+		max:   -1,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			return strings.Join(args, " "), nil
+		},
+	}
+	builtins["set"] = &builtin{
+		usage: "set <var> [word...]",
+		help:  "set a variable to the words",
+		min:   1, max: -1,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			for i := 0; i < len(args[0]); i++ {
+				if !isNameChar(args[0][i]) {
+					return "", fmt.Errorf("invalid variable name %q", args[0])
+				}
+			}
+			sh.vars[args[0]] = strings.Join(args[1:], " ")
+			return "", nil
+		},
+	}
+	builtins["sleep"] = &builtin{
+		usage: "sleep <duration>",
+		help:  "wait, e.g. for 100ms",
+		min:   1, max: 1,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			d, err := time.ParseDuration(args[0])
+			if err != nil {
+				return "", err
+			}
+			time.Sleep(d)
+			return "", nil
+		},
+	}
+	builtins["expect"] = &builtin{
+		usage: "expect <a> <op> <b> [message...]",
+		help:  "fail unless the comparison holds (==, !=, <, <=, >, >=)",
+		min:   3, max: -1,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			ok, err := compare(args[0], args[1], args[2])
+			if err != nil || ok {
+				return "", err
+			}
+			if len(args) > 3 {
+				return "", fmt.Errorf("expectation failed: %v (%v %v %v)", strings.Join(args[3:], " "), args[0], args[1], args[2])
+			}
+			return "", fmt.Errorf("expectation failed: %v %v %v", args[0], args[1], args[2])
+		},
+	}
+	builtins["if"] = &builtin{
+		usage: "if <a> <op> <b> { ... }",
+		help:  "run the block when the comparison holds",
+		min:   3, max: 3,
+		block: true,
+		run: func(sh *shell, args []string, body []stmt) (string, error) {
+			ok, err := compare(args[0], args[1], args[2])
+			if err != nil || !ok {
+				return "", err
+			}
+			return "", sh.run(body)
+		},
+	}
+	builtins["repeat"] = &builtin{
+		usage: "repeat <n> [var] { ... }",
+		help:  "run the block n times, counting from 1 in var (i by default)",
+		min:   1, max: 2,
+		block: true,
+		run: func(sh *shell, args []string, body []stmt) (string, error) {
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				return "", fmt.Errorf("invalid count %q", args[0])
+			}
+			name := "i"
+			if len(args) == 2 {
+				name = args[1]
+			}
+			for i := 1; i <= n; i++ {
+				sh.vars[name] = strconv.Itoa(i)
+				if err := sh.run(body); err != nil {
+					return "", err
+				}
+			}
+			return "", nil
+		},
+	}
+	builtins["for"] = &builtin{
+		usage: "for <var> in <word...> { ... }",
+		help:  "run the block for each of the space separated words",
+		min:   2, max: -1,
+		block: true,
+		run: func(sh *shell, args []string, body []stmt) (string, error) {
+			if args[1] != "in" {
+				return "", fmt.Errorf("usage: %v", builtins["for"].usage)
+			}
+			for _, a := range args[2:] {
+				for _, v := range strings.Fields(a) {
+					sh.vars[args[0]] = v
+					if err := sh.run(body); err != nil {
+						return "", err
+					}
+				}
+			}
+			return "", nil
+		},
+	}
+	builtins["exit"] = &builtin{
+		usage: "exit [status]",
+		help:  "leave the shell",
+		max:   1,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			code := 0
+			if len(args) == 1 {
+				n, err := strconv.Atoi(args[0])
+				if err != nil {
+					return "", fmt.Errorf("invalid status %q", args[0])
+				}
+				code = n
+			}
+			return "", exitError(code)
+		},
+	}
+	builtins["help"] = &builtin{
+		usage: "help",
+		help:  "list the commands",
+		run: func(sh *shell, _ []string, _ []stmt) (string, error) {
+			names := make([]string, 0, len(builtins))
+			for name := range builtins {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				b := builtins[name]
+				fmt.Fprintf(sh.out, "%-36v %v\n", b.usage, b.help)
+			}
+			return "", nil
+		},
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	var tests = []struct {
+		src, out, err string
+	}{
+		{"echo a b; echo c", "a b\nc\n", ""},
+		{"set x 5 # comment\necho x=$x ${x}0 '$x'", "x=5 50 $x\n", ""},
+		{"echo \"a  b\"", "a  b\n", ""},
+		{"echo a; echo $_", "a\na\n", ""},
+		{"repeat 3 { echo $i }", "1\n2\n3\n", ""},
+		{"repeat 2 n {\n\techo $n\n}", "1\n2\n", ""},
+		{"set l \"17 27\"; for p in $l 22 { echo $p }", "17\n27\n22\n", ""},
+		{"if 0x10 == 16 { echo yes }; if a > b { echo no }", "yes\n", ""},
+		{"expect 2 >= 1.5; echo ok", "ok\n", ""},
+		{"echo a\nexpect 1 == 2 reset line", "a\n", "line 2: expectation failed: reset line (1 == 2)"},
+		{"repeat 2 {\n\tbogus\n}", "", "line 2: unknown command \"bogus\", try help"},
+		{"echo $nope", "", "line 1: undefined variable nope"},
+		{"repeat { echo }", "", "line 1: usage: repeat <n> [var] { ... }"},
+		{"echo {", "", "missing }"},
+		{"echo }", "", "line 1: unexpected }"},
+		{"echo 'a", "", "line 1: unterminated '"},
+		{"echo a; exit 3; echo b", "a\n", "exit 3"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		sh := newShell(&out)
+		stmts, err := parse(test.src)
+		if err == nil {
+			err = sh.run(stmts)
+		}
+		if got := out.String(); got != test.out {
+			t.Errorf("%q: got output %q, want %q", test.src, got, test.out)
+		}
+		if (err == nil) != (test.err == "") || err != nil && err.Error() != test.err {
+			t.Errorf("%q: got error %v, want %q", test.src, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+	_ "github.com/kidoman/embd/sensor/all"
+)
+
+// quantity is one of the values sampled from a sensor.
+type quantity struct {
+	Name  string
+	Unit  string
+	Class string // Home Assistant device class, if any
+}
+
+// sensorDevice wraps a sensor behind a common sampling func, which returns a
+// value for each quantity.
+type sensorDevice struct {
+	Quantities []quantity
+	Sample     func() ([]float64, error)
+	Close      func() error
+}
+
+// sensorConfig tells openSensor how the sensor is wired. The sensors
+// without pins are on the spi bus returned by SPI if set, else on the i2c
+// bus returned by Bus.
+type sensorConfig struct {
+	Bus  func() embd.I2CBus
+	SPI  func() embd.SPIBus
+	Addr byte // 0 for the default address of the driver
+
+	Pin, Echo, Trigger string
+	Options            map[string]string
+}
+
+func components(v sensor.Vector) []float64 {
+	return []float64{v.X, v.Y, v.Z}
+}
+
+func vector(v sensor.Vector, err error) ([]float64, error) {
+	return components(v), err
+}
+
+func scalar(v float64, err error) ([]float64, error) {
+	return []float64{v}, err
+}
+
+func axes(prefix, unit string) []quantity {
+	return []quantity{{prefix + "_x", unit, ""}, {prefix + "_y", unit, ""}, {prefix + "_z", unit, ""}}
+}
+
+// reading reads some quantities of a sensor through their interface, or
+// takes them from a measurement of all the quantities.
+type reading struct {
+	get  func(sensor.Quantities) []float64
+	read func() ([]float64, error)
+}
+
+// quantities lists what the sensor measures, from the quantity interfaces
+// it implements.
+func quantities(d sensor.Device) ([]quantity, []reading) {
+	var qs []quantity
+	var reads []reading
+	add := func(q []quantity, get func(sensor.Quantities) []float64, read func() ([]float64, error)) {
+		qs = append(qs, q...)
+		reads = append(reads, reading{get, read})
+	}
+	if s, ok := d.(sensor.Thermometer); ok {
+		add([]quantity{{"temperature", "°C", "temperature"}},
+			func(q sensor.Quantities) []float64 { return []float64{q.Temperature} },
+			func() ([]float64, error) { return scalar(s.Temperature()) })
+	}
+	if s, ok := d.(sensor.Barometer); ok {
+		add([]quantity{{"pressure", "Pa", "pressure"}},
+			func(q sensor.Quantities) []float64 { return []float64{q.Pressure} },
+			func() ([]float64, error) { return scalar(s.Pressure()) })
+	}
+	if s, ok := d.(sensor.Hygrometer); ok {
+		add([]quantity{{"humidity", "%", "humidity"}},
+			func(q sensor.Quantities) []float64 { return []float64{q.Humidity} },
+			func() ([]float64, error) { return scalar(s.Humidity()) })
+	}
+	if s, ok := d.(interface {
+		DewPoint() (float64, error)
+	}); ok {
+		add([]quantity{{"dew_point", "°C", "temperature"}},
+			func(q sensor.Quantities) []float64 { return []float64{q.DewPoint} },
+			func() ([]float64, error) { return scalar(s.DewPoint()) })
+	}
+	if s, ok := d.(sensor.Luxmeter); ok {
+		add([]quantity{{"illuminance", "lx", "illuminance"}},
+			func(q sensor.Quantities) []float64 { return []float64{q.Illuminance} },
+			func() ([]float64, error) { return scalar(s.Illuminance()) })
+	}
+	if s, ok := d.(sensor.Gyroscope); ok {
+		add(axes("gyro", "rad/s"),
+			func(q sensor.Quantities) []float64 { return components(q.AngularVelocity) },
+			func() ([]float64, error) { return vector(s.AngularVelocity()) })
+	}
+	if s, ok := d.(sensor.Accelerometer); ok {
+		add(axes("accel", "m/s²"),
+			func(q sensor.Quantities) []float64 { return components(q.Acceleration) },
+			func() ([]float64, error) { return vector(s.Acceleration()) })
+	}
+	if s, ok := d.(sensor.Magnetometer); ok {
+		add(axes("mag", "T"),
+			func(q sensor.Quantities) []float64 { return components(q.MagneticField) },
+			func() ([]float64, error) { return vector(s.MagneticField()) })
+	}
+	if s, ok := d.(sensor.RangeFinder); ok {
+		add([]quantity{{"distance", "m", "distance"}},
+			func(q sensor.Quantities) []float64 { return []float64{q.Range} },
+			func() ([]float64, error) { return scalar(s.Range()) })
+	}
+	if s, ok := d.(interface {
+		IsWet() (bool, error)
+	}); ok {
+		add([]quantity{{"wet", "", "moisture"}}, nil, func() ([]float64, error) {
+			wet, err := s.IsWet()
+			if wet {
+				return []float64{1}, err
+			}
+			return []float64{0}, err
+		})
+	}
+	return qs, reads
+}
+
+// measured returns the values of the reading in the measurement q, if it
+// holds them. A NaN is a quantity the measurement skipped, which the
+// quantity interface reports the reason of.
+func (r reading) measured(q *sensor.Quantities) ([]float64, bool) {
+	if q == nil || r.get == nil {
+		return nil, false
+	}
+	values := r.get(*q)
+	for _, v := range values {
+		if math.IsNaN(v) {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+func openSensor(driver string, cfg sensorConfig) (*sensorDevice, error) {
+	c := sensor.Config{Addr: cfg.Addr, Options: cfg.Options, Pins: make(map[string]embd.DigitalPin)}
+	for role, key := range map[string]string{"data": cfg.Pin, "echo": cfg.Echo, "trigger": cfg.Trigger} {
+		if key == "" {
+			continue
+		}
+		if err := embd.InitGPIO(); err != nil {
+			return nil, err
+		}
+		pin, err := embd.NewDigitalPin(key)
+		if err != nil {
+			return nil, err
+		}
+		c.Pins[role] = pin
+	}
+	switch {
+	case len(c.Pins) > 0:
+	case cfg.SPI != nil:
+		c.SPI = cfg.SPI()
+	default:
+		c.Bus = cfg.Bus()
+	}
+
+	d, err := sensor.New(driver, c)
+	if err != nil {
+		return nil, err
+	}
+	qs, reads := quantities(d)
+	if len(qs) == 0 {
+		d.Close()
+		return nil, fmt.Errorf("%v measures no known quantity", driver)
+	}
+	// The quantities are taken from a single measurement when the driver
+	// can make one, for them to be consistent and read once.
+	measurer, _ := d.(sensor.Measurer)
+	return &sensorDevice{
+		Quantities: qs,
+		Sample: func() ([]float64, error) {
+			var m *sensor.Quantities
+			if measurer != nil {
+				q, err := measurer.MeasureQuantities()
+				if err != nil {
+					return nil, err
+				}
+				m = &q
+			}
+			var values []float64
+			for _, r := range reads {
+				v, ok := r.measured(m)
+				if !ok {
+					var err error
+					if v, err = r.read(); err != nil {
+						return nil, err
+					}
+				}
+				values = append(values, v...)
+			}
+			return values, nil
+		},
+		Close: d.Close,
+	}, nil
+}
+
+// parseSensorSpec parses a "driver[@addr][=name]" flag value. The name
+// defaults to the driver and the address to 0.
+func parseSensorSpec(spec string) (driver string, addr byte, name string, err error) {
+	driver = spec
+	if i := strings.Index(spec, "="); i >= 0 {
+		driver, name = spec[:i], spec[i+1:]
+	}
+	if i := strings.Index(driver, "@"); i >= 0 {
+		n, err := strconv.ParseUint(driver[i+1:], 0, 8)
+		if err != nil {
+			return "", 0, "", fmt.Errorf("invalid address in %q", spec)
+		}
+		driver, addr = driver[:i], byte(n)
+	}
+	if name == "" {
+		name = driver
+	}
+	return driver, addr, name, nil
+}
+
+type sensorValue struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+}
+
+type sensorSample struct {
+	Sensor string        `json:"sensor"`
+	Time   time.Time     `json:"time"`
+	Values []sensorValue `json:"values"`
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+func printSample(s sensorSample, asJSON, watch bool) {
+	if asJSON {
+		printJSON(s)
+		return
+	}
+	if !watch {
+		for _, v := range s.Values {
+			fmt.Printf("%v: %v %v\n", v.Name, formatValue(v.Value), v.Unit)
+		}
+		return
+	}
+	fmt.Print(s.Time.Format(time.RFC3339Nano))
+	for _, v := range s.Values {
+		fmt.Printf(" %v=%v%v", v.Name, formatValue(v.Value), v.Unit)
+	}
+	fmt.Println()
+}
+
+func sample(driver string, d *sensorDevice) (sensorSample, error) {
+	values, err := d.Sample()
+	if err != nil {
+		return sensorSample{}, err
+	}
+	s := sensorSample{Sensor: driver, Time: time.Now()}
+	for i, q := range d.Quantities {
+		s.Values = append(s.Values, sensorValue{Name: q.Name, Value: values[i], Unit: q.Unit})
+	}
+	return s, nil
+}
+
+func readSensor(c *cli.Context) {
+	checkArgs(c, 1)
+	driver := c.Args().First()
+
+	cfg := sensorConfig{
+		Bus: func() embd.I2CBus {
+			return i2cBus(c.String("bus"))
+		},
+		Pin:     c.String("pin"),
+		Echo:    c.String("echo"),
+		Trigger: c.String("trigger"),
+		Options: make(map[string]string),
+	}
+	for _, o := range c.StringSlice("option") {
+		i := strings.Index(o, "=")
+		if i < 0 {
+			die(fmt.Errorf("invalid option %q, expected key=value", o))
+		}
+		cfg.Options[o[:i]] = o[i+1:]
+	}
+	if c.IsSet("spi") {
+		channel, err := parseByte(c.String("spi"))
+		if err != nil {
+			die(err)
+		}
+		cfg.SPI = func() embd.SPIBus {
+			if err := embd.InitSPI(); err != nil {
+				die(err)
+			}
+			return embd.NewSPIBus(embd.SPIMode0, channel, 1000000, 8, 0)
+		}
+	}
+	if c.IsSet("addr") {
+		addr, err := parseByte(c.String("addr"))
+		if err != nil {
+			die(err)
+		}
+		cfg.Addr = addr
+	}
+	d, err := openSensor(driver, cfg)
+	if err != nil {
+		die(err)
+	}
+	defer d.Close()
+
+	asJSON, watch := c.Bool("json"), c.Bool("watch")
+	if !watch {
+		s, err := sample(driver, d)
+		if err != nil {
+			d.Close()
+			die(err)
+		}
+		printSample(s, asJSON, false)
+		return
+	}
+
+	interval := c.Duration("interval")
+	if interval <= 0 {
+		d.Close()
+		die(fmt.Errorf("invalid interval %v", interval))
+	}
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if s, err := sample(driver, d); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			printSample(s, asJSON, true)
+		}
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+var sensorCmd = cli.Command{
+	Name:      "sensor",
+	Usage:     "read a sensor once or continuously",
+	ArgsUsage: "<" + strings.Join(sensor.Drivers(), "|") + ">",
+	Action:    readSensor,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "bus", Value: "1", Usage: "i2c bus of the sensor"},
+		cli.StringFlag{Name: "addr", Usage: "i2c address, for the sensors which have several"},
+		cli.StringFlag{Name: "spi", Usage: "spi channel, for the sensors wired to spi rather than i2c"},
+		cli.StringFlag{Name: "pin", Usage: "data pin of a dht11, dht22 or watersensor"},
+		cli.StringFlag{Name: "echo", Usage: "echo pin of an us020"},
+		cli.StringFlag{Name: "trigger", Usage: "trigger pin of an us020"},
+		cli.StringSliceFlag{Name: "option", Value: &cli.StringSlice{}, Usage: "driver setting as key=value, e.g. mode=H2 for a bh1750fvi, oversampling=8 for a bmp180 or range=2000 for a l3gd20"},
+		cli.BoolFlag{Name: "watch", Usage: "keep sampling until interrupted"},
+		cli.DurationFlag{Name: "interval", Value: time.Second, Usage: "sampling interval with --watch"},
+		jsonFlag,
+	},
+}
+
+func init() {
+	registerCommand(sensorCmd)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+type luxBus struct {
+	embd.I2CBus
+}
+
+func (luxBus) WriteByte(addr, value byte) error { return nil }
+
+func (luxBus) ReadWordFromReg(addr, reg byte) (uint16, error) { return 2400, nil }
+
+func TestOpenSensor(t *testing.T) {
+	bus := func() embd.I2CBus { return luxBus{} }
+	var tests = []struct {
+		driver string
+		cfg    sensorConfig
+	}{
+		{"bme680", sensorConfig{Bus: bus}},
+		{"bmp180", sensorConfig{Bus: bus, Addr: 0x76}},
+		{"bh1750fvi", sensorConfig{Bus: bus, Options: map[string]string{"mode": "low"}}},
+		{"watersensor", sensorConfig{Bus: bus}},
+	}
+	for _, test := range tests {
+		if _, err := openSensor(test.driver, test.cfg); err == nil {
+			t.Errorf("%v %+v: expected an error", test.driver, test.cfg)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	d, err := openSensor("bh1750fvi", sensorConfig{Bus: func() embd.I2CBus { return luxBus{} }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := sample("bh1750fvi", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Values) != 1 {
+		t.Fatalf("got %v values, want 1", len(s.Values))
+	}
+	if v := s.Values[0]; v.Name != "illuminance" || v.Unit != "lx" || v.Value != 2000 {
+		t.Errorf("got %+v", v)
+	}
+	if got := formatValue(1.0 / 3); got != "0.333" {
+		t.Errorf("formatValue: got %v", got)
+	}
+}
+
+// measurer takes all its quantities at once, and counts the accesses to the
+// sensor.
+type measurer struct {
+	measures, reads int
+	noHumidity      bool
+}
+
+func (d *measurer) MeasureQuantities() (sensor.Quantities, error) {
+	d.measures++
+	q := sensor.NoQuantities()
+	q.Temperature, q.Acceleration = 21.5, sensor.Vector{X: 1, Y: 2, Z: 3}
+	if !d.noHumidity {
+		q.Humidity = 40
+	}
+	return q, nil
+}
+
+func (d *measurer) Temperature() (float64, error) { d.reads++; return 0, nil }
+
+func (d *measurer) Humidity() (float64, error) {
+	d.reads++
+	return 0, errors.New("humidity skipped")
+}
+
+func (d *measurer) Acceleration() (sensor.Vector, error) { d.reads++; return sensor.Vector{}, nil }
+
+func (d *measurer) Close() error { return nil }
+
+// testMeasurer is registered once, the registry being global to the tests.
+var testMeasurer = &measurer{}
+
+func init() {
+	sensor.Register("measurer", func(sensor.Config) (sensor.Device, error) { return testMeasurer, nil })
+}
+
+func TestSampleMeasure(t *testing.T) {
+	m := testMeasurer
+	*m = measurer{}
+	d, err := openSensor("measurer", sensorConfig{Bus: func() embd.I2CBus { return nil }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := d.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{21.5, 40, 1, 2, 3}; !reflect.DeepEqual(values, want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+	if m.measures != 1 || m.reads != 0 {
+		t.Errorf("got %v measures and %v reads, want a single measure", m.measures, m.reads)
+	}
+
+	// A skipped quantity is read through its interface, which tells why.
+	m.noHumidity = true
+	if _, err := d.Sample(); err == nil || err.Error() != "humidity skipped" {
+		t.Errorf("got %v, want the error of the humidity", err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd/server"
+)
+
+// splitList splits a comma separated flag value. An empty value means no
+// restriction (nil) and "none" an empty list.
+func splitList(s string) []string {
+	switch s {
+	case "":
+		return nil
+	case "none":
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+func splitByteList(s string) ([]byte, error) {
+	list := splitList(s)
+	if list == nil {
+		return nil, nil
+	}
+	return parseBytes(list)
+}
+
+func serve(c *cli.Context) {
+	cfg := server.Config{
+		Pins:             splitList(c.String("pins")),
+		LEDs:             splitList(c.String("leds")),
+		ReadOnly:         c.Bool("read-only"),
+		Token:            c.String("token"),
+		SnapshotInterval: c.Duration("interval"),
+	}
+	var err error
+	if cfg.I2CBuses, err = splitByteList(c.String("i2c")); err != nil {
+		die(err)
+	}
+	if cfg.SPIChannels, err = splitByteList(c.String("spi")); err != nil {
+		die(err)
+	}
+
+	s, err := server.New(cfg)
+	if err != nil {
+		die(err)
+	}
+
+	addr := c.String("addr")
+	fmt.Printf("serving on http://%v/api\n", addr)
+	if err := http.ListenAndServe(addr, s); err != nil {
+		die(err)
+	}
+}
+
+var serveCmd = cli.Command{
+	Name:   "serve",
+	Usage:  "expose the pins, leds and buses of the host over http",
+	Action: serve,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "addr", Value: "localhost:8080", Usage: "address to listen on"},
+		cli.StringFlag{Name: "pins", Usage: "comma separated pins which may be accessed (default all, none for none)"},
+		cli.StringFlag{Name: "leds", Usage: "comma separated leds which may be accessed (default all, none for none)"},
+		cli.StringFlag{Name: "i2c", Usage: "comma separated i2c buses which may be accessed (default all, none for none)"},
+		cli.StringFlag{Name: "spi", Usage: "comma separated spi channels which may be accessed (default all, none for none)"},
+		cli.BoolFlag{Name: "read-only", Usage: "only allow requests which do not change the state of the host"},
+		cli.StringFlag{Name: "token", Usage: "token clients must present", EnvVar: "EMBD_TOKEN"},
+		cli.DurationFlag{Name: "interval", Value: time.Second, Usage: "default interval between two stream snapshots"},
+	},
+}
+
+func init() {
+	registerCommand(serveCmd)
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+	"golang.org/x/term"
+)
+
+// hardware keeps track of what the shell opened, so that pins and buses
+// stay open across commands and are released on exit.
+type hardware struct {
+	gpio, i2c, spi, led bool
+
+	spiBuses map[byte]embd.SPIBus
+}
+
+func (h *hardware) initGPIO() error {
+	if err := embd.InitGPIO(); err != nil {
+		return err
+	}
+	h.gpio = true
+	return nil
+}
+
+func (h *hardware) digitalPin(key string) (embd.DigitalPin, error) {
+	if err := h.initGPIO(); err != nil {
+		return nil, err
+	}
+	return embd.NewDigitalPin(key)
+}
+
+func (h *hardware) i2cBus(s string) (embd.I2CBus, error) {
+	l, err := parseByte(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := embd.InitI2C(); err != nil {
+		return nil, err
+	}
+	h.i2c = true
+	return embd.NewI2CBus(l), nil
+}
+
+func (h *hardware) openSPI(channel byte, mode byte, speed, bpw int) error {
+	if err := embd.InitSPI(); err != nil {
+		return err
+	}
+	h.spi = true
+	if h.spiBuses == nil {
+		h.spiBuses = make(map[byte]embd.SPIBus)
+	}
+	if bus, ok := h.spiBuses[channel]; ok {
+		bus.Close()
+	}
+	h.spiBuses[channel] = embd.NewSPIBus(mode, channel, speed, bpw, 0)
+	return nil
+}
+
+// spiBus returns the bus of the channel, opened in mode 0 at 1 MHz unless
+// spi open said otherwise.
+func (h *hardware) spiBus(channel byte) (embd.SPIBus, error) {
+	if bus, ok := h.spiBuses[channel]; ok {
+		return bus, nil
+	}
+	if err := h.openSPI(channel, embd.SPIMode0, 1000000, 8); err != nil {
+		return nil, err
+	}
+	return h.spiBuses[channel], nil
+}
+
+func (h *hardware) close() {
+	for _, bus := range h.spiBuses {
+		bus.Close()
+	}
+	if h.spi {
+		embd.CloseSPI()
+	}
+	if h.i2c {
+		embd.CloseI2C()
+	}
+	if h.led {
+		embd.CloseLED()
+	}
+	if h.gpio {
+		embd.CloseGPIO()
+	}
+}
+
+func formatBytes(data []byte) string {
+	s := make([]string, len(data))
+	for i, b := range data {
+		s[i] = fmt.Sprintf("0x%02x", b)
+	}
+	return strings.Join(s, " ")
+}
+
+func init() {
+	builtins["pin"] = &builtin{
+		usage: "pin <pin> in|out",
+		help:  "set the direction of a pin",
+		min:   2, max: 2,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			var dir embd.Direction
+			switch args[1] {
+			case "in":
+				dir = embd.In
+			case "out":
+				dir = embd.Out
+			default:
+				return "", fmt.Errorf("invalid direction %q", args[1])
+			}
+			pin, err := sh.hw.digitalPin(args[0])
+			if err != nil {
+				return "", err
+			}
+			return "", pin.SetDirection(dir)
+		},
+	}
+	builtins["read"] = &builtin{
+		usage: "read <pin>",
+		help:  "read the level of a pin",
+		min:   1, max: 1,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			pin, err := sh.hw.digitalPin(args[0])
+			if err != nil {
+				return "", err
+			}
+			v, err := pin.Read()
+			if err != nil {
+				return "", err
+			}
+			return strconv.Itoa(v), nil
+		},
+	}
+	builtins["write"] = &builtin{
+		usage: "write <pin> 0|1",
+		help:  "drive a pin low or high",
+		min:   2, max: 2,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			v, err := parseLevel(args[1])
+			if err != nil {
+				return "", err
+			}
+			pin, err := sh.hw.digitalPin(args[0])
+			if err != nil {
+				return "", err
+			}
+			return "", pin.Write(v)
+		},
+	}
+	builtins["activelow"] = &builtin{
+		usage: "activelow <pin> on|off",
+		help:  "invert the logic of a pin",
+		min:   2, max: 2,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			if args[1] != "on" && args[1] != "off" {
+				return "", fmt.Errorf("invalid setting %q", args[1])
+			}
+			pin, err := sh.hw.digitalPin(args[0])
+			if err != nil {
+				return "", err
+			}
+			return "", pin.ActiveLow(args[1] == "on")
+		},
+	}
+	builtins["analog"] = &builtin{
+		usage: "analog <pin>",
+		help:  "read an analog input",
+		min:   1, max: 1,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			if err := sh.hw.initGPIO(); err != nil {
+				return "", err
+			}
+			pin, err := embd.NewAnalogPin(args[0])
+			if err != nil {
+				return "", err
+			}
+			v, err := pin.Read()
+			if err != nil {
+				return "", err
+			}
+			return strconv.Itoa(v), nil
+		},
+	}
+	builtins["pwm"] = &builtin{
+		usage: "pwm <pin> period|duty|us|polarity <value>",
+		help:  "configure a pwm output, times in ns",
+		min:   3, max: 3,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			if err := sh.hw.initGPIO(); err != nil {
+				return "", err
+			}
+			pin, err := embd.NewPWMPin(args[0])
+			if err != nil {
+				return "", err
+			}
+			if args[1] == "polarity" {
+				pol, err := parsePolarity(args[2])
+				if err != nil {
+					return "", err
+				}
+				return "", pin.SetPolarity(pol)
+			}
+			n, err := strconv.Atoi(args[2])
+			if err != nil {
+				return "", fmt.Errorf("invalid value %q", args[2])
+			}
+			switch args[1] {
+			case "period":
+				return "", pin.SetPeriod(n)
+			case "duty":
+				return "", pin.SetDuty(n)
+			case "us":
+				return "", pin.SetMicroseconds(n)
+			}
+			return "", fmt.Errorf("invalid setting %q", args[1])
+		},
+	}
+	builtins["led"] = &builtin{
+		usage: "led <led> on|off|toggle",
+		help:  "control a led",
+		min:   2, max: 2,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			if err := embd.InitLED(); err != nil {
+				return "", err
+			}
+			sh.hw.led = true
+			l, err := embd.NewLED(args[0])
+			if err != nil {
+				return "", err
+			}
+			switch args[1] {
+			case "on":
+				return "", l.On()
+			case "off":
+				return "", l.Off()
+			case "toggle":
+				return "", l.Toggle()
+			}
+			return "", fmt.Errorf("invalid action %q", args[1])
+		},
+	}
+	builtins["i2c"] = &builtin{
+		usage: "i2c read|write <bus> <addr> <reg> [n|byte...]",
+		help:  "read n bytes (1 by default) from or write bytes to registers",
+		min:   4, max: -1,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			addrReg, err := parseBytes(args[2:4])
+			if err != nil {
+				return "", err
+			}
+			switch args[0] {
+			case "read":
+				n := 1
+				if len(args) > 5 {
+					return "", fmt.Errorf("usage: %v", builtins["i2c"].usage)
+				}
+				if len(args) == 5 {
+					if n, err = strconv.Atoi(args[4]); err != nil || n < 1 {
+						return "", fmt.Errorf("invalid length %q", args[4])
+					}
+				}
+				bus, err := sh.hw.i2cBus(args[1])
+				if err != nil {
+					return "", err
+				}
+				data := make([]byte, n)
+				if err := bus.ReadFromReg(addrReg[0], addrReg[1], data); err != nil {
+					return "", err
+				}
+				return formatBytes(data), nil
+			case "write":
+				data, err := parseBytes(args[4:])
+				if err != nil {
+					return "", err
+				}
+				if len(data) == 0 {
+					return "", fmt.Errorf("usage: %v", builtins["i2c"].usage)
+				}
+				bus, err := sh.hw.i2cBus(args[1])
+				if err != nil {
+					return "", err
+				}
+				return "", bus.WriteToReg(addrReg[0], addrReg[1], data)
+			}
+			return "", fmt.Errorf("usage: %v", builtins["i2c"].usage)
+		},
+	}
+	builtins["spi"] = &builtin{
+		usage: "spi open <ch> <mode> <speed> <bpw> | spi xfer <ch> <hex...>",
+		help:  "configure a spi channel or transfer a hex payload",
+		min:   2, max: -1,
+		run: func(sh *shell, args []string, _ []stmt) (string, error) {
+			channel, err := parseByte(args[1])
+			if err != nil {
+				return "", err
+			}
+			switch {
+			case args[0] == "open" && len(args) == 5:
+				var n [3]int
+				for i, a := range args[2:] {
+					if n[i], err = strconv.Atoi(a); err != nil {
+						return "", fmt.Errorf("invalid number %q", a)
+					}
+				}
+				if n[0] < int(embd.SPIMode0) || n[0] > int(embd.SPIMode3) {
+					return "", fmt.Errorf("invalid spi mode %v", n[0])
+				}
+				return "", sh.hw.openSPI(channel, byte(n[0]), n[1], n[2])
+			case args[0] == "xfer" && len(args) > 2:
+				data, err := parseHex(args[2:])
+				if err != nil {
+					return "", err
+				}
+				bus, err := sh.hw.spiBus(channel)
+				if err != nil {
+					return "", err
+				}
+				if err := bus.TransferAndReceiveData(data); err != nil {
+					return "", err
+				}
+				return formatBytes(data), nil
+			}
+			return "", fmt.Errorf("usage: %v", builtins["spi"].usage)
+		},
+	}
+}
+
+// completeLine completes the word before pos, with the names of the
+// commands at the start of a statement and the other words elsewhere. Only
+// the common prefix of several candidates is inserted.
+func completeLine(line string, pos int, commands, others []string) (string, int, bool) {
+	start := strings.LastIndexAny(line[:pos], " \t;{}") + 1
+	prefix := line[start:pos]
+	candidates := others
+	before := strings.TrimRight(line[:start], " \t")
+	if before == "" || strings.ContainsAny(before[len(before)-1:], ";{}") {
+		candidates = commands
+	}
+
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 {
+		common += " "
+	}
+	if common == prefix {
+		return "", 0, false
+	}
+	return line[:start] + common + line[pos:], start + len(common), true
+}
+
+// completionWords returns the command names, and the pin names and keywords
+// completed in the arguments.
+func completionWords() (commands, others []string) {
+	for name := range builtins {
+		commands = append(commands, name)
+	}
+	sort.Strings(commands)
+
+	seen := make(map[string]bool)
+	add := func(w string) {
+		if w != "" && !seen[w] {
+			seen[w] = true
+			others = append(others, w)
+		}
+	}
+	if pins, err := hostPinMap(); err == nil {
+		for _, pd := range pins {
+			add(pd.ID)
+			for _, a := range pd.Aliases {
+				add(strings.TrimSpace(a))
+			}
+		}
+	}
+	for _, w := range []string{"in", "out", "on", "off", "toggle", "read", "write", "open", "xfer", "period", "duty", "us", "polarity", "positive", "negative"} {
+		add(w)
+	}
+	sort.Strings(others)
+	return commands, others
+}
+
+// interactive reads statements from the terminal until exit or end of
+// input. Statements with an open block are continued on the next lines.
+func interactive(sh *shell) int {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		die(err)
+	}
+	defer term.Restore(fd, state)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "embd> ")
+	sh.out = t
+
+	var commands, others []string
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		if commands == nil {
+			commands, others = completionWords()
+		}
+		return completeLine(line, pos, commands, others)
+	}
+
+	var src string
+	for {
+		line, err := t.ReadLine()
+		if err != nil {
+			return 0
+		}
+		src += line + "\n"
+		stmts, err := parse(src)
+		if err == errIncomplete {
+			t.SetPrompt("...> ")
+			continue
+		}
+		src = ""
+		t.SetPrompt("embd> ")
+		if err == nil {
+			err = sh.run(stmts)
+		}
+		if code, ok := err.(exitError); ok {
+			return int(code)
+		}
+		if err != nil {
+			fmt.Fprintln(t, err)
+		}
+	}
+}
+
+// script runs src, reporting errors with the name of the script.
+func script(sh *shell, name, src string) int {
+	stmts, err := parse(src)
+	if err == nil {
+		err = sh.run(stmts)
+	}
+	switch err := err.(type) {
+	case nil:
+		return 0
+	case exitError:
+		return int(err)
+	default:
+		fmt.Fprintf(os.Stderr, "%v: %v\n", name, err)
+		return 1
+	}
+}
+
+func runShell(c *cli.Context) {
+	sh := newShell(os.Stdout)
+	args := c.Args()
+	for i, a := range args {
+		sh.vars[strconv.Itoa(i)] = a
+	}
+
+	var code int
+	switch {
+	case c.String("exec") != "":
+		code = script(sh, "exec", c.String("exec"))
+	case len(args) > 0:
+		src, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			die(err)
+		}
+		code = script(sh, args[0], string(src))
+	case term.IsTerminal(int(os.Stdin.Fd())):
+		code = interactive(sh)
+	default:
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			die(err)
+		}
+		code = script(sh, "stdin", string(src))
+	}
+
+	sh.hw.close()
+	os.Exit(code)
+}
+
+var shellCmd = cli.Command{
+	Name:      "shell",
+	Usage:     "run commands interactively or from a script, keeping pins and buses open",
+	ArgsUsage: "[script [args...]]",
+	Description: `Statements are separated by newlines or semicolons, e.g.
+
+     pin 17 out; write 17 1; sleep 100ms; i2c read 1 0x77 0xd0
+
+   Run help in the shell for the list of commands. Variables are set with set
+   and expanded with $name, the output of the last command is in $_ and the
+   script arguments in $1, $2... Blocks are run with repeat, for and if, and
+   expect fails the script unless a condition holds. The pins are released
+   on exit.`,
+	Action: runShell,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "exec, e", Usage: "run the given statements instead of a script"},
+	},
+}
+
+func init() {
+	registerCommand(shellCmd)
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestCompleteLine(t *testing.T) {
+	commands := []string{"echo", "pin", "pwm", "read"}
+	others := []string{"GPIO_17", "GPIO_27", "P1_11", "in", "out"}
+	var tests = []struct {
+		line string
+		pos  int
+		want string
+		ok   bool
+	}{
+		{"pi", 2, "pin ", true},
+		{"p", 1, "p", false},
+		{"pin GPIO_1", 10, "pin GPIO_17 ", true},
+		{"pin GP", 6, "pin GPIO_", true},
+		{"pin 17 o", 8, "pin 17 out ", true},
+		{"pin 17 out; re", 14, "pin 17 out; read ", true},
+		{"repeat 2 { ec", 13, "repeat 2 { echo ", true},
+		{"xyz", 3, "", false},
+	}
+	for _, test := range tests {
+		line, pos, ok := completeLine(test.line, test.pos, commands, others)
+		if ok != test.ok || ok && (line != test.want || pos != len(test.want)) {
+			t.Errorf("%q: got %q, %v, %v", test.line, line, pos, ok)
+		}
+	}
+}
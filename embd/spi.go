@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/kidoman/embd"
+)
+
+// parseHex parses a hex payload given either as one string ("018000") or
+// as separate bytes ("0x01 0x80 0x00").
+func parseHex(args []string) ([]byte, error) {
+	var data []byte
+	for _, a := range args {
+		a = strings.TrimPrefix(strings.TrimPrefix(a, "0x"), "0X")
+		if len(a)%2 == 1 {
+			a = "0" + a
+		}
+		b, err := hex.DecodeString(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex payload %q", a)
+		}
+		data = append(data, b...)
+	}
+	return data, nil
+}
+
+func spiXfer(c *cli.Context) {
+	if len(c.Args()) == 0 {
+		cli.ShowSubcommandHelp(c)
+		os.Exit(1)
+	}
+	data, err := parseHex(c.Args())
+	if err != nil {
+		die(err)
+	}
+	mode := c.Int("mode")
+	if mode < int(embd.SPIMode0) || mode > int(embd.SPIMode3) {
+		die(fmt.Errorf("invalid spi mode %v", mode))
+	}
+	channel, err := parseByte(c.String("channel"))
+	if err != nil {
+		die(err)
+	}
+
+	if err := embd.InitSPI(); err != nil {
+		die(err)
+	}
+	defer embd.CloseSPI()
+	bus := embd.NewSPIBus(byte(mode), channel, c.Int("speed"), c.Int("bpw"), c.Int("delay"))
+
+	if err := bus.TransferAndReceiveData(data); err != nil {
+		die(err)
+	}
+
+	if c.Bool("json") {
+		out := make([]int, len(data))
+		for i, b := range data {
+			out[i] = int(b)
+		}
+		printJSON(out)
+		return
+	}
+	for i, b := range data {
+		if i > 0 {
+			fmt.Print(" ")
+		}
+		fmt.Printf("0x%02x", b)
+	}
+	fmt.Println()
+}
+
+var spiCmd = cli.Command{
+	Name:  "spi",
+	Usage: "transfer data on a spi bus",
+	Subcommands: []cli.Command{
+		{
+			Name:      "xfer",
+			Usage:     "send a hex payload and print the bytes received meanwhile",
+			ArgsUsage: "<hex>...",
+			Action:    spiXfer,
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "mode", Usage: "spi mode (0 to 3)"},
+				cli.StringFlag{Name: "channel", Value: "0", Usage: "chip select"},
+				cli.IntFlag{Name: "speed", Value: 1000000, Usage: "clock speed in Hz"},
+				cli.IntFlag{Name: "bpw", Value: 8, Usage: "bits per word"},
+				cli.IntFlag{Name: "delay", Usage: "delay after the transfer in µs"},
+				jsonFlag,
+			},
+		},
+	},
+}
+
+func init() {
+	registerCommand(spiCmd)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseHex(t *testing.T) {
+	var tests = []struct {
+		args []string
+		data []byte
+		err  bool
+	}{
+		{[]string{"018000"}, []byte{0x01, 0x80, 0x00}, false},
+		{[]string{"0x01", "0x80", "0"}, []byte{0x01, 0x80, 0x00}, false},
+		{[]string{"0xD0", "abc"}, []byte{0xd0, 0x0a, 0xbc}, false},
+		{[]string{"0xzz"}, nil, true},
+	}
+	for _, test := range tests {
+		data, err := parseHex(test.args)
+		if (err != nil) != test.err {
+			t.Errorf("%v: got error %v", test.args, err)
+			continue
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Errorf("%v: got % x, want % x", test.args, data, test.data)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Package fakefs builds fake sysfs, devfs and procfs trees, so that embd can
+// be exercised without the actual hardware, e.g. in tests or emulators.
+package fakefs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kidoman/embd"
+)
+
+// Tree maps slash separated paths, relative to the filesystem root, to the
+// contents of the files. Paths ending with a slash are created as
+// directories.
+type Tree map[string]string
+
+// Create creates the files and directories of the tree under root.
+func (t Tree) Create(root string) error {
+	for name, data := range t {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Setup creates the tree in a temp dir and makes it the embd filesystem
+// root. The returned func removes the tree and restores the previous root.
+func Setup(tree Tree) (func(), error) {
+	root, err := ioutil.TempDir("", "embd")
+	if err != nil {
+		return nil, err
+	}
+	if err := tree.Create(root); err != nil {
+		os.RemoveAll(root)
+		return nil, err
+	}
+
+	old := embd.FSRoot()
+	embd.SetFSRoot(root)
+
+	return func() {
+		embd.SetFSRoot(old)
+		os.RemoveAll(root)
+	}, nil
+}
+
+// ReadFile returns the contents of the file at the absolute path name under
+// the embd filesystem root.
+func ReadFile(name string) (string, error) {
+	data, err := ioutil.ReadFile(embd.FSPath(name))
+	return string(data), err
+}
@@ -0,0 +1,465 @@
+// Package fakehost provides a fake host, whose pins, buses and led record
+// what is done to them, so that the packages driving the hardware through
+// embd can be exercised without it, e.g. in tests.
+package fakehost
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kidoman/embd"
+)
+
+// AnalogValue is the value read from the analog pins.
+const AnalogValue = 512
+
+// Host is the hardware of a fake host. It records the calls made to its
+// pins, buses and led, which are all answered successfully.
+type Host struct {
+	// NoEdge holds the logical numbers of the digital pins without edge
+	// detection, which fail to be watched.
+	NoEdge map[int]bool
+
+	pinMap embd.PinMap
+
+	mu    sync.Mutex
+	calls []string
+	pins  map[string]*DigitalPin
+	pwms  map[string]*PWMPin
+	led   *LED
+
+	// listener stands for the lock of the interrupt listener, which the
+	// drivers hold while calling the watch handlers.
+	listener sync.Mutex
+}
+
+// New returns a host with the pins of the map.
+func New(pinMap embd.PinMap) *Host {
+	h := &Host{
+		pinMap: pinMap,
+		pins:   make(map[string]*DigitalPin),
+		pwms:   make(map[string]*PWMPin),
+	}
+	h.led = &LED{h: h}
+	return h
+}
+
+// Register registers the host with embd under the given name.
+func (h *Host) Register(host embd.Host) {
+	embd.Register(host, func(rev int) *embd.Descriptor {
+		return h.Descriptor()
+	})
+}
+
+// Descriptor returns the drivers of the host: GPIO, I2C, SPI and a led
+// named led0.
+func (h *Host) Descriptor() *embd.Descriptor {
+	return &embd.Descriptor{
+		GPIODriver: func() embd.GPIODriver {
+			return embd.NewGPIODriver(h.pinMap, func(pd *embd.PinDesc, drv embd.GPIODriver) embd.DigitalPin {
+				p := &DigitalPin{h: h, id: pd.ID, n: pd.DigitalLogical, drv: drv}
+				h.mu.Lock()
+				h.pins[pd.ID] = p
+				h.mu.Unlock()
+				return p
+			}, func(pd *embd.PinDesc, drv embd.GPIODriver) embd.AnalogPin {
+				return &analogPin{id: pd.ID, n: pd.AnalogLogical, drv: drv}
+			}, func(pd *embd.PinDesc, drv embd.GPIODriver) embd.PWMPin {
+				p := &PWMPin{h: h, id: pd.ID, drv: drv}
+				h.mu.Lock()
+				h.pwms[pd.ID] = p
+				h.mu.Unlock()
+				return p
+			})
+		},
+		I2CDriver: func() embd.I2CDriver {
+			return embd.NewI2CDriver(func(l byte) embd.I2CBus {
+				return &i2cBus{h: h, l: l}
+			})
+		},
+		SPIDriver: func() embd.SPIDriver {
+			return embd.NewSPIDriver(0, func(_ int, mode, channel byte, speed, bpw, delay int, _ func() error) embd.SPIBus {
+				h.log("spi open %v %v %v", mode, channel, speed)
+				return &spiBus{h: h}
+			}, nil)
+		},
+		LEDDriver: func() embd.LEDDriver {
+			return embd.NewLEDDriver(embd.LEDMap{"led0": {"0", "led0"}}, func(string) embd.LED {
+				return h.led
+			})
+		},
+	}
+}
+
+func (h *Host) log(format string, args ...interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, fmt.Sprintf(format, args...))
+}
+
+// Calls returns the calls made so far, e.g. "P1_11 write 1" or
+// "i2c1 read 0x77 reg 0xd0 2".
+func (h *Host) Calls() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.calls...)
+}
+
+// TakeCalls returns the calls made so far and forgets them.
+func (h *Host) TakeCalls() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	calls := h.calls
+	h.calls = nil
+	return calls
+}
+
+// Reset puts the hardware back in its initial state and forgets the calls.
+func (h *Host) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, p := range h.pins {
+		p.mu.Lock()
+		p.val = embd.Low
+		p.mu.Unlock()
+	}
+	for _, p := range h.pwms {
+		*p = PWMPin{h: p.h, id: p.id, drv: p.drv}
+	}
+	h.led.on = false
+	h.calls = nil
+}
+
+// Pin returns the digital pin with the given id, or nil if it was not
+// opened.
+func (h *Host) Pin(id string) *DigitalPin {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.pins[id]
+}
+
+// PWM returns the pwm pin with the given id, or nil if it was not opened.
+func (h *Host) PWM(id string) *PWMPin {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.pwms[id]
+}
+
+// LED returns the led of the host.
+func (h *Host) LED() *LED {
+	return h.led
+}
+
+// DigitalPin is a digital pin of the host.
+type DigitalPin struct {
+	h   *Host
+	id  string
+	n   int
+	drv embd.GPIODriver
+
+	mu      sync.Mutex
+	val     int
+	dir     embd.Direction
+	handler func(embd.DigitalPin)
+}
+
+// Set changes the value of the pin and calls its watch handler, if any.
+func (p *DigitalPin) Set(val int) {
+	p.h.listener.Lock()
+	defer p.h.listener.Unlock()
+	p.mu.Lock()
+	p.val = val
+	handler := p.handler
+	p.mu.Unlock()
+	if handler != nil {
+		handler(p)
+	}
+}
+
+// Watched tells whether the pin is watched.
+func (p *DigitalPin) Watched() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.handler != nil
+}
+
+// Dir returns the direction the pin was last set to.
+func (p *DigitalPin) Dir() embd.Direction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dir
+}
+
+func (p *DigitalPin) Watch(edge embd.Edge, handler func(embd.DigitalPin)) error {
+	p.h.listener.Lock()
+	defer p.h.listener.Unlock()
+	p.h.log("%v watch %v", p.id, edge)
+	if p.h.NoEdge[p.n] {
+		return errors.New("fakehost: no edge detection")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handler = handler
+	return nil
+}
+
+func (p *DigitalPin) StopWatching() error {
+	p.h.listener.Lock()
+	defer p.h.listener.Unlock()
+	p.h.log("%v stop watching", p.id)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handler = nil
+	return nil
+}
+
+func (p *DigitalPin) N() int { return p.n }
+
+func (p *DigitalPin) Write(val int) error {
+	p.h.log("%v write %v", p.id, val)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.val = val
+	return nil
+}
+
+func (p *DigitalPin) Read() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.val, nil
+}
+
+func (p *DigitalPin) TimePulse(state int) (time.Duration, error) {
+	return 42 * time.Microsecond, nil
+}
+
+func (p *DigitalPin) SetDirection(dir embd.Direction) error {
+	p.h.log("%v direction %v", p.id, dir)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dir = dir
+	return nil
+}
+
+func (p *DigitalPin) ActiveLow(b bool) error {
+	p.h.log("%v active low %v", p.id, b)
+	return nil
+}
+
+func (p *DigitalPin) PullUp() error   { p.h.log("%v pull up", p.id); return nil }
+func (p *DigitalPin) PullDown() error { p.h.log("%v pull down", p.id); return nil }
+
+func (p *DigitalPin) Close() error {
+	p.h.log("%v close", p.id)
+	return p.drv.Unregister(p.id)
+}
+
+// analogPin reads AnalogValue.
+type analogPin struct {
+	id  string
+	n   int
+	drv embd.GPIODriver
+}
+
+func (p *analogPin) N() int             { return p.n }
+func (p *analogPin) Read() (int, error) { return AnalogValue, nil }
+func (p *analogPin) Close() error       { return p.drv.Unregister(p.id) }
+
+// PWMPin is a pwm pin of the host.
+type PWMPin struct {
+	h   *Host
+	id  string
+	drv embd.GPIODriver
+
+	period, duty int
+	polarity     embd.Polarity
+	analog       byte
+}
+
+// Period returns the period in ns.
+func (p *PWMPin) Period() int {
+	p.h.mu.Lock()
+	defer p.h.mu.Unlock()
+	return p.period
+}
+
+// Duty returns the duty cycle in ns.
+func (p *PWMPin) Duty() int {
+	p.h.mu.Lock()
+	defer p.h.mu.Unlock()
+	return p.duty
+}
+
+// Polarity returns the polarity.
+func (p *PWMPin) Polarity() embd.Polarity {
+	p.h.mu.Lock()
+	defer p.h.mu.Unlock()
+	return p.polarity
+}
+
+// Analog returns the value last set by SetAnalog.
+func (p *PWMPin) Analog() byte {
+	p.h.mu.Lock()
+	defer p.h.mu.Unlock()
+	return p.analog
+}
+
+func (p *PWMPin) set(f func(), format string, args ...interface{}) error {
+	p.h.log(format, args...)
+	p.h.mu.Lock()
+	defer p.h.mu.Unlock()
+	f()
+	return nil
+}
+
+func (p *PWMPin) N() string { return "pwmchip0/pwm0" }
+
+func (p *PWMPin) SetPeriod(ns int) error {
+	return p.set(func() { p.period = ns }, "%v period %v", p.id, ns)
+}
+
+func (p *PWMPin) SetDuty(ns int) error {
+	return p.set(func() { p.duty = ns }, "%v duty %v", p.id, ns)
+}
+
+func (p *PWMPin) SetMicroseconds(us int) error {
+	return p.set(func() { p.duty = us * 1000 }, "%v us %v", p.id, us)
+}
+
+func (p *PWMPin) SetAnalog(v byte) error {
+	return p.set(func() { p.analog = v }, "%v analog %v", p.id, v)
+}
+
+func (p *PWMPin) SetPolarity(pol embd.Polarity) error {
+	return p.set(func() { p.polarity = pol }, "%v polarity %v", p.id, pol)
+}
+
+func (p *PWMPin) Close() error { return p.drv.Unregister(p.id) }
+
+// LED is the led of the host.
+type LED struct {
+	h  *Host
+	on bool
+}
+
+// Lit tells whether the led is on.
+func (l *LED) Lit() bool {
+	l.h.mu.Lock()
+	defer l.h.mu.Unlock()
+	return l.on
+}
+
+func (l *LED) set(on func(bool) bool, call string) error {
+	l.h.log(call)
+	l.h.mu.Lock()
+	defer l.h.mu.Unlock()
+	l.on = on(l.on)
+	return nil
+}
+
+func (l *LED) On() error     { return l.set(func(bool) bool { return true }, "led on") }
+func (l *LED) Off() error    { return l.set(func(bool) bool { return false }, "led off") }
+func (l *LED) Toggle() error { return l.set(func(on bool) bool { return !on }, "led toggle") }
+func (l *LED) Close() error  { l.h.log("led close"); return nil }
+
+// i2cBus reads back the register number incremented by the offset of the
+// byte.
+type i2cBus struct {
+	h *Host
+	l byte
+}
+
+func (b *i2cBus) ReadByte(addr byte) (byte, error) {
+	b.h.log("i2c%v read byte %#x", b.l, addr)
+	return 0xAA, nil
+}
+
+func (b *i2cBus) ReadBytes(addr byte, num int) ([]byte, error) {
+	b.h.log("i2c%v read %#x %v", b.l, addr, num)
+	return make([]byte, num), nil
+}
+
+func (b *i2cBus) WriteByte(addr, value byte) error {
+	b.h.log("i2c%v write byte %#x %#x", b.l, addr, value)
+	return nil
+}
+
+func (b *i2cBus) WriteBytes(addr byte, value []byte) error {
+	b.h.log("i2c%v write %#x %v", b.l, addr, value)
+	return nil
+}
+
+func (b *i2cBus) ReadFromReg(addr, reg byte, value []byte) error {
+	b.h.log("i2c%v read %#x reg %#x %v", b.l, addr, reg, len(value))
+	for i := range value {
+		value[i] = reg + byte(i)
+	}
+	return nil
+}
+
+func (b *i2cBus) ReadByteFromReg(addr, reg byte) (byte, error) {
+	b.h.log("i2c%v read byte %#x reg %#x", b.l, addr, reg)
+	return reg, nil
+}
+
+func (b *i2cBus) ReadWordFromReg(addr, reg byte) (uint16, error) {
+	b.h.log("i2c%v read word %#x reg %#x", b.l, addr, reg)
+	return 0xBEEF, nil
+}
+
+func (b *i2cBus) WriteToReg(addr, reg byte, value []byte) error {
+	b.h.log("i2c%v write %#x reg %#x %v", b.l, addr, reg, value)
+	return nil
+}
+
+func (b *i2cBus) WriteByteToReg(addr, reg, value byte) error {
+	b.h.log("i2c%v write byte %#x reg %#x %#x", b.l, addr, reg, value)
+	return nil
+}
+
+func (b *i2cBus) WriteWordToReg(addr, reg byte, value uint16) error {
+	b.h.log("i2c%v write word %#x reg %#x %#x", b.l, addr, reg, value)
+	return nil
+}
+
+func (b *i2cBus) Close() error { return nil }
+
+// spiBus answers every byte with its complement.
+type spiBus struct {
+	h *Host
+}
+
+func (b *spiBus) Write(data []byte) (int, error) {
+	b.h.log("spi write %v", data)
+	return len(data), nil
+}
+
+func (b *spiBus) TransferAndReceiveData(data []uint8) error {
+	b.h.log("spi transfer %v", data)
+	for i := range data {
+		data[i] = ^data[i]
+	}
+	return nil
+}
+
+func (b *spiBus) ReceiveData(n int) ([]uint8, error) {
+	b.h.log("spi receive %v", n)
+	return make([]byte, n), nil
+}
+
+func (b *spiBus) TransferAndReceiveByte(data byte) (byte, error) {
+	b.h.log("spi transfer byte %v", data)
+	return ^data, nil
+}
+
+func (b *spiBus) ReceiveByte() (byte, error) {
+	b.h.log("spi receive byte")
+	return 0x55, nil
+}
+
+func (b *spiBus) Close() error {
+	b.h.log("spi close")
+	return nil
+}
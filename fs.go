@@ -0,0 +1,37 @@
+// Filesystem root.
+
+package embd
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// fsRoot is the directory under which sysfs, devfs and procfs are looked up.
+var fsRoot = defaultFSRoot()
+
+func defaultFSRoot() string {
+	if dir := os.Getenv("EMBD_FSROOT"); dir != "" {
+		return dir
+	}
+	return "/"
+}
+
+// SetFSRoot makes embd access /sys, /dev and /proc under dir instead of /.
+// This lets tests and emulators point embd at a fake tree, for example in a
+// temp dir. The root can also be set through the EMBD_FSROOT environment
+// variable. It must be set before any driver is initialized.
+func SetFSRoot(dir string) {
+	fsRoot = dir
+}
+
+// FSRoot returns the current filesystem root.
+func FSRoot() string {
+	return fsRoot
+}
+
+// FSPath returns the location of the absolute path p (e.g.
+// "/sys/class/gpio") under the filesystem root.
+func FSPath(p string) string {
+	return filepath.Join(fsRoot, p)
+}
@@ -144,6 +144,10 @@ type GPIODriver interface {
 	// PWMPin returns a pin capable of generating PWM.
 	PWMPin(key interface{}) (PWMPin, error)
 
+	// DigitalPort returns a group of pins capable of doing digital IO
+	// together.
+	DigitalPort(keys ...interface{}) (DigitalPort, error)
+
 	// Close releases the resources associated with the driver.
 	Close() error
 }
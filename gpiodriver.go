@@ -5,6 +5,8 @@ package embd
 import (
 	"errors"
 	"fmt"
+
+	"github.com/golang/glog"
 )
 
 type pin interface {
@@ -14,13 +16,15 @@ type pin interface {
 type digitalPinFactory func(pd *PinDesc, drv GPIODriver) DigitalPin
 type analogPinFactory func(pd *PinDesc, drv GPIODriver) AnalogPin
 type pwmPinFactory func(pd *PinDesc, drv GPIODriver) PWMPin
+type digitalPortFactory func(id string, pds []*PinDesc, drv GPIODriver) (DigitalPort, error)
 
 type gpioDriver struct {
 	pinMap PinMap
 
-	dpf digitalPinFactory
-	apf analogPinFactory
-	ppf pwmPinFactory
+	dpf    digitalPinFactory
+	apf    analogPinFactory
+	ppf    pwmPinFactory
+	dportf digitalPortFactory
 
 	initializedPins map[string]pin
 }
@@ -28,11 +32,19 @@ type gpioDriver struct {
 // NewGPIODriver returns a GPIODriver interface which allows control
 // over the GPIO subsystem.
 func NewGPIODriver(pinMap PinMap, dpf digitalPinFactory, apf analogPinFactory, ppf pwmPinFactory) GPIODriver {
+	return NewGPIODriverWithPorts(pinMap, dpf, apf, ppf, nil)
+}
+
+// NewGPIODriverWithPorts is like NewGPIODriver but also takes a factory
+// for ports which can drive several lines in a single operation. Ports
+// the factory cannot provide are driven one pin at a time.
+func NewGPIODriverWithPorts(pinMap PinMap, dpf digitalPinFactory, apf analogPinFactory, ppf pwmPinFactory, dportf digitalPortFactory) GPIODriver {
 	return &gpioDriver{
 		pinMap: pinMap,
 		dpf:    dpf,
 		apf:    apf,
 		ppf:    ppf,
+		dportf: dportf,
 
 		initializedPins: map[string]pin{},
 	}
@@ -107,6 +119,55 @@ func (io *gpioDriver) PWMPin(key interface{}) (PWMPin, error) {
 	return p, nil
 }
 
+func (io *gpioDriver) DigitalPort(keys ...interface{}) (DigitalPort, error) {
+	if io.dpf == nil && io.dportf == nil {
+		return nil, errors.New("gpio: digital io not supported on this host")
+	}
+	if err := validatePortKeys(keys); err != nil {
+		return nil, err
+	}
+
+	pds := make([]*PinDesc, len(keys))
+	for i, key := range keys {
+		pd, found := io.pinMap.Lookup(key, CapDigital)
+		if !found {
+			return nil, fmt.Errorf("gpio: could not find pin matching %v", key)
+		}
+		pds[i] = pd
+	}
+
+	id := portID(pds)
+	if p, ok := io.initializedPins[id]; ok {
+		return p.(DigitalPort), nil
+	}
+
+	if io.dportf != nil {
+		p, err := io.dportf(id, pds, io)
+		if err == nil {
+			io.initializedPins[id] = p
+			return p, nil
+		}
+		if io.dpf == nil {
+			return nil, err
+		}
+		glog.V(1).Infof("gpio: %v: bulk access unavailable (%v), falling back to single pins", id, err)
+	}
+
+	pins := make([]DigitalPin, len(pds))
+	for i, pd := range pds {
+		p, err := io.DigitalPin(pd.ID)
+		if err != nil {
+			return nil, err
+		}
+		pins[i] = p
+	}
+
+	p := newDigitalPort(id, pins, io)
+	io.initializedPins[id] = p
+
+	return p, nil
+}
+
 func (io *gpioDriver) PinMap() PinMap {
 	return io.pinMap
 }
@@ -3,5 +3,8 @@ package all
 
 import (
 	_ "github.com/kidoman/embd/host/bbb"
+	_ "github.com/kidoman/embd/host/linux"
+	_ "github.com/kidoman/embd/host/orangepi"
+	_ "github.com/kidoman/embd/host/remote"
 	_ "github.com/kidoman/embd/host/rpi"
 )
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kidoman/embd"
 )
@@ -50,12 +51,11 @@ func (p *analogPin) init() error {
 }
 
 func (p *analogPin) ensureEnabled() error {
-	return ensureFeatureEnabled("cape-bone-iio")
+	return LoadOverlay("cape-bone-iio")
 }
 
 func (p *analogPin) valueFilePath() (string, error) {
-	pattern := fmt.Sprintf("/sys/devices/ocp.*/helper.*/AIN%v", p.n)
-	return embd.FindFirstMatchingFile(pattern)
+	return WaitForFile(fmt.Sprintf("/sys/devices/ocp.*/helper.*/AIN%v", p.n), 500*time.Millisecond)
 }
 
 func (p *analogPin) openFile(path string) (*os.File, error) {
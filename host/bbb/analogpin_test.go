@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakefs"
 )
 
 func TestAnalogPinClose(t *testing.T) {
@@ -24,3 +25,40 @@ func TestAnalogPinClose(t *testing.T) {
 		t.Fatal("Looking up closed analog pin 1: but got the old instance")
 	}
 }
+
+func TestAnalogPinRead(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/devices/bone_capemgr.9/slots": "",
+		"sys/devices/ocp.3/helper.15/AIN1": "1234\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	pinMap := embd.PinMap{
+		&embd.PinDesc{ID: "P9_40", Aliases: []string{"1", "AIN1"}, Caps: embd.CapAnalog, AnalogLogical: 1},
+	}
+	driver := embd.NewGPIODriver(pinMap, nil, newAnalogPin, nil)
+	pin, err := driver.AnalogPin("AIN1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := pin.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != 1234 {
+		t.Errorf("Read: got %v, want 1234", val)
+	}
+	got, err := fakefs.ReadFile(slotsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "cape-bone-iio" {
+		t.Errorf("slots: got %q, want %q", got, "cape-bone-iio")
+	}
+	if err := pin.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,17 +5,17 @@
 	GPIO (digital (rw), analog (ro), pwm)
 	I²C
 	LED
+
+	Overlays can be managed through the cape manager (LoadOverlay,
+	UnloadOverlay, Slots) and, with the universal cape, the header pins can
+	be switched between modes at runtime (SetPinMode).
 */
 package bbb
 
 import (
-	"bufio"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"strings"
+	"time"
 
-	"github.com/golang/glog"
 	"github.com/kidoman/embd"
 	"github.com/kidoman/embd/host/generic"
 )
@@ -97,80 +97,19 @@ var ledMap = embd.LEDMap{
 
 var spiDeviceMinor int = 1
 
-func ensureFeatureEnabled(id string) error {
-	glog.V(3).Infof("bbb: enabling feature %v", id)
-	pattern := "/sys/devices/bone_capemgr.*/slots"
-	file, err := embd.FindFirstMatchingFile(pattern)
-	if err != nil {
-		return err
-	}
-	bytes, err := ioutil.ReadFile(file)
-	if err != nil {
-		return err
-	}
-	str := string(bytes)
-	if strings.Contains(str, id) {
-		glog.V(3).Infof("bbb: feature %v already enabled", id)
-		return nil
-	}
-	slots, err := os.OpenFile(file, os.O_WRONLY, os.ModeExclusive)
-	if err != nil {
-		return err
-	}
-	defer slots.Close()
-	glog.V(3).Infof("bbb: writing %v to slots file", id)
-	_, err = slots.WriteString(id)
-	return err
-}
-
-// This cannot be currently used to disable things like the
-// analog and pwm modules. Removing them from slots file can
-// potentially cause a kernel panic and unsettle things. So the
-// recommended thing to do is to simply reboot.
-func ensureFeatureDisabled(id string) error {
-	pattern := "/sys/devices/bone_capemgr.*/slots"
-	file, err := embd.FindFirstMatchingFile(pattern)
-	if err != nil {
-		return err
-	}
-	slots, err := os.OpenFile(file, os.O_RDWR, os.ModeExclusive)
-	if err != nil {
-		return err
-	}
-	defer slots.Close()
-	scanner := bufio.NewScanner(slots)
-	for scanner.Scan() {
-		text := scanner.Text()
-		if !strings.Contains(text, id) {
-			continue
-		}
-		// Extract the id from the line
-		idx := strings.Index(text, ":")
-		if idx < 0 {
-			// Something is off, bail
-			continue
-		}
-		dis := strings.TrimSpace(text[:idx])
-		slots.Seek(0, 0)
-		_, err = slots.WriteString("-" + dis)
-		return err
-	}
-	// Could not disable the feature
-	return fmt.Errorf("embd: could not disable feature %q", id)
-}
-
 func spiInitializer() error {
-	if err := ensureFeatureEnabled("BB-SPIDEV0"); err != nil {
+	if err := LoadOverlay("BB-SPIDEV0"); err != nil {
 		return err
 	}
-	return nil
+	_, err := WaitForFile(fmt.Sprintf("/dev/spidev%v.*", spiDeviceMinor), time.Second)
+	return err
 }
 
 func init() {
 	embd.Register(embd.HostBBB, func(rev int) *embd.Descriptor {
 		return &embd.Descriptor{
 			GPIODriver: func() embd.GPIODriver {
-				return embd.NewGPIODriver(pins, generic.NewDigitalPin, newAnalogPin, newPWMPin)
+				return embd.NewGPIODriverWithPorts(pins, generic.NewDigitalPin, newAnalogPin, newPWMPin, generic.NewDigitalPort)
 			},
 			I2CDriver: func() embd.I2CDriver {
 				return embd.NewI2CDriver(generic.NewI2CBus)
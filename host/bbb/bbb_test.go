@@ -0,0 +1,175 @@
+package bbb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kidoman/embd/fakefs"
+)
+
+const slotsPath = "/sys/devices/bone_capemgr.9/slots"
+
+func TestParseSlot(t *testing.T) {
+	var tests = []struct {
+		line string
+		slot Slot
+		ok   bool
+	}{
+		{" 0: 54:PF--- ", Slot{N: 0, Flags: "PF---"}, true},
+		{
+			" 4: ff:P-O-L Bone-LT-eMMC-2G,00A0,Texas Instrument,BB-BONE-EMMC-2G",
+			Slot{N: 4, Flags: "P-O-L", Board: "Bone-LT-eMMC-2G", Version: "00A0", Manufacturer: "Texas Instrument", PartNumber: "BB-BONE-EMMC-2G"},
+			true,
+		},
+		{" 0: PF----  -1 ", Slot{N: 0, Flags: "PF----"}, true},
+		{
+			" 7: P-O-L-   1 Override Board Name,00A0,Override Manuf,BB-UART1",
+			Slot{N: 7, Flags: "P-O-L-", Board: "Override Board Name", Version: "00A0", Manufacturer: "Override Manuf", PartNumber: "BB-UART1"},
+			true,
+		},
+		{"", Slot{}, false},
+		{"cape-bone-iio", Slot{}, false},
+	}
+	for _, test := range tests {
+		slot, ok := parseSlot(test.line)
+		if ok != test.ok {
+			t.Errorf("Parsing %q: got ok = %v, want %v", test.line, ok, test.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(slot, test.slot) {
+			t.Errorf("Parsing %q: got %+v, want %+v", test.line, slot, test.slot)
+		}
+	}
+	if s, _ := parseSlot(tests[1].line); !s.Loaded() {
+		t.Errorf("Slot %+v: not loaded", s)
+	}
+}
+
+func TestLoadOverlay(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/devices/bone_capemgr.9/slots": " 0: 54:PF--- \n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	if err := LoadOverlay("BB-SPIDEV0"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fakefs.ReadFile(slotsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "BB-SPIDEV0") {
+		t.Errorf("slots: got %q, want the overlay to be written", got)
+	}
+}
+
+func TestLoadOverlayAlreadyLoaded(t *testing.T) {
+	const slots = " 7: P-O-L-   1 Override Board Name,00A0,Override Manuf,BB-SPIDEV0\n"
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/devices/platform/bone_capemgr/slots": slots,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	loaded, err := OverlayLoaded("BB-SPIDEV0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded {
+		t.Error("OverlayLoaded: got false")
+	}
+	if err := LoadOverlay("BB-SPIDEV0"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fakefs.ReadFile("/sys/devices/platform/bone_capemgr/slots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != slots {
+		t.Errorf("slots: got %q, want it untouched", got)
+	}
+}
+
+func TestOverlayNotLoaded(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/devices/platform/bone_capemgr/slots": " 7: P-O---   1 Override Board Name,00A0,Override Manuf,BB-SPIDEV0\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	loaded, err := OverlayLoaded("BB-SPIDEV0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded {
+		t.Error("OverlayLoaded: got true for a slot which is not loaded")
+	}
+}
+
+func TestUnloadOverlay(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/devices/bone_capemgr.9/slots": " 0: 54:PF--- \n 7: ff:P-O-L Override Board Name,00A0,Override Manuf,bone_pwm_P9_14\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	if err := UnloadOverlay("bone_pwm_P9_14"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fakefs.ReadFile(slotsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "-7") {
+		t.Errorf("slots: got %q, want slot 7 to be removed", got)
+	}
+	if err := UnloadOverlay("BB-SPIDEV0"); err == nil {
+		t.Error("Unloading an overlay which is not loaded: got no error")
+	}
+}
+
+func TestNoCapeManager(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/devices/": "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	if _, err := Slots(); err == nil {
+		t.Error("Slots without a cape manager: got no error")
+	}
+}
+
+func TestWaitForFile(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"dev/spidev1.0": "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	file, err := WaitForFile("/dev/spidev1.*", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(file, "/dev/spidev1.0") {
+		t.Errorf("WaitForFile: got %v", file)
+	}
+	if _, err := WaitForFile("/dev/spidev2.*", 20*time.Millisecond); err == nil {
+		t.Error("WaitForFile of a missing file: got no error")
+	}
+}
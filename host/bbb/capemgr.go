@@ -0,0 +1,214 @@
+// Cape manager and device tree overlay support.
+
+package bbb
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+)
+
+// slotsPatterns are the locations of the cape manager slots file on the 3.8
+// and the 4.x kernels.
+var slotsPatterns = []string{
+	"/sys/devices/bone_capemgr.*/slots",
+	"/sys/devices/platform/bone_capemgr/slots",
+}
+
+// Slot describes a cape manager slot, either filled by a cape EEPROM or by
+// an overlay loaded at runtime.
+type Slot struct {
+	N int
+
+	// Flags are the raw slot flags, e.g. "P-O-L".
+	Flags string
+
+	Board        string
+	Version      string
+	Manufacturer string
+
+	// PartNumber is the name of the overlay, e.g. "BB-SPIDEV0".
+	PartNumber string
+}
+
+// Loaded reports whether the overlay of the slot is loaded.
+func (s *Slot) Loaded() bool {
+	return strings.Contains(s.Flags, "L")
+}
+
+func slotsFile() (string, error) {
+	for _, pattern := range slotsPatterns {
+		file, err := embd.FindFirstMatchingFile(embd.FSPath(pattern))
+		if err != nil {
+			return "", err
+		}
+		if file != "" {
+			return file, nil
+		}
+	}
+	return "", errors.New("bbb: cape manager slots file not found")
+}
+
+// parseSlot parses a line of the slots file. The 3.8 kernels use
+//
+//	" 7: ff:P-O-L Override Board Name,00A0,Override Manuf,BB-SPIDEV0"
+//
+// while the 4.x kernels use
+//
+//	" 7: P-O-L-   1 Override Board Name,00A0,Override Manuf,BB-SPIDEV0"
+func parseSlot(line string) (Slot, bool) {
+	var s Slot
+
+	idx := strings.Index(line, ":")
+	if idx < 0 {
+		return s, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[:idx]))
+	if err != nil {
+		return s, false
+	}
+	s.N = n
+
+	fields := strings.Fields(line[idx+1:])
+	if len(fields) == 0 {
+		return s, false
+	}
+	flags := fields[0]
+	if i := strings.Index(flags, ":"); i >= 0 {
+		flags = flags[i+1:]
+	}
+	s.Flags = flags
+	fields = fields[1:]
+	if len(fields) > 0 {
+		if _, err := strconv.Atoi(fields[0]); err == nil {
+			fields = fields[1:]
+		}
+	}
+
+	desc := strings.SplitN(strings.Join(fields, " "), ",", 4)
+	if len(desc) == 4 {
+		s.Board, s.Version, s.Manufacturer, s.PartNumber = desc[0], desc[1], desc[2], desc[3]
+	}
+
+	return s, true
+}
+
+// Slots returns the cape manager slots.
+func Slots() ([]Slot, error) {
+	file, err := slotsFile()
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var slots []Slot
+	for _, line := range strings.Split(string(bytes), "\n") {
+		if s, ok := parseSlot(line); ok {
+			slots = append(slots, s)
+		}
+	}
+	return slots, nil
+}
+
+// OverlayLoaded reports whether the overlay with the given part number is
+// loaded. A slot which failed to load it does not count.
+func OverlayLoaded(name string) (bool, error) {
+	slots, err := Slots()
+	if err != nil {
+		return false, err
+	}
+	for _, s := range slots {
+		if s.PartNumber == name && s.Loaded() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func writeSlots(file, cmd string) error {
+	slots, err := os.OpenFile(file, os.O_WRONLY, os.ModeExclusive)
+	if err != nil {
+		return err
+	}
+	defer slots.Close()
+	_, err = slots.WriteString(cmd)
+	return err
+}
+
+// LoadOverlay asks the cape manager to load the named overlay (e.g.
+// "BB-SPIDEV0"). It does nothing if the overlay is already loaded.
+func LoadOverlay(name string) error {
+	glog.V(3).Infof("bbb: loading overlay %v", name)
+	loaded, err := OverlayLoaded(name)
+	if err != nil {
+		return err
+	}
+	if loaded {
+		glog.V(3).Infof("bbb: overlay %v already loaded", name)
+		return nil
+	}
+	file, err := slotsFile()
+	if err != nil {
+		return err
+	}
+	glog.V(3).Infof("bbb: writing %v to slots file", name)
+	return writeSlots(file, name)
+}
+
+// UnloadOverlay removes the slot holding the named overlay.
+//
+// Unloading overlays such as the analog and pwm modules can cause a kernel
+// panic on some kernels. The recommended thing to do for those is to simply
+// reboot.
+func UnloadOverlay(name string) error {
+	slots, err := Slots()
+	if err != nil {
+		return err
+	}
+	for _, s := range slots {
+		if s.PartNumber != name {
+			continue
+		}
+		file, err := slotsFile()
+		if err != nil {
+			return err
+		}
+		glog.V(3).Infof("bbb: unloading overlay %v from slot %v", name, s.N)
+		return writeSlots(file, "-"+strconv.Itoa(s.N))
+	}
+	return fmt.Errorf("bbb: overlay %q is not loaded", name)
+}
+
+// WaitForFile waits until a file matching the glob pattern (e.g.
+// "/dev/spidev1.*") shows up, as happens some time after an overlay is
+// loaded. It returns the first match.
+func WaitForFile(pattern string, d time.Duration) (string, error) {
+	timeout := time.After(d)
+
+	for {
+		file, err := embd.FindFirstMatchingFile(embd.FSPath(pattern))
+		if err != nil {
+			return "", err
+		}
+		if file != "" {
+			return file, nil
+		}
+
+		select {
+		case <-timeout:
+			return "", fmt.Errorf("bbb: %v not found before timeout", pattern)
+		case <-time.After(10 * time.Millisecond):
+			// We are looping, wait a bit.
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Runtime pinmux support.
+// This follows the model of config-pin: the universal cape (built into the
+// 4.x kernels, loaded as the cape-universal overlays on 3.8) creates a
+// pinmux helper per header pin whose state selects the pin mode.
+
+package bbb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/kidoman/embd"
+)
+
+// PinMode is a pinmux mode, as understood by config-pin.
+type PinMode string
+
+// The pinmux modes. Not every pin supports every mode, see PinModes.
+const (
+	ModeDefault      PinMode = "default"
+	ModeGPIO         PinMode = "gpio"
+	ModeGPIOPullUp   PinMode = "gpio_pu"
+	ModeGPIOPullDown PinMode = "gpio_pd"
+	ModePWM          PinMode = "pwm"
+	ModeUART         PinMode = "uart"
+	ModeSPI          PinMode = "spi"
+	ModeSPICS        PinMode = "spi_cs"
+	ModeSPISCLK      PinMode = "spi_sclk"
+	ModeI2C          PinMode = "i2c"
+)
+
+var pinmuxPatterns = []string{
+	"/sys/devices/platform/ocp/ocp:%v_pinmux",
+	"/sys/devices/ocp.*/%v_pinmux.*",
+}
+
+// pinmuxPath finds the pinmux helper of the header pin identified by key.
+func pinmuxPath(key interface{}) (string, error) {
+	pd, found := pins.Lookup(key, embd.CapDigital|embd.CapAnalog|embd.CapPWM|embd.CapI2C|embd.CapSPI|embd.CapUART|embd.CapGPMC|embd.CapLCD)
+	if !found {
+		return "", fmt.Errorf("bbb: no pin found for %v", key)
+	}
+	for _, pattern := range pinmuxPatterns {
+		dir, err := embd.FindFirstMatchingFile(embd.FSPath(fmt.Sprintf(pattern, pd.ID)))
+		if err != nil {
+			return "", err
+		}
+		if dir != "" {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("bbb: no pinmux helper for %v, is the universal cape loaded?", pd.ID)
+}
+
+// SetPinMode switches the header pin identified by key to mode.
+func SetPinMode(key interface{}, mode PinMode) error {
+	dir, err := pinmuxPath(key)
+	if err != nil {
+		return err
+	}
+	state, err := os.OpenFile(path.Join(dir, "state"), os.O_WRONLY, os.ModeExclusive)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+	if _, err := state.WriteString(string(mode)); err != nil {
+		return fmt.Errorf("bbb: setting mode %v for %v: %v", mode, key, err)
+	}
+	return nil
+}
+
+// CurrentPinMode returns the mode the header pin identified by key is in.
+func CurrentPinMode(key interface{}) (PinMode, error) {
+	dir, err := pinmuxPath(key)
+	if err != nil {
+		return "", err
+	}
+	state, err := ioutil.ReadFile(path.Join(dir, "state"))
+	if err != nil {
+		return "", err
+	}
+	return PinMode(strings.TrimSpace(string(state))), nil
+}
+
+// PinModes returns the modes supported by the header pin identified by key,
+// as listed in its device tree node.
+func PinModes(key interface{}) ([]PinMode, error) {
+	dir, err := pinmuxPath(key)
+	if err != nil {
+		return nil, err
+	}
+	names, err := ioutil.ReadFile(path.Join(dir, "of_node", "pinctrl-names"))
+	if err != nil {
+		return nil, err
+	}
+	var modes []PinMode
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) > 0 {
+			modes = append(modes, PinMode(name))
+		}
+	}
+	return modes, nil
+}
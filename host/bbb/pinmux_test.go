@@ -0,0 +1,66 @@
+package bbb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kidoman/embd/fakefs"
+)
+
+func TestSetPinMode(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/devices/platform/ocp/ocp:P9_14_pinmux/state":                 "default",
+		"sys/devices/platform/ocp/ocp:P9_14_pinmux/of_node/pinctrl-names": "default\x00gpio\x00gpio_pu\x00gpio_pd\x00pwm\x00",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	modes, err := PinModes("EHRPWM1A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PinMode{ModeDefault, ModeGPIO, ModeGPIOPullUp, ModeGPIOPullDown, ModePWM}
+	if !reflect.DeepEqual(modes, want) {
+		t.Errorf("PinModes: got %v, want %v", modes, want)
+	}
+
+	if err := SetPinMode("P9_14", ModePWM); err != nil {
+		t.Fatal(err)
+	}
+	// The fake state file is a regular file, "pwm" overwrites the start of
+	// "default".
+	got, err := fakefs.ReadFile("/sys/devices/platform/ocp/ocp:P9_14_pinmux/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "pwmault" {
+		t.Errorf("state: got %q", got)
+	}
+
+	if err := SetPinMode("P9_16", ModePWM); err == nil {
+		t.Error("SetPinMode without a pinmux helper: got no error")
+	}
+	if err := SetPinMode("P10_1", ModePWM); err == nil {
+		t.Error("SetPinMode of an unknown pin: got no error")
+	}
+}
+
+func TestCurrentPinMode(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/devices/ocp.3/P9_24_pinmux.27/state": "uart\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	mode, err := CurrentPinMode("UART1_TXD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != ModeUART {
+		t.Errorf("CurrentPinMode: got %v, want %v", mode, ModeUART)
+	}
+}
@@ -3,7 +3,6 @@
 package bbb
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -72,9 +71,6 @@ func (p *pwmPin) init() error {
 	if err != nil {
 		return err
 	}
-	if err := p.ensurePeriodFileExists(basePath, 500*time.Millisecond); err != nil {
-		return err
-	}
 	if p.periodf, err = p.periodFile(basePath); err != nil {
 		return err
 	}
@@ -95,45 +91,31 @@ func (p *pwmPin) init() error {
 }
 
 func (p *pwmPin) ensurePWMEnabled() error {
-	return ensureFeatureEnabled("am33xx_pwm")
+	return LoadOverlay("am33xx_pwm")
 }
 
 func (p *pwmPin) ensurePinEnabled() error {
-	return ensureFeatureEnabled(p.id())
+	return LoadOverlay(p.id())
 }
 
 func (p *pwmPin) ensurePinDisabled() error {
-	return ensureFeatureDisabled(p.id())
+	return UnloadOverlay(p.id())
 }
 
+// basePath waits for the pwm_test helper of the pin to show up once its
+// overlay is loaded.
 func (p *pwmPin) basePath() (string, error) {
-	pattern := "/sys/devices/ocp.*/pwm_test_" + p.n + ".*"
-	return embd.FindFirstMatchingFile(pattern)
+	periodPath, err := WaitForFile("/sys/devices/ocp.*/pwm_test_"+p.n+".*/period", 500*time.Millisecond)
+	if err != nil {
+		return "", err
+	}
+	return path.Dir(periodPath), nil
 }
 
 func (p *pwmPin) openFile(path string) (*os.File, error) {
 	return os.OpenFile(path, os.O_WRONLY, os.ModeExclusive)
 }
 
-func (p *pwmPin) ensurePeriodFileExists(basePath string, d time.Duration) error {
-	path := p.periodFilePath(basePath)
-	timeout := time.After(d)
-
-	for {
-		select {
-		case <-timeout:
-			return errors.New("embd: period file not found before timeout")
-		default:
-			if _, err := os.Stat(path); err == nil {
-				return nil
-			}
-		}
-
-		// We are looping, wait a bit.
-		time.Sleep(10 * time.Millisecond)
-	}
-}
-
 func (p *pwmPin) periodFilePath(basePath string) string {
 	return path.Join(basePath, "period")
 }
@@ -175,7 +157,7 @@ func (p *pwmPin) SetDuty(ns int) error {
 	}
 
 	if ns > PWMMaxPulseWidth {
-		return fmt.Errorf("embd: pwm duty %v for pin %v is out of bounds (must be =< %vns)", p.n, PWMMaxPulseWidth)
+		return fmt.Errorf("embd: pwm duty %v for pin %v is out of bounds (must be =< %vns)", ns, p.n, PWMMaxPulseWidth)
 	}
 
 	if ns > p.period {
@@ -196,7 +178,7 @@ func (p *pwmPin) SetMicroseconds(us int) error {
 	}
 
 	if p.period != 20000000 {
-		glog.Warningf("embd: pwm pin %v has freq %v hz. recommended 50 hz for servo mode", 1000000000/p.period)
+		glog.Warningf("embd: pwm pin %v has freq %v hz. recommended 50 hz for servo mode", p.n, 1000000000/p.period)
 	}
 	duty := us * 1000 // in nanoseconds
 	if duty > p.period {
@@ -1,9 +1,11 @@
 package bbb
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakefs"
 )
 
 func TestPWMPinClose(t *testing.T) {
@@ -24,3 +26,60 @@ func TestPWMPinClose(t *testing.T) {
 		t.Fatal("Looking up closed pwm pin 1: but got the old instance")
 	}
 }
+
+func TestPWMPin(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/devices/bone_capemgr.9/slots":             "",
+		"sys/devices/ocp.3/pwm_test_P9_14.15/period":   "",
+		"sys/devices/ocp.3/pwm_test_P9_14.15/duty":     "",
+		"sys/devices/ocp.3/pwm_test_P9_14.15/polarity": "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	pinMap := embd.PinMap{
+		&embd.PinDesc{ID: "P9_14", Aliases: []string{"EHRPWM1A"}, Caps: embd.CapPWM},
+	}
+	driver := embd.NewGPIODriver(pinMap, nil, nil, newPWMPin)
+	pin, err := driver.PWMPin("EHRPWM1A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetPeriod(20000000); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetDuty(1500000); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetDuty(PWMMaxPulseWidth + 1); err == nil || !strings.Contains(err.Error(), "P9_14") {
+		t.Errorf("SetDuty out of bounds: got %v", err)
+	}
+
+	// The fake files are regular files, so every value written since the
+	// reset done on init is kept.
+	var files = []struct {
+		name, want string
+	}{
+		{"/sys/devices/ocp.3/pwm_test_P9_14.15/period", "50000020000000"},
+		{"/sys/devices/ocp.3/pwm_test_P9_14.15/duty", "01500000"},
+		{"/sys/devices/ocp.3/pwm_test_P9_14.15/polarity", "0"},
+	}
+	for _, f := range files {
+		got, err := fakefs.ReadFile(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != f.want {
+			t.Errorf("%v: got %q, want %q", f.name, got, f.want)
+		}
+	}
+	got, err := fakefs.ReadFile(slotsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "bone_pwm_P9_14" {
+		t.Errorf("slots: got %q, want %q", got, "bone_pwm_P9_14")
+	}
+}
@@ -83,7 +83,7 @@ func init() {
 	embd.Register(embd.HostCHIP, func(rev int) *embd.Descriptor {
 		return &embd.Descriptor{
 			GPIODriver: func() embd.GPIODriver {
-				return embd.NewGPIODriver(chipPins, generic.NewDigitalPin, nil, nil)
+				return embd.NewGPIODriverWithPorts(chipPins, generic.NewDigitalPin, nil, nil, generic.NewDigitalPort)
 			},
 			I2CDriver: func() embd.I2CDriver {
 				return embd.NewI2CDriver(generic.NewI2CBus)
@@ -0,0 +1,81 @@
+package chip
+
+import (
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakefs"
+	"github.com/kidoman/embd/host/generic"
+)
+
+func TestPinLookup(t *testing.T) {
+	var tests = []struct {
+		key interface{}
+		cap int
+		id  string
+		n   int
+	}{
+		{"U14-13", embd.CapDigital, "XIO-P0", 1016},
+		{"gpio7", embd.CapDigital, "XIO-P7", 1023},
+		{48, embd.CapI2C, "TWI1-SDA", 48},
+		{"U13-18", embd.CapPWM, "PWM0", 34},
+		{"SPI2_MOSI", embd.CapSPI, "CSIHSYNC", 130},
+	}
+	for _, test := range tests {
+		pd, found := chipPins.Lookup(test.key, test.cap)
+		if !found {
+			t.Errorf("Lookup(%v): not found", test.key)
+			continue
+		}
+		if pd.ID != test.id || pd.DigitalLogical != test.n {
+			t.Errorf("Lookup(%v): got %v (%v), want %v (%v)", test.key, pd.ID, pd.DigitalLogical, test.id, test.n)
+		}
+	}
+}
+
+func TestDigitalPin(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/gpio/export":              "",
+		"sys/class/gpio/unexport":            "",
+		"sys/class/gpio/gpio1016/direction":  "",
+		"sys/class/gpio/gpio1016/value":      "0",
+		"sys/class/gpio/gpio1016/active_low": "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	driver := embd.NewGPIODriver(chipPins, generic.NewDigitalPin, nil, nil)
+	pin, err := driver.DigitalPin("U14-13")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetDirection(embd.Out); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.Write(embd.High); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var files = []struct {
+		name, want string
+	}{
+		{"/sys/class/gpio/export", "1016"},
+		{"/sys/class/gpio/unexport", "1016"},
+		{"/sys/class/gpio/gpio1016/direction", "out"},
+		{"/sys/class/gpio/gpio1016/value", "1"},
+	}
+	for _, f := range files {
+		got, err := fakefs.ReadFile(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != f.want {
+			t.Errorf("%v: got %q, want %q", f.name, got, f.want)
+		}
+	}
+}
@@ -64,7 +64,7 @@ func (p *digitalPin) init() error {
 }
 
 func (p *digitalPin) export() error {
-	exporter, err := os.OpenFile("/sys/class/gpio/export", os.O_WRONLY, os.ModeExclusive)
+	exporter, err := os.OpenFile(embd.FSPath("/sys/class/gpio/export"), os.O_WRONLY, os.ModeExclusive)
 	if err != nil {
 		return err
 	}
@@ -77,7 +77,7 @@ func (p *digitalPin) export() error {
 }
 
 func (p *digitalPin) unexport() error {
-	unexporter, err := os.OpenFile("/sys/class/gpio/unexport", os.O_WRONLY, os.ModeExclusive)
+	unexporter, err := os.OpenFile(embd.FSPath("/sys/class/gpio/unexport"), os.O_WRONLY, os.ModeExclusive)
 	if err != nil {
 		return err
 	}
@@ -87,7 +87,7 @@ func (p *digitalPin) unexport() error {
 }
 
 func (p *digitalPin) basePath() string {
-	return fmt.Sprintf("/sys/class/gpio/gpio%v", p.n)
+	return embd.FSPath(fmt.Sprintf("/sys/class/gpio/gpio%v", p.n))
 }
 
 func (p *digitalPin) openFile(path string) (*os.File, error) {
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakefs"
 )
 
 func TestDigitalPinClose(t *testing.T) {
@@ -24,3 +25,86 @@ func TestDigitalPinClose(t *testing.T) {
 		t.Fatal("Looking up closed digital pin 1: but got the old instance")
 	}
 }
+
+func TestDigitalPin(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/gpio/export":            "",
+		"sys/class/gpio/unexport":          "",
+		"sys/class/gpio/gpio17/direction":  "",
+		"sys/class/gpio/gpio17/value":      "0",
+		"sys/class/gpio/gpio17/active_low": "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	pinMap := embd.PinMap{
+		&embd.PinDesc{ID: "P1_11", Aliases: []string{"17"}, Caps: embd.CapDigital, DigitalLogical: 17},
+	}
+	driver := embd.NewGPIODriver(pinMap, NewDigitalPin, nil, nil)
+	pin, err := driver.DigitalPin(17)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetDirection(embd.Out); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.ActiveLow(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.Write(embd.High); err != nil {
+		t.Fatal(err)
+	}
+	val, err := pin.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != embd.High {
+		t.Errorf("Read: got %v, want %v", val, embd.High)
+	}
+	if err := pin.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var files = []struct {
+		name, want string
+	}{
+		{"/sys/class/gpio/export", "17"},
+		{"/sys/class/gpio/unexport", "17"},
+		{"/sys/class/gpio/gpio17/direction", "out"},
+		{"/sys/class/gpio/gpio17/value", "1"},
+		{"/sys/class/gpio/gpio17/active_low", "1"},
+	}
+	for _, f := range files {
+		got, err := fakefs.ReadFile(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != f.want {
+			t.Errorf("%v: got %q, want %q", f.name, got, f.want)
+		}
+	}
+}
+
+func TestDigitalPinNotExported(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/gpio/export": "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	pinMap := embd.PinMap{
+		&embd.PinDesc{ID: "P1_11", Aliases: []string{"17"}, Caps: embd.CapDigital, DigitalLogical: 17},
+	}
+	driver := embd.NewGPIODriver(pinMap, NewDigitalPin, nil, nil)
+	pin, err := driver.DigitalPin(17)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetDirection(embd.Out); err == nil {
+		t.Error("SetDirection without the gpio17 directory: got no error")
+	}
+}
@@ -0,0 +1,293 @@
+// Parallel digital IO support.
+// This driver uses the GPIO character device (/dev/gpiochipN) and requires
+// kernel version 4.8+. All the lines of a port must belong to the same chip.
+
+package generic
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/kidoman/embd"
+)
+
+const (
+	gpioHandlesMax = 64
+
+	gpioGetLineHandleCmd       = 0xC16CB403 // _IOWR(0xB4, 0x03, struct gpiohandle_request)
+	gpioHandleGetLineValuesCmd = 0xC040B408 // _IOWR(0xB4, 0x08, struct gpiohandle_data)
+	gpioHandleSetLineValuesCmd = 0xC040B409 // _IOWR(0xB4, 0x09, struct gpiohandle_data)
+
+	gpioHandleRequestInput  = 1 << 0
+	gpioHandleRequestOutput = 1 << 1
+
+	gpioConsumer = "embd"
+)
+
+type gpioHandleRequest struct {
+	lineOffsets   [gpioHandlesMax]uint32
+	flags         uint32
+	defaultValues [gpioHandlesMax]uint8
+	consumerLabel [32]byte
+	lines         uint32
+	fd            int32
+}
+
+type gpioHandleData struct {
+	values [gpioHandlesMax]uint8
+}
+
+type digitalPort struct {
+	id string
+
+	drv embd.GPIODriver
+
+	chip    string
+	offsets []uint32
+
+	handle *os.File
+	dir    embd.Direction
+	word   uint64
+
+	mu sync.Mutex
+}
+
+// NewDigitalPort returns a port which reads and writes all its lines with a
+// single syscall. It fails if the lines are not all on the same gpio chip.
+func NewDigitalPort(id string, pds []*embd.PinDesc, drv embd.GPIODriver) (embd.DigitalPort, error) {
+	var chip string
+	offsets := make([]uint32, len(pds))
+	for i, pd := range pds {
+		c, offset, err := LineChip(pd.DigitalLogical)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && c != chip {
+			return nil, fmt.Errorf("gpio: %v spans gpio chips %v and %v", id, chip, c)
+		}
+		chip = c
+		offsets[i] = uint32(offset)
+	}
+	if _, err := os.Stat(chip); err != nil {
+		return nil, err
+	}
+
+	return &digitalPort{id: id, drv: drv, chip: chip, offsets: offsets}, nil
+}
+
+// LineChip finds the character device of the chip owning the global gpio
+// number n, along with the offset of the line within that chip.
+func LineChip(n int) (string, int, error) {
+	chips, err := filepath.Glob(embd.FSPath("/sys/class/gpio/gpiochip*"))
+	if err != nil {
+		return "", 0, err
+	}
+	for _, c := range chips {
+		base, err := readIntFile(path.Join(c, "base"))
+		if err != nil {
+			return "", 0, err
+		}
+		ngpio, err := readIntFile(path.Join(c, "ngpio"))
+		if err != nil {
+			return "", 0, err
+		}
+		if n < base || n >= base+ngpio {
+			continue
+		}
+		devs, err := filepath.Glob(path.Join(c, "device", "gpiochip*"))
+		if err != nil {
+			return "", 0, err
+		}
+		if len(devs) == 0 {
+			return "", 0, fmt.Errorf("gpio: no character device for %v", c)
+		}
+		return embd.FSPath(path.Join("/dev", path.Base(devs[0]))), n - base, nil
+	}
+	return "", 0, fmt.Errorf("gpio: no gpio chip found for line %v", n)
+}
+
+func readIntFile(path string) (int, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(bytes)))
+}
+
+// ioctl is a variable for the tests to stand in for the gpio chip.
+var ioctl = func(fd, cmd uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, cmd, uintptr(arg)); errno != 0 {
+		return syscall.Errno(errno)
+	}
+	return nil
+}
+
+// open requests a handle on the lines of the port with the request flags,
+// driving word on them if they are requested as outputs.
+func (p *digitalPort) open(flags uint32, word uint64) (*os.File, error) {
+	chip, err := os.OpenFile(p.chip, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer chip.Close()
+
+	var req gpioHandleRequest
+	copy(req.lineOffsets[:], p.offsets)
+	req.flags = flags
+	if flags == gpioHandleRequestOutput {
+		for i := range p.offsets {
+			req.defaultValues[i] = uint8(word >> uint(i) & 1)
+		}
+	}
+	copy(req.consumerLabel[:], gpioConsumer)
+	req.lines = uint32(len(p.offsets))
+
+	if err := ioctl(chip.Fd(), gpioGetLineHandleCmd, unsafe.Pointer(&req)); err != nil {
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(req.fd), p.id), nil
+}
+
+func (p *digitalPort) request(dir embd.Direction) error {
+	if p.handle != nil {
+		if err := p.handle.Close(); err != nil {
+			return err
+		}
+		p.handle = nil
+	}
+
+	var flags uint32 = gpioHandleRequestInput
+	if dir == embd.Out {
+		flags = gpioHandleRequestOutput
+	}
+	handle, err := p.open(flags, p.word)
+	if err != nil {
+		return err
+	}
+
+	p.handle = handle
+	p.dir = dir
+
+	return nil
+}
+
+func (p *digitalPort) read(handle *os.File) (uint64, error) {
+	var data gpioHandleData
+	if err := ioctl(handle.Fd(), gpioHandleGetLineValuesCmd, unsafe.Pointer(&data)); err != nil {
+		return 0, err
+	}
+	var word uint64
+	for i := range p.offsets {
+		if data.values[i] != 0 {
+			word |= 1 << uint(i)
+		}
+	}
+
+	return word, nil
+}
+
+// current reads the lines as they are, without changing their direction.
+func (p *digitalPort) current() (uint64, error) {
+	handle, err := p.open(0, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer handle.Close()
+
+	return p.read(handle)
+}
+
+func (p *digitalPort) Width() int {
+	return len(p.offsets)
+}
+
+func (p *digitalPort) SetDirection(dir embd.Direction) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.request(dir)
+}
+
+func (p *digitalPort) WriteWord(val uint64) error {
+	return p.WriteMasked(val, ^uint64(0))
+}
+
+func (p *digitalPort) WriteMasked(val, mask uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.handle == nil {
+		// The lines outside of the mask keep their current values.
+		word := val & mask
+		if all := uint64(1)<<uint(len(p.offsets)) - 1; mask&all != all {
+			cur, err := p.current()
+			if err != nil {
+				return err
+			}
+			word |= cur &^ mask
+		}
+		handle, err := p.open(gpioHandleRequestOutput, word)
+		if err != nil {
+			return err
+		}
+		p.handle, p.dir, p.word = handle, embd.Out, word
+		return nil
+	}
+	if p.dir == embd.In {
+		return fmt.Errorf("gpio: %v is an input", p.id)
+	}
+
+	word := p.word&^mask | val&mask
+
+	var data gpioHandleData
+	for i := range p.offsets {
+		data.values[i] = uint8(word >> uint(i) & 1)
+	}
+	if err := ioctl(p.handle.Fd(), gpioHandleSetLineValuesCmd, unsafe.Pointer(&data)); err != nil {
+		return err
+	}
+	p.word = word
+
+	return nil
+}
+
+func (p *digitalPort) ReadWord() (uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.handle == nil {
+		if err := p.request(embd.In); err != nil {
+			return 0, err
+		}
+	}
+
+	return p.read(p.handle)
+}
+
+func (p *digitalPort) Close() error {
+	if err := p.drv.Unregister(p.id); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.handle == nil {
+		return nil
+	}
+	if err := p.handle.Close(); err != nil {
+		return err
+	}
+	p.handle = nil
+
+	return nil
+}
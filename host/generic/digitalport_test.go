@@ -0,0 +1,206 @@
+package generic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakefs"
+)
+
+func TestGPIOHandleRequestLayout(t *testing.T) {
+	// Must match sizeof(struct gpiohandle_request) as encoded in the ioctl.
+	if size := unsafe.Sizeof(gpioHandleRequest{}); size != 364 {
+		t.Fatalf("sizeof gpioHandleRequest: got %v, want 364", size)
+	}
+	if size := unsafe.Sizeof(gpioHandleData{}); size != 64 {
+		t.Fatalf("sizeof gpioHandleData: got %v, want 64", size)
+	}
+	if size := unsafe.Sizeof(gpioChipInfo{}); size != 68 {
+		t.Fatalf("sizeof gpioChipInfo: got %v, want 68", size)
+	}
+	if size := unsafe.Sizeof(gpioLineInfo{}); size != 72 {
+		t.Fatalf("sizeof gpioLineInfo: got %v, want 72", size)
+	}
+	if size := unsafe.Sizeof(gpioEventRequest{}); size != 48 {
+		t.Fatalf("sizeof gpioEventRequest: got %v, want 48", size)
+	}
+	if size := unsafe.Sizeof(gpioEventData{}); size != 16 {
+		t.Fatalf("sizeof gpioEventData: got %v, want 16", size)
+	}
+}
+
+func TestLineChip(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/gpio/gpiochip0/device/gpiochip0/":   "",
+		"sys/class/gpio/gpiochip0/base":                "0\n",
+		"sys/class/gpio/gpiochip0/ngpio":               "54\n",
+		"sys/class/gpio/gpiochip504/device/gpiochip1/": "",
+		"sys/class/gpio/gpiochip504/base":              "504\n",
+		"sys/class/gpio/gpiochip504/ngpio":             "8\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	var tests = []struct {
+		n      int
+		chip   string
+		offset int
+		found  bool
+	}{
+		{17, "/dev/gpiochip0", 17, true},
+		{53, "/dev/gpiochip0", 53, true},
+		{506, "/dev/gpiochip1", 2, true},
+		{54, "", 0, false},
+	}
+	for _, test := range tests {
+		chip, offset, err := LineChip(test.n)
+		if found := err == nil; found != test.found {
+			t.Errorf("Looking up line %v: got err %v, expected found = %v", test.n, err, test.found)
+			continue
+		}
+		if test.found && (chip != embd.FSPath(test.chip) || offset != test.offset) {
+			t.Errorf("Looking up line %v: got (%v, %v), want (%v, %v)", test.n, chip, offset, embd.FSPath(test.chip), test.offset)
+		}
+	}
+}
+
+func TestWriteInputPort(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	p := &digitalPort{id: "port(P1_11)", offsets: []uint32{17}, handle: r, dir: embd.In}
+	if err := p.WriteWord(1); err == nil || err.Error() != "gpio: port(P1_11) is an input" {
+		t.Errorf("WriteWord on an input port: got %v", err)
+	}
+	r.Close()
+}
+
+// fakeChip stands in for the gpio chip behind the ioctls of a port, keeping
+// the values of the port lines as a word.
+type fakeChip struct {
+	values   uint64
+	requests []uint32
+	err      error
+}
+
+func (c *fakeChip) ioctl(fd, cmd uintptr, arg unsafe.Pointer) error {
+	switch cmd {
+	case gpioGetLineHandleCmd:
+		if c.err != nil {
+			return c.err
+		}
+		req := (*gpioHandleRequest)(arg)
+		c.requests = append(c.requests, req.flags)
+		if req.flags == gpioHandleRequestOutput {
+			c.values = 0
+			for i := 0; i < int(req.lines); i++ {
+				c.values |= uint64(req.defaultValues[i]) << uint(i)
+			}
+		}
+		handle, err := syscall.Open(os.DevNull, syscall.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		req.fd = int32(handle)
+	case gpioHandleGetLineValuesCmd:
+		data := (*gpioHandleData)(arg)
+		for i := range data.values {
+			data.values[i] = uint8(c.values >> uint(i) & 1)
+		}
+	case gpioHandleSetLineValuesCmd:
+		data := (*gpioHandleData)(arg)
+		c.values = 0
+		for i, v := range data.values {
+			c.values |= uint64(v) << uint(i)
+		}
+	default:
+		return fmt.Errorf("unexpected ioctl %#x", cmd)
+	}
+	return nil
+}
+
+func fakePort(chip *fakeChip) (*digitalPort, func()) {
+	old := ioctl
+	ioctl = chip.ioctl
+	p := &digitalPort{id: "port(P1_11)", chip: os.DevNull, offsets: []uint32{17, 18, 27, 22}}
+	return p, func() {
+		if p.handle != nil {
+			p.handle.Close()
+		}
+		ioctl = old
+	}
+}
+
+func TestWriteMasked(t *testing.T) {
+	chip := &fakeChip{values: 0xA}
+	p, restore := fakePort(chip)
+	defer restore()
+
+	// The first masked write keeps the lines outside of the mask as they are.
+	if err := p.WriteMasked(0x1, 0x3); err != nil {
+		t.Fatal(err)
+	}
+	if chip.values != 0x9 || p.word != 0x9 {
+		t.Errorf("WriteMasked(0x1, 0x3) over 0xA: got lines %#x, word %#x, want 0x9", chip.values, p.word)
+	}
+	if want := []uint32{0, gpioHandleRequestOutput}; fmt.Sprint(chip.requests) != fmt.Sprint(want) {
+		t.Errorf("requests: got %v, want %v", chip.requests, want)
+	}
+	if p.dir != embd.Out {
+		t.Errorf("direction: got %v, want out", p.dir)
+	}
+
+	// The next ones go through the bulk set of the handle.
+	if err := p.WriteMasked(0x6, 0xC); err != nil {
+		t.Fatal(err)
+	}
+	if chip.values != 0x5 || p.word != 0x5 {
+		t.Errorf("WriteMasked(0x6, 0xC) over 0x9: got lines %#x, word %#x, want 0x5", chip.values, p.word)
+	}
+	if got, err := p.ReadWord(); err != nil || got != 0x5 {
+		t.Errorf("ReadWord: got (%#x, %v), want 0x5", got, err)
+	}
+	if len(chip.requests) != 2 {
+		t.Errorf("requests: got %v, expected no new request for an output port", chip.requests)
+	}
+}
+
+func TestWriteWord(t *testing.T) {
+	chip := &fakeChip{values: 0xF}
+	p, restore := fakePort(chip)
+	defer restore()
+
+	// Writing all the lines has nothing to keep, so nothing to read.
+	if err := p.WriteWord(0x3); err != nil {
+		t.Fatal(err)
+	}
+	if chip.values != 0x3 || p.word != 0x3 {
+		t.Errorf("WriteWord(0x3): got lines %#x, word %#x, want 0x3", chip.values, p.word)
+	}
+	if want := []uint32{gpioHandleRequestOutput}; fmt.Sprint(chip.requests) != fmt.Sprint(want) {
+		t.Errorf("requests: got %v, want %v", chip.requests, want)
+	}
+}
+
+func TestWriteMaskedFailedRequest(t *testing.T) {
+	chip := &fakeChip{err: errors.New("busy")}
+	p, restore := fakePort(chip)
+	defer restore()
+
+	if err := p.WriteWord(0x3); err != chip.err {
+		t.Errorf("WriteWord: got %v, want %v", err, chip.err)
+	}
+	if p.word != 0 || p.handle != nil {
+		t.Errorf("got word %#x, handle %v after a failed request", p.word, p.handle)
+	}
+}
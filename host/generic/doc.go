@@ -3,6 +3,8 @@
 
 	Digital I/O
 	I²C
+	SPI
+	PWM
 	LED control
 
 	They are used by the hosts to satiate the HAL.
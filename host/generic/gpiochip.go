@@ -0,0 +1,74 @@
+// GPIO chip enumeration through the GPIO character device.
+
+package generic
+
+import (
+	"bytes"
+	"os"
+	"unsafe"
+)
+
+const (
+	gpioGetChipInfoCmd = 0x8044B401 // _IOR(0xB4, 0x01, struct gpiochip_info)
+	gpioGetLineInfoCmd = 0xC048B402 // _IOWR(0xB4, 0x02, struct gpioline_info)
+)
+
+type gpioChipInfo struct {
+	name  [32]byte
+	label [32]byte
+	lines uint32
+}
+
+type gpioLineInfo struct {
+	lineOffset uint32
+	flags      uint32
+	name       [32]byte
+	consumer   [32]byte
+}
+
+// ChipInfo describes a gpio chip as reported by its character device.
+type ChipInfo struct {
+	Name  string
+	Label string
+
+	// Lines holds the name of each line of the chip, indexed by offset.
+	// Unnamed lines have an empty name.
+	Lines []string
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// ReadChipInfo queries the gpio chip character device dev (for example
+// /dev/gpiochip0) for its name, label and line names.
+func ReadChipInfo(dev string) (*ChipInfo, error) {
+	file, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ci gpioChipInfo
+	if err := ioctl(file.Fd(), gpioGetChipInfoCmd, unsafe.Pointer(&ci)); err != nil {
+		return nil, err
+	}
+
+	info := &ChipInfo{
+		Name:  cString(ci.name[:]),
+		Label: cString(ci.label[:]),
+		Lines: make([]string, ci.lines),
+	}
+	for i := range info.Lines {
+		li := gpioLineInfo{lineOffset: uint32(i)}
+		if err := ioctl(file.Fd(), gpioGetLineInfoCmd, unsafe.Pointer(&li)); err != nil {
+			return nil, err
+		}
+		info.Lines[i] = cString(li.name[:])
+	}
+
+	return info, nil
+}
@@ -55,7 +55,7 @@ func (b *i2cBus) init() error {
 	}
 
 	var err error
-	if b.file, err = os.OpenFile(fmt.Sprintf("/dev/i2c-%v", b.l), os.O_RDWR, os.ModeExclusive); err != nil {
+	if b.file, err = os.OpenFile(embd.FSPath(fmt.Sprintf("/dev/i2c-%v", b.l)), os.O_RDWR, os.ModeExclusive); err != nil {
 		return err
 	}
 
@@ -79,7 +79,14 @@ func (b *i2cBus) setAddress(addr byte) error {
 	return nil
 }
 
-func (b *i2cBus) ReadByte(addr byte) (byte, error) {
+// observe reports a transaction to the bus hooks.
+func (b *i2cBus) observe(op string, addr byte, n int, start time.Time, err error) {
+	embd.ObserveBus(embd.BusTransaction{Bus: "i2c", Num: b.l, Op: op, Addr: addr, Len: n, Err: err}, start)
+}
+
+func (b *i2cBus) ReadByte(addr byte) (value byte, err error) {
+	defer func(start time.Time) { b.observe("ReadByte", addr, 1, start, err) }(time.Now())
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -101,7 +108,9 @@ func (b *i2cBus) ReadByte(addr byte) (byte, error) {
 	return bytes[0], nil
 }
 
-func (b *i2cBus) ReadBytes(addr byte, num int) ([]byte, error) {
+func (b *i2cBus) ReadBytes(addr byte, num int) (value []byte, err error) {
+	defer func(start time.Time) { b.observe("ReadBytes", addr, num, start, err) }(time.Now())
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -123,7 +132,9 @@ func (b *i2cBus) ReadBytes(addr byte, num int) ([]byte, error) {
 	return bytes, nil
 }
 
-func (b *i2cBus) WriteByte(addr, value byte) error {
+func (b *i2cBus) WriteByte(addr, value byte) (err error) {
+	defer func(start time.Time) { b.observe("WriteByte", addr, 1, start, err) }(time.Now())
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -144,7 +155,9 @@ func (b *i2cBus) WriteByte(addr, value byte) error {
 	return err
 }
 
-func (b *i2cBus) WriteBytes(addr byte, value []byte) error {
+func (b *i2cBus) WriteBytes(addr byte, value []byte) (err error) {
+	defer func(start time.Time) { b.observe("WriteBytes", addr, len(value), start, err) }(time.Now())
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -172,7 +185,9 @@ func (b *i2cBus) WriteBytes(addr byte, value []byte) error {
 	return nil
 }
 
-func (b *i2cBus) ReadFromReg(addr, reg byte, value []byte) error {
+func (b *i2cBus) ReadFromReg(addr, reg byte, value []byte) (err error) {
+	defer func(start time.Time) { b.observe("ReadFromReg", addr, len(value), start, err) }(time.Now())
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -225,7 +240,9 @@ func (b *i2cBus) ReadWordFromReg(addr, reg byte) (uint16, error) {
 	return uint16((uint16(buf[0]) << 8) | uint16(buf[1])), nil
 }
 
-func (b *i2cBus) WriteToReg(addr, reg byte, value []byte) error {
+func (b *i2cBus) WriteToReg(addr, reg byte, value []byte) (err error) {
+	defer func(start time.Time) { b.observe("WriteToReg", addr, len(value), start, err) }(time.Now())
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -259,7 +276,9 @@ func (b *i2cBus) WriteToReg(addr, reg byte, value []byte) error {
 	return nil
 }
 
-func (b *i2cBus) WriteByteToReg(addr, reg, value byte) error {
+func (b *i2cBus) WriteByteToReg(addr, reg, value byte) (err error) {
+	defer func(start time.Time) { b.observe("WriteByteToReg", addr, 1, start, err) }(time.Now())
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -294,7 +313,9 @@ func (b *i2cBus) WriteByteToReg(addr, reg, value byte) error {
 	return nil
 }
 
-func (b *i2cBus) WriteWordToReg(addr, reg byte, value uint16) error {
+func (b *i2cBus) WriteWordToReg(addr, reg byte, value uint16) (err error) {
+	defer func(start time.Time) { b.observe("WriteWordToReg", addr, 2, start, err) }(time.Now())
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
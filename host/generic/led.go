@@ -39,7 +39,7 @@ func (l *led) init() error {
 }
 
 func (l *led) brightnessFilePath() string {
-	return fmt.Sprintf("/sys/class/leds/%v/brightness", l.id)
+	return embd.FSPath(fmt.Sprintf("/sys/class/leds/%v/brightness", l.id))
 }
 
 func (l *led) openFile(path string) (*os.File, error) {
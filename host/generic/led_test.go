@@ -0,0 +1,58 @@
+package generic
+
+import (
+	"testing"
+
+	"github.com/kidoman/embd/fakefs"
+)
+
+func TestLED(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/leds/led0/brightness": "0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	led := NewLED("led0")
+	if err := led.On(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fakefs.ReadFile("/sys/class/leds/led0/brightness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "1" {
+		t.Errorf("On: got brightness %q, want %q", got, "1")
+	}
+	if err := led.Toggle(); err != nil {
+		t.Fatal(err)
+	}
+	// The fake brightness file is a regular file, so the "0" written by
+	// Toggle lands after the "1" written by On.
+	got, err = fakefs.ReadFile("/sys/class/leds/led0/brightness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "10" {
+		t.Errorf("Toggle: got brightness %q, want %q", got, "10")
+	}
+	if err := led.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLEDMissing(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/leds/": "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	if err := NewLED("led0").On(); err == nil {
+		t.Error("On without the led0 directory: got no error")
+	}
+}
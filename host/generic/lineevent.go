@@ -0,0 +1,135 @@
+// Edge capture through the line events of the GPIO character device, which
+// the kernel timestamps as they occur.
+
+package generic
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	gpioGetLineEventCmd = 0xC030B404 // _IOWR(0xB4, 0x04, struct gpioevent_request)
+
+	gpioEventRequestBothEdges = 1<<0 | 1<<1
+	gpioEventRisingEdge       = 0x01
+
+	// The kernel queues 16 events per line.
+	gpioEventsMax = 16
+)
+
+type gpioEventRequest struct {
+	lineOffset    uint32
+	handleFlags   uint32
+	eventFlags    uint32
+	consumerLabel [32]byte
+	fd            int32
+}
+
+type gpioEventData struct {
+	timestamp uint64
+	id        uint32
+	_         uint32
+}
+
+// LineEvent is an edge of a gpio line.
+type LineEvent struct {
+	// Rising tells a rising edge from a falling one.
+	Rising bool
+	// Time is the kernel timestamp of the edge.
+	Time time.Duration
+}
+
+// PulseLine drives the line offset of the gpio chip character device dev
+// low for pulse, then releases it and returns the edges of the line, until
+// max of them are received or none is for idle. It is meant for the single
+// wire protocols, where the timing of the answer is too tight for polling
+// the line from user space: the edges keep their time however late they are
+// read. Those of the first microseconds after the release may be missed.
+// The kernel queues gpioEventsMax edges only, and drops the next ones when
+// they are not read in time: PulseLine fails if the queue was found full and
+// fewer than max edges were received.
+func PulseLine(dev string, offset int, pulse time.Duration, max int, idle time.Duration) ([]LineEvent, error) {
+	chip, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer chip.Close()
+
+	handle := gpioHandleRequest{flags: gpioHandleRequestOutput, lines: 1}
+	handle.lineOffsets[0] = uint32(offset)
+	copy(handle.consumerLabel[:], gpioConsumer)
+	if err := ioctl(chip.Fd(), gpioGetLineHandleCmd, unsafe.Pointer(&handle)); err != nil {
+		return nil, err
+	}
+	time.Sleep(pulse)
+	// The line is still driven low once its handle is closed, until the
+	// event request turns it into an input.
+	if err := syscall.Close(int(handle.fd)); err != nil {
+		return nil, err
+	}
+
+	req := gpioEventRequest{
+		lineOffset:  uint32(offset),
+		handleFlags: gpioHandleRequestInput,
+		eventFlags:  gpioEventRequestBothEdges,
+	}
+	copy(req.consumerLabel[:], gpioConsumer)
+	if err := ioctl(chip.Fd(), gpioGetLineEventCmd, unsafe.Pointer(&req)); err != nil {
+		return nil, err
+	}
+	fd := int(req.fd)
+	defer syscall.Close(fd)
+
+	epfd, err := syscall.EpollCreate1(0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(epfd)
+	event := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &event); err != nil {
+		return nil, err
+	}
+
+	timeout := int((idle + time.Millisecond - 1) / time.Millisecond)
+	var (
+		epollEvents [1]syscall.EpollEvent
+		data        [gpioEventsMax]gpioEventData
+		edges       []LineEvent
+		full        bool
+	)
+	buf := (*[unsafe.Sizeof(data)]byte)(unsafe.Pointer(&data))[:]
+	for len(edges) < max {
+		n, err := syscall.EpollWait(epfd, epollEvents[:], timeout)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		n, err = syscall.Read(fd, buf)
+		if err != nil {
+			return nil, err
+		}
+		n /= int(unsafe.Sizeof(data[0]))
+		if n == gpioEventsMax {
+			full = true
+		}
+		for _, e := range data[:n] {
+			edges = append(edges, LineEvent{Rising: e.id == gpioEventRisingEdge, Time: time.Duration(e.timestamp)})
+		}
+	}
+	if len(edges) > max {
+		edges = edges[:max]
+	}
+	if full && len(edges) < max {
+		return nil, fmt.Errorf("gpio: got %v of %v edges, the kernel queue of %v events may have overflowed", len(edges), max, gpioEventsMax)
+	}
+	return edges, nil
+}
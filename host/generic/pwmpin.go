@@ -0,0 +1,301 @@
+// PWM support.
+// This driver uses the sysfs PWM interface (/sys/class/pwm) found on kernel
+// version 3.12+. The chip and channel of a pin are taken from the first of
+// its ID or aliases of the form "pwmchipN/pwmM".
+
+package generic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/util"
+)
+
+const (
+	// PWMDefaultPeriod represents the default period (500000ns) for pwm. Equals 2000 Hz.
+	PWMDefaultPeriod = 500000
+
+	// PWMMaxPulseWidth represents the max period (1000000000ns) supported by pwm. Equals 1 Hz.
+	PWMMaxPulseWidth = 1000000000
+)
+
+type pwmPin struct {
+	id string
+
+	drv embd.GPIODriver
+
+	chip    int
+	channel int
+	found   bool
+
+	period   int
+	polarity embd.Polarity
+	enabled  bool
+
+	dutyf     *os.File
+	periodf   *os.File
+	polarityf *os.File
+	enablef   *os.File
+
+	initialized bool
+}
+
+// NewPWMPin returns a PWMPin driving a channel of a sysfs pwm chip.
+func NewPWMPin(pd *embd.PinDesc, drv embd.GPIODriver) embd.PWMPin {
+	p := &pwmPin{id: pd.ID, drv: drv}
+	for _, key := range append([]string{pd.ID}, pd.Aliases...) {
+		if chip, channel, ok := ParsePWMChannel(key); ok {
+			p.chip, p.channel, p.found = chip, channel, true
+			break
+		}
+	}
+	return p
+}
+
+// PWMChannel returns the "pwmchipN/pwmM" key naming a channel of a sysfs
+// pwm chip.
+func PWMChannel(chip, channel int) string {
+	return fmt.Sprintf("pwmchip%v/pwm%v", chip, channel)
+}
+
+// ParsePWMChannel is the inverse of PWMChannel.
+func ParsePWMChannel(key string) (chip, channel int, ok bool) {
+	if _, err := fmt.Sscanf(key, "pwmchip%d/pwm%d", &chip, &channel); err != nil {
+		return 0, 0, false
+	}
+	return chip, channel, key == PWMChannel(chip, channel)
+}
+
+func (p *pwmPin) N() string {
+	return p.id
+}
+
+func (p *pwmPin) chipPath() string {
+	return embd.FSPath(fmt.Sprintf("/sys/class/pwm/pwmchip%v", p.chip))
+}
+
+func (p *pwmPin) basePath() string {
+	return path.Join(p.chipPath(), fmt.Sprintf("pwm%v", p.channel))
+}
+
+func (p *pwmPin) init() error {
+	if p.initialized {
+		return nil
+	}
+	if !p.found {
+		return fmt.Errorf("embd: pin %v is not mapped to a pwm channel", p.id)
+	}
+
+	if err := p.export(); err != nil {
+		return err
+	}
+	basePath := p.basePath()
+	if err := p.ensureChannelExists(basePath, 500*time.Millisecond); err != nil {
+		return err
+	}
+
+	var err error
+	if p.periodf, err = p.openFile(path.Join(basePath, "period")); err != nil {
+		return err
+	}
+	if p.dutyf, err = p.openFile(path.Join(basePath, "duty_cycle")); err != nil {
+		return err
+	}
+	if p.polarityf, err = p.openFile(path.Join(basePath, "polarity")); err != nil {
+		return err
+	}
+	if p.enablef, err = p.openFile(path.Join(basePath, "enable")); err != nil {
+		return err
+	}
+
+	p.initialized = true
+
+	return nil
+}
+
+func (p *pwmPin) writeChipFile(name string) error {
+	file, err := os.OpenFile(path.Join(p.chipPath(), name), os.O_WRONLY, os.ModeExclusive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(strconv.Itoa(p.channel))
+	return err
+}
+
+func (p *pwmPin) export() error {
+	err := p.writeChipFile("export")
+	if e, ok := err.(*os.PathError); ok && e.Err == syscall.EBUSY {
+		return nil // EBUSY -> the channel has already been exported
+	}
+	return err
+}
+
+func (p *pwmPin) unexport() error {
+	return p.writeChipFile("unexport")
+}
+
+// ensureChannelExists waits for udev to set up the freshly exported channel.
+func (p *pwmPin) ensureChannelExists(basePath string, d time.Duration) error {
+	timeout := time.After(d)
+
+	for {
+		select {
+		case <-timeout:
+			return fmt.Errorf("embd: pwm channel %v not found before timeout", basePath)
+		default:
+			if _, err := os.Stat(path.Join(basePath, "enable")); err == nil {
+				return nil
+			}
+		}
+
+		// We are looping, wait a bit.
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (p *pwmPin) openFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY, os.ModeExclusive)
+}
+
+func (p *pwmPin) enable(b bool) error {
+	if p.enabled == b {
+		return nil
+	}
+	v := "0"
+	if b {
+		v = "1"
+	}
+	if _, err := p.enablef.WriteString(v); err != nil {
+		return err
+	}
+	p.enabled = b
+	return nil
+}
+
+func (p *pwmPin) SetPeriod(ns int) error {
+	if err := p.init(); err != nil {
+		return err
+	}
+
+	if ns > PWMMaxPulseWidth {
+		return fmt.Errorf("embd: pwm period for %v is out of bounds (must be =< %vns)", p.id, PWMMaxPulseWidth)
+	}
+
+	if _, err := p.periodf.WriteString(strconv.Itoa(ns)); err != nil {
+		return err
+	}
+
+	p.period = ns
+
+	return p.enable(true)
+}
+
+func (p *pwmPin) SetDuty(ns int) error {
+	if err := p.init(); err != nil {
+		return err
+	}
+
+	if p.period == 0 {
+		if err := p.SetPeriod(PWMDefaultPeriod); err != nil {
+			return err
+		}
+	}
+	if ns > p.period {
+		return fmt.Errorf("embd: pwm duty %v for pin %v is greater than the period %v", ns, p.id, p.period)
+	}
+
+	if _, err := p.dutyf.WriteString(strconv.Itoa(ns)); err != nil {
+		return err
+	}
+
+	return p.enable(true)
+}
+
+func (p *pwmPin) SetMicroseconds(us int) error {
+	if err := p.init(); err != nil {
+		return err
+	}
+
+	if p.period != 20000000 {
+		glog.Warningf("embd: pwm pin %v has period %vns. recommended 20000000ns (50 hz) for servo mode", p.id, p.period)
+	}
+	return p.SetDuty(us * 1000)
+}
+
+func (p *pwmPin) SetAnalog(value byte) error {
+	if err := p.init(); err != nil {
+		return err
+	}
+
+	if p.period == 0 {
+		if err := p.SetPeriod(PWMDefaultPeriod); err != nil {
+			return err
+		}
+	}
+	duty := util.Map(int64(value), 0, 255, 0, int64(p.period))
+	return p.SetDuty(int(duty))
+}
+
+// SetPolarity sets the polarity of the channel. The kernel only accepts
+// polarity changes while the channel is disabled, so it is briefly stopped.
+func (p *pwmPin) SetPolarity(pol embd.Polarity) error {
+	if err := p.init(); err != nil {
+		return err
+	}
+
+	var v string
+	switch pol {
+	case embd.Positive:
+		v = "normal"
+	case embd.Negative:
+		v = "inversed"
+	default:
+		return errors.New("embd: invalid pwm polarity")
+	}
+
+	enabled := p.enabled
+	if err := p.enable(false); err != nil {
+		return err
+	}
+	if _, err := p.polarityf.WriteString(v); err != nil {
+		return err
+	}
+	p.polarity = pol
+
+	return p.enable(enabled)
+}
+
+func (p *pwmPin) Close() error {
+	if err := p.drv.Unregister(p.id); err != nil {
+		return err
+	}
+
+	if !p.initialized {
+		return nil
+	}
+
+	if err := p.enable(false); err != nil {
+		return err
+	}
+	for _, f := range []*os.File{p.periodf, p.dutyf, p.polarityf, p.enablef} {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	if err := p.unexport(); err != nil {
+		return err
+	}
+
+	p.initialized = false
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package generic
+
+import (
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakefs"
+)
+
+func TestParsePWMChannel(t *testing.T) {
+	var tests = []struct {
+		key           string
+		chip, channel int
+		ok            bool
+	}{
+		{"pwmchip0/pwm1", 0, 1, true},
+		{"pwmchip12/pwm0", 12, 0, true},
+		{"pwmchip0/pwm1x", 0, 0, false},
+		{"P1_12", 0, 0, false},
+		{"pwmchip0", 0, 0, false},
+	}
+	for _, test := range tests {
+		chip, channel, ok := ParsePWMChannel(test.key)
+		if ok != test.ok || ok && (chip != test.chip || channel != test.channel) {
+			t.Errorf("ParsePWMChannel(%q): got %v, %v, %v; want %v, %v, %v", test.key, chip, channel, ok, test.chip, test.channel, test.ok)
+		}
+	}
+}
+
+func TestPWMPin(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/pwm/pwmchip0/export":          "",
+		"sys/class/pwm/pwmchip0/unexport":        "",
+		"sys/class/pwm/pwmchip0/pwm1/period":     "",
+		"sys/class/pwm/pwmchip0/pwm1/duty_cycle": "",
+		"sys/class/pwm/pwmchip0/pwm1/polarity":   "",
+		"sys/class/pwm/pwmchip0/pwm1/enable":     "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	pinMap := embd.PinMap{
+		&embd.PinDesc{ID: "PWM1", Aliases: []string{PWMChannel(0, 1)}, Caps: embd.CapPWM},
+	}
+	driver := embd.NewGPIODriver(pinMap, nil, nil, NewPWMPin)
+	pin, err := driver.PWMPin("PWM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetPeriod(20000000); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetDuty(1500000); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetDuty(30000000); err == nil {
+		t.Error("SetDuty above the period: got no error")
+	}
+	if err := pin.SetPolarity(embd.Negative); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var files = []struct {
+		name, want string
+	}{
+		{"/sys/class/pwm/pwmchip0/export", "1"},
+		{"/sys/class/pwm/pwmchip0/unexport", "1"},
+		{"/sys/class/pwm/pwmchip0/pwm1/period", "20000000"},
+		{"/sys/class/pwm/pwmchip0/pwm1/duty_cycle", "1500000"},
+		{"/sys/class/pwm/pwmchip0/pwm1/polarity", "inversed"},
+		{"/sys/class/pwm/pwmchip0/pwm1/enable", "1010"},
+	}
+	for _, f := range files {
+		got, err := fakefs.ReadFile(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != f.want {
+			t.Errorf("%v: got %q, want %q", f.name, got, f.want)
+		}
+	}
+}
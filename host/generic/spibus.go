@@ -5,6 +5,7 @@ import (
 	"os"
 	"sync"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/golang/glog"
@@ -87,7 +88,7 @@ func (b *spiBus) init() error {
 	}
 
 	var err error
-	if b.file, err = os.OpenFile(fmt.Sprintf("/dev/spidev%v.%v", b.spiDevMinor, b.channel), os.O_RDWR, os.ModeExclusive); err != nil {
+	if b.file, err = os.OpenFile(embd.FSPath(fmt.Sprintf("/dev/spidev%v.%v", b.spiDevMinor, b.channel)), os.O_RDWR, os.ModeExclusive); err != nil {
 		return err
 	}
 	glog.V(3).Infof("spi: sucessfully opened file /dev/spidev%v.%v", b.spiDevMinor, b.channel)
@@ -176,7 +177,14 @@ func (b *spiBus) setDelay() {
 	b.spiTransferData.delayus = delay
 }
 
-func (b *spiBus) TransferAndReceiveData(dataBuffer []uint8) error {
+// observe reports a transaction to the bus hooks.
+func (b *spiBus) observe(op string, n int, start time.Time, err error) {
+	embd.ObserveBus(embd.BusTransaction{Bus: "spi", Num: byte(b.spiDevMinor), Channel: b.channel, Op: op, Len: n, Err: err}, start)
+}
+
+func (b *spiBus) TransferAndReceiveData(dataBuffer []uint8) (err error) {
+	defer func(start time.Time) { b.observe("TransferAndReceiveData", len(dataBuffer), start, err) }(time.Now())
+
 	if err := b.init(); err != nil {
 		return err
 	}
@@ -236,6 +244,8 @@ func (b *spiBus) ReceiveByte() (byte, error) {
 }
 
 func (b *spiBus) Write(data []byte) (n int, err error) {
+	defer func(start time.Time) { b.observe("Write", len(data), start, err) }(time.Now())
+
 	if err := b.init(); err != nil {
 		return 0, err
 	}
@@ -0,0 +1,120 @@
+/*
+	Package linux provides a fallback host for Linux boards embd has no
+	dedicated support for.
+
+	The host is built from the devices the kernel exposes:
+
+	GPIO (digital (rw)) from /dev/gpiochip*, using the line names as aliases
+	PWM from /sys/class/pwm/*
+	I²C from /dev/i2c-*
+	SPI from /dev/spidev*.*
+	LED from /sys/class/leds/*
+
+	It is used when DetectHost does not recognize the board, and can be
+	selected explicitly with embd.SetHost(embd.HostGeneric, 0).
+*/
+package linux
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/host/generic"
+)
+
+// Describe returns a descriptor for the devices found on the host. Features
+// without any device are left out of the descriptor.
+func (d *Devices) Describe() *embd.Descriptor {
+	desc := &embd.Descriptor{}
+
+	if pins := d.PinMap(); len(pins) > 0 {
+		desc.GPIODriver = func() embd.GPIODriver {
+			return embd.NewGPIODriverWithPorts(pins, generic.NewDigitalPin, nil, generic.NewPWMPin, generic.NewDigitalPort)
+		}
+	}
+	if len(d.I2CBuses) > 0 {
+		desc.I2CDriver = func() embd.I2CDriver {
+			return embd.NewI2CDriver(generic.NewI2CBus)
+		}
+	}
+	if leds := d.LEDMap(); len(leds) > 0 {
+		desc.LEDDriver = func() embd.LEDDriver {
+			return embd.NewLEDDriver(leds, generic.NewLED)
+		}
+	}
+	if len(d.SPIDevices) > 0 {
+		// The SPI driver is bound to a single bus, pick the first one.
+		minor := d.SPIDevices[0].Bus
+		desc.SPIDriver = func() embd.SPIDriver {
+			return embd.NewSPIDriver(minor, generic.NewSPIBus, nil)
+		}
+	}
+
+	return desc
+}
+
+// PinMap returns a pin for every gpio line and pwm channel. GPIO pins are
+// named GPIO_N after their sysfs number N and can also be looked up by that
+// number, by chip and offset ("gpiochip0:17") and by line name when it is
+// unique.
+func (d *Devices) PinMap() embd.PinMap {
+	names := make(map[string]int)
+	for _, c := range d.GPIOChips {
+		for _, name := range c.Lines {
+			names[name]++
+		}
+	}
+
+	var pins embd.PinMap
+	for _, c := range d.GPIOChips {
+		if c.Base < 0 {
+			glog.Warningf("linux: gpio chip %v (%v) has no sysfs entry, skipping its lines", c.Name, c.Label)
+			continue
+		}
+		for i, name := range c.Lines {
+			n := c.Base + i
+			aliases := []string{strconv.Itoa(n), fmt.Sprintf("%v:%v", c.Name, i)}
+			if name != "" && names[name] == 1 {
+				aliases = append(aliases, name)
+			}
+			pins = append(pins, &embd.PinDesc{
+				ID:             fmt.Sprintf("GPIO_%v", n),
+				Aliases:        aliases,
+				Caps:           embd.CapDigital,
+				DigitalLogical: n,
+			})
+		}
+	}
+	for _, c := range d.PWMChips {
+		for i := 0; i < c.Channels; i++ {
+			pins = append(pins, &embd.PinDesc{
+				ID:   generic.PWMChannel(c.N, i),
+				Caps: embd.CapPWM,
+			})
+		}
+	}
+
+	return pins
+}
+
+// LEDMap returns the LEDs, which can be looked up by name or by index.
+func (d *Devices) LEDMap() embd.LEDMap {
+	leds := make(embd.LEDMap)
+	for i, name := range d.LEDs {
+		leds[name] = []string{strconv.Itoa(i), name}
+	}
+	return leds
+}
+
+func init() {
+	embd.Register(embd.HostGeneric, func(rev int) *embd.Descriptor {
+		devices, err := Scan()
+		if err != nil {
+			glog.Errorf("linux: scanning devices: %v", err)
+			return &embd.Descriptor{}
+		}
+		return devices.Describe()
+	})
+}
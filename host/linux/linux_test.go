@@ -0,0 +1,174 @@
+package linux
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakefs"
+	"github.com/kidoman/embd/host/generic"
+)
+
+var fakeChips = map[string]*generic.ChipInfo{
+	"gpiochip0":  {Name: "gpiochip0", Label: "pinctrl", Lines: []string{"SDA", "SCL", "NC", "NC"}},
+	"gpiochip1":  {Name: "gpiochip1", Label: "usb-bridge", Lines: []string{"", ""}},
+	"gpiochip10": {Name: "gpiochip10", Label: "expander", Lines: []string{"LED", ""}},
+}
+
+func fakeTree(t *testing.T) func() {
+	readChipInfo = func(dev string) (*generic.ChipInfo, error) {
+		return fakeChips[filepath.Base(dev)], nil
+	}
+
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"dev/gpiochip0":  "",
+		"dev/gpiochip1":  "",
+		"dev/gpiochip10": "",
+		"dev/i2c-10":     "",
+		"dev/i2c-1":      "",
+		"dev/spidev1.0":  "",
+		"dev/spidev0.1":  "",
+		"dev/spidev0.0":  "",
+		"sys/class/gpio/gpiochip0/device/gpiochip0/":    "",
+		"sys/class/gpio/gpiochip0/base":                 "0\n",
+		"sys/class/gpio/gpiochip500/device/gpiochip10/": "",
+		"sys/class/gpio/gpiochip500/base":               "500\n",
+		"sys/class/leds/led1/":                          "",
+		"sys/class/leds/led0/":                          "",
+		"sys/class/pwm/pwmchip0/npwm":                   "2\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return restore
+}
+
+func TestScan(t *testing.T) {
+	defer fakeTree(t)()
+
+	d, err := Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Devices{
+		GPIOChips: []GPIOChip{
+			{Name: "gpiochip0", Label: "pinctrl", Base: 0, Lines: []string{"SDA", "SCL", "NC", "NC"}},
+			{Name: "gpiochip1", Label: "usb-bridge", Base: -1, Lines: []string{"", ""}},
+			{Name: "gpiochip10", Label: "expander", Base: 500, Lines: []string{"LED", ""}},
+		},
+		I2CBuses:   []byte{1, 10},
+		SPIDevices: []SPIDevice{{0, 0}, {0, 1}, {1, 0}},
+		LEDs:       []string{"led0", "led1"},
+		PWMChips:   []PWMChip{{N: 0, Channels: 2}},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("Scan: got %+v, want %+v", d, want)
+	}
+}
+
+func TestScanFailures(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"dev/gpiochip0": "",
+		"dev/gpiochip1": "",
+		"dev/i2c-1":     "",
+		"sys/class/gpio/gpiochip0/device/gpiochip0/": "",
+		"sys/class/gpio/gpiochip0/base":              "0\n",
+		"sys/class/pwm/pwmchip0/":                    "",
+		"sys/class/pwm/pwmchip1/npwm":                "1\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+	readChipInfo = func(dev string) (*generic.ChipInfo, error) {
+		if filepath.Base(dev) == "gpiochip1" {
+			return nil, errors.New("permission denied")
+		}
+		return fakeChips[filepath.Base(dev)], nil
+	}
+
+	// The unreadable gpio and pwm chips are skipped.
+	d, err := Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Devices{
+		GPIOChips: []GPIOChip{{Name: "gpiochip0", Label: "pinctrl", Base: 0, Lines: []string{"SDA", "SCL", "NC", "NC"}}},
+		I2CBuses:  []byte{1},
+		PWMChips:  []PWMChip{{N: 1, Channels: 1}},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("Scan: got %+v, want %+v", d, want)
+	}
+}
+
+func TestPinMap(t *testing.T) {
+	defer fakeTree(t)()
+
+	d, err := Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins := d.PinMap()
+
+	// 4 + 2 gpio lines of the chips with a sysfs entry and 2 pwm channels.
+	if len(pins) != 8 {
+		t.Fatalf("PinMap: got %v pins, want 8", len(pins))
+	}
+
+	var tests = []struct {
+		key  interface{}
+		cap  int
+		id   string
+		n    int
+		miss bool
+	}{
+		{key: 1, cap: embd.CapDigital, id: "GPIO_1", n: 1},
+		{key: "SDA", cap: embd.CapDigital, id: "GPIO_0", n: 0},
+		{key: "LED", cap: embd.CapDigital, id: "GPIO_500", n: 500},
+		{key: "gpiochip10:1", cap: embd.CapDigital, id: "GPIO_501", n: 501},
+		{key: "NC", cap: embd.CapDigital, miss: true},
+		{key: "pwmchip0/pwm1", cap: embd.CapPWM, id: "pwmchip0/pwm1"},
+	}
+	for _, test := range tests {
+		pd, found := pins.Lookup(test.key, test.cap)
+		if found == test.miss {
+			t.Errorf("Lookup(%v): found %v", test.key, found)
+			continue
+		}
+		if test.miss {
+			continue
+		}
+		if pd.ID != test.id || pd.DigitalLogical != test.n {
+			t.Errorf("Lookup(%v): got %v (%v), want %v (%v)", test.key, pd.ID, pd.DigitalLogical, test.id, test.n)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	desc := (&Devices{}).Describe()
+	if desc.GPIODriver != nil || desc.I2CDriver != nil || desc.LEDDriver != nil || desc.SPIDriver != nil {
+		t.Error("Describe without devices: got drivers")
+	}
+
+	defer fakeTree(t)()
+
+	d, err := Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc = d.Describe()
+	if desc.GPIODriver == nil || desc.I2CDriver == nil || desc.LEDDriver == nil || desc.SPIDriver == nil {
+		t.Fatal("Describe: missing drivers")
+	}
+	led, err := desc.LEDDriver().LED(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if led == nil {
+		t.Error("LED 1: got nil")
+	}
+}
@@ -0,0 +1,249 @@
+// Device enumeration.
+
+package linux
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/host/generic"
+)
+
+// readChipInfo is replaced in tests, as the character devices cannot be
+// faked with plain files.
+var readChipInfo = generic.ReadChipInfo
+
+// GPIOChip describes a gpio chip.
+type GPIOChip struct {
+	// Name is the name of the character device, e.g. "gpiochip0".
+	Name  string
+	Label string
+
+	// Base is the sysfs number of the first line, or -1 if the chip is not
+	// exported through sysfs.
+	Base int
+
+	// Lines holds the name of each line, indexed by offset.
+	Lines []string
+}
+
+// SPIDevice identifies a spidev device node.
+type SPIDevice struct {
+	Bus, ChipSelect int
+}
+
+// PWMChip describes a sysfs pwm chip.
+type PWMChip struct {
+	N        int
+	Channels int
+}
+
+// Devices lists the devices found on the host.
+type Devices struct {
+	GPIOChips  []GPIOChip
+	I2CBuses   []byte
+	SPIDevices []SPIDevice
+	LEDs       []string
+	PWMChips   []PWMChip
+}
+
+// Scan enumerates the gpio chips, I²C buses, SPI devices, LEDs and pwm chips
+// of the host. The devices which cannot be enumerated are logged and
+// skipped, an error is only returned when none of the kinds of devices
+// could be.
+func Scan() (*Devices, error) {
+	var d Devices
+	var errs []error
+	check := func(kind string, err error) {
+		if err != nil {
+			glog.Errorf("linux: scanning %v: %v", kind, err)
+			errs = append(errs, err)
+		}
+	}
+
+	var err error
+	d.GPIOChips, err = scanGPIOChips()
+	check("gpio chips", err)
+	d.I2CBuses, err = scanI2CBuses()
+	check("i2c buses", err)
+	d.SPIDevices, err = scanSPIDevices()
+	check("spi devices", err)
+	d.LEDs, err = scanLEDs()
+	check("leds", err)
+	d.PWMChips, err = scanPWMChips()
+	check("pwm chips", err)
+
+	if len(errs) == 5 {
+		return nil, fmt.Errorf("linux: no devices could be enumerated: %v", errs[0])
+	}
+	return &d, nil
+}
+
+// glob returns the matches of pattern within dir sorted by the number found
+// after prefix, so that gpiochip10 comes after gpiochip9.
+func glob(dir, prefix, suffix string) ([]string, []int, error) {
+	matches, err := filepath.Glob(path.Join(dir, prefix+"*"+suffix))
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	var ns []int
+	for _, m := range matches {
+		name := path.Base(m)
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix))
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+		ns = append(ns, n)
+	}
+	sort.Sort(byNumber{names, ns})
+	return names, ns, nil
+}
+
+type byNumber struct {
+	names []string
+	ns    []int
+}
+
+func (s byNumber) Len() int           { return len(s.names) }
+func (s byNumber) Less(i, j int) bool { return s.ns[i] < s.ns[j] }
+func (s byNumber) Swap(i, j int) {
+	s.names[i], s.names[j] = s.names[j], s.names[i]
+	s.ns[i], s.ns[j] = s.ns[j], s.ns[i]
+}
+
+func readInt(path string) (int, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(bytes)))
+}
+
+func scanGPIOChips() ([]GPIOChip, error) {
+	names, _, err := glob(embd.FSPath("/dev"), "gpiochip", "")
+	if err != nil {
+		return nil, err
+	}
+	bases := gpioBases()
+
+	var chips []GPIOChip
+	for _, name := range names {
+		info, err := readChipInfo(embd.FSPath(path.Join("/dev", name)))
+		if err != nil {
+			glog.Errorf("linux: reading gpio chip %v, skipping it: %v", name, err)
+			continue
+		}
+		base, ok := bases[name]
+		if !ok {
+			base = -1
+		}
+		chips = append(chips, GPIOChip{Name: name, Label: info.Label, Base: base, Lines: info.Lines})
+	}
+	return chips, nil
+}
+
+// gpioBases maps the gpio chip character devices to the sysfs number of
+// their first line. The chips whose base cannot be read are left out.
+func gpioBases() map[string]int {
+	bases := make(map[string]int)
+	chips, _ := filepath.Glob(embd.FSPath("/sys/class/gpio/gpiochip*"))
+	for _, c := range chips {
+		devs, _ := filepath.Glob(path.Join(c, "device", "gpiochip*"))
+		if len(devs) == 0 {
+			continue
+		}
+		base, err := readInt(path.Join(c, "base"))
+		if err != nil {
+			glog.Errorf("linux: reading the base of %v: %v", path.Base(c), err)
+			continue
+		}
+		bases[path.Base(devs[0])] = base
+	}
+	return bases
+}
+
+func scanI2CBuses() ([]byte, error) {
+	_, ns, err := glob(embd.FSPath("/dev"), "i2c-", "")
+	if err != nil {
+		return nil, err
+	}
+	var buses []byte
+	for _, n := range ns {
+		if n > 255 {
+			continue
+		}
+		buses = append(buses, byte(n))
+	}
+	return buses, nil
+}
+
+func scanSPIDevices() ([]SPIDevice, error) {
+	matches, err := filepath.Glob(embd.FSPath("/dev/spidev*.*"))
+	if err != nil {
+		return nil, err
+	}
+	var devs []SPIDevice
+	for _, m := range matches {
+		var d SPIDevice
+		if _, err := fmt.Sscanf(path.Base(m), "spidev%d.%d", &d.Bus, &d.ChipSelect); err != nil {
+			continue
+		}
+		devs = append(devs, d)
+	}
+	sort.Sort(bySPIDevice(devs))
+	return devs, nil
+}
+
+type bySPIDevice []SPIDevice
+
+func (s bySPIDevice) Len() int      { return len(s) }
+func (s bySPIDevice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySPIDevice) Less(i, j int) bool {
+	if s[i].Bus != s[j].Bus {
+		return s[i].Bus < s[j].Bus
+	}
+	return s[i].ChipSelect < s[j].ChipSelect
+}
+
+func scanLEDs() ([]string, error) {
+	infos, err := ioutil.ReadDir(embd.FSPath("/sys/class/leds"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var leds []string
+	for _, info := range infos {
+		leds = append(leds, info.Name())
+	}
+	return leds, nil
+}
+
+func scanPWMChips() ([]PWMChip, error) {
+	classPath := embd.FSPath("/sys/class/pwm")
+	names, ns, err := glob(classPath, "pwmchip", "")
+	if err != nil {
+		return nil, err
+	}
+	var chips []PWMChip
+	for i, name := range names {
+		npwm, err := readInt(path.Join(classPath, name, "npwm"))
+		if err != nil {
+			glog.Errorf("linux: reading pwm chip %v, skipping it: %v", name, err)
+			continue
+		}
+		chips = append(chips, PWMChip{N: ns[i], Channels: npwm})
+	}
+	return chips, nil
+}
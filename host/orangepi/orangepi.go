@@ -0,0 +1,146 @@
+// Package orangepi provides support for the Allwinner H3/H5 based Orange Pi
+// boards with a 40-pin header (PC, PC Plus, One, Lite, Plus 2E, PC2, Prime).
+// References:
+//   http://linux-sunxi.org/Orange_Pi_PC
+//   http://linux-sunxi.org/GPIO
+//
+// The following features are supported on mainline Linux kernels
+//   GPIO (digital (rw))
+//   I²C
+//   SPI
+//   LED
+//
+// Header pins are named P1_N after their physical position, like on the
+// Raspberry Pi, and can also be addressed by their Allwinner name (e.g. PA12)
+// and their sysfs gpio number.
+
+package orangepi
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/host/generic"
+)
+
+// The buses routed to the header. SPI0 shows up as /dev/spidev0.0 and the
+// UARTs as /dev/ttySn once enabled in the device tree.
+var (
+	I2CBuses = []byte{0, 1}
+	SPIBuses = []int{0}
+	UARTs    = []int{1, 2, 3}
+)
+
+var spiDeviceMinor = 0
+
+// PinNumber returns the sysfs gpio number of the Allwinner pin name, where
+// each port from PA to PL has 32 lines: PA12 is 12, PG8 is 6*32+8 = 200.
+func PinNumber(name string) (int, error) {
+	if len(name) < 3 || name[0] != 'P' || name[1] < 'A' || name[1] > 'L' {
+		return 0, fmt.Errorf("orangepi: invalid pin name %q", name)
+	}
+	n, err := strconv.Atoi(name[2:])
+	if err != nil || n < 0 || n > 31 {
+		return 0, fmt.Errorf("orangepi: invalid pin name %q", name)
+	}
+	return int(name[1]-'A')*32 + n, nil
+}
+
+// PinName is the inverse of PinNumber.
+func PinName(n int) string {
+	return fmt.Sprintf("P%c%v", 'A'+n/32, n%32)
+}
+
+func header(pos int, name string, caps int, aliases ...string) *embd.PinDesc {
+	n, err := PinNumber(name)
+	if err != nil {
+		panic(err)
+	}
+	return &embd.PinDesc{
+		ID:             fmt.Sprintf("P1_%v", pos),
+		Aliases:        append([]string{name, strconv.Itoa(n), fmt.Sprintf("GPIO_%v", n)}, aliases...),
+		Caps:           caps,
+		DigitalLogical: n,
+	}
+}
+
+var pins = embd.PinMap{
+	header(3, "PA12", embd.CapDigital|embd.CapI2C, "SDA", "I2C0_SDA"),
+	header(5, "PA11", embd.CapDigital|embd.CapI2C, "SCL", "I2C0_SCL"),
+	header(7, "PA6", embd.CapDigital),
+	header(8, "PA13", embd.CapDigital|embd.CapUART, "UART3_TX"),
+	header(10, "PA14", embd.CapDigital|embd.CapUART, "UART3_RX"),
+	header(11, "PA1", embd.CapDigital|embd.CapUART, "UART2_RX"),
+	header(12, "PD14", embd.CapDigital),
+	header(13, "PA0", embd.CapDigital|embd.CapUART, "UART2_TX"),
+	header(15, "PA3", embd.CapDigital|embd.CapUART, "UART2_CTS"),
+	header(16, "PC4", embd.CapDigital),
+	header(18, "PC7", embd.CapDigital),
+	header(19, "PC0", embd.CapDigital|embd.CapSPI, "MOSI", "SPI0_MOSI"),
+	header(21, "PC1", embd.CapDigital|embd.CapSPI, "MISO", "SPI0_MISO"),
+	header(22, "PA2", embd.CapDigital|embd.CapUART, "UART2_RTS"),
+	header(23, "PC2", embd.CapDigital|embd.CapSPI, "SCLK", "SPI0_CLK"),
+	header(24, "PC3", embd.CapDigital|embd.CapSPI, "CE0", "SPI0_CS0"),
+	header(26, "PA21", embd.CapDigital, "PCM0_DIN"),
+	header(27, "PA19", embd.CapDigital|embd.CapI2C, "I2C1_SDA"),
+	header(28, "PA18", embd.CapDigital|embd.CapI2C, "I2C1_SCL"),
+	header(29, "PA7", embd.CapDigital),
+	header(31, "PA8", embd.CapDigital),
+	header(32, "PG8", embd.CapDigital|embd.CapUART, "UART1_RTS"),
+	header(33, "PA9", embd.CapDigital),
+	header(35, "PA10", embd.CapDigital),
+	header(36, "PG9", embd.CapDigital|embd.CapUART, "UART1_CTS"),
+	header(37, "PA20", embd.CapDigital, "PCM0_DOUT"),
+	header(38, "PG6", embd.CapDigital|embd.CapUART, "UART1_TX"),
+	header(40, "PG7", embd.CapDigital|embd.CapUART, "UART1_RX"),
+}
+
+// The onboard LEDs are named differently by the older and the newer
+// mainline device trees.
+var ledMaps = []embd.LEDMap{
+	{
+		"orangepi:green:pwr":  []string{"0", "PWR", "pwr", "green"},
+		"orangepi:red:status": []string{"1", "STATUS", "status", "red"},
+	},
+	{
+		"green:power": []string{"0", "PWR", "pwr", "green"},
+		"red:status":  []string{"1", "STATUS", "status", "red"},
+	},
+}
+
+// ledMap returns the LED map matching the LEDs present on the host.
+func ledMap() embd.LEDMap {
+	for _, m := range ledMaps {
+		found := true
+		for id := range m {
+			if _, err := os.Stat(embd.FSPath("/sys/class/leds/" + id)); err != nil {
+				found = false
+			}
+		}
+		if found {
+			return m
+		}
+	}
+	return ledMaps[0]
+}
+
+func init() {
+	embd.Register(embd.HostOrangePi, func(rev int) *embd.Descriptor {
+		return &embd.Descriptor{
+			GPIODriver: func() embd.GPIODriver {
+				return embd.NewGPIODriverWithPorts(pins, generic.NewDigitalPin, nil, nil, generic.NewDigitalPort)
+			},
+			I2CDriver: func() embd.I2CDriver {
+				return embd.NewI2CDriver(generic.NewI2CBus)
+			},
+			LEDDriver: func() embd.LEDDriver {
+				return embd.NewLEDDriver(ledMap(), generic.NewLED)
+			},
+			SPIDriver: func() embd.SPIDriver {
+				return embd.NewSPIDriver(spiDeviceMinor, generic.NewSPIBus, nil)
+			},
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package orangepi
+
+import (
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakefs"
+)
+
+func TestPinNumber(t *testing.T) {
+	var tests = []struct {
+		name string
+		n    int
+		ok   bool
+	}{
+		{"PA0", 0, true},
+		{"PA12", 12, true},
+		{"PC4", 68, true},
+		{"PD14", 110, true},
+		{"PG8", 200, true},
+		{"PL10", 362, true},
+		{"PM1", 0, false},
+		{"PA32", 0, false},
+		{"PA", 0, false},
+		{"GPIO1", 0, false},
+	}
+	for _, test := range tests {
+		n, err := PinNumber(test.name)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("PinNumber(%q): got err %v, want ok = %v", test.name, err, test.ok)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+		if n != test.n {
+			t.Errorf("PinNumber(%q): got %v, want %v", test.name, n, test.n)
+		}
+		if name := PinName(n); name != test.name {
+			t.Errorf("PinName(%v): got %q, want %q", n, name, test.name)
+		}
+	}
+}
+
+func TestPinLookup(t *testing.T) {
+	var tests = []struct {
+		key interface{}
+		cap int
+		id  string
+		n   int
+	}{
+		{"P1_3", embd.CapI2C, "P1_3", 12},
+		{"PG7", embd.CapDigital, "P1_40", 199},
+		{200, embd.CapDigital, "P1_32", 200},
+		{"SPI0_CLK", embd.CapSPI, "P1_23", 66},
+		{"I2C1_SDA", embd.CapI2C, "P1_27", 19},
+	}
+	for _, test := range tests {
+		pd, found := pins.Lookup(test.key, test.cap)
+		if !found {
+			t.Errorf("Lookup(%v): not found", test.key)
+			continue
+		}
+		if pd.ID != test.id || pd.DigitalLogical != test.n {
+			t.Errorf("Lookup(%v): got %v (%v), want %v (%v)", test.key, pd.ID, pd.DigitalLogical, test.id, test.n)
+		}
+	}
+	if len(pins) != 28 {
+		t.Errorf("pins: got %v gpio capable header pins, want 28", len(pins))
+	}
+}
+
+func TestLEDMap(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/leds/green:power/": "",
+		"sys/class/leds/red:status/":  "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	m := ledMap()
+	if _, ok := m["red:status"]; !ok {
+		t.Errorf("ledMap: got %v, want the newer LED names", m)
+	}
+}
@@ -0,0 +1,589 @@
+// The agent, running on the target.
+
+package remote
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+)
+
+// edgeTimeout bounds how long a NextEdge call waits for an edge, so that
+// the calls of a watch which is stopped do not linger.
+const edgeTimeout = time.Second
+
+// maxTransfer bounds the length of the reads requested by the clients.
+const maxTransfer = 4096
+
+// Agent gives remote hosts access to the drivers of a host descriptor.
+type Agent struct {
+	// Token, when set, must be presented by the clients through an Auth
+	// call before any other call.
+	Token string
+
+	desc *embd.Descriptor
+
+	// mu serializes the accesses to the drivers, which are not safe for
+	// concurrent use.
+	mu   sync.Mutex
+	gpio embd.GPIODriver
+	i2c  embd.I2CDriver
+	spi  embd.SPIDriver
+	led  embd.LEDDriver
+
+	// The LED driver creates a new LED on every lookup, so they are kept
+	// here between calls.
+	leds map[string]embd.LED
+}
+
+// NewAgent returns an agent serving the drivers of desc, usually the
+// descriptor of the local host as returned by embd.DescribeHost. The
+// drivers are only created when first used.
+func NewAgent(desc *embd.Descriptor) *Agent {
+	return &Agent{desc: desc, leds: make(map[string]embd.LED)}
+}
+
+// Serve accepts connections on l and serves each of them in its own
+// goroutine. It returns when l fails.
+func (a *Agent) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		glog.V(1).Infof("remote: connection from %v", conn.RemoteAddr())
+		go a.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single connection until the client hangs up. The
+// watches and SPI buses the client left open are released then.
+func (a *Agent) ServeConn(conn io.ReadWriteCloser) {
+	s := &session{
+		a:       a,
+		watches: make(map[int]*watch),
+		buses:   make(map[int]embd.SPIBus),
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName(serviceName, s); err != nil {
+		glog.Errorf("remote: %v", err)
+		conn.Close()
+		return
+	}
+	srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	s.close()
+}
+
+// Close closes the drivers the agent has created.
+func (a *Agent) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var err error
+	for _, drv := range []interface {
+		Close() error
+	}{a.gpio, a.i2c, a.spi, a.led} {
+		if drv == nil {
+			continue
+		}
+		if e := drv.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	a.gpio, a.i2c, a.spi, a.led = nil, nil, nil, nil
+	a.leds = make(map[string]embd.LED)
+	return err
+}
+
+// The driver accessors must be called with a.mu held.
+
+func (a *Agent) gpioDriver() (embd.GPIODriver, error) {
+	if a.gpio == nil {
+		if a.desc.GPIODriver == nil {
+			return nil, embd.ErrFeatureNotSupported
+		}
+		a.gpio = a.desc.GPIODriver()
+	}
+	return a.gpio, nil
+}
+
+func (a *Agent) i2cDriver() (embd.I2CDriver, error) {
+	if a.i2c == nil {
+		if a.desc.I2CDriver == nil {
+			return nil, embd.ErrFeatureNotSupported
+		}
+		a.i2c = a.desc.I2CDriver()
+	}
+	return a.i2c, nil
+}
+
+func (a *Agent) spiDriver() (embd.SPIDriver, error) {
+	if a.spi == nil {
+		if a.desc.SPIDriver == nil {
+			return nil, embd.ErrFeatureNotSupported
+		}
+		a.spi = a.desc.SPIDriver()
+	}
+	return a.spi, nil
+}
+
+func (a *Agent) ledDriver() (embd.LEDDriver, error) {
+	if a.led == nil {
+		if a.desc.LEDDriver == nil {
+			return nil, embd.ErrFeatureNotSupported
+		}
+		a.led = a.desc.LEDDriver()
+	}
+	return a.led, nil
+}
+
+type watch struct {
+	pin   embd.DigitalPin
+	edges chan struct{}
+	done  chan struct{}
+}
+
+// session holds the state of a connection. Its exported methods make up
+// the RPC service.
+type session struct {
+	a *Agent
+
+	mu      sync.Mutex
+	authed  bool
+	next    int
+	watches map[int]*watch
+	buses   map[int]embd.SPIBus
+}
+
+func errUnknownOp(op string) error {
+	return fmt.Errorf("remote: unknown operation %q", op)
+}
+
+var errUnauthorized = errors.New("remote: invalid token")
+
+// Auth authenticates the session with the token of the agent.
+func (s *session) Auth(token *string, _ *Empty) error {
+	if s.a.Token != "" && subtle.ConstantTimeCompare([]byte(*token), []byte(s.a.Token)) != 1 {
+		return errUnauthorized
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authed = true
+	return nil
+}
+
+// authorized tells whether the session may make calls.
+func (s *session) authorized() error {
+	if s.a.Token == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.authed {
+		return errUnauthorized
+	}
+	return nil
+}
+
+// checkLen checks the length of a read requested by a client.
+func checkLen(n int) error {
+	if n < 0 || n > maxTransfer {
+		return fmt.Errorf("remote: invalid length %v, the maximum is %v", n, maxTransfer)
+	}
+	return nil
+}
+
+func (s *session) PinMap(_ *Empty, reply *embd.PinMap) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+
+	drv, err := s.a.gpioDriver()
+	if err != nil {
+		return err
+	}
+	*reply = drv.PinMap()
+	return nil
+}
+
+func (s *session) Digital(req *PinRequest, reply *PinReply) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+
+	drv, err := s.a.gpioDriver()
+	if err != nil {
+		return err
+	}
+	pin, err := drv.DigitalPin(req.ID)
+	if err != nil {
+		return err
+	}
+	switch req.Op {
+	case opRead:
+		reply.Value, err = pin.Read()
+	case opWrite:
+		err = pin.Write(req.Value)
+	case opPulse:
+		reply.Duration, err = pin.TimePulse(req.Value)
+	case opDirection:
+		err = pin.SetDirection(embd.Direction(req.Value))
+	case opActiveLow:
+		err = pin.ActiveLow(req.Value != 0)
+	case opPullUp:
+		err = pin.PullUp()
+	case opPullDown:
+		err = pin.PullDown()
+	case opClose:
+		err = pin.Close()
+	default:
+		err = errUnknownOp(req.Op)
+	}
+	return err
+}
+
+func (s *session) Watch(req *WatchRequest, reply *int) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+
+	drv, err := s.a.gpioDriver()
+	if err != nil {
+		return err
+	}
+	pin, err := drv.DigitalPin(req.ID)
+	if err != nil {
+		return err
+	}
+	w := &watch{pin: pin, edges: make(chan struct{}, 64), done: make(chan struct{})}
+	err = pin.Watch(embd.Edge(req.Edge), func(embd.DigitalPin) {
+		select {
+		case w.edges <- struct{}{}:
+		default:
+			glog.V(1).Infof("remote: dropping an edge of %v", req.ID)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	s.watches[s.next] = w
+	*reply = s.next
+	return nil
+}
+
+func (s *session) watch(id int) (*watch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.watches[id]
+	if !ok {
+		return nil, fmt.Errorf("remote: no watch %v", id)
+	}
+	return w, nil
+}
+
+// NextEdge waits for the next edges of a watch.
+func (s *session) NextEdge(id *int, reply *EdgeReply) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	w, err := s.watch(*id)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-w.edges:
+		reply.Count = 1
+	case <-w.done:
+		return fmt.Errorf("remote: watch %v stopped", *id)
+	case <-time.After(edgeTimeout):
+		return nil
+	}
+	for {
+		select {
+		case <-w.edges:
+			reply.Count++
+		default:
+			return nil
+		}
+	}
+}
+
+func (s *session) StopWatching(id *int, _ *Empty) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	// The watch is removed in the lookup, for a concurrent StopWatching or
+	// close not to release it too.
+	s.mu.Lock()
+	w, ok := s.watches[*id]
+	delete(s.watches, *id)
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("remote: no watch %v", *id)
+	}
+	close(w.done)
+
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+	return w.pin.StopWatching()
+}
+
+func (s *session) Analog(req *PinRequest, reply *PinReply) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+
+	drv, err := s.a.gpioDriver()
+	if err != nil {
+		return err
+	}
+	pin, err := drv.AnalogPin(req.ID)
+	if err != nil {
+		return err
+	}
+	switch req.Op {
+	case opRead:
+		reply.Value, err = pin.Read()
+	case opClose:
+		err = pin.Close()
+	default:
+		err = errUnknownOp(req.Op)
+	}
+	return err
+}
+
+func (s *session) PWM(req *PinRequest, reply *PinReply) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+
+	drv, err := s.a.gpioDriver()
+	if err != nil {
+		return err
+	}
+	pin, err := drv.PWMPin(req.ID)
+	if err != nil {
+		return err
+	}
+	switch req.Op {
+	case opN:
+		reply.N = pin.N()
+	case opPeriod:
+		err = pin.SetPeriod(req.Value)
+	case opDuty:
+		err = pin.SetDuty(req.Value)
+	case opPolarity:
+		err = pin.SetPolarity(embd.Polarity(req.Value))
+	case opMicroseconds:
+		err = pin.SetMicroseconds(req.Value)
+	case opAnalog:
+		err = pin.SetAnalog(byte(req.Value))
+	case opClose:
+		err = pin.Close()
+	default:
+		err = errUnknownOp(req.Op)
+	}
+	return err
+}
+
+func (s *session) I2C(req *I2CRequest, reply *I2CReply) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+
+	drv, err := s.a.i2cDriver()
+	if err != nil {
+		return err
+	}
+	if req.Op == opRead {
+		if err := checkLen(req.N); err != nil {
+			return err
+		}
+	}
+	bus := drv.Bus(req.Bus)
+	switch {
+	case req.Op == opRead && req.HasReg:
+		reply.Data = make([]byte, req.N)
+		err = bus.ReadFromReg(req.Addr, req.Reg, reply.Data)
+	case req.Op == opRead:
+		reply.Data, err = bus.ReadBytes(req.Addr, req.N)
+	case req.Op == opReadByte && req.HasReg:
+		var b byte
+		b, err = bus.ReadByteFromReg(req.Addr, req.Reg)
+		reply.Data = []byte{b}
+	case req.Op == opReadByte:
+		var b byte
+		b, err = bus.ReadByte(req.Addr)
+		reply.Data = []byte{b}
+	case req.Op == opReadWord:
+		reply.Word, err = bus.ReadWordFromReg(req.Addr, req.Reg)
+	case req.Op == opWrite && req.HasReg:
+		err = bus.WriteToReg(req.Addr, req.Reg, req.Data)
+	case req.Op == opWrite:
+		err = bus.WriteBytes(req.Addr, req.Data)
+	case req.Op == opWriteByte && req.HasReg:
+		err = bus.WriteByteToReg(req.Addr, req.Reg, byte(req.Word))
+	case req.Op == opWriteByte:
+		err = bus.WriteByte(req.Addr, byte(req.Word))
+	case req.Op == opWriteWord:
+		err = bus.WriteWordToReg(req.Addr, req.Reg, req.Word)
+	default:
+		err = errUnknownOp(req.Op)
+	}
+	return err
+}
+
+func (s *session) SPIOpen(req *SPIOpenRequest, reply *int) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	s.a.mu.Lock()
+	drv, err := s.a.spiDriver()
+	if err != nil {
+		s.a.mu.Unlock()
+		return err
+	}
+	bus := drv.Bus(req.Mode, req.Channel, req.Speed, req.BPW, req.Delay)
+	s.a.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	s.buses[s.next] = bus
+	*reply = s.next
+	return nil
+}
+
+func (s *session) SPI(req *SPIRequest, reply *SPIReply) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	bus, ok := s.buses[req.Handle]
+	if ok && req.Op == opClose {
+		delete(s.buses, req.Handle)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("remote: no spi bus %v", req.Handle)
+	}
+	if req.Op == opRead {
+		if err := checkLen(req.N); err != nil {
+			return err
+		}
+	}
+
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+
+	var err error
+	switch req.Op {
+	case opWrite:
+		reply.N, err = bus.Write(req.Data)
+	case opTransfer:
+		reply.Data = req.Data
+		err = bus.TransferAndReceiveData(reply.Data)
+	case opRead:
+		reply.Data, err = bus.ReceiveData(req.N)
+	case opTransferByte:
+		var b byte
+		if len(req.Data) != 1 {
+			return errors.New("remote: expected a single byte")
+		}
+		b, err = bus.TransferAndReceiveByte(req.Data[0])
+		reply.Data = []byte{b}
+	case opReadByte:
+		var b byte
+		b, err = bus.ReceiveByte()
+		reply.Data = []byte{b}
+	case opClose:
+		err = bus.Close()
+	default:
+		err = errUnknownOp(req.Op)
+	}
+	return err
+}
+
+func (s *session) LED(req *LEDRequest, _ *Empty) error {
+	if err := s.authorized(); err != nil {
+		return err
+	}
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+
+	led, ok := s.a.leds[req.Key]
+	if !ok {
+		drv, err := s.a.ledDriver()
+		if err != nil {
+			return err
+		}
+		if led, err = drv.LED(req.Key); err != nil {
+			return err
+		}
+		s.a.leds[req.Key] = led
+	}
+	var err error
+	switch req.Op {
+	case opOpen:
+	case opOn:
+		err = led.On()
+	case opOff:
+		err = led.Off()
+	case opToggle:
+		err = led.Toggle()
+	case opClose:
+		delete(s.a.leds, req.Key)
+		err = led.Close()
+	default:
+		err = errUnknownOp(req.Op)
+	}
+	return err
+}
+
+// close releases the watches and buses of the session.
+func (s *session) close() {
+	s.mu.Lock()
+	watches, buses := s.watches, s.buses
+	s.watches, s.buses = nil, nil
+	s.mu.Unlock()
+
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+	for _, w := range watches {
+		close(w.done)
+		if err := w.pin.StopWatching(); err != nil {
+			glog.Errorf("remote: %v", err)
+		}
+	}
+	for _, b := range buses {
+		if err := b.Close(); err != nil {
+			glog.Errorf("remote: %v", err)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Remote I²C, SPI and LED support.
+
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+)
+
+type i2cBus struct {
+	c *client
+	l byte
+}
+
+func (b *i2cBus) do(req I2CRequest) (*I2CReply, error) {
+	req.Bus = b.l
+	var reply I2CReply
+	err := b.c.call("I2C", &req, &reply)
+	return &reply, err
+}
+
+func (b *i2cBus) readByte(req I2CRequest) (byte, error) {
+	reply, err := b.do(req)
+	if err != nil {
+		return 0, err
+	}
+	if len(reply.Data) != 1 {
+		return 0, fmt.Errorf("remote: expected a single byte, got %v", len(reply.Data))
+	}
+	return reply.Data[0], nil
+}
+
+func (b *i2cBus) ReadByte(addr byte) (byte, error) {
+	return b.readByte(I2CRequest{Op: opReadByte, Addr: addr})
+}
+
+func (b *i2cBus) ReadBytes(addr byte, num int) ([]byte, error) {
+	reply, err := b.do(I2CRequest{Op: opRead, Addr: addr, N: num})
+	return reply.Data, err
+}
+
+func (b *i2cBus) WriteByte(addr, value byte) error {
+	_, err := b.do(I2CRequest{Op: opWriteByte, Addr: addr, Word: uint16(value)})
+	return err
+}
+
+func (b *i2cBus) WriteBytes(addr byte, value []byte) error {
+	_, err := b.do(I2CRequest{Op: opWrite, Addr: addr, Data: value})
+	return err
+}
+
+func (b *i2cBus) ReadFromReg(addr, reg byte, value []byte) error {
+	reply, err := b.do(I2CRequest{Op: opRead, Addr: addr, Reg: reg, HasReg: true, N: len(value)})
+	if err != nil {
+		return err
+	}
+	copy(value, reply.Data)
+	return nil
+}
+
+func (b *i2cBus) ReadByteFromReg(addr, reg byte) (byte, error) {
+	return b.readByte(I2CRequest{Op: opReadByte, Addr: addr, Reg: reg, HasReg: true})
+}
+
+func (b *i2cBus) ReadWordFromReg(addr, reg byte) (uint16, error) {
+	reply, err := b.do(I2CRequest{Op: opReadWord, Addr: addr, Reg: reg, HasReg: true})
+	return reply.Word, err
+}
+
+func (b *i2cBus) WriteToReg(addr, reg byte, value []byte) error {
+	_, err := b.do(I2CRequest{Op: opWrite, Addr: addr, Reg: reg, HasReg: true, Data: value})
+	return err
+}
+
+func (b *i2cBus) WriteByteToReg(addr, reg, value byte) error {
+	_, err := b.do(I2CRequest{Op: opWriteByte, Addr: addr, Reg: reg, HasReg: true, Word: uint16(value)})
+	return err
+}
+
+func (b *i2cBus) WriteWordToReg(addr, reg byte, value uint16) error {
+	_, err := b.do(I2CRequest{Op: opWriteWord, Addr: addr, Reg: reg, HasReg: true, Word: value})
+	return err
+}
+
+// Close does nothing, the buses of the agent stay open for its lifetime.
+func (b *i2cBus) Close() error {
+	return nil
+}
+
+// spiBus opens the bus on the agent when first used, as the SPI driver
+// gives no way of reporting errors when a bus is created.
+type spiBus struct {
+	c   *client
+	req SPIOpenRequest
+
+	mu     sync.Mutex
+	handle int
+}
+
+func (b *spiBus) do(op string, data []byte, n int) (*SPIReply, error) {
+	b.mu.Lock()
+	if b.handle == 0 {
+		if err := b.c.call("SPIOpen", &b.req, &b.handle); err != nil {
+			b.mu.Unlock()
+			return &SPIReply{}, err
+		}
+	}
+	handle := b.handle
+	b.mu.Unlock()
+
+	var reply SPIReply
+	err := b.c.call("SPI", &SPIRequest{Handle: handle, Op: op, Data: data, N: n}, &reply)
+	return &reply, err
+}
+
+func (b *spiBus) Write(data []byte) (int, error) {
+	reply, err := b.do(opWrite, data, 0)
+	return reply.N, err
+}
+
+func (b *spiBus) TransferAndReceiveData(data []uint8) error {
+	reply, err := b.do(opTransfer, data, 0)
+	if err != nil {
+		return err
+	}
+	copy(data, reply.Data)
+	return nil
+}
+
+func (b *spiBus) ReceiveData(n int) ([]uint8, error) {
+	reply, err := b.do(opRead, nil, n)
+	return reply.Data, err
+}
+
+func (b *spiBus) TransferAndReceiveByte(data byte) (byte, error) {
+	reply, err := b.do(opTransferByte, []byte{data}, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(reply.Data) != 1 {
+		return 0, fmt.Errorf("remote: expected a single byte, got %v", len(reply.Data))
+	}
+	return reply.Data[0], nil
+}
+
+func (b *spiBus) ReceiveByte() (byte, error) {
+	reply, err := b.do(opReadByte, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(reply.Data) != 1 {
+		return 0, fmt.Errorf("remote: expected a single byte, got %v", len(reply.Data))
+	}
+	return reply.Data[0], nil
+}
+
+func (b *spiBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.handle == 0 {
+		return nil
+	}
+	err := b.c.call("SPI", &SPIRequest{Handle: b.handle, Op: opClose}, &SPIReply{})
+	b.handle = 0
+	return err
+}
+
+// ledDriver leaves the lookup of the LEDs to the agent, as the LED map is
+// not part of the driver interface.
+type ledDriver struct {
+	c *client
+
+	leds map[string]*led
+}
+
+func (d *ledDriver) LED(k interface{}) (embd.LED, error) {
+	var key string
+	switch k := k.(type) {
+	case int:
+		key = strconv.Itoa(k)
+	case string:
+		key = k
+	case fmt.Stringer:
+		key = k.String()
+	default:
+		return nil, errors.New("led: invalid key type")
+	}
+
+	if l, ok := d.leds[key]; ok {
+		return l, nil
+	}
+	if err := d.c.call("LED", &LEDRequest{Key: key, Op: opOpen}, &Empty{}); err != nil {
+		return nil, err
+	}
+	l := &led{c: d.c, key: key}
+	d.leds[key] = l
+	return l, nil
+}
+
+func (d *ledDriver) Close() error {
+	for key, l := range d.leds {
+		if err := l.Close(); err != nil {
+			glog.Errorf("remote: closing led %v: %v", key, err)
+		}
+	}
+	d.leds = make(map[string]*led)
+	return nil
+}
+
+type led struct {
+	c   *client
+	key string
+}
+
+func (l *led) do(op string) error {
+	return l.c.call("LED", &LEDRequest{Key: l.key, Op: op}, &Empty{})
+}
+
+func (l *led) On() error {
+	return l.do(opOn)
+}
+
+func (l *led) Off() error {
+	return l.do(opOff)
+}
+
+func (l *led) Toggle() error {
+	return l.do(opToggle)
+}
+
+func (l *led) Close() error {
+	return l.do(opClose)
+}
@@ -0,0 +1,300 @@
+// Remote GPIO support.
+
+package remote
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+)
+
+// gpioDriver fetches the pin map of the agent when first used, then
+// behaves like the generic driver built from it. Pins are looked up
+// locally and known to the agent by their ID.
+type gpioDriver struct {
+	c *client
+
+	once sync.Once
+	drv  embd.GPIODriver
+	err  error
+}
+
+func (d *gpioDriver) init() error {
+	d.once.Do(func() {
+		var pinMap embd.PinMap
+		if d.err = d.c.call("PinMap", &Empty{}, &pinMap); d.err != nil {
+			return
+		}
+		d.drv = embd.NewGPIODriver(pinMap, d.newDigitalPin, d.newAnalogPin, d.newPWMPin)
+	})
+	return d.err
+}
+
+func (d *gpioDriver) PinMap() embd.PinMap {
+	if err := d.init(); err != nil {
+		glog.Errorf("remote: %v", err)
+		return nil
+	}
+	return d.drv.PinMap()
+}
+
+func (d *gpioDriver) Unregister(id string) error {
+	if err := d.init(); err != nil {
+		return err
+	}
+	return d.drv.Unregister(id)
+}
+
+func (d *gpioDriver) DigitalPin(key interface{}) (embd.DigitalPin, error) {
+	if err := d.init(); err != nil {
+		return nil, err
+	}
+	return d.drv.DigitalPin(key)
+}
+
+func (d *gpioDriver) AnalogPin(key interface{}) (embd.AnalogPin, error) {
+	if err := d.init(); err != nil {
+		return nil, err
+	}
+	return d.drv.AnalogPin(key)
+}
+
+func (d *gpioDriver) PWMPin(key interface{}) (embd.PWMPin, error) {
+	if err := d.init(); err != nil {
+		return nil, err
+	}
+	return d.drv.PWMPin(key)
+}
+
+func (d *gpioDriver) DigitalPort(keys ...interface{}) (embd.DigitalPort, error) {
+	if err := d.init(); err != nil {
+		return nil, err
+	}
+	return d.drv.DigitalPort(keys...)
+}
+
+func (d *gpioDriver) Close() error {
+	if d.drv == nil {
+		return nil
+	}
+	return d.drv.Close()
+}
+
+func (d *gpioDriver) newDigitalPin(pd *embd.PinDesc, drv embd.GPIODriver) embd.DigitalPin {
+	return &digitalPin{c: d.c, id: pd.ID, n: pd.DigitalLogical, drv: drv}
+}
+
+func (d *gpioDriver) newAnalogPin(pd *embd.PinDesc, drv embd.GPIODriver) embd.AnalogPin {
+	return &analogPin{c: d.c, id: pd.ID, n: pd.AnalogLogical, drv: drv}
+}
+
+func (d *gpioDriver) newPWMPin(pd *embd.PinDesc, drv embd.GPIODriver) embd.PWMPin {
+	return &pwmPin{c: d.c, id: pd.ID, drv: drv}
+}
+
+type digitalPin struct {
+	c   *client
+	id  string
+	n   int
+	drv embd.GPIODriver
+
+	watchM  sync.Mutex
+	watchID int
+	stop    chan struct{}
+}
+
+func (p *digitalPin) do(op string, val int) (*PinReply, error) {
+	var reply PinReply
+	err := p.c.call("Digital", &PinRequest{ID: p.id, Op: op, Value: val}, &reply)
+	return &reply, err
+}
+
+func (p *digitalPin) N() int {
+	return p.n
+}
+
+func (p *digitalPin) Write(val int) error {
+	_, err := p.do(opWrite, val)
+	return err
+}
+
+func (p *digitalPin) Read() (int, error) {
+	reply, err := p.do(opRead, 0)
+	return reply.Value, err
+}
+
+func (p *digitalPin) TimePulse(state int) (time.Duration, error) {
+	reply, err := p.do(opPulse, state)
+	return reply.Duration, err
+}
+
+func (p *digitalPin) SetDirection(dir embd.Direction) error {
+	_, err := p.do(opDirection, int(dir))
+	return err
+}
+
+func (p *digitalPin) ActiveLow(b bool) error {
+	val := 0
+	if b {
+		val = 1
+	}
+	_, err := p.do(opActiveLow, val)
+	return err
+}
+
+func (p *digitalPin) PullUp() error {
+	_, err := p.do(opPullUp, 0)
+	return err
+}
+
+func (p *digitalPin) PullDown() error {
+	_, err := p.do(opPullDown, 0)
+	return err
+}
+
+// Watch starts watching the pin on the agent and polls it for edges from a
+// goroutine, which calls handler once per edge.
+func (p *digitalPin) Watch(edge embd.Edge, handler func(embd.DigitalPin)) error {
+	p.watchM.Lock()
+	defer p.watchM.Unlock()
+
+	if p.stop != nil {
+		if err := p.stopWatching(); err != nil {
+			return err
+		}
+	}
+
+	var id int
+	if err := p.c.call("Watch", &WatchRequest{ID: p.id, Edge: string(edge)}, &id); err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	p.watchID, p.stop = id, stop
+
+	go func() {
+		for {
+			var reply EdgeReply
+			err := p.c.call("NextEdge", &id, &reply)
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err != nil {
+				glog.Errorf("remote: watching %v: %v", p.id, err)
+				return
+			}
+			for i := 0; i < reply.Count; i++ {
+				handler(p)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (p *digitalPin) StopWatching() error {
+	p.watchM.Lock()
+	defer p.watchM.Unlock()
+
+	if p.stop == nil {
+		return nil
+	}
+	return p.stopWatching()
+}
+
+func (p *digitalPin) stopWatching() error {
+	close(p.stop)
+	p.stop = nil
+	return p.c.call("StopWatching", &p.watchID, &Empty{})
+}
+
+func (p *digitalPin) Close() error {
+	if err := p.StopWatching(); err != nil {
+		return err
+	}
+	if err := p.drv.Unregister(p.id); err != nil {
+		return err
+	}
+	_, err := p.do(opClose, 0)
+	return err
+}
+
+type analogPin struct {
+	c   *client
+	id  string
+	n   int
+	drv embd.GPIODriver
+}
+
+func (p *analogPin) N() int {
+	return p.n
+}
+
+func (p *analogPin) Read() (int, error) {
+	var reply PinReply
+	err := p.c.call("Analog", &PinRequest{ID: p.id, Op: opRead}, &reply)
+	return reply.Value, err
+}
+
+func (p *analogPin) Close() error {
+	if err := p.drv.Unregister(p.id); err != nil {
+		return err
+	}
+	return p.c.call("Analog", &PinRequest{ID: p.id, Op: opClose}, &PinReply{})
+}
+
+type pwmPin struct {
+	c   *client
+	id  string
+	drv embd.GPIODriver
+}
+
+func (p *pwmPin) do(op string, val int) (*PinReply, error) {
+	var reply PinReply
+	err := p.c.call("PWM", &PinRequest{ID: p.id, Op: op, Value: val}, &reply)
+	return &reply, err
+}
+
+func (p *pwmPin) N() string {
+	reply, err := p.do(opN, 0)
+	if err != nil {
+		glog.Errorf("remote: %v", err)
+	}
+	return reply.N
+}
+
+func (p *pwmPin) SetPeriod(ns int) error {
+	_, err := p.do(opPeriod, ns)
+	return err
+}
+
+func (p *pwmPin) SetDuty(ns int) error {
+	_, err := p.do(opDuty, ns)
+	return err
+}
+
+func (p *pwmPin) SetPolarity(pol embd.Polarity) error {
+	_, err := p.do(opPolarity, int(pol))
+	return err
+}
+
+func (p *pwmPin) SetMicroseconds(us int) error {
+	_, err := p.do(opMicroseconds, us)
+	return err
+}
+
+func (p *pwmPin) SetAnalog(value byte) error {
+	_, err := p.do(opAnalog, int(value))
+	return err
+}
+
+func (p *pwmPin) Close() error {
+	if err := p.drv.Unregister(p.id); err != nil {
+		return err
+	}
+	_, err := p.do(opClose, 0)
+	return err
+}
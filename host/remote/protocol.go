@@ -0,0 +1,116 @@
+// Messages exchanged between the remote host and the agent.
+// They are carried by JSON-RPC (net/rpc/jsonrpc) over a TCP connection, each
+// call being one of the methods of the "Agent" service.
+
+package remote
+
+import "time"
+
+const serviceName = "Agent"
+
+// The operations of the requests.
+const (
+	opRead         = "read"
+	opWrite        = "write"
+	opPulse        = "pulse"
+	opDirection    = "direction"
+	opActiveLow    = "activelow"
+	opPullUp       = "pullup"
+	opPullDown     = "pulldown"
+	opN            = "n"
+	opClose        = "close"
+	opPeriod       = "period"
+	opDuty         = "duty"
+	opPolarity     = "polarity"
+	opMicroseconds = "microseconds"
+	opAnalog       = "analog"
+	opReadByte     = "readbyte"
+	opReadWord     = "readword"
+	opWriteByte    = "writebyte"
+	opWriteWord    = "writeword"
+	opTransfer     = "transfer"
+	opTransferByte = "transferbyte"
+	opOpen         = "open"
+	opOn           = "on"
+	opOff          = "off"
+	opToggle       = "toggle"
+)
+
+// Empty is used for the calls which take or return nothing.
+type Empty struct{}
+
+// PinRequest is an operation on a digital, analog or PWM pin, identified by
+// its ID in the pin map of the agent.
+type PinRequest struct {
+	ID    string
+	Op    string
+	Value int
+}
+
+// PinReply is the result of a PinRequest.
+type PinReply struct {
+	Value    int
+	N        string
+	Duration time.Duration
+}
+
+// WatchRequest starts watching the edges of a digital pin.
+type WatchRequest struct {
+	ID   string
+	Edge string
+}
+
+// EdgeReply carries the number of edges seen since the previous NextEdge
+// call on a watch. It is zero if none happened before the call timed out.
+type EdgeReply struct {
+	Count int
+}
+
+// I2CRequest is an operation on an I²C bus. Reg is only used by the
+// register operations.
+type I2CRequest struct {
+	Bus    byte
+	Op     string
+	Addr   byte
+	Reg    byte
+	HasReg bool
+	Data   []byte
+	Word   uint16
+	N      int
+}
+
+// I2CReply is the result of an I2CRequest.
+type I2CReply struct {
+	Data []byte
+	Word uint16
+}
+
+// SPIOpenRequest opens a SPI bus with the given parameters. The reply is a
+// handle to use in SPIRequests.
+type SPIOpenRequest struct {
+	Mode    byte
+	Channel byte
+	Speed   int
+	BPW     int
+	Delay   int
+}
+
+// SPIRequest is an operation on a SPI bus opened with SPIOpenRequest.
+type SPIRequest struct {
+	Handle int
+	Op     string
+	Data   []byte
+	N      int
+}
+
+// SPIReply is the result of a SPIRequest.
+type SPIReply struct {
+	Data []byte
+	N    int
+}
+
+// LEDRequest is an operation on a LED, identified by any of its aliases.
+type LEDRequest struct {
+	Key string
+	Op  string
+}
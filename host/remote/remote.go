@@ -0,0 +1,168 @@
+// Package remote implements a host which proxies all the GPIO, I²C, SPI
+// and LED calls over the network to an embd agent running on the target.
+//
+// Run the agent on the board:
+//
+//	embd agent --addr :7070
+//
+// and select the remote host on the workstation, either from the program:
+//
+//	remote.SetAddr("raspberrypi.local:7070")
+//	embd.SetHost(embd.HostRemote, 0)
+//
+// or, for unmodified programs importing host/all, through the environment:
+//
+//	EMBD_REMOTE=raspberrypi.local:7070 go run samples/bmp180.go
+//
+// The agent listens on localhost unless told otherwise. When it is given a
+// token, clients must present it, set with SetToken or through the
+// EMBD_REMOTE_TOKEN environment variable:
+//
+//	embd agent --addr :7070 --token secret
+//	EMBD_REMOTE=raspberrypi.local:7070 EMBD_REMOTE_TOKEN=secret go run samples/bmp180.go
+//
+// The connection is not encrypted, so the agent should only be exposed on
+// trusted networks.
+package remote
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+)
+
+// DefaultAddr is the address of the agent used when none is configured.
+const DefaultAddr = "localhost:7070"
+
+const dialTimeout = 5 * time.Second
+
+// client is a lazily established connection to the agent. It is
+// reestablished on the next call after the agent goes away.
+type client struct {
+	addr  string
+	token string
+
+	mu  sync.Mutex
+	rpc *rpc.Client
+}
+
+var agent = &client{addr: defaultAddr(), token: os.Getenv("EMBD_REMOTE_TOKEN")}
+
+func defaultAddr() string {
+	if addr := os.Getenv("EMBD_REMOTE"); addr != "" {
+		return addr
+	}
+	return DefaultAddr
+}
+
+// SetAddr sets the address of the agent. The address can also be set
+// through the EMBD_REMOTE environment variable. It must be set before any
+// driver is initialized.
+func SetAddr(addr string) {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	agent.addr = addr
+	if agent.rpc != nil {
+		agent.rpc.Close()
+		agent.rpc = nil
+	}
+}
+
+// SetToken sets the token presented to the agent. The token can also be set
+// through the EMBD_REMOTE_TOKEN environment variable. It must be set before
+// any driver is initialized.
+func SetToken(token string) {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	agent.token = token
+	if agent.rpc != nil {
+		agent.rpc.Close()
+		agent.rpc = nil
+	}
+}
+
+func (c *client) conn() (*rpc.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rpc != nil {
+		return c.rpc, nil
+	}
+	conn, err := net.DialTimeout("tcp", c.addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(1).Infof("remote: connected to %v", c.addr)
+	rc := jsonrpc.NewClient(conn)
+	if c.token != "" {
+		if err := rc.Call(serviceName+".Auth", &c.token, &Empty{}); err != nil {
+			rc.Close()
+			return nil, err
+		}
+	}
+	c.rpc = rc
+	return c.rpc, nil
+}
+
+func (c *client) call(method string, args, reply interface{}) error {
+	rc, err := c.conn()
+	if err != nil {
+		return err
+	}
+	err = rc.Call(serviceName+"."+method, args, reply)
+	switch err {
+	case nil:
+		return nil
+	case rpc.ErrShutdown, io.EOF, io.ErrUnexpectedEOF:
+		c.mu.Lock()
+		if c.rpc == rc {
+			rc.Close()
+			c.rpc = nil
+		}
+		c.mu.Unlock()
+		return err
+	}
+	// Keep the identity of the errors programs may compare against.
+	if se, ok := err.(rpc.ServerError); ok {
+		for _, e := range []error{embd.ErrFeatureNotSupported, embd.ErrFeatureNotImplemented} {
+			if string(se) == e.Error() {
+				return e
+			}
+		}
+		return errors.New(string(se))
+	}
+	return err
+}
+
+func init() {
+	embd.Register(embd.HostRemote, func(rev int) *embd.Descriptor {
+		return &embd.Descriptor{
+			GPIODriver: func() embd.GPIODriver {
+				return &gpioDriver{c: agent}
+			},
+			I2CDriver: func() embd.I2CDriver {
+				return embd.NewI2CDriver(func(l byte) embd.I2CBus {
+					return &i2cBus{c: agent, l: l}
+				})
+			},
+			LEDDriver: func() embd.LEDDriver {
+				return &ledDriver{c: agent, leds: make(map[string]*led)}
+			},
+			SPIDriver: func() embd.SPIDriver {
+				return embd.NewSPIDriver(0, func(_ int, mode, channel byte, speed, bpw, delay int, _ func() error) embd.SPIBus {
+					return &spiBus{c: agent, req: SPIOpenRequest{mode, channel, speed, bpw, delay}}
+				}, nil)
+			},
+		}
+	})
+}
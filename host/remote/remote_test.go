@@ -0,0 +1,394 @@
+package remote
+
+import (
+	"net"
+	"net/rpc/jsonrpc"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakehost"
+)
+
+var testPins = embd.PinMap{
+	&embd.PinDesc{ID: "P1_11", Aliases: []string{"17", "GPIO_17"}, Caps: embd.CapDigital, DigitalLogical: 17},
+	&embd.PinDesc{ID: "P1_12", Aliases: []string{"18", "GPIO_18"}, Caps: embd.CapDigital | embd.CapPWM, DigitalLogical: 18},
+	&embd.PinDesc{ID: "AIN0", Aliases: []string{"AIN0"}, Caps: embd.CapAnalog, AnalogLogical: 0},
+}
+
+// setup starts an agent on a loopback port and points the remote host at
+// it. The embd drivers are global, so all the tests share a single agent.
+var setup = func() func(t *testing.T) *fakehost.Host {
+	var (
+		once sync.Once
+		h    = fakehost.New(testPins)
+		err  error
+	)
+	return func(t *testing.T) *fakehost.Host {
+		once.Do(func() {
+			var l net.Listener
+			if l, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				return
+			}
+			go NewAgent(h.Descriptor()).Serve(l)
+			SetAddr(l.Addr().String())
+			embd.SetHost(embd.HostRemote, 0)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.TakeCalls()
+		return h
+	}
+}()
+
+func checkCalls(t *testing.T, h *fakehost.Host, want ...string) {
+	t.Helper()
+	if got := h.TakeCalls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("agent calls:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPinMap(t *testing.T) {
+	setup(t)
+
+	desc, err := embd.DescribeHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := desc.GPIODriver().PinMap(); !reflect.DeepEqual(got, testPins) {
+		t.Errorf("pin map: got %v, want %v", got, testPins)
+	}
+}
+
+func TestDigitalPin(t *testing.T) {
+	h := setup(t)
+
+	pin, err := embd.NewDigitalPin("GPIO_17")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.SetDirection(embd.Out); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.Write(embd.High); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := pin.Read(); err != nil || v != embd.High {
+		t.Errorf("read: got %v, %v, want %v", v, err, embd.High)
+	}
+	if d, err := pin.TimePulse(embd.High); err != nil || d != 42*time.Microsecond {
+		t.Errorf("time pulse: got %v, %v, want 42µs", d, err)
+	}
+	if err := pin.ActiveLow(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.PullUp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pin.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkCalls(t, h, "P1_11 direction 1", "P1_11 write 1", "P1_11 active low true", "P1_11 pull up", "P1_11 close")
+
+	if _, err := embd.NewDigitalPin("P9_99"); err == nil {
+		t.Errorf("unknown pin: got nil error")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	h := setup(t)
+
+	pin, err := embd.NewDigitalPin(18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pin.Close()
+
+	edges := make(chan embd.DigitalPin, 10)
+	if err := pin.Watch(embd.EdgeRising, func(p embd.DigitalPin) { edges <- p }); err != nil {
+		t.Fatal(err)
+	}
+	fake := h.Pin("P1_12")
+	fake.Set(embd.High)
+	fake.Set(embd.High)
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-edges:
+			if p != pin {
+				t.Errorf("handler called with %v, want the watched pin", p)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for edge %v", i)
+		}
+	}
+
+	if err := pin.StopWatching(); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Watched() {
+		t.Errorf("pin still watched on the agent")
+	}
+	checkCalls(t, h, "P1_12 watch rising", "P1_12 stop watching")
+}
+
+func TestAnalogAndPWM(t *testing.T) {
+	h := setup(t)
+
+	if v, err := embd.AnalogRead("AIN0"); err != nil || v != 512 {
+		t.Errorf("analog read: got %v, %v, want 512", v, err)
+	}
+
+	pwm, err := embd.NewPWMPin("P1_12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pwm.Close()
+	if n := pwm.N(); n != "pwmchip0/pwm0" {
+		t.Errorf("N: got %q", n)
+	}
+	if err := pwm.SetPeriod(20000000); err != nil {
+		t.Fatal(err)
+	}
+	if err := pwm.SetPolarity(embd.Negative); err != nil {
+		t.Fatal(err)
+	}
+	if err := pwm.SetMicroseconds(1500); err != nil {
+		t.Fatal(err)
+	}
+	if err := pwm.SetAnalog(128); err != nil {
+		t.Fatal(err)
+	}
+	checkCalls(t, h, "P1_12 period 20000000", "P1_12 polarity 1", "P1_12 us 1500", "P1_12 analog 128")
+}
+
+func TestI2C(t *testing.T) {
+	h := setup(t)
+
+	if err := embd.InitI2C(); err != nil {
+		t.Fatal(err)
+	}
+	bus := embd.NewI2CBus(1)
+
+	if b, err := bus.ReadByte(0x77); err != nil || b != 0xAA {
+		t.Errorf("ReadByte: got %#x, %v", b, err)
+	}
+	if data, err := bus.ReadBytes(0x77, 3); err != nil || len(data) != 3 {
+		t.Errorf("ReadBytes: got %v, %v", data, err)
+	}
+	if err := bus.WriteByte(0x77, 0x2E); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.WriteBytes(0x77, []byte{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 2)
+	if err := bus.ReadFromReg(0x77, 0xD0, data); err != nil || !reflect.DeepEqual(data, []byte{0xD0, 0xD1}) {
+		t.Errorf("ReadFromReg: got %v, %v", data, err)
+	}
+	if b, err := bus.ReadByteFromReg(0x77, 0xF4); err != nil || b != 0xF4 {
+		t.Errorf("ReadByteFromReg: got %#x, %v", b, err)
+	}
+	if w, err := bus.ReadWordFromReg(0x77, 0xF6); err != nil || w != 0xBEEF {
+		t.Errorf("ReadWordFromReg: got %#x, %v", w, err)
+	}
+	if err := bus.WriteToReg(0x77, 0xF4, []byte{0x2E}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.WriteByteToReg(0x77, 0xF4, 0x34); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.WriteWordToReg(0x77, 0xF4, 0x1234); err != nil {
+		t.Fatal(err)
+	}
+	checkCalls(t, h,
+		"i2c1 read byte 0x77",
+		"i2c1 read 0x77 3",
+		"i2c1 write byte 0x77 0x2e",
+		"i2c1 write 0x77 [1 2]",
+		"i2c1 read 0x77 reg 0xd0 2",
+		"i2c1 read byte 0x77 reg 0xf4",
+		"i2c1 read word 0x77 reg 0xf6",
+		"i2c1 write 0x77 reg 0xf4 [46]",
+		"i2c1 write byte 0x77 reg 0xf4 0x34",
+		"i2c1 write word 0x77 reg 0xf4 0x1234",
+	)
+}
+
+func TestSPI(t *testing.T) {
+	h := setup(t)
+
+	if err := embd.InitSPI(); err != nil {
+		t.Fatal(err)
+	}
+	bus := embd.NewSPIBus(embd.SPIMode0, 0, 1000000, 8, 0)
+
+	data := []byte{0, 0xFF, 0x0F}
+	if err := bus.TransferAndReceiveData(data); err != nil || !reflect.DeepEqual(data, []byte{0xFF, 0, 0xF0}) {
+		t.Errorf("TransferAndReceiveData: got %v, %v", data, err)
+	}
+	if b, err := bus.TransferAndReceiveByte(0x01); err != nil || b != 0xFE {
+		t.Errorf("TransferAndReceiveByte: got %#x, %v", b, err)
+	}
+	if b, err := bus.ReceiveByte(); err != nil || b != 0x55 {
+		t.Errorf("ReceiveByte: got %#x, %v", b, err)
+	}
+	if data, err := bus.ReceiveData(2); err != nil || len(data) != 2 {
+		t.Errorf("ReceiveData: got %v, %v", data, err)
+	}
+	if n, err := bus.Write([]byte{1, 2, 3}); err != nil || n != 3 {
+		t.Errorf("Write: got %v, %v", n, err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkCalls(t, h,
+		"spi open 0 0 1000000",
+		"spi transfer [0 255 15]",
+		"spi transfer byte 1",
+		"spi receive byte",
+		"spi receive 2",
+		"spi write [1 2 3]",
+		"spi close",
+	)
+}
+
+func TestLED(t *testing.T) {
+	h := setup(t)
+
+	if err := embd.LEDOn(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := embd.LEDToggle("led0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := embd.LEDOff("led0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := embd.LEDOn("led9"); err == nil || err.Error() != `led: no match found for "led9"` {
+		t.Errorf("unknown led: got %v", err)
+	}
+	checkCalls(t, h, "led on", "led toggle", "led off")
+}
+
+func TestSessionCleanup(t *testing.T) {
+	h := fakehost.New(testPins)
+	a := NewAgent(h.Descriptor())
+	server, conn := net.Pipe()
+	go a.ServeConn(server)
+	c := &client{addr: "pipe"}
+	c.rpc = jsonrpc.NewClient(conn)
+
+	var id int
+	if err := c.call("Watch", &WatchRequest{ID: "P1_11", Edge: "both"}, &id); err != nil {
+		t.Fatal(err)
+	}
+	var handle int
+	if err := c.call("SPIOpen", &SPIOpenRequest{Speed: 500000}, &handle); err != nil {
+		t.Fatal(err)
+	}
+	c.rpc.Close()
+
+	waitFor(t, func() bool { return !h.Pin("P1_11").Watched() })
+	waitFor(t, func() bool {
+		return len(h.Calls()) == 4
+	})
+	checkCalls(t, h, "P1_11 watch both", "spi open 0 0 500000", "P1_11 stop watching", "spi close")
+}
+
+func TestInvalidLength(t *testing.T) {
+	h := fakehost.New(testPins)
+	server, conn := net.Pipe()
+	go NewAgent(h.Descriptor()).ServeConn(server)
+	c := &client{addr: "pipe", rpc: jsonrpc.NewClient(conn)}
+	defer c.rpc.Close()
+
+	for _, n := range []int{-1, maxTransfer + 1} {
+		var reply I2CReply
+		if err := c.call("I2C", &I2CRequest{Bus: 1, Op: opRead, Addr: 0x77, N: n}, &reply); err == nil {
+			t.Errorf("i2c read of %v: no error", n)
+		}
+		if err := c.call("I2C", &I2CRequest{Bus: 1, Op: opRead, Addr: 0x77, HasReg: true, N: n}, &reply); err == nil {
+			t.Errorf("i2c register read of %v: no error", n)
+		}
+	}
+	var handle int
+	if err := c.call("SPIOpen", &SPIOpenRequest{Speed: 500000}, &handle); err != nil {
+		t.Fatal(err)
+	}
+	var reply SPIReply
+	if err := c.call("SPI", &SPIRequest{Handle: handle, Op: opRead, N: -1}, &reply); err == nil {
+		t.Error("spi read of -1: no error")
+	}
+	// The agent is still serving.
+	if err := c.call("I2C", &I2CRequest{Bus: 1, Op: opRead, Addr: 0x77, N: 3}, &I2CReply{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestToken(t *testing.T) {
+	h := fakehost.New(testPins)
+	a := NewAgent(h.Descriptor())
+	a.Token = "secret"
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go a.Serve(l)
+
+	var pins embd.PinMap
+	c := &client{addr: l.Addr().String()}
+	if err := c.call("PinMap", &Empty{}, &pins); err == nil || err.Error() != errUnauthorized.Error() {
+		t.Errorf("without token: got %v", err)
+	}
+	c = &client{addr: l.Addr().String(), token: "guess"}
+	if err := c.call("PinMap", &Empty{}, &pins); err == nil || err.Error() != errUnauthorized.Error() {
+		t.Errorf("invalid token: got %v", err)
+	}
+	c = &client{addr: l.Addr().String(), token: "secret"}
+	if err := c.call("PinMap", &Empty{}, &pins); err != nil || len(pins) != len(testPins) {
+		t.Errorf("valid token: got %v, %v", len(pins), err)
+	}
+}
+
+func TestConcurrentStopWatching(t *testing.T) {
+	h := fakehost.New(testPins)
+	a := NewAgent(h.Descriptor())
+	server, conn := net.Pipe()
+	go a.ServeConn(server)
+	c := &client{addr: "pipe"}
+	c.rpc = jsonrpc.NewClient(conn)
+	defer c.rpc.Close()
+
+	var id int
+	if err := c.call("Watch", &WatchRequest{ID: "P1_11", Edge: "both"}, &id); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- c.call("StopWatching", &id, &Empty{}) }()
+	}
+	var stopped int
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err == nil {
+			stopped++
+		}
+	}
+	if stopped != 1 {
+		t.Errorf("stopped the watch %v times, want once", stopped)
+	}
+}
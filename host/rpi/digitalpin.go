@@ -0,0 +1,180 @@
+// Fast digital IO support.
+// Pins are driven straight through the memory mapped GPIO registers, which
+// is orders of magnitude faster than going through sysfs.
+
+package rpi
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/host/generic"
+)
+
+type digitalPin struct {
+	id string
+	n  int
+
+	drv embd.GPIODriver
+
+	regs      *gpioRegs
+	activeLow bool
+
+	// Edge detection is not available through the registers, so watching
+	// is delegated to a sysfs pin.
+	watcher embd.DigitalPin
+}
+
+// NewDigitalPin returns a DigitalPin which accesses the GPIO registers
+// through /dev/gpiomem. If the registers cannot be mapped, it falls back to
+// the generic sysfs implementation.
+func NewDigitalPin(pd *embd.PinDesc, drv embd.GPIODriver) embd.DigitalPin {
+	regs, err := mapGPIOMem()
+	if err != nil {
+		glog.V(1).Infof("rpi: cannot map %v (%v), using sysfs for pin %v", gpioMemPath, err, pd.ID)
+		return generic.NewDigitalPin(pd, drv)
+	}
+	return newDigitalPin(pd, drv, regs)
+}
+
+func newDigitalPin(pd *embd.PinDesc, drv embd.GPIODriver, regs *gpioRegs) *digitalPin {
+	return &digitalPin{id: pd.ID, n: pd.DigitalLogical, drv: drv, regs: regs}
+}
+
+func (p *digitalPin) N() int {
+	return p.n
+}
+
+// Function returns the currently selected function of the pin.
+func (p *digitalPin) Function() Function {
+	return p.regs.function(p.n)
+}
+
+// SetFunction selects the function (input, output or one of the alternate
+// functions) of the pin.
+func (p *digitalPin) SetFunction(f Function) error {
+	p.regs.setFunction(p.n, f)
+	return nil
+}
+
+func (p *digitalPin) SetDirection(dir embd.Direction) error {
+	f := FuncInput
+	if dir == embd.Out {
+		f = FuncOutput
+	}
+	return p.SetFunction(f)
+}
+
+func (p *digitalPin) read() int {
+	if p.regs.level(p.n) != p.activeLow {
+		return embd.High
+	}
+	return embd.Low
+}
+
+func (p *digitalPin) Read() (int, error) {
+	return p.read(), nil
+}
+
+func (p *digitalPin) Write(val int) error {
+	if (val == embd.High) != p.activeLow {
+		p.regs.set(p.n)
+	} else {
+		p.regs.clear(p.n)
+	}
+	return nil
+}
+
+func (p *digitalPin) TimePulse(state int) (time.Duration, error) {
+	aroundState := embd.Low
+	if state == embd.Low {
+		aroundState = embd.High
+	}
+
+	// Wait for any previous pulse to end
+	for p.read() != aroundState {
+	}
+
+	// Wait until ECHO goes high
+	for p.read() != state {
+	}
+
+	startTime := time.Now() // Record time when ECHO goes high
+
+	// Wait until ECHO goes low
+	for p.read() != aroundState {
+	}
+
+	return time.Since(startTime), nil // Calculate time lapsed for ECHO to transition from high to low
+}
+
+func (p *digitalPin) ActiveLow(b bool) error {
+	p.activeLow = b
+	if p.watcher != nil {
+		return p.watcher.ActiveLow(b)
+	}
+	return nil
+}
+
+func (p *digitalPin) PullUp() error {
+	p.regs.setPull(p.n, PullUp)
+	return nil
+}
+
+func (p *digitalPin) PullDown() error {
+	p.regs.setPull(p.n, PullDown)
+	return nil
+}
+
+// PullOff disables the pull-up/down resistor of the pin.
+func (p *digitalPin) PullOff() error {
+	p.regs.setPull(p.n, PullOff)
+	return nil
+}
+
+func (p *digitalPin) Watch(edge embd.Edge, handler func(embd.DigitalPin)) error {
+	if p.watcher == nil {
+		pd := &embd.PinDesc{ID: p.id, DigitalLogical: p.n}
+		p.watcher = generic.NewDigitalPin(pd, watchDriver{p.drv})
+		if err := p.watcher.ActiveLow(p.activeLow); err != nil {
+			return err
+		}
+	}
+	return p.watcher.Watch(edge, func(embd.DigitalPin) {
+		handler(p)
+	})
+}
+
+func (p *digitalPin) StopWatching() error {
+	if p.watcher == nil {
+		return nil
+	}
+	return p.watcher.StopWatching()
+}
+
+func (p *digitalPin) Close() error {
+	if err := p.drv.Unregister(p.id); err != nil {
+		return err
+	}
+
+	if p.watcher == nil {
+		return nil
+	}
+	if err := p.watcher.Close(); err != nil {
+		return err
+	}
+	p.watcher = nil
+
+	return nil
+}
+
+// watchDriver keeps the sysfs pin used for edge detection from
+// unregistering the fast pin it belongs to when it is closed.
+type watchDriver struct {
+	embd.GPIODriver
+}
+
+func (watchDriver) Unregister(string) error {
+	return nil
+}
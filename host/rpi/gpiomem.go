@@ -0,0 +1,170 @@
+// Memory mapped access to the BCM283x/BCM2711 GPIO registers.
+
+package rpi
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/kidoman/embd"
+)
+
+const (
+	gpioMemPath = "/dev/gpiomem"
+	gpioMemSize = 4096
+
+	gpfsel0   = 0x00
+	gpset0    = 0x1C
+	gpclr0    = 0x28
+	gplev0    = 0x34
+	gppud     = 0x94
+	gppudclk0 = 0x98
+
+	// BCM2711 replaces the GPPUD/GPPUDCLK sequence with direct 2 bit fields.
+	gpioPupPdnCntrlReg0 = 0xE4
+	gpioPupPdnCntrlReg3 = 0xF0
+
+	// Reading an unimplemented register on the older chips returns "gpio".
+	bcm2835Signature = 0x6770696f
+
+	pudSetupDelay = 5 * time.Microsecond
+)
+
+// Function represents a GPIO function select value.
+type Function uint32
+
+// The function select values of the BCM283x GPIO block.
+const (
+	FuncInput  Function = 0x0
+	FuncOutput Function = 0x1
+	FuncAlt0   Function = 0x4
+	FuncAlt1   Function = 0x5
+	FuncAlt2   Function = 0x6
+	FuncAlt3   Function = 0x7
+	FuncAlt4   Function = 0x3
+	FuncAlt5   Function = 0x2
+)
+
+// Pull represents a pull-up/down resistor setting.
+type Pull uint32
+
+// The pull settings, as encoded in GPPUD.
+const (
+	PullOff  Pull = 0x0
+	PullDown Pull = 0x1
+	PullUp   Pull = 0x2
+)
+
+// gpioRegs provides access to the GPIO register block. The backing slice is
+// either the /dev/gpiomem mapping or, in tests, plain memory.
+type gpioRegs struct {
+	mem []byte
+
+	bcm2711 bool
+
+	mu sync.Mutex // Guards read-modify-write sequences.
+}
+
+func newGPIORegs(mem []byte) *gpioRegs {
+	r := &gpioRegs{mem: mem}
+	r.bcm2711 = r.read(gpioPupPdnCntrlReg3) != bcm2835Signature
+	return r
+}
+
+func (r *gpioRegs) reg(off int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&r.mem[off]))
+}
+
+func (r *gpioRegs) read(off int) uint32 {
+	return atomic.LoadUint32(r.reg(off))
+}
+
+func (r *gpioRegs) write(off int, val uint32) {
+	atomic.StoreUint32(r.reg(off), val)
+}
+
+func (r *gpioRegs) function(n int) Function {
+	off := gpfsel0 + (n/10)*4
+	shift := uint(n%10) * 3
+	return Function(r.read(off) >> shift & 0x7)
+}
+
+func (r *gpioRegs) setFunction(n int, f Function) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	off := gpfsel0 + (n/10)*4
+	shift := uint(n%10) * 3
+	r.write(off, r.read(off)&^(0x7<<shift)|uint32(f)<<shift)
+}
+
+func (r *gpioRegs) set(n int) {
+	r.write(gpset0+(n/32)*4, 1<<uint(n%32))
+}
+
+func (r *gpioRegs) clear(n int) {
+	r.write(gpclr0+(n/32)*4, 1<<uint(n%32))
+}
+
+func (r *gpioRegs) level(n int) bool {
+	return r.read(gplev0+(n/32)*4)&(1<<uint(n%32)) != 0
+}
+
+func (r *gpioRegs) setPull(n int, p Pull) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.bcm2711 {
+		// The BCM2711 swaps the encoding of up and down.
+		var bits uint32
+		switch p {
+		case PullUp:
+			bits = 0x1
+		case PullDown:
+			bits = 0x2
+		}
+		off := gpioPupPdnCntrlReg0 + (n/16)*4
+		shift := uint(n%16) * 2
+		r.write(off, r.read(off)&^(0x3<<shift)|bits<<shift)
+		return
+	}
+
+	clk := gppudclk0 + (n/32)*4
+	r.write(gppud, uint32(p))
+	time.Sleep(pudSetupDelay)
+	r.write(clk, 1<<uint(n%32))
+	time.Sleep(pudSetupDelay)
+	r.write(gppud, 0)
+	r.write(clk, 0)
+}
+
+var gpioMem struct {
+	regs *gpioRegs
+	err  error
+	once sync.Once
+}
+
+// mapGPIOMem maps the GPIO registers exposed by /dev/gpiomem. The mapping
+// is shared by all the pins and lives as long as the process.
+func mapGPIOMem() (*gpioRegs, error) {
+	gpioMem.once.Do(func() {
+		file, err := os.OpenFile(embd.FSPath(gpioMemPath), os.O_RDWR|os.O_SYNC, 0)
+		if err != nil {
+			gpioMem.err = err
+			return
+		}
+		defer file.Close()
+
+		mem, err := syscall.Mmap(int(file.Fd()), 0, gpioMemSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			gpioMem.err = err
+			return
+		}
+		gpioMem.regs = newGPIORegs(mem)
+	})
+	return gpioMem.regs, gpioMem.err
+}
@@ -0,0 +1,133 @@
+package rpi
+
+import (
+	"testing"
+
+	"github.com/kidoman/embd"
+)
+
+func newTestRegs(bcm2711 bool) *gpioRegs {
+	mem := make([]byte, gpioMemSize)
+	if !bcm2711 {
+		// Mimic the older chips, which return "gpio" for the unimplemented
+		// pull control registers.
+		mem[gpioPupPdnCntrlReg3] = 0x6f
+		mem[gpioPupPdnCntrlReg3+1] = 0x69
+		mem[gpioPupPdnCntrlReg3+2] = 0x70
+		mem[gpioPupPdnCntrlReg3+3] = 0x67
+	}
+	return newGPIORegs(mem)
+}
+
+func TestGPIORegsDetectChip(t *testing.T) {
+	if newTestRegs(false).bcm2711 {
+		t.Error("BCM2835 register block detected as BCM2711")
+	}
+	if !newTestRegs(true).bcm2711 {
+		t.Error("BCM2711 register block not detected")
+	}
+}
+
+func TestGPIORegsFunction(t *testing.T) {
+	var tests = []struct {
+		n   int
+		f   Function
+		off int
+		val uint32
+	}{
+		{0, FuncOutput, gpfsel0, 0x1},
+		{9, FuncAlt0, gpfsel0, 0x4 << 27},
+		{17, FuncOutput, gpfsel0 + 4, 0x1 << 21},
+		{53, FuncAlt5, gpfsel0 + 20, 0x2 << 9},
+	}
+	for _, test := range tests {
+		regs := newTestRegs(false)
+		regs.write(test.off, 0xFFFFFFFF)
+		regs.setFunction(test.n, test.f)
+		if got := regs.function(test.n); got != test.f {
+			t.Errorf("Function of pin %v: got %#x, want %#x", test.n, got, test.f)
+		}
+		want := ^uint32(0)&^(0x7<<(uint(test.n%10)*3)) | test.val
+		if got := regs.read(test.off); got != want {
+			t.Errorf("GPFSEL for pin %v: got %#08x, want %#08x", test.n, got, want)
+		}
+	}
+}
+
+func TestGPIORegsSetClearLevel(t *testing.T) {
+	regs := newTestRegs(false)
+	regs.set(4)
+	if got := regs.read(gpset0); got != 1<<4 {
+		t.Errorf("GPSET0: got %#08x, want %#08x", got, 1<<4)
+	}
+	regs.clear(40)
+	if got := regs.read(gpclr0 + 4); got != 1<<8 {
+		t.Errorf("GPCLR1: got %#08x, want %#08x", got, 1<<8)
+	}
+	regs.write(gplev0+4, 1<<2)
+	if !regs.level(34) {
+		t.Error("Level of pin 34: got low, want high")
+	}
+	if regs.level(2) {
+		t.Error("Level of pin 2: got high, want low")
+	}
+}
+
+func TestGPIORegsPullBCM2835(t *testing.T) {
+	regs := newTestRegs(false)
+	regs.setPull(17, PullUp)
+	// The sequence ends by clearing both registers.
+	if got := regs.read(gppud); got != 0 {
+		t.Errorf("GPPUD after sequence: got %#x, want 0", got)
+	}
+	if got := regs.read(gppudclk0); got != 0 {
+		t.Errorf("GPPUDCLK0 after sequence: got %#x, want 0", got)
+	}
+}
+
+func TestGPIORegsPullBCM2711(t *testing.T) {
+	var tests = []struct {
+		n    int
+		pull Pull
+		off  int
+		val  uint32
+	}{
+		{0, PullUp, gpioPupPdnCntrlReg0, 0x1},
+		{17, PullDown, gpioPupPdnCntrlReg0 + 4, 0x2 << 2},
+		{47, PullUp, gpioPupPdnCntrlReg0 + 8, 0x1 << 30},
+		{47, PullOff, gpioPupPdnCntrlReg0 + 8, 0},
+	}
+	for _, test := range tests {
+		regs := newTestRegs(true)
+		regs.setPull(test.n, test.pull)
+		if got := regs.read(test.off); got != test.val {
+			t.Errorf("Pull %v on pin %v: got %#08x, want %#08x", test.pull, test.n, got, test.val)
+		}
+	}
+}
+
+func TestDigitalPinWrite(t *testing.T) {
+	regs := newTestRegs(false)
+	pinMap := embd.PinMap{
+		&embd.PinDesc{ID: "P1_11", Aliases: []string{"17"}, Caps: embd.CapDigital, DigitalLogical: 17},
+	}
+	driver := embd.NewGPIODriver(pinMap, func(pd *embd.PinDesc, drv embd.GPIODriver) embd.DigitalPin {
+		return newDigitalPin(pd, drv, regs)
+	}, nil, nil)
+	pin, err := driver.DigitalPin(17)
+	if err != nil {
+		t.Fatalf("Looking up digital pin 17: got %v", err)
+	}
+	if err := pin.ActiveLow(true); err != nil {
+		t.Fatalf("Setting pin 17 active low: got %v", err)
+	}
+	if err := pin.Write(embd.High); err != nil {
+		t.Fatalf("Writing pin 17: got %v", err)
+	}
+	if got := regs.read(gpclr0); got != 1<<17 {
+		t.Errorf("Writing high to active low pin 17: GPCLR0 = %#08x, want %#08x", got, 1<<17)
+	}
+	if v, _ := pin.Read(); v != embd.High {
+		t.Errorf("Reading active low pin 17 with level low: got %v, want %v", v, embd.High)
+	}
+}
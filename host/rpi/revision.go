@@ -0,0 +1,203 @@
+// Board revision decoding.
+// Refer to https://www.raspberrypi.org/documentation/hardware/raspberrypi/revision-codes/
+// for details.
+
+package rpi
+
+import (
+	"fmt"
+
+	"github.com/kidoman/embd"
+)
+
+// The processors used on the Raspberry Pi boards.
+const (
+	BCM2835 = "BCM2835"
+	BCM2836 = "BCM2836"
+	BCM2837 = "BCM2837"
+	BCM2711 = "BCM2711"
+)
+
+// BoardInfo describes a Raspberry Pi board, as decoded from the revision
+// code found in /proc/cpuinfo.
+type BoardInfo struct {
+	// Code is the raw revision code.
+	Code int
+
+	// Model is the board model, e.g. "3B+" or "Zero W".
+	Model string
+
+	// Revision is the PCB revision, e.g. "1.2".
+	Revision string
+
+	// Memory is the amount of RAM in MB.
+	Memory int
+
+	Manufacturer string
+	Processor    string
+
+	// Header is the number of pins on the GPIO header (26 or 40).
+	Header int
+
+	// I2CBuses, SPIBuses and UARTs list the bus numbers which can be routed
+	// to the GPIO header, some of them only after loading the matching
+	// device tree overlay.
+	I2CBuses []byte
+	SPIBuses []int
+	UARTs    []int
+}
+
+const (
+	newStyleFlag = 1 << 23
+	warrantyMask = 0xFFFFFF
+)
+
+var newStyleModels = map[int]string{
+	0x00: "A",
+	0x01: "B",
+	0x02: "A+",
+	0x03: "B+",
+	0x04: "2B",
+	0x05: "Alpha",
+	0x06: "CM1",
+	0x08: "3B",
+	0x09: "Zero",
+	0x0a: "CM3",
+	0x0c: "Zero W",
+	0x0d: "3B+",
+	0x0e: "3A+",
+	0x10: "CM3+",
+	0x11: "4B",
+	0x12: "Zero 2 W",
+	0x13: "400",
+	0x14: "CM4",
+}
+
+var newStyleProcessors = map[int]string{
+	0: BCM2835,
+	1: BCM2836,
+	2: BCM2837,
+	3: BCM2711,
+}
+
+var manufacturers = map[int]string{
+	0: "Sony UK",
+	1: "Egoman",
+	2: "Embest",
+	3: "Sony Japan",
+	4: "Embest",
+	5: "Stadium",
+}
+
+var oldStyleBoards = map[int]BoardInfo{
+	0x0002: {Model: "B", Revision: "1.0", Memory: 256, Manufacturer: "Egoman"},
+	0x0003: {Model: "B", Revision: "1.0", Memory: 256, Manufacturer: "Egoman"},
+	0x0004: {Model: "B", Revision: "2.0", Memory: 256, Manufacturer: "Sony UK"},
+	0x0005: {Model: "B", Revision: "2.0", Memory: 256, Manufacturer: "Qisda"},
+	0x0006: {Model: "B", Revision: "2.0", Memory: 256, Manufacturer: "Egoman"},
+	0x0007: {Model: "A", Revision: "2.0", Memory: 256, Manufacturer: "Egoman"},
+	0x0008: {Model: "A", Revision: "2.0", Memory: 256, Manufacturer: "Sony UK"},
+	0x0009: {Model: "A", Revision: "2.0", Memory: 256, Manufacturer: "Qisda"},
+	0x000d: {Model: "B", Revision: "2.0", Memory: 512, Manufacturer: "Egoman"},
+	0x000e: {Model: "B", Revision: "2.0", Memory: 512, Manufacturer: "Sony UK"},
+	0x000f: {Model: "B", Revision: "2.0", Memory: 512, Manufacturer: "Egoman"},
+	0x0010: {Model: "B+", Revision: "1.2", Memory: 512, Manufacturer: "Sony UK"},
+	0x0011: {Model: "CM1", Revision: "1.0", Memory: 512, Manufacturer: "Sony UK"},
+	0x0012: {Model: "A+", Revision: "1.1", Memory: 256, Manufacturer: "Sony UK"},
+	0x0013: {Model: "B+", Revision: "1.2", Memory: 512, Manufacturer: "Embest"},
+	0x0014: {Model: "CM1", Revision: "1.0", Memory: 512, Manufacturer: "Embest"},
+	0x0015: {Model: "A+", Revision: "1.1", Memory: 256, Manufacturer: "Embest"},
+}
+
+// DecodeRevision decodes both the old style (0002-0015) and the new style
+// (bit 23 set) revision codes.
+func DecodeRevision(code int) (*BoardInfo, error) {
+	var info BoardInfo
+
+	if code&newStyleFlag == 0 {
+		board, ok := oldStyleBoards[code&warrantyMask]
+		if !ok {
+			return nil, fmt.Errorf("rpi: unknown revision code %#04x", code)
+		}
+		info = board
+		info.Processor = BCM2835
+	} else {
+		var ok bool
+		if info.Model, ok = newStyleModels[code>>4&0xFF]; !ok {
+			return nil, fmt.Errorf("rpi: unknown board type %#x in revision code %#x", code>>4&0xFF, code)
+		}
+		if info.Processor, ok = newStyleProcessors[code>>12&0xF]; !ok {
+			return nil, fmt.Errorf("rpi: unknown processor %#x in revision code %#x", code>>12&0xF, code)
+		}
+		if info.Manufacturer, ok = manufacturers[code>>16&0xF]; !ok {
+			return nil, fmt.Errorf("rpi: unknown manufacturer %#x in revision code %#x", code>>16&0xF, code)
+		}
+		info.Revision = fmt.Sprintf("1.%v", code&0xF)
+		info.Memory = 256 << uint(code>>20&0x7)
+	}
+	info.Code = code
+
+	info.Header = 40
+	info.I2CBuses = []byte{1}
+	info.SPIBuses = []int{0, 1}
+	info.UARTs = []int{0}
+	switch {
+	case info.Model == "B" && info.Revision == "1.0":
+		info.Header = 26
+		info.I2CBuses = []byte{0}
+		info.SPIBuses = []int{0}
+	case info.Model == "A" || info.Model == "B":
+		// The pins of SPI1 are not on the 26 pin header.
+		info.Header = 26
+		info.SPIBuses = []int{0}
+	case info.Processor == BCM2711:
+		info.I2CBuses = []byte{1, 3, 4, 5, 6}
+		info.SPIBuses = []int{0, 1, 3, 4, 5, 6}
+		info.UARTs = []int{0, 2, 3, 4, 5}
+	}
+
+	return &info, nil
+}
+
+// Board returns the information about the board embd is running on.
+func Board() (*BoardInfo, error) {
+	host, rev, err := embd.DetectHost()
+	if err != nil {
+		return nil, err
+	}
+	if host != embd.HostRPi {
+		return nil, fmt.Errorf("rpi: host %v is not a Raspberry Pi", host)
+	}
+	return DecodeRevision(rev)
+}
+
+func (b *BoardInfo) String() string {
+	return fmt.Sprintf("Raspberry Pi %v rev %v (%vMB, %v, made by %v)", b.Model, b.Revision, b.Memory, b.Processor, b.Manufacturer)
+}
+
+// pinMap returns the header pin map matching the board.
+func (b *BoardInfo) pinMap() embd.PinMap {
+	switch {
+	case b.Model == "B" && b.Revision == "1.0":
+		return rev1Pins
+	case b.Header == 26:
+		return rev2Pins
+	case b.Processor == BCM2711:
+		return rev4Pins
+	default:
+		return rev3Pins
+	}
+}
+
+// legacyPinMap picks the pin map for revision codes which cannot be decoded,
+// such as the ones passed to embd.SetHost.
+func legacyPinMap(rev int) embd.PinMap {
+	switch {
+	case rev < 4:
+		return rev1Pins
+	case rev < 16:
+		return rev2Pins
+	default:
+		return rev3Pins
+	}
+}
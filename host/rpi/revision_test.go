@@ -0,0 +1,113 @@
+package rpi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeRevision(t *testing.T) {
+	var tests = []struct {
+		code int
+		info BoardInfo
+	}{
+		{0x0002, BoardInfo{Model: "B", Revision: "1.0", Memory: 256, Manufacturer: "Egoman", Processor: BCM2835, Header: 26}},
+		{0x000e, BoardInfo{Model: "B", Revision: "2.0", Memory: 512, Manufacturer: "Sony UK", Processor: BCM2835, Header: 26}},
+		{0x1000010, BoardInfo{Model: "B+", Revision: "1.2", Memory: 512, Manufacturer: "Sony UK", Processor: BCM2835, Header: 40}},
+		{0xa01041, BoardInfo{Model: "2B", Revision: "1.1", Memory: 1024, Manufacturer: "Sony UK", Processor: BCM2836, Header: 40}},
+		{0xa02082, BoardInfo{Model: "3B", Revision: "1.2", Memory: 1024, Manufacturer: "Sony UK", Processor: BCM2837, Header: 40}},
+		{0xa020d3, BoardInfo{Model: "3B+", Revision: "1.3", Memory: 1024, Manufacturer: "Sony UK", Processor: BCM2837, Header: 40}},
+		{0x9000c1, BoardInfo{Model: "Zero W", Revision: "1.1", Memory: 512, Manufacturer: "Sony UK", Processor: BCM2835, Header: 40}},
+		{0xa22082, BoardInfo{Model: "3B", Revision: "1.2", Memory: 1024, Manufacturer: "Embest", Processor: BCM2837, Header: 40}},
+		{0xc03111, BoardInfo{Model: "4B", Revision: "1.1", Memory: 4096, Manufacturer: "Sony UK", Processor: BCM2711, Header: 40}},
+		{0xd03114, BoardInfo{Model: "4B", Revision: "1.4", Memory: 8192, Manufacturer: "Sony UK", Processor: BCM2711, Header: 40}},
+	}
+	for _, test := range tests {
+		info, err := DecodeRevision(test.code)
+		if err != nil {
+			t.Errorf("Decoding %#x: unexpected error: %v", test.code, err)
+			continue
+		}
+		got := BoardInfo{
+			Model:        info.Model,
+			Revision:     info.Revision,
+			Memory:       info.Memory,
+			Manufacturer: info.Manufacturer,
+			Processor:    info.Processor,
+			Header:       info.Header,
+		}
+		if !reflect.DeepEqual(got, test.info) {
+			t.Errorf("Decoding %#x: got %+v, want %+v", test.code, got, test.info)
+		}
+		if info.Code != test.code {
+			t.Errorf("Decoding %#x: got code %#x", test.code, info.Code)
+		}
+	}
+}
+
+func TestDecodeRevisionUnknown(t *testing.T) {
+	for _, code := range []int{0x0000, 0x0016, 0x8000f0, 0x80f000} {
+		if _, err := DecodeRevision(code); err == nil {
+			t.Errorf("Decoding %#x: did not get error", code)
+		}
+	}
+}
+
+func TestBoardBuses(t *testing.T) {
+	var tests = []struct {
+		code int
+		i2c  []byte
+		spi  []int
+		uart []int
+	}{
+		{0x0002, []byte{0}, []int{0}, []int{0}},
+		{0x000e, []byte{1}, []int{0}, []int{0}},
+		{0xa02082, []byte{1}, []int{0, 1}, []int{0}},
+		{0xc03111, []byte{1, 3, 4, 5, 6}, []int{0, 1, 3, 4, 5, 6}, []int{0, 2, 3, 4, 5}},
+	}
+	for _, test := range tests {
+		info, err := DecodeRevision(test.code)
+		if err != nil {
+			t.Fatalf("Decoding %#x: unexpected error: %v", test.code, err)
+		}
+		if !reflect.DeepEqual(info.I2CBuses, test.i2c) || !reflect.DeepEqual(info.SPIBuses, test.spi) || !reflect.DeepEqual(info.UARTs, test.uart) {
+			t.Errorf("Buses of %#x: got (%v, %v, %v), want (%v, %v, %v)", test.code, info.I2CBuses, info.SPIBuses, info.UARTs, test.i2c, test.spi, test.uart)
+		}
+	}
+}
+
+func TestBoardPinMap(t *testing.T) {
+	var tests = []struct {
+		code int
+		key  interface{}
+		cap  int
+		id   string
+	}{
+		{0x0003, 0, 0, "P1_3"},
+		{0x000e, 2, 0, "P1_3"},
+		{0x000e, "GPIO_27", 0, "P1_13"},
+		{0xa02082, 26, 0, "P1_37"},
+		{0xc03111, "I2C3_SDA", 0, "P1_7"},
+		{0xc03111, "I2C3_SCL", 0, "P1_29"},
+		{0xc03111, "I2C6_SDA", 0, "P1_15"},
+		{0xc03111, "SPI4_SCLK", 0, "P1_26"},
+		{0xc03111, "UART5_RXD", 0, "P1_33"},
+		{0xc03111, "ID_SD", 0, "P1_27"},
+	}
+	for _, test := range tests {
+		info, err := DecodeRevision(test.code)
+		if err != nil {
+			t.Fatalf("Decoding %#x: unexpected error: %v", test.code, err)
+		}
+		pd, found := info.pinMap().Lookup(test.key, ^0)
+		if !found {
+			t.Errorf("Looking up %v on %#x: not found", test.key, test.code)
+			continue
+		}
+		if pd.ID != test.id {
+			t.Errorf("Looking up %v on %#x: got %v, want %v", test.key, test.code, pd.ID, test.id)
+		}
+	}
+	if _, found := rev3Pins.Lookup("I2C6_SDA", ^0); found {
+		t.Error("Pi 4 only alias found in the rev 3 pin map")
+	}
+}
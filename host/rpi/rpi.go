@@ -5,6 +5,9 @@
 	GPIO (digital (rw))
 	I²C
 	LED
+
+	Digital IO goes through the memory mapped registers exposed by
+	/dev/gpiomem when available, and through sysfs otherwise.
 */
 package rpi
 
@@ -68,25 +71,54 @@ var rev3Pins = append(append(embd.PinMap(nil), rev2Pins...), embd.PinMap{
 	&embd.PinDesc{ID: "P1_40", Aliases: []string{"21", "GPIO_21"}, Caps: embd.CapDigital, DigitalLogical: 21},
 }...)
 
+// The BCM2711 can route its additional I²C (3-6), SPI (3-6) and UART (2-5)
+// controllers to the header once the matching overlays are loaded. The Pi 4
+// pins carry aliases for those, along with the ID EEPROM pins.
+var rev4Pins = embd.PinMap{
+	&embd.PinDesc{ID: "P1_3", Aliases: []string{"2", "GPIO_2", "SDA", "I2C1_SDA", "SPI3_MOSI"}, Caps: embd.CapDigital | embd.CapI2C | embd.CapSPI, DigitalLogical: 2},
+	&embd.PinDesc{ID: "P1_5", Aliases: []string{"3", "GPIO_3", "SCL", "I2C1_SCL", "SPI3_SCLK"}, Caps: embd.CapDigital | embd.CapI2C | embd.CapSPI, DigitalLogical: 3},
+	&embd.PinDesc{ID: "P1_7", Aliases: []string{"4", "GPIO_4", "GPCLK0", "I2C3_SDA", "SPI4_CE0_N", "UART3_TXD"}, Caps: embd.CapDigital | embd.CapI2C | embd.CapUART | embd.CapSPI, DigitalLogical: 4},
+	&embd.PinDesc{ID: "P1_8", Aliases: []string{"14", "GPIO_14", "TXD", "UART0_TXD", "SPI5_MOSI"}, Caps: embd.CapDigital | embd.CapUART | embd.CapSPI, DigitalLogical: 14},
+	&embd.PinDesc{ID: "P1_10", Aliases: []string{"15", "GPIO_15", "RXD", "UART0_RXD", "SPI5_SCLK"}, Caps: embd.CapDigital | embd.CapUART | embd.CapSPI, DigitalLogical: 15},
+	&embd.PinDesc{ID: "P1_11", Aliases: []string{"17", "GPIO_17"}, Caps: embd.CapDigital, DigitalLogical: 17},
+	&embd.PinDesc{ID: "P1_12", Aliases: []string{"18", "GPIO_18", "PCM_CLK", "SPI6_CE0_N"}, Caps: embd.CapDigital | embd.CapSPI, DigitalLogical: 18},
+	&embd.PinDesc{ID: "P1_13", Aliases: []string{"27", "GPIO_27"}, Caps: embd.CapDigital, DigitalLogical: 27},
+	&embd.PinDesc{ID: "P1_15", Aliases: []string{"22", "GPIO_22", "I2C6_SDA"}, Caps: embd.CapDigital | embd.CapI2C, DigitalLogical: 22},
+	&embd.PinDesc{ID: "P1_16", Aliases: []string{"23", "GPIO_23", "I2C6_SCL"}, Caps: embd.CapDigital | embd.CapI2C, DigitalLogical: 23},
+	&embd.PinDesc{ID: "P1_18", Aliases: []string{"24", "GPIO_24"}, Caps: embd.CapDigital, DigitalLogical: 24},
+	&embd.PinDesc{ID: "P1_19", Aliases: []string{"10", "GPIO_10", "MOSI", "SPI0_MOSI"}, Caps: embd.CapDigital | embd.CapSPI, DigitalLogical: 10},
+	&embd.PinDesc{ID: "P1_21", Aliases: []string{"9", "GPIO_9", "MISO", "SPI0_MISO", "I2C4_SCL", "UART4_RXD"}, Caps: embd.CapDigital | embd.CapI2C | embd.CapUART | embd.CapSPI, DigitalLogical: 9},
+	&embd.PinDesc{ID: "P1_22", Aliases: []string{"25", "GPIO_25"}, Caps: embd.CapDigital, DigitalLogical: 25},
+	&embd.PinDesc{ID: "P1_23", Aliases: []string{"11", "GPIO_11", "SCLK", "SPI0_SCLK"}, Caps: embd.CapDigital | embd.CapSPI, DigitalLogical: 11},
+	&embd.PinDesc{ID: "P1_24", Aliases: []string{"8", "GPIO_8", "CE0", "SPI0_CE0_N", "I2C4_SDA", "UART4_TXD"}, Caps: embd.CapDigital | embd.CapI2C | embd.CapUART | embd.CapSPI, DigitalLogical: 8},
+	&embd.PinDesc{ID: "P1_26", Aliases: []string{"7", "GPIO_7", "CE1", "SPI0_CE1_N", "SPI4_SCLK"}, Caps: embd.CapDigital | embd.CapSPI, DigitalLogical: 7},
+	&embd.PinDesc{ID: "P1_27", Aliases: []string{"0", "GPIO_0", "ID_SD", "I2C0_SDA", "SPI3_CE0_N", "UART2_TXD"}, Caps: embd.CapDigital | embd.CapI2C | embd.CapSPI | embd.CapUART, DigitalLogical: 0},
+	&embd.PinDesc{ID: "P1_28", Aliases: []string{"1", "GPIO_1", "ID_SC", "I2C0_SCL", "SPI3_MISO", "UART2_RXD"}, Caps: embd.CapDigital | embd.CapI2C | embd.CapSPI | embd.CapUART, DigitalLogical: 1},
+	&embd.PinDesc{ID: "P1_29", Aliases: []string{"5", "GPIO_5", "I2C3_SCL", "SPI4_MISO", "UART3_RXD"}, Caps: embd.CapDigital | embd.CapI2C | embd.CapUART | embd.CapSPI, DigitalLogical: 5},
+	&embd.PinDesc{ID: "P1_31", Aliases: []string{"6", "GPIO_6", "SPI4_MOSI"}, Caps: embd.CapDigital | embd.CapSPI, DigitalLogical: 6},
+	&embd.PinDesc{ID: "P1_32", Aliases: []string{"12", "GPIO_12", "I2C5_SDA", "SPI5_CE0_N", "UART5_TXD"}, Caps: embd.CapDigital | embd.CapI2C | embd.CapUART | embd.CapSPI, DigitalLogical: 12},
+	&embd.PinDesc{ID: "P1_33", Aliases: []string{"13", "GPIO_13", "I2C5_SCL", "SPI5_MISO", "UART5_RXD"}, Caps: embd.CapDigital | embd.CapI2C | embd.CapUART | embd.CapSPI, DigitalLogical: 13},
+	&embd.PinDesc{ID: "P1_35", Aliases: []string{"19", "GPIO_19", "SPI6_MISO"}, Caps: embd.CapDigital | embd.CapSPI, DigitalLogical: 19},
+	&embd.PinDesc{ID: "P1_36", Aliases: []string{"16", "GPIO_16"}, Caps: embd.CapDigital, DigitalLogical: 16},
+	&embd.PinDesc{ID: "P1_37", Aliases: []string{"26", "GPIO_26"}, Caps: embd.CapDigital, DigitalLogical: 26},
+	&embd.PinDesc{ID: "P1_38", Aliases: []string{"20", "GPIO_20", "SPI6_MOSI"}, Caps: embd.CapDigital | embd.CapSPI, DigitalLogical: 20},
+	&embd.PinDesc{ID: "P1_40", Aliases: []string{"21", "GPIO_21", "SPI6_SCLK"}, Caps: embd.CapDigital | embd.CapSPI, DigitalLogical: 21},
+}
+
 var ledMap = embd.LEDMap{
 	"led0": []string{"0", "led0", "LED0"},
 }
 
 func init() {
 	embd.Register(embd.HostRPi, func(rev int) *embd.Descriptor {
-		// Refer to http://elinux.org/RPi_HardwareHistory#Board_Revision_History
-		// for details.
-		pins := rev3Pins
-		if rev < 16 {
-			pins = rev2Pins
-		}
-		if rev < 4 {
-			pins = rev1Pins
+		pins := legacyPinMap(rev)
+		if info, err := DecodeRevision(rev); err == nil {
+			pins = info.pinMap()
 		}
 
 		return &embd.Descriptor{
 			GPIODriver: func() embd.GPIODriver {
-				return embd.NewGPIODriver(pins, generic.NewDigitalPin, nil, nil)
+				return embd.NewGPIODriverWithPorts(pins, NewDigitalPin, nil, nil, generic.NewDigitalPort)
 			},
 			I2CDriver: func() embd.I2CDriver {
 				return embd.NewI2CDriver(generic.NewI2CBus)
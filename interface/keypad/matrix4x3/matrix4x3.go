@@ -2,11 +2,13 @@
 package matrix4x3
 
 import (
+	"context"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
 )
 
 type Key int
@@ -75,8 +77,7 @@ type Matrix4x3 struct {
 
 	poll int
 
-	keyPressed chan Key
-	quit       chan bool
+	sampler sensor.Sampler
 }
 
 // New creates a new interface for matrix4x3.
@@ -180,47 +181,33 @@ func (d *Matrix4x3) findPressedKey() (Key, error) {
 	return KNone, nil
 }
 
+func (d *Matrix4x3) sample() (interface{}, error) {
+	return d.findPressedKey()
+}
+
 // Pressed key returns the current key pressed on the keypad.
-func (d *Matrix4x3) PressedKey() (key Key, err error) {
-	select {
-	case key = <-d.keyPressed:
-		return
-	default:
-		return d.findPressedKey()
+func (d *Matrix4x3) PressedKey() (Key, error) {
+	if r, ok := d.sampler.Latest(); ok {
+		if r.Err != nil {
+			return KNone, r.Err
+		}
+		return r.Value.(Key), nil
 	}
+	return d.findPressedKey()
+}
+
+// Readings scans the keypad every period until ctx is done. The values are
+// Keys, KNone when no key is pressed.
+func (d *Matrix4x3) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	return sensor.Sample(ctx, period, d.sample)
 }
 
 // Run starts the continuous key scan loop.
 func (d *Matrix4x3) Run() {
-	d.quit = make(chan bool)
-
-	go func() {
-		timer := time.Tick(time.Duration(d.poll) * time.Millisecond)
-		var key Key
-
-		for {
-			var keyUpdates chan Key
-
-			select {
-			case <-timer:
-				var err error
-				if key, err = d.findPressedKey(); err == nil {
-					keyUpdates = d.keyPressed
-				}
-			case keyUpdates <- key:
-				keyUpdates = nil
-			case <-d.quit:
-				d.keyPressed = nil
-
-				return
-			}
-		}
-	}()
+	d.sampler.Start(time.Duration(d.poll)*time.Millisecond, d.sample)
 }
 
-// Close.
+// Close stops the key scan loop.
 func (d *Matrix4x3) Close() {
-	if d.quit != nil {
-		d.quit <- true
-	}
+	d.sampler.Stop()
 }
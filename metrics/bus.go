@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/kidoman/embd"
+)
+
+// DefaultLatencyBuckets are the upper bounds of the latency histogram of
+// the buses, in seconds.
+var DefaultLatencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1}
+
+type busKey struct {
+	bus string
+	num byte
+}
+
+type busStats struct {
+	transactions uint64
+	errors       uint64
+	bytes        uint64
+	seconds      float64
+	counts       []uint64 // by bucket, not cumulative
+}
+
+// BusCollector counts the transactions, errors and bytes of each I²C and
+// SPI bus, and the distribution of their latency.
+type BusCollector struct {
+	buckets []float64
+	remove  func()
+
+	mu    sync.Mutex
+	stats map[busKey]*busStats
+}
+
+// NewBusCollector returns a collector observing the buses of the host
+// through a bus hook. buckets are the upper bounds of the latency
+// histogram in seconds, DefaultLatencyBuckets if nil.
+func NewBusCollector(buckets []float64) *BusCollector {
+	if buckets == nil {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	c := &BusCollector{buckets: buckets, stats: make(map[busKey]*busStats)}
+	c.remove = embd.AddBusHook(c.Observe)
+	return c
+}
+
+// Observe records a transaction. It is called by the bus hook.
+func (c *BusCollector) Observe(t embd.BusTransaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := busKey{t.Bus, t.Num}
+	s, ok := c.stats[k]
+	if !ok {
+		s = &busStats{counts: make([]uint64, len(c.buckets))}
+		c.stats[k] = s
+	}
+	s.transactions++
+	if t.Err != nil {
+		s.errors++
+	} else {
+		s.bytes += uint64(t.Len)
+	}
+	d := t.Duration.Seconds()
+	s.seconds += d
+	if i := sort.SearchFloat64s(c.buckets, d); i < len(c.buckets) {
+		s.counts[i]++
+	}
+}
+
+// Close stops observing the buses.
+func (c *BusCollector) Close() {
+	c.remove()
+}
+
+type byBus []busKey
+
+func (k byBus) Len() int      { return len(k) }
+func (k byBus) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k byBus) Less(i, j int) bool {
+	if k[i].bus != k[j].bus {
+		return k[i].bus < k[j].bus
+	}
+	return k[i].num < k[j].num
+}
+
+// Collect implements Collector.
+func (c *BusCollector) Collect() []Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	transactions := Family{Name: "embd_bus_transactions_total", Help: "Transactions on the bus.", Type: Counter}
+	errors := Family{Name: "embd_bus_errors_total", Help: "Failed transactions on the bus.", Type: Counter}
+	bytes := Family{Name: "embd_bus_bytes_total", Help: "Bytes transferred by the successful transactions on the bus.", Type: Counter}
+	latency := Family{Name: "embd_bus_transaction_duration_seconds", Help: "Duration of the transactions on the bus.", Type: Histogram}
+
+	keys := make([]busKey, 0, len(c.stats))
+	for k := range c.stats {
+		keys = append(keys, k)
+	}
+	sort.Sort(byBus(keys))
+
+	for _, k := range keys {
+		s := c.stats[k]
+		labels := []Label{{"bus", k.bus}, {"num", strconv.Itoa(int(k.num))}}
+		transactions.Metrics = append(transactions.Metrics, Metric{Labels: labels, Value: float64(s.transactions)})
+		errors.Metrics = append(errors.Metrics, Metric{Labels: labels, Value: float64(s.errors)})
+		bytes.Metrics = append(bytes.Metrics, Metric{Labels: labels, Value: float64(s.bytes)})
+
+		h := Metric{Labels: labels, Value: s.seconds, Count: s.transactions}
+		var n uint64
+		for i, ub := range c.buckets {
+			n += s.counts[i]
+			h.Buckets = append(h.Buckets, Bucket{UpperBound: ub, Count: n})
+		}
+		latency.Metrics = append(latency.Metrics, h)
+	}
+	return []Family{transactions, errors, bytes, latency}
+}
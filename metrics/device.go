@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+)
+
+// SensorValue is a quantity measured by a sensor, e.g. the temperature.
+type SensorValue struct {
+	Name  string
+	Unit  string
+	Value float64
+}
+
+// Sensor is a named sensor, read on every scrape.
+type Sensor struct {
+	Name string
+	Read func() ([]SensorValue, error)
+}
+
+// SensorCollector exports the values of sensors as gauges, and counts the
+// failed reads.
+type SensorCollector struct {
+	sensors []Sensor
+
+	mu     sync.Mutex
+	errors map[string]uint64
+}
+
+// NewSensorCollector returns a collector reading the sensors.
+func NewSensorCollector(sensors ...Sensor) *SensorCollector {
+	return &SensorCollector{sensors: sensors, errors: make(map[string]uint64)}
+}
+
+// Collect implements Collector.
+func (c *SensorCollector) Collect() []Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := Family{Name: "embd_sensor_value", Help: "Value read from the sensor, in the unit of its label.", Type: Gauge}
+	errors := Family{Name: "embd_sensor_read_errors_total", Help: "Failed reads of the sensor.", Type: Counter}
+	for _, s := range c.sensors {
+		vs, err := s.Read()
+		if err != nil {
+			glog.Errorf("metrics: reading %v: %v", s.Name, err)
+			c.errors[s.Name]++
+		}
+		errors.Metrics = append(errors.Metrics, Metric{Labels: []Label{{"sensor", s.Name}}, Value: float64(c.errors[s.Name])})
+		if err != nil {
+			continue
+		}
+		for _, v := range vs {
+			labels := []Label{{"sensor", s.Name}, {"name", v.Name}, {"unit", v.Unit}}
+			values.Metrics = append(values.Metrics, Metric{Labels: labels, Value: v.Value})
+		}
+	}
+	return []Family{values, errors}
+}
+
+// Input is a named digital input. The pin must already be an input.
+type Input struct {
+	Name string
+	Pin  embd.DigitalPin
+}
+
+type input struct {
+	interrupts uint64 // first, to be 64-bit aligned for atomic on 32-bit platforms
+	Input
+	watched bool
+}
+
+// InputCollector exports the levels of digital inputs, and counts their
+// edges for the pins which support interrupts.
+type InputCollector struct {
+	inputs []*input
+}
+
+// NewInputCollector returns a collector of the inputs, and starts watching
+// their edges. The pins which cannot be watched only have their level
+// exported.
+func NewInputCollector(inputs ...Input) *InputCollector {
+	c := &InputCollector{}
+	for _, in := range inputs {
+		in := &input{Input: in}
+		err := in.Pin.Watch(embd.EdgeBoth, func(embd.DigitalPin) {
+			atomic.AddUint64(&in.interrupts, 1)
+		})
+		if err != nil {
+			glog.Warningf("metrics: cannot watch %v, not counting its interrupts: %v", in.Name, err)
+		}
+		in.watched = err == nil
+		c.inputs = append(c.inputs, in)
+	}
+	return c
+}
+
+// Collect implements Collector.
+func (c *InputCollector) Collect() []Family {
+	levels := Family{Name: "embd_digital_input", Help: "Level of the digital input, 0 or 1.", Type: Gauge}
+	interrupts := Family{Name: "embd_digital_input_interrupts_total", Help: "Edges detected on the digital input.", Type: Counter}
+	for _, in := range c.inputs {
+		labels := []Label{{"pin", in.Name}}
+		if v, err := in.Pin.Read(); err != nil {
+			glog.Errorf("metrics: reading %v: %v", in.Name, err)
+		} else {
+			levels.Metrics = append(levels.Metrics, Metric{Labels: labels, Value: float64(v)})
+		}
+		if in.watched {
+			interrupts.Metrics = append(interrupts.Metrics, Metric{Labels: labels, Value: float64(atomic.LoadUint64(&in.interrupts))})
+		}
+	}
+	return []Family{levels, interrupts}
+}
+
+// Close stops watching the inputs.
+func (c *InputCollector) Close() error {
+	var err error
+	for _, in := range c.inputs {
+		if !in.watched {
+			continue
+		}
+		if e := in.Pin.StopWatching(); e != nil && err == nil {
+			err = e
+		}
+		in.watched = false
+	}
+	return err
+}
@@ -0,0 +1,194 @@
+// Package metrics exports the sensors, the digital inputs and the health of
+// the buses of the host in the Prometheus text format.
+//
+// A Registry gathers the metrics of its collectors whenever it is scraped:
+//
+//	reg := metrics.NewRegistry()
+//	reg.Register(metrics.NewBusCollector(nil))
+//	reg.Register(metrics.NewSensorCollector(metrics.Sensor{Name: "bmp180", Read: read}))
+//	http.Handle("/metrics", reg)
+//
+// BusCollector relies on the hooks of the I²C and SPI buses of the host
+// (see embd.AddBusHook), so the transactions of every driver are counted
+// without any change to the drivers.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// Type is the type of a metric family.
+type Type string
+
+// The metric types.
+const (
+	Counter   Type = "counter"
+	Gauge     Type = "gauge"
+	Histogram Type = "histogram"
+)
+
+// Label is a dimension of a metric.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Bucket is a bucket of a histogram, with the number of observations less
+// than or equal to UpperBound.
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// Metric is a sample of a metric family. For a histogram, Value is the sum
+// of the observations, Count their number and Buckets their cumulative
+// distribution.
+type Metric struct {
+	Labels  []Label
+	Value   float64
+	Count   uint64
+	Buckets []Bucket
+}
+
+// Family is a set of metrics sharing a name.
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Metrics []Metric
+}
+
+// Collector returns the current metrics of what it watches.
+type Collector interface {
+	Collect() []Family
+}
+
+// Registry gathers the metrics of a set of collectors. It serves them over
+// HTTP in the Prometheus text format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a collector to the registry.
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+type byName []Family
+
+func (f byName) Len() int           { return len(f) }
+func (f byName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f byName) Less(i, j int) bool { return f[i].Name < f[j].Name }
+
+// Gather collects the metrics of all the collectors. The families with the
+// same name are merged, and sorted by name.
+func (r *Registry) Gather() []Family {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	var families []Family
+	index := make(map[string]int)
+	for _, c := range collectors {
+		for _, f := range c.Collect() {
+			if i, ok := index[f.Name]; ok {
+				families[i].Metrics = append(families[i].Metrics, f.Metrics...)
+				continue
+			}
+			index[f.Name] = len(families)
+			families = append(families, f)
+		}
+	}
+	sort.Stable(byName(families))
+	return families
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := Write(w, r.Gather()); err != nil {
+		glog.Errorf("metrics: %v", err)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeSample(w *bufio.Writer, name string, labels []Label, value string) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%v="%v"`, l.Name, labelEscaper.Replace(l.Value))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(value)
+	w.WriteByte('\n')
+}
+
+// Write writes the families in the Prometheus text format.
+func Write(w io.Writer, families []Family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		if f.Help != "" {
+			fmt.Fprintf(bw, "# HELP %v %v\n", f.Name, helpEscaper.Replace(f.Help))
+		}
+		fmt.Fprintf(bw, "# TYPE %v %v\n", f.Name, f.Type)
+		for _, m := range f.Metrics {
+			if f.Type != Histogram {
+				writeSample(bw, f.Name, m.Labels, formatFloat(m.Value))
+				continue
+			}
+			inf := false
+			for _, b := range m.Buckets {
+				le := Label{"le", formatFloat(b.UpperBound)}
+				writeSample(bw, f.Name+"_bucket", append(m.Labels[:len(m.Labels):len(m.Labels)], le), strconv.FormatUint(b.Count, 10))
+				inf = inf || math.IsInf(b.UpperBound, 1)
+			}
+			if !inf {
+				le := Label{"le", "+Inf"}
+				writeSample(bw, f.Name+"_bucket", append(m.Labels[:len(m.Labels):len(m.Labels)], le), strconv.FormatUint(m.Count, 10))
+			}
+			writeSample(bw, f.Name+"_sum", m.Labels, formatFloat(m.Value))
+			writeSample(bw, f.Name+"_count", m.Labels, strconv.FormatUint(m.Count, 10))
+		}
+	}
+	return bw.Flush()
+}
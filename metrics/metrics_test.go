@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kidoman/embd"
+)
+
+type families []Family
+
+func (f families) Collect() []Family { return f }
+
+func TestWrite(t *testing.T) {
+	fs := []Family{
+		{Name: "a", Help: "Multi\nline \\ help.", Type: Gauge, Metrics: []Metric{
+			{Value: 1.5},
+			{Labels: []Label{{"l", `quote " and \`}}, Value: math.Inf(1)},
+		}},
+		{Name: "h", Type: Histogram, Metrics: []Metric{
+			{Labels: []Label{{"bus", "i2c"}}, Value: 0.25, Count: 3, Buckets: []Bucket{{0.1, 1}, {1, 2}}},
+		}},
+	}
+	want := `# HELP a Multi\nline \\ help.
+# TYPE a gauge
+a 1.5
+a{l="quote \" and \\"} +Inf
+# TYPE h histogram
+h_bucket{bus="i2c",le="0.1"} 1
+h_bucket{bus="i2c",le="1"} 2
+h_bucket{bus="i2c",le="+Inf"} 3
+h_sum{bus="i2c"} 0.25
+h_count{bus="i2c"} 3
+`
+	var b bytes.Buffer
+	if err := Write(&b, fs); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != want {
+		t.Errorf("got\n%v\nwant\n%v", b.String(), want)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register(families{{Name: "b", Type: Counter, Metrics: []Metric{{Labels: []Label{{"n", "1"}}, Value: 1}}}})
+	reg.Register(families{{Name: "a", Type: Gauge, Metrics: []Metric{{Value: 2}}}})
+	reg.Register(families{{Name: "b", Type: Counter, Metrics: []Metric{{Labels: []Label{{"n", "2"}}, Value: 3}}}})
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := "# TYPE a gauge\na 2\n# TYPE b counter\nb{n=\"1\"} 1\nb{n=\"2\"} 3\n"
+	if rec.Body.String() != want {
+		t.Errorf("got\n%v\nwant\n%v", rec.Body.String(), want)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", ct)
+	}
+}
+
+func collect(c Collector) string {
+	var b bytes.Buffer
+	Write(&b, c.Collect())
+	return b.String()
+}
+
+func TestBusCollector(t *testing.T) {
+	c := NewBusCollector([]float64{0.01, 0.001})
+	start := time.Now().Add(-5 * time.Millisecond)
+	embd.ObserveBus(embd.BusTransaction{Bus: "i2c", Num: 1, Len: 2}, start)
+	embd.ObserveBus(embd.BusTransaction{Bus: "i2c", Num: 1, Len: 2, Err: errors.New("nack")}, start)
+	c.Observe(embd.BusTransaction{Bus: "spi", Num: 0, Len: 4, Duration: 500 * time.Microsecond})
+	c.Close()
+	embd.ObserveBus(embd.BusTransaction{Bus: "i2c", Num: 1}, start)
+
+	got := collect(c)
+	for _, want := range []string{
+		`embd_bus_transactions_total{bus="i2c",num="1"} 2`,
+		`embd_bus_transactions_total{bus="spi",num="0"} 1`,
+		`embd_bus_errors_total{bus="i2c",num="1"} 1`,
+		`embd_bus_bytes_total{bus="i2c",num="1"} 2`,
+		`embd_bus_bytes_total{bus="spi",num="0"} 4`,
+		`embd_bus_transaction_duration_seconds_bucket{bus="i2c",num="1",le="0.001"} 0`,
+		`embd_bus_transaction_duration_seconds_bucket{bus="i2c",num="1",le="0.01"} 2`,
+		`embd_bus_transaction_duration_seconds_bucket{bus="spi",num="0",le="0.001"} 1`,
+		`embd_bus_transaction_duration_seconds_count{bus="spi",num="0"} 1`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("missing %v in\n%v", want, got)
+		}
+	}
+}
+
+func TestSensorCollector(t *testing.T) {
+	fail := false
+	c := NewSensorCollector(Sensor{Name: "bmp180", Read: func() ([]SensorValue, error) {
+		if fail {
+			return nil, errors.New("failed")
+		}
+		return []SensorValue{{"temperature", "°C", 21.5}, {"pressure", "Pa", 101325}}, nil
+	}})
+
+	got := collect(c)
+	for _, want := range []string{
+		`embd_sensor_value{sensor="bmp180",name="temperature",unit="°C"} 21.5`,
+		`embd_sensor_value{sensor="bmp180",name="pressure",unit="Pa"} 101325`,
+		`embd_sensor_read_errors_total{sensor="bmp180"} 0`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("missing %v in\n%v", want, got)
+		}
+	}
+
+	fail = true
+	got = collect(c)
+	if strings.Contains(got, "embd_sensor_value{") || !strings.Contains(got, `embd_sensor_read_errors_total{sensor="bmp180"} 1`) {
+		t.Errorf("unexpected metrics after a failed read\n%v", got)
+	}
+}
+
+type fakePin struct {
+	embd.DigitalPin
+	val     int
+	noWatch bool
+	handler func(embd.DigitalPin)
+}
+
+func (p *fakePin) Read() (int, error) { return p.val, nil }
+
+func (p *fakePin) Watch(edge embd.Edge, handler func(embd.DigitalPin)) error {
+	if p.noWatch {
+		return errors.New("no interrupts")
+	}
+	p.handler = handler
+	return nil
+}
+
+func (p *fakePin) StopWatching() error {
+	p.handler = nil
+	return nil
+}
+
+func TestInputCollector(t *testing.T) {
+	door, button := &fakePin{val: 1}, &fakePin{noWatch: true}
+	c := NewInputCollector(Input{"door", door}, Input{"button", button})
+	door.handler(door)
+	door.handler(door)
+
+	want := `# HELP embd_digital_input Level of the digital input, 0 or 1.
+# TYPE embd_digital_input gauge
+embd_digital_input{pin="door"} 1
+embd_digital_input{pin="button"} 0
+# HELP embd_digital_input_interrupts_total Edges detected on the digital input.
+# TYPE embd_digital_input_interrupts_total counter
+embd_digital_input_interrupts_total{pin="door"} 2
+`
+	if got := collect(c); got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if door.handler != nil {
+		t.Error("Close: door still watched")
+	}
+}
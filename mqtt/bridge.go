@@ -0,0 +1,555 @@
+// Package mqtt bridges the pins, LEDs and sensors of the host to an MQTT
+// broker.
+//
+// The bridge publishes to and listens on these topics, below Config.Prefix
+// (embd/<hostname> by default):
+//
+//	status                     online, or offline once the bridge is gone
+//	digital/<name>             state of a digital input or output, 0 or 1
+//	digital/<name>/set         command of a digital output, 0/1 or OFF/ON
+//	analog/<name>              sampled value of an analog input
+//	pwm/<name>                 value of a PWM output, 0 to 255
+//	pwm/<name>/set             command of a PWM output, 0 to 255
+//	led/<name>                 state of a LED, OFF or ON
+//	led/<name>/set             command of a LED, OFF, ON or TOGGLE
+//	sensor/<sensor>/<reading>  sampled sensor reading
+//
+// The offline status is registered as the last will, so it is published by
+// the broker when the bridge disconnects unexpectedly. With discovery
+// enabled, Home Assistant configuration payloads are published below
+// Config.DiscoveryPrefix so that all the above show up as entities.
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+)
+
+// Item is a pin or a LED exposed by the bridge. Name is used in the topics
+// and defaults to Key, the pin or LED key.
+type Item struct {
+	Key  string
+	Name string
+}
+
+func (i Item) name() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	return i.Key
+}
+
+// Reading is a quantity measured by a sensor, e.g. the temperature.
+type Reading struct {
+	// Name is the last level of the topic of the reading.
+	Name string
+
+	// Unit is the unit of the values, e.g. "°C".
+	Unit string
+
+	// DeviceClass is the optional Home Assistant device class, e.g.
+	// "temperature".
+	DeviceClass string
+}
+
+// Sensor is a named group of readings, sampled every Config.Interval.
+type Sensor struct {
+	Name     string
+	Readings []Reading
+
+	// Sample measures all the readings at once, returning their values in
+	// the order of Readings.
+	Sample func() ([]float64, error)
+}
+
+// Config describes what the bridge exposes and how.
+type Config struct {
+	// Prefix is prepended to all the topics. Defaults to "embd/<NodeID>".
+	Prefix string
+
+	// NodeID identifies the host in the discovery payloads. Defaults to
+	// the hostname.
+	NodeID string
+
+	// QoS is the quality of service of the messages and subscriptions.
+	QoS byte
+
+	// Retain makes the state messages retained, so that new subscribers
+	// get the last known state right away. The status and discovery
+	// messages are always retained.
+	Retain bool
+
+	// Discovery enables the Home Assistant discovery payloads, published
+	// below DiscoveryPrefix (defaults to "homeassistant").
+	Discovery       bool
+	DiscoveryPrefix string
+
+	// Interval is the sampling interval of the analog inputs, sensors and
+	// of the digital inputs which cannot be watched. Defaults to 10s.
+	Interval time.Duration
+
+	Inputs  []Item
+	Outputs []Item
+	Analogs []Item
+	PWMs    []Item
+	LEDs    []Item
+	Sensors []Sensor
+}
+
+type input struct {
+	Item
+	pin     embd.DigitalPin
+	watched bool
+	last    int
+}
+
+type output struct {
+	Item
+	pin embd.DigitalPin
+}
+
+type analog struct {
+	Item
+	pin embd.AnalogPin
+}
+
+type pwm struct {
+	Item
+	pin   embd.PWMPin
+	value int
+}
+
+type led struct {
+	Item
+	led embd.LED
+	on  bool
+}
+
+// Bridge publishes the state of the host to an MQTT broker and applies the
+// commands it receives.
+type Bridge struct {
+	c   Client
+	cfg Config
+
+	// mu guards the devices and their last known state. It is not held
+	// while publishing, so that a slow broker does not hold up the watch
+	// handlers of the inputs, which run under the lock of the interrupt
+	// listener.
+	mu      sync.Mutex
+	inputs  []*input
+	outputs []*output
+	analogs []*analog
+	pwms    []*pwm
+	leds    []*led
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+var invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// sanitize makes s usable as a Home Assistant node or object id.
+func sanitize(s string) string {
+	return invalidIDChars.ReplaceAllString(s, "_")
+}
+
+// New returns a bridge publishing through c. Call Start to run it.
+func New(c Client, cfg Config) *Bridge {
+	if cfg.NodeID == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "embd"
+		}
+		cfg.NodeID = host
+	}
+	cfg.NodeID = sanitize(cfg.NodeID)
+	if cfg.Prefix == "" {
+		cfg.Prefix = "embd/" + cfg.NodeID
+	}
+	cfg.Prefix = strings.TrimSuffix(cfg.Prefix, "/")
+	if cfg.DiscoveryPrefix == "" {
+		cfg.DiscoveryPrefix = "homeassistant"
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = 10 * time.Second
+	}
+
+	return &Bridge{c: c, cfg: cfg}
+}
+
+func (b *Bridge) topic(levels ...string) string {
+	return b.cfg.Prefix + "/" + strings.Join(levels, "/")
+}
+
+func (b *Bridge) publish(topic, payload string, retained bool) {
+	err := b.c.Publish(Message{Topic: topic, Payload: []byte(payload), QoS: b.cfg.QoS, Retained: retained})
+	if err != nil {
+		glog.Errorf("mqtt: publishing to %v: %v", topic, err)
+	}
+}
+
+func (b *Bridge) publishState(payload string, levels ...string) {
+	b.publish(b.topic(levels...), payload, b.cfg.Retain)
+}
+
+// open opens all the configured devices.
+func (b *Bridge) open() error {
+	for _, it := range b.cfg.Inputs {
+		pin, err := embd.NewDigitalPin(it.Key)
+		if err != nil {
+			return err
+		}
+		if err := pin.SetDirection(embd.In); err != nil {
+			return err
+		}
+		b.inputs = append(b.inputs, &input{Item: it, pin: pin, last: -1})
+	}
+	for _, it := range b.cfg.Outputs {
+		pin, err := embd.NewDigitalPin(it.Key)
+		if err != nil {
+			return err
+		}
+		if err := pin.SetDirection(embd.Out); err != nil {
+			return err
+		}
+		b.outputs = append(b.outputs, &output{Item: it, pin: pin})
+	}
+	for _, it := range b.cfg.Analogs {
+		pin, err := embd.NewAnalogPin(it.Key)
+		if err != nil {
+			return err
+		}
+		b.analogs = append(b.analogs, &analog{Item: it, pin: pin})
+	}
+	for _, it := range b.cfg.PWMs {
+		pin, err := embd.NewPWMPin(it.Key)
+		if err != nil {
+			return err
+		}
+		b.pwms = append(b.pwms, &pwm{Item: it, pin: pin})
+	}
+	for _, it := range b.cfg.LEDs {
+		l, err := embd.NewLED(it.Key)
+		if err != nil {
+			return err
+		}
+		b.leds = append(b.leds, &led{Item: it, led: l})
+	}
+	return nil
+}
+
+// Start opens the devices, connects to the broker and starts publishing.
+func (b *Bridge) Start() error {
+	if err := b.open(); err != nil {
+		return err
+	}
+
+	will := &Message{Topic: b.topic("status"), Payload: []byte("offline"), QoS: b.cfg.QoS, Retained: true}
+	if err := b.c.Connect(will, b.onConnect); err != nil {
+		return err
+	}
+
+	for _, in := range b.inputs {
+		in := in
+		err := in.pin.Watch(embd.EdgeBoth, func(embd.DigitalPin) {
+			b.updateInput(in, false)
+		})
+		if err != nil {
+			glog.Warningf("mqtt: cannot watch %v, polling it instead: %v", in.Key, err)
+			continue
+		}
+		b.mu.Lock()
+		in.watched = true
+		b.mu.Unlock()
+	}
+
+	b.quit = make(chan struct{})
+	b.done = make(chan struct{})
+	go b.loop()
+
+	return nil
+}
+
+// onConnect announces the bridge, subscribes to the command topics and
+// publishes the current state. It runs after every reconnection.
+func (b *Bridge) onConnect() {
+	b.publish(b.topic("status"), "online", true)
+	if b.cfg.Discovery {
+		b.publishDiscovery()
+	}
+
+	b.mu.Lock()
+	outputs, pwms, leds := b.outputs, b.pwms, b.leds
+	b.mu.Unlock()
+
+	for _, o := range outputs {
+		o := o
+		b.subscribe(func(payload string) error { return b.setOutput(o, payload) }, "digital", o.name(), "set")
+	}
+	for _, p := range pwms {
+		p := p
+		b.subscribe(func(payload string) error { return b.setPWM(p, payload) }, "pwm", p.name(), "set")
+	}
+	for _, l := range leds {
+		l := l
+		b.subscribe(func(payload string) error { return b.setLED(l, payload) }, "led", l.name(), "set")
+	}
+
+	b.publishAll()
+}
+
+func (b *Bridge) subscribe(handle func(payload string) error, levels ...string) {
+	topic := b.topic(levels...)
+	err := b.c.Subscribe(topic, b.cfg.QoS, func(m Message) {
+		if err := handle(strings.TrimSpace(string(m.Payload))); err != nil {
+			glog.Errorf("mqtt: %v: %v", m.Topic, err)
+		}
+	})
+	if err != nil {
+		glog.Errorf("mqtt: subscribing to %v: %v", topic, err)
+	}
+}
+
+// publishAll publishes the last known state of every device.
+func (b *Bridge) publishAll() {
+	b.mu.Lock()
+	for _, in := range b.inputs {
+		in.last = -1
+	}
+	inputs := b.inputs
+	b.mu.Unlock()
+	for _, in := range inputs {
+		b.updateInput(in, true)
+	}
+
+	var states []state
+	b.mu.Lock()
+	for _, o := range b.outputs {
+		if val, err := o.pin.Read(); err == nil {
+			states = append(states, state{strconv.Itoa(val), "digital", o.name()})
+		}
+	}
+	for _, p := range b.pwms {
+		states = append(states, state{strconv.Itoa(p.value), "pwm", p.name()})
+	}
+	for _, l := range b.leds {
+		states = append(states, state{onOff(l.on), "led", l.name()})
+	}
+	b.mu.Unlock()
+
+	for _, st := range states {
+		b.publishState(st.payload, st.kind, st.name)
+	}
+}
+
+// state is a state message, collected under b.mu and published after.
+type state struct {
+	payload, kind, name string
+}
+
+// updateInput reads an input and publishes its state when it changed.
+func (b *Bridge) updateInput(in *input, force bool) {
+	b.mu.Lock()
+	val, err := in.pin.Read()
+	changed := err == nil && (val != in.last || force)
+	if changed {
+		in.last = val
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		glog.Errorf("mqtt: reading %v: %v", in.Key, err)
+		return
+	}
+	if changed {
+		b.publishState(strconv.Itoa(val), "digital", in.name())
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
+
+func parseDigital(payload string) (int, error) {
+	switch strings.ToUpper(payload) {
+	case "0", "OFF", "FALSE", "LOW":
+		return embd.Low, nil
+	case "1", "ON", "TRUE", "HIGH":
+		return embd.High, nil
+	}
+	return 0, fmt.Errorf("invalid digital value %q", payload)
+}
+
+func (b *Bridge) setOutput(o *output, payload string) error {
+	val, err := parseDigital(payload)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	err = o.pin.Write(val)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	b.publishState(strconv.Itoa(val), "digital", o.name())
+	return nil
+}
+
+func (b *Bridge) setPWM(p *pwm, payload string) error {
+	val, err := strconv.Atoi(payload)
+	if err != nil || val < 0 || val > 255 {
+		return fmt.Errorf("invalid pwm value %q", payload)
+	}
+
+	b.mu.Lock()
+	err = p.pin.SetAnalog(byte(val))
+	if err == nil {
+		p.value = val
+	}
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	b.publishState(strconv.Itoa(val), "pwm", p.name())
+	return nil
+}
+
+func (b *Bridge) setLED(l *led, payload string) error {
+	b.mu.Lock()
+	var err error
+	switch strings.ToUpper(payload) {
+	case "ON", "1":
+		err = l.led.On()
+		l.on = true
+	case "OFF", "0":
+		err = l.led.Off()
+		l.on = false
+	case "TOGGLE":
+		err = l.led.Toggle()
+		l.on = !l.on
+	default:
+		err = fmt.Errorf("invalid led state %q", payload)
+	}
+	on := l.on
+	b.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	b.publishState(onOff(on), "led", l.name())
+	return nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// sample polls the inputs which are not watched and samples the analog
+// inputs and the sensors.
+func (b *Bridge) sample() {
+	b.mu.Lock()
+	var polled []*input
+	for _, in := range b.inputs {
+		if !in.watched {
+			polled = append(polled, in)
+		}
+	}
+	b.mu.Unlock()
+	for _, in := range polled {
+		b.updateInput(in, false)
+	}
+
+	var states []state
+	b.mu.Lock()
+	for _, a := range b.analogs {
+		val, err := a.pin.Read()
+		if err != nil {
+			glog.Errorf("mqtt: reading %v: %v", a.Key, err)
+			continue
+		}
+		states = append(states, state{strconv.Itoa(val), "analog", a.name()})
+	}
+	b.mu.Unlock()
+	for _, st := range states {
+		b.publishState(st.payload, st.kind, st.name)
+	}
+
+	for _, s := range b.cfg.Sensors {
+		vals, err := s.Sample()
+		if err == nil && len(vals) != len(s.Readings) {
+			err = fmt.Errorf("got %v values for %v readings", len(vals), len(s.Readings))
+		}
+		if err != nil {
+			glog.Errorf("mqtt: reading %v: %v", s.Name, err)
+			continue
+		}
+		for i, r := range s.Readings {
+			b.publishState(formatFloat(vals[i]), "sensor", s.Name, r.Name)
+		}
+	}
+}
+
+func (b *Bridge) loop() {
+	defer close(b.done)
+
+	t := time.NewTicker(b.cfg.Interval)
+	defer t.Stop()
+
+	b.sample()
+	for {
+		select {
+		case <-t.C:
+			b.sample()
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+// Close stops the bridge, announces it as offline and disconnects from the
+// broker. The devices are left open.
+func (b *Bridge) Close() error {
+	if b.quit == nil {
+		return errors.New("mqtt: bridge not started")
+	}
+	close(b.quit)
+	<-b.done
+	b.quit = nil
+
+	// The watch handlers take b.mu under the lock of the interrupt
+	// listener, which StopWatching needs.
+	b.mu.Lock()
+	var watched []*input
+	for _, in := range b.inputs {
+		if in.watched {
+			watched = append(watched, in)
+			in.watched = false
+		}
+	}
+	b.mu.Unlock()
+
+	var err error
+	for _, in := range watched {
+		if e := in.pin.StopWatching(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	b.publish(b.topic("status"), "offline", true)
+	b.c.Disconnect()
+
+	return err
+}
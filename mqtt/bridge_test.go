@@ -0,0 +1,402 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakehost"
+)
+
+const testHost embd.Host = "mqtt test"
+
+var testPins = embd.PinMap{
+	&embd.PinDesc{ID: "P1_11", Aliases: []string{"17"}, Caps: embd.CapDigital, DigitalLogical: 17},
+	&embd.PinDesc{ID: "P1_12", Aliases: []string{"18"}, Caps: embd.CapDigital | embd.CapPWM, DigitalLogical: 18},
+	&embd.PinDesc{ID: "P1_13", Aliases: []string{"27"}, Caps: embd.CapDigital, DigitalLogical: 27},
+	&embd.PinDesc{ID: "P1_15", Aliases: []string{"22"}, Caps: embd.CapDigital, DigitalLogical: 22},
+	&embd.PinDesc{ID: "AIN0", Aliases: []string{"AIN0"}, Caps: embd.CapAnalog},
+}
+
+// host is the hardware of the test host. Pin 22 has no edge detection.
+var host = fakehost.New(testPins)
+
+func init() {
+	host.NoEdge = map[int]bool{22: true}
+	host.Register(testHost)
+	embd.SetHost(testHost, 0)
+}
+
+func pin(n int) *fakehost.DigitalPin {
+	pd, _ := testPins.Lookup(n, embd.CapDigital)
+	return host.Pin(pd.ID)
+}
+
+// fakeClient is an in-process stand-in for a broker connection.
+type fakeClient struct {
+	mu           sync.Mutex
+	will         *Message
+	connected    bool
+	published    []Message
+	subs         map[string]func(Message)
+	disconnected bool
+
+	// stall, when set, blocks the publications to its topic until closed.
+	stall      chan struct{}
+	stallTopic string
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{subs: make(map[string]func(Message))}
+}
+
+func (c *fakeClient) Connect(will *Message, onConnect func()) error {
+	c.mu.Lock()
+	c.will = will
+	c.connected = true
+	c.mu.Unlock()
+	onConnect()
+	return nil
+}
+
+func (c *fakeClient) Publish(m Message) error {
+	c.mu.Lock()
+	stall := c.stall
+	if m.Topic != c.stallTopic {
+		stall = nil
+	}
+	c.mu.Unlock()
+	if stall != nil {
+		<-stall
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, m)
+	return nil
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, handler func(Message)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subs[topic] = handler
+	return nil
+}
+
+func (c *fakeClient) Disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disconnected = true
+}
+
+// deliver simulates a message from the broker.
+func (c *fakeClient) deliver(t *testing.T, topic, payload string) {
+	t.Helper()
+	c.mu.Lock()
+	handler := c.subs[topic]
+	c.mu.Unlock()
+	if handler == nil {
+		t.Fatalf("no subscription to %v", topic)
+	}
+	handler(Message{Topic: topic, Payload: []byte(payload)})
+}
+
+// last returns the last message published to topic.
+func (c *fakeClient) last(topic string) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.published) - 1; i >= 0; i-- {
+		if c.published[i].Topic == topic {
+			return c.published[i], true
+		}
+	}
+	return Message{}, false
+}
+
+func (c *fakeClient) count(topic string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, m := range c.published {
+		if m.Topic == topic {
+			n++
+		}
+	}
+	return n
+}
+
+// expect waits for payload to be the last message published to topic.
+func (c *fakeClient) expect(t *testing.T, topic, payload string, retained bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m, ok := c.last(topic)
+		if ok && string(m.Payload) == payload && m.Retained == retained {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v: got %q (retained %v, published %v), want %q (retained %v)", topic, m.Payload, m.Retained, ok, payload, retained)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	host.Reset()
+	c := newFakeClient()
+	b := New(c, Config{
+		Prefix:   "home/pi/",
+		Retain:   true,
+		Interval: time.Hour,
+		Inputs:   []Item{{Key: "17", Name: "door"}},
+		Outputs:  []Item{{Key: "27", Name: "relay"}},
+		Analogs:  []Item{{Key: "AIN0"}},
+		PWMs:     []Item{{Key: "P1_12", Name: "fan"}},
+		LEDs:     []Item{{Key: "led0"}},
+		Sensors: []Sensor{
+			{
+				Name: "bmp180",
+				Readings: []Reading{
+					{Name: "temperature", Unit: "°C"},
+					{Name: "pressure", Unit: "Pa"},
+				},
+				Sample: func() ([]float64, error) { return []float64{21.5, 101325}, nil },
+			},
+			{
+				Name:     "sht3x",
+				Readings: []Reading{{Name: "temperature", Unit: "°C"}},
+				Sample:   func() ([]float64, error) { return nil, errors.New("bus error") },
+			},
+		},
+	})
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (&Message{Topic: "home/pi/status", Payload: []byte("offline"), Retained: true}); !reflect.DeepEqual(c.will, want) {
+		t.Errorf("will: got %+v, want %+v", c.will, want)
+	}
+	c.expect(t, "home/pi/status", "online", true)
+	c.expect(t, "home/pi/digital/door", "0", true)
+	c.expect(t, "home/pi/digital/relay", "0", true)
+	c.expect(t, "home/pi/pwm/fan", "0", true)
+	c.expect(t, "home/pi/led/led0", "OFF", true)
+	c.expect(t, "home/pi/analog/AIN0", "512", true)
+	c.expect(t, "home/pi/sensor/bmp180/temperature", "21.5", true)
+	c.expect(t, "home/pi/sensor/bmp180/pressure", "101325", true)
+	if _, ok := c.last("home/pi/sensor/sht3x/temperature"); ok {
+		t.Errorf("published a failed reading")
+	}
+	if dir := pin(17).Dir(); dir != embd.In {
+		t.Errorf("direction of the input: got %v, want in", dir)
+	}
+	if dir := pin(27).Dir(); dir != embd.Out {
+		t.Errorf("direction of the output: got %v, want out", dir)
+	}
+
+	// Edges are published, non changes are not.
+	pin(17).Set(embd.High)
+	c.expect(t, "home/pi/digital/door", "1", true)
+	pin(17).Set(embd.High)
+	if n := c.count("home/pi/digital/door"); n != 2 {
+		t.Errorf("door published %v times, want 2", n)
+	}
+
+	c.deliver(t, "home/pi/digital/relay/set", "ON")
+	c.expect(t, "home/pi/digital/relay", "1", true)
+	if v, _ := pin(27).Read(); v != embd.High {
+		t.Errorf("relay: got %v, want high", v)
+	}
+	c.deliver(t, "home/pi/digital/relay/set", "maybe")
+	c.expect(t, "home/pi/digital/relay", "1", true)
+
+	c.deliver(t, "home/pi/pwm/fan/set", "128")
+	c.expect(t, "home/pi/pwm/fan", "128", true)
+	if host.PWM("P1_12").Analog() != 128 {
+		t.Errorf("fan: got %v, want 128", host.PWM("P1_12").Analog())
+	}
+	c.deliver(t, "home/pi/pwm/fan/set", "300")
+	c.expect(t, "home/pi/pwm/fan", "128", true)
+
+	c.deliver(t, "home/pi/led/led0/set", "TOGGLE")
+	c.expect(t, "home/pi/led/led0", "ON", true)
+	if !host.LED().Lit() {
+		t.Errorf("led0 is off, want on")
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(t, "home/pi/status", "offline", true)
+	if !c.disconnected {
+		t.Errorf("not disconnected")
+	}
+	if pin(17).Watched() {
+		t.Errorf("door still watched")
+	}
+}
+
+func TestCloseDuringEdges(t *testing.T) {
+	host.Reset()
+	c := newFakeClient()
+	b := New(c, Config{Interval: time.Hour, Inputs: []Item{{Key: "17"}}})
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for val := embd.High; ; val ^= 1 {
+			select {
+			case <-stop:
+				return
+			default:
+				pin(17).Set(val)
+			}
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan error)
+	go func() { closed <- b.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close deadlocked with the watch handler")
+	}
+	close(stop)
+	<-done
+}
+
+func TestSlowBroker(t *testing.T) {
+	host.Reset()
+	c := newFakeClient()
+	b := New(c, Config{NodeID: "node", Interval: time.Hour, Inputs: []Item{{Key: "17"}}, LEDs: []Item{{Key: "led0"}}})
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	stall := make(chan struct{})
+	c.mu.Lock()
+	c.stall, c.stallTopic = stall, "embd/node/digital/17"
+	c.mu.Unlock()
+	go pin(17).Set(embd.High)
+	time.Sleep(10 * time.Millisecond)
+
+	// The stalled publication of the input does not hold up the commands.
+	c.deliver(t, "embd/node/led/led0/set", "ON")
+	c.expect(t, "embd/node/led/led0", "ON", false)
+	close(stall)
+	c.expect(t, "embd/node/digital/17", "1", false)
+}
+
+func TestPolledInput(t *testing.T) {
+	host.Reset()
+	c := newFakeClient()
+	b := New(c, Config{
+		NodeID:   "node",
+		Interval: time.Millisecond,
+		Inputs:   []Item{{Key: "22"}},
+	})
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	c.expect(t, "embd/node/digital/22", "0", false)
+	pin(22).Write(embd.High)
+	c.expect(t, "embd/node/digital/22", "1", false)
+}
+
+func TestDiscovery(t *testing.T) {
+	host.Reset()
+	c := newFakeClient()
+	b := New(c, Config{
+		NodeID:    "bench.pi",
+		Discovery: true,
+		Interval:  time.Hour,
+		Outputs:   []Item{{Key: "27", Name: "relay"}},
+		PWMs:      []Item{{Key: "P1_12", Name: "fan"}},
+		Sensors: []Sensor{{
+			Name:     "bmp180",
+			Readings: []Reading{{Name: "temperature", Unit: "°C", DeviceClass: "temperature"}},
+			Sample:   func() ([]float64, error) { return []float64{21.5}, nil },
+		}},
+	})
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	device := map[string]interface{}{"identifiers": []interface{}{"bench_pi"}, "name": "bench_pi", "manufacturer": "embd"}
+	var tests = []struct {
+		topic string
+		want  map[string]interface{}
+	}{
+		{
+			"homeassistant/switch/bench_pi/digital_relay/config",
+			map[string]interface{}{
+				"name":               "relay",
+				"unique_id":          "bench_pi_digital_relay",
+				"state_topic":        "embd/bench_pi/digital/relay",
+				"command_topic":      "embd/bench_pi/digital/relay/set",
+				"availability_topic": "embd/bench_pi/status",
+				"payload_on":         "1",
+				"payload_off":        "0",
+				"device":             device,
+			},
+		},
+		{
+			"homeassistant/number/bench_pi/pwm_fan/config",
+			map[string]interface{}{
+				"name":               "fan",
+				"unique_id":          "bench_pi_pwm_fan",
+				"state_topic":        "embd/bench_pi/pwm/fan",
+				"command_topic":      "embd/bench_pi/pwm/fan/set",
+				"availability_topic": "embd/bench_pi/status",
+				"min":                0.0,
+				"max":                255.0,
+				"device":             device,
+			},
+		},
+		{
+			"homeassistant/sensor/bench_pi/sensor_bmp180_temperature/config",
+			map[string]interface{}{
+				"name":                "bmp180 temperature",
+				"unique_id":           "bench_pi_sensor_bmp180_temperature",
+				"state_topic":         "embd/bench_pi/sensor/bmp180/temperature",
+				"availability_topic":  "embd/bench_pi/status",
+				"unit_of_measurement": "°C",
+				"device_class":        "temperature",
+				"device":              device,
+			},
+		},
+	}
+	for _, test := range tests {
+		m, ok := c.last(test.topic)
+		if !ok {
+			t.Errorf("%v: not published", test.topic)
+			continue
+		}
+		if !m.Retained {
+			t.Errorf("%v: not retained", test.topic)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(m.Payload, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v:\ngot  %v\nwant %v", test.topic, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// MQTT client abstraction.
+
+package mqtt
+
+import (
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Message is a message published to or received from the broker.
+type Message struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retained bool
+}
+
+// Client is the part of an MQTT client the bridge relies on. NewPahoClient
+// returns one talking to a real broker, tests can provide their own.
+type Client interface {
+	// Connect connects to the broker, registering will as the last will
+	// when it is not nil. onConnect is called after every successful
+	// (re)connection, subscriptions are expected to be made from there.
+	Connect(will *Message, onConnect func()) error
+
+	// Publish publishes a message and waits for it to be sent.
+	Publish(m Message) error
+
+	// Subscribe calls handler for every message received on topic.
+	Subscribe(topic string, qos byte, handler func(Message)) error
+
+	// Disconnect disconnects from the broker.
+	Disconnect()
+}
+
+// Options configure the connection to the broker.
+type Options struct {
+	// Broker is the URL of the broker, e.g. "tcp://localhost:1883".
+	Broker string
+
+	ClientID string
+	Username string
+	Password string
+}
+
+// disconnectQuiesce is how long Disconnect waits for the pending work to
+// complete.
+const disconnectQuiesce = 250 // ms
+
+type pahoClient struct {
+	opts Options
+	c    paho.Client
+}
+
+// NewPahoClient returns a Client backed by the Eclipse Paho library. It
+// reconnects automatically when the connection to the broker is lost.
+func NewPahoClient(opts Options) Client {
+	return &pahoClient{opts: opts}
+}
+
+func (c *pahoClient) Connect(will *Message, onConnect func()) error {
+	po := paho.NewClientOptions().
+		AddBroker(c.opts.Broker).
+		SetClientID(c.opts.ClientID).
+		SetUsername(c.opts.Username).
+		SetPassword(c.opts.Password).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute).
+		// Command handlers publish the new state, which would deadlock
+		// if messages had to be handled in order.
+		SetOrderMatters(false)
+	if will != nil {
+		po.SetBinaryWill(will.Topic, will.Payload, will.QoS, will.Retained)
+	}
+	if onConnect != nil {
+		po.SetOnConnectHandler(func(paho.Client) { onConnect() })
+	}
+
+	c.c = paho.NewClient(po)
+	t := c.c.Connect()
+	t.Wait()
+	return t.Error()
+}
+
+func (c *pahoClient) Publish(m Message) error {
+	t := c.c.Publish(m.Topic, m.QoS, m.Retained, m.Payload)
+	t.Wait()
+	return t.Error()
+}
+
+func (c *pahoClient) Subscribe(topic string, qos byte, handler func(Message)) error {
+	t := c.c.Subscribe(topic, qos, func(_ paho.Client, m paho.Message) {
+		handler(Message{Topic: m.Topic(), Payload: m.Payload(), QoS: m.Qos(), Retained: m.Retained()})
+	})
+	t.Wait()
+	return t.Error()
+}
+
+func (c *pahoClient) Disconnect() {
+	if c.c != nil {
+		c.c.Disconnect(disconnectQuiesce)
+	}
+}
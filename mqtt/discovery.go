@@ -0,0 +1,108 @@
+// Home Assistant MQTT discovery.
+// Refer to https://www.home-assistant.io/docs/mqtt/discovery/ for details.
+
+package mqtt
+
+import (
+	"encoding/json"
+
+	"github.com/golang/glog"
+)
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// haConfig is the configuration payload of an entity.
+type haConfig struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic"`
+	CommandTopic      string   `json:"command_topic,omitempty"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	PayloadOn         string   `json:"payload_on,omitempty"`
+	PayloadOff        string   `json:"payload_off,omitempty"`
+	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	Min               *int     `json:"min,omitempty"`
+	Max               *int     `json:"max,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+// entity returns the discovery topic and the base configuration of an
+// entity whose state is published to the topic made of levels.
+func (b *Bridge) entity(component string, levels ...string) (string, *haConfig) {
+	object := sanitize(levels[0])
+	for _, l := range levels[1:] {
+		object += "_" + sanitize(l)
+	}
+	topic := b.cfg.DiscoveryPrefix + "/" + component + "/" + b.cfg.NodeID + "/" + object + "/config"
+
+	name := levels[len(levels)-1]
+	if len(levels) > 2 {
+		name = levels[1] + " " + name
+	}
+
+	return topic, &haConfig{
+		Name:              name,
+		UniqueID:          b.cfg.NodeID + "_" + object,
+		StateTopic:        b.topic(levels...),
+		AvailabilityTopic: b.topic("status"),
+		Device: haDevice{
+			Identifiers:  []string{b.cfg.NodeID},
+			Name:         b.cfg.NodeID,
+			Manufacturer: "embd",
+		},
+	}
+}
+
+func (b *Bridge) publishConfig(topic string, cfg *haConfig) {
+	payload, err := json.Marshal(cfg)
+	if err != nil {
+		glog.Errorf("mqtt: %v", err)
+		return
+	}
+	b.publish(topic, string(payload), true)
+}
+
+func (b *Bridge) publishDiscovery() {
+	minPWM, maxPWM := 0, 255
+
+	for _, it := range b.cfg.Inputs {
+		topic, cfg := b.entity("binary_sensor", "digital", it.name())
+		cfg.PayloadOn, cfg.PayloadOff = "1", "0"
+		b.publishConfig(topic, cfg)
+	}
+	for _, it := range b.cfg.Outputs {
+		topic, cfg := b.entity("switch", "digital", it.name())
+		cfg.CommandTopic = cfg.StateTopic + "/set"
+		cfg.PayloadOn, cfg.PayloadOff = "1", "0"
+		b.publishConfig(topic, cfg)
+	}
+	for _, it := range b.cfg.Analogs {
+		topic, cfg := b.entity("sensor", "analog", it.name())
+		b.publishConfig(topic, cfg)
+	}
+	for _, it := range b.cfg.PWMs {
+		topic, cfg := b.entity("number", "pwm", it.name())
+		cfg.CommandTopic = cfg.StateTopic + "/set"
+		cfg.Min, cfg.Max = &minPWM, &maxPWM
+		b.publishConfig(topic, cfg)
+	}
+	for _, it := range b.cfg.LEDs {
+		topic, cfg := b.entity("light", "led", it.name())
+		cfg.CommandTopic = cfg.StateTopic + "/set"
+		cfg.PayloadOn, cfg.PayloadOff = "ON", "OFF"
+		b.publishConfig(topic, cfg)
+	}
+	for _, s := range b.cfg.Sensors {
+		for _, r := range s.Readings {
+			topic, cfg := b.entity("sensor", "sensor", s.Name, r.Name)
+			cfg.UnitOfMeasurement = r.Unit
+			cfg.DeviceClass = r.DeviceClass
+			b.publishConfig(topic, cfg)
+		}
+	}
+}
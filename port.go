@@ -0,0 +1,164 @@
+// Parallel digital port support.
+
+package embd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxDigitalPortWidth is the maximum number of pins a DigitalPort can group.
+const MaxDigitalPortWidth = 64
+
+// DigitalPort implements access to an ordered group of digital IO capable
+// GPIO pins which are read and written together as a single word. Bit i of
+// a word corresponds to the i-th pin the port was created with.
+type DigitalPort interface {
+	// Width returns the number of pins in the port.
+	Width() int
+
+	// SetDirection sets the direction of all the pins in the port.
+	SetDirection(dir Direction) error
+
+	// WriteWord writes the low Width() bits of val to the port.
+	WriteWord(val uint64) error
+
+	// WriteMasked updates only the pins whose bit is set in mask, leaving
+	// the others untouched. Writing fails once the port is set as an input.
+	WriteMasked(val, mask uint64) error
+
+	// ReadWord reads the current state of the port.
+	ReadWord() (uint64, error)
+
+	// Close releases the resources associated with the port.
+	Close() error
+}
+
+func portID(pds []*PinDesc) string {
+	ids := make([]string, len(pds))
+	for i, pd := range pds {
+		ids[i] = pd.ID
+	}
+	return "port(" + strings.Join(ids, ",") + ")"
+}
+
+func portMask(width int) uint64 {
+	if width >= MaxDigitalPortWidth {
+		return ^uint64(0)
+	}
+	return uint64(1)<<uint(width) - 1
+}
+
+// digitalPort is the fallback DigitalPort used when the host has no way of
+// touching several lines at once. It drives the pins one at a time.
+type digitalPort struct {
+	id   string
+	pins []DigitalPin
+
+	drv GPIODriver
+}
+
+func newDigitalPort(id string, pins []DigitalPin, drv GPIODriver) DigitalPort {
+	return &digitalPort{id: id, pins: pins, drv: drv}
+}
+
+func (p *digitalPort) Width() int {
+	return len(p.pins)
+}
+
+func (p *digitalPort) SetDirection(dir Direction) error {
+	for _, pin := range p.pins {
+		if err := pin.SetDirection(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *digitalPort) WriteWord(val uint64) error {
+	return p.WriteMasked(val, portMask(len(p.pins)))
+}
+
+func (p *digitalPort) WriteMasked(val, mask uint64) error {
+	for i, pin := range p.pins {
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		v := Low
+		if val&(1<<uint(i)) != 0 {
+			v = High
+		}
+		if err := pin.Write(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *digitalPort) ReadWord() (uint64, error) {
+	var word uint64
+	for i, pin := range p.pins {
+		v, err := pin.Read()
+		if err != nil {
+			return 0, err
+		}
+		if v == High {
+			word |= 1 << uint(i)
+		}
+	}
+	return word, nil
+}
+
+func (p *digitalPort) Close() error {
+	if err := p.drv.Unregister(p.id); err != nil {
+		return err
+	}
+	for _, pin := range p.pins {
+		if err := pin.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewDigitalPort returns a DigitalPort interface which allows control over
+// the provided pins as a group. On hosts which support it, all the lines are
+// updated together in a single operation.
+func NewDigitalPort(keys ...interface{}) (DigitalPort, error) {
+	if err := InitGPIO(); err != nil {
+		return nil, err
+	}
+
+	return gpioDriverInstance.DigitalPort(keys...)
+}
+
+// WritePort writes val to the port made up of the provided pins.
+func WritePort(val uint64, keys ...interface{}) error {
+	port, err := NewDigitalPort(keys...)
+	if err != nil {
+		return err
+	}
+
+	return port.WriteWord(val)
+}
+
+// ReadPort reads the state of the port made up of the provided pins.
+func ReadPort(keys ...interface{}) (uint64, error) {
+	port, err := NewDigitalPort(keys...)
+	if err != nil {
+		return 0, err
+	}
+
+	return port.ReadWord()
+}
+
+func validatePortKeys(keys []interface{}) error {
+	if len(keys) == 0 {
+		return errors.New("gpio: a port needs at least one pin")
+	}
+	if len(keys) > MaxDigitalPortWidth {
+		return fmt.Errorf("gpio: a port can have at most %v pins, got %v", MaxDigitalPortWidth, len(keys))
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package embd
+
+import "testing"
+
+type fakePortPin struct {
+	fakeDigitalPin
+
+	val    int
+	writes int
+}
+
+func (p *fakePortPin) Read() (int, error) {
+	return p.val, nil
+}
+
+func (p *fakePortPin) Write(val int) error {
+	p.val = val
+	p.writes++
+	return nil
+}
+
+func newFakePortPin(pd *PinDesc, drv GPIODriver) DigitalPin {
+	return &fakePortPin{fakeDigitalPin: fakeDigitalPin{id: pd.ID, n: pd.DigitalLogical, drv: drv}}
+}
+
+var portPinMap = PinMap{
+	&PinDesc{ID: "P1_1", Aliases: []string{"1"}, Caps: CapDigital, DigitalLogical: 1},
+	&PinDesc{ID: "P1_2", Aliases: []string{"2"}, Caps: CapDigital, DigitalLogical: 2},
+	&PinDesc{ID: "P1_3", Aliases: []string{"3"}, Caps: CapDigital, DigitalLogical: 3},
+	&PinDesc{ID: "P1_4", Aliases: []string{"4"}, Caps: CapDigital, DigitalLogical: 4},
+}
+
+func TestDigitalPortWord(t *testing.T) {
+	driver := NewGPIODriver(portPinMap, newFakePortPin, nil, nil)
+	port, err := driver.DigitalPort(1, 2, 3, 4)
+	if err != nil {
+		t.Fatalf("Creating port: got %v", err)
+	}
+	if port.Width() != 4 {
+		t.Fatalf("Port width: got %v, want 4", port.Width())
+	}
+
+	var tests = []struct {
+		val, mask uint64
+		word      uint64
+	}{
+		{0xA, 0xF, 0xA},
+		{0x5, 0x3, 0x9},
+		{0xF, 0x4, 0xD},
+		{0xFF, 0xFF, 0xF},
+	}
+	for _, test := range tests {
+		if err := port.WriteMasked(test.val, test.mask); err != nil {
+			t.Errorf("Writing %#x with mask %#x: got %v", test.val, test.mask, err)
+			continue
+		}
+		word, err := port.ReadWord()
+		if err != nil {
+			t.Errorf("Reading after writing %#x with mask %#x: got %v", test.val, test.mask, err)
+			continue
+		}
+		if word != test.word {
+			t.Errorf("Writing %#x with mask %#x: read %#x, want %#x", test.val, test.mask, word, test.word)
+		}
+	}
+}
+
+func TestDigitalPortMaskedWriteSkipsPins(t *testing.T) {
+	driver := NewGPIODriver(portPinMap, newFakePortPin, nil, nil)
+	port, err := driver.DigitalPort(1, 2)
+	if err != nil {
+		t.Fatalf("Creating port: got %v", err)
+	}
+	if err := port.WriteMasked(0x3, 0x2); err != nil {
+		t.Fatalf("Writing port: got %v", err)
+	}
+	pin, _ := driver.DigitalPin(1)
+	if writes := pin.(*fakePortPin).writes; writes != 0 {
+		t.Fatalf("Masked out pin was written %v times", writes)
+	}
+}
+
+func TestDigitalPortCaching(t *testing.T) {
+	driver := NewGPIODriver(portPinMap, newFakePortPin, nil, nil)
+	port, err := driver.DigitalPort(1, 2)
+	if err != nil {
+		t.Fatalf("Creating port: got %v", err)
+	}
+	port2, err := driver.DigitalPort("P1_1", "P1_2")
+	if err != nil {
+		t.Fatalf("Creating port: got %v", err)
+	}
+	if port != port2 {
+		t.Fatal("Looking up the same port twice returned different instances")
+	}
+	if err := port.Close(); err != nil {
+		t.Fatalf("Closing port: got %v", err)
+	}
+	port3, err := driver.DigitalPort(1, 2)
+	if err != nil {
+		t.Fatalf("Creating port: got %v", err)
+	}
+	if port == port3 {
+		t.Fatal("Looking up a closed port, but got the same old instance")
+	}
+}
+
+func TestDigitalPortBulkFallback(t *testing.T) {
+	var requested []*PinDesc
+	failing := func(id string, pds []*PinDesc, drv GPIODriver) (DigitalPort, error) {
+		requested = pds
+		return nil, ErrFeatureNotSupported
+	}
+	driver := NewGPIODriverWithPorts(portPinMap, newFakePortPin, nil, nil, failing)
+	port, err := driver.DigitalPort(3, 4)
+	if err != nil {
+		t.Fatalf("Creating port: got %v", err)
+	}
+	if len(requested) != 2 || requested[0].ID != "P1_3" || requested[1].ID != "P1_4" {
+		t.Fatalf("Port factory got %v, want [P1_3 P1_4]", requested)
+	}
+	if _, ok := port.(*digitalPort); !ok {
+		t.Fatalf("Expected the single pin fallback, got %T", port)
+	}
+}
+
+func TestDigitalPortInvalid(t *testing.T) {
+	driver := NewGPIODriver(portPinMap, newFakePortPin, nil, nil)
+	if _, err := driver.DigitalPort(); err == nil {
+		t.Error("Creating an empty port: did not get error")
+	}
+	if _, err := driver.DigitalPort(1, 9); err == nil {
+		t.Error("Creating a port with an unknown pin: did not get error")
+	}
+}
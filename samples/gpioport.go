@@ -0,0 +1,44 @@
+// +build ignore
+
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/kidoman/embd"
+
+	_ "github.com/kidoman/embd/host/all"
+)
+
+func main() {
+	flag.Parse()
+
+	if err := embd.InitGPIO(); err != nil {
+		panic(err)
+	}
+	defer embd.CloseGPIO()
+
+	// Bit 0 is GPIO 17, bit 7 is GPIO 26.
+	port, err := embd.NewDigitalPort(17, 18, 27, 22, 23, 24, 25, 26)
+	if err != nil {
+		panic(err)
+	}
+	defer port.Close()
+
+	if err := port.SetDirection(embd.Out); err != nil {
+		panic(err)
+	}
+
+	for i := uint64(0); i < 256; i++ {
+		if err := port.WriteWord(i); err != nil {
+			panic(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Only touch the upper nibble.
+	if err := port.WriteMasked(0xA0, 0xF0); err != nil {
+		panic(err)
+	}
+}
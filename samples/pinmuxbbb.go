@@ -0,0 +1,42 @@
+// +build ignore
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/kidoman/embd/host/bbb"
+)
+
+func main() {
+	pin := flag.String("pin", "P9_14", "header pin")
+	mode := flag.String("mode", "", "mode to switch the pin to (gpio, pwm, uart, spi, i2c, ...)")
+	flag.Parse()
+
+	slots, err := bbb.Slots()
+	if err != nil {
+		panic(err)
+	}
+	for _, s := range slots {
+		fmt.Printf("slot %v: %v %v\n", s.N, s.Flags, s.PartNumber)
+	}
+
+	modes, err := bbb.PinModes(*pin)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%v supports %v\n", *pin, modes)
+
+	if *mode != "" {
+		if err := bbb.SetPinMode(*pin, bbb.PinMode(*mode)); err != nil {
+			panic(err)
+		}
+	}
+
+	current, err := bbb.CurrentPinMode(*pin)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%v is in %v mode\n", *pin, current)
+}
@@ -0,0 +1,18 @@
+// Package all conveniently registers all the inbuilt sensor drivers.
+package all
+
+import (
+	_ "github.com/kidoman/embd/sensor/bh1750fvi"
+	_ "github.com/kidoman/embd/sensor/bme280"
+	_ "github.com/kidoman/embd/sensor/bmp085"
+	_ "github.com/kidoman/embd/sensor/bmp180"
+	_ "github.com/kidoman/embd/sensor/dht"
+	_ "github.com/kidoman/embd/sensor/htu21d"
+	_ "github.com/kidoman/embd/sensor/l3gd20"
+	_ "github.com/kidoman/embd/sensor/lsm303"
+	_ "github.com/kidoman/embd/sensor/mpu6050"
+	_ "github.com/kidoman/embd/sensor/sht3x"
+	_ "github.com/kidoman/embd/sensor/tmp006"
+	_ "github.com/kidoman/embd/sensor/us020"
+	_ "github.com/kidoman/embd/sensor/watersensor"
+)
@@ -0,0 +1,61 @@
+package all
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kidoman/embd/sensor"
+	"github.com/kidoman/embd/sensor/bh1750fvi"
+	"github.com/kidoman/embd/sensor/bme280"
+	"github.com/kidoman/embd/sensor/bmp085"
+	"github.com/kidoman/embd/sensor/bmp180"
+	"github.com/kidoman/embd/sensor/dht"
+	"github.com/kidoman/embd/sensor/htu21d"
+	"github.com/kidoman/embd/sensor/l3gd20"
+	"github.com/kidoman/embd/sensor/lsm303"
+	"github.com/kidoman/embd/sensor/mpu6050"
+	"github.com/kidoman/embd/sensor/sht3x"
+	"github.com/kidoman/embd/sensor/tmp006"
+	"github.com/kidoman/embd/sensor/us020"
+	"github.com/kidoman/embd/sensor/watersensor"
+)
+
+var (
+	_ sensor.Thermometer   = (*bmp085.BMP085)(nil)
+	_ sensor.Barometer     = (*bmp085.BMP085)(nil)
+	_ sensor.Measurer      = (*bmp085.BMP085)(nil)
+	_ sensor.Thermometer   = (*bmp180.BMP180)(nil)
+	_ sensor.Barometer     = (*bmp180.BMP180)(nil)
+	_ sensor.Measurer      = (*bmp180.BMP180)(nil)
+	_ sensor.Luxmeter      = (*bh1750fvi.BH1750FVI)(nil)
+	_ sensor.Thermometer   = (*bme280.BME280)(nil)
+	_ sensor.Barometer     = (*bme280.BME280)(nil)
+	_ sensor.Hygrometer    = (*bme280.BME280)(nil)
+	_ sensor.Measurer      = (*bme280.BME280)(nil)
+	_ sensor.Thermometer   = (*dht.DHT)(nil)
+	_ sensor.Hygrometer    = (*dht.DHT)(nil)
+	_ sensor.Measurer      = (*dht.DHT)(nil)
+	_ sensor.Thermometer   = (*htu21d.HTU21D)(nil)
+	_ sensor.Hygrometer    = (*htu21d.HTU21D)(nil)
+	_ sensor.Measurer      = (*htu21d.HTU21D)(nil)
+	_ sensor.Gyroscope     = (*l3gd20.L3GD20)(nil)
+	_ sensor.Magnetometer  = (*lsm303.LSM303)(nil)
+	_ sensor.Accelerometer = (*mpu6050.MPU6050)(nil)
+	_ sensor.Gyroscope     = (*mpu6050.MPU6050)(nil)
+	_ sensor.Thermometer   = (*mpu6050.MPU6050)(nil)
+	_ sensor.Measurer      = (*mpu6050.MPU6050)(nil)
+	_ sensor.Magnetometer  = (*mpu6050.MPU9250)(nil)
+	_ sensor.Thermometer   = (*sht3x.SHT3x)(nil)
+	_ sensor.Hygrometer    = (*sht3x.SHT3x)(nil)
+	_ sensor.Measurer      = (*sht3x.SHT3x)(nil)
+	_ sensor.Thermometer   = (*tmp006.TMP006)(nil)
+	_ sensor.RangeFinder   = (*us020.US020)(nil)
+	_ sensor.Device        = (*watersensor.WaterSensor)(nil)
+)
+
+func TestDrivers(t *testing.T) {
+	want := []string{"bh1750fvi", "bme280", "bmp085", "bmp180", "bmp280", "dht11", "dht22", "htu21d", "l3gd20", "lsm303", "mpu6050", "mpu9250", "sht3x", "si7021", "tmp006", "us020", "watersensor"}
+	if got := sensor.Drivers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
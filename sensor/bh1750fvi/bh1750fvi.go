@@ -2,10 +2,12 @@
 package bh1750fvi
 
 import (
-	"sync"
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
 )
 
 //accuracy = sensorValue/actualValue] (min = 0.96, typ = 1.2, max = 1.44
@@ -29,10 +31,7 @@ type BH1750FVI struct {
 	Bus  embd.I2CBus
 	Poll int
 
-	mu sync.RWMutex
-
-	lightingReadings chan float64
-	quit             chan bool
+	sampler sensor.Sampler
 
 	i2cAddr       byte
 	operationCode byte
@@ -76,47 +75,56 @@ func (d *BH1750FVI) measureLighting() (float64, error) {
 
 // Lighting returns the ambient lighting in lx.
 func (d *BH1750FVI) Lighting() (float64, error) {
-	select {
-	case lighting := <-d.lightingReadings:
-		return lighting, nil
-	default:
-		return d.measureLighting()
+	if r, ok := d.sampler.Latest(); ok {
+		if r.Err != nil {
+			return 0, r.Err
+		}
+		return r.Value.(float64), nil
 	}
+	return d.measureLighting()
+}
+
+// Illuminance returns the ambient lighting in lx.
+func (d *BH1750FVI) Illuminance() (float64, error) {
+	return d.Lighting()
+}
+
+func (d *BH1750FVI) sample() (interface{}, error) {
+	return d.measureLighting()
+}
+
+// Readings measures the lighting in lx every period until ctx is done.
+func (d *BH1750FVI) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	return sensor.Sample(ctx, period, d.sample)
 }
 
 // Run starts continuous sensor data acquisition loop.
 func (d *BH1750FVI) Run() {
-	go func() {
-		d.quit = make(chan bool)
-
-		timer := time.Tick(time.Duration(d.Poll) * time.Millisecond)
-
-		var lighting float64
-
-		for {
-			select {
-			case d.lightingReadings <- lighting:
-			case <-timer:
-				l, err := d.measureLighting()
-				if err == nil {
-					lighting = l
-				}
-				if err == nil && d.lightingReadings == nil {
-					d.lightingReadings = make(chan float64)
-				}
-			case <-d.quit:
-				d.lightingReadings = nil
-				return
-			}
-		}
-	}()
-	return
+	d.sampler.Start(time.Duration(d.Poll)*time.Millisecond, d.sample)
 }
 
-// Close.
-func (d *BH1750FVI) Close() {
-	if d.quit != nil {
-		d.quit <- true
-	}
-	return
+// Close stops the data acquisition loop.
+func (d *BH1750FVI) Close() error {
+	d.sampler.Stop()
+	return nil
+}
+
+// The "mode" option selects the resolution: High (the default) or High2.
+// The sensor answers at 0x5c instead of 0x23 when its ADDR pin is high.
+func init() {
+	sensor.Register("bh1750fvi", func(c sensor.Config) (sensor.Device, error) {
+		bus, addr, err := c.I2C(sensorI2cAddr, 0x5c)
+		if err != nil {
+			return nil, err
+		}
+		mode := c.Options["mode"]
+		switch mode {
+		case "", High, High2:
+		default:
+			return nil, fmt.Errorf("bh1750fvi: invalid mode %q", mode)
+		}
+		d := New(mode, bus)
+		d.i2cAddr = addr
+		return d, nil
+	})
 }
@@ -0,0 +1,672 @@
+// Package bme280 allows interfacing with the Bosch BME280 humidity, pressure
+// and temperature sensor, and with the BMP280 which lacks the humidity, over
+// I2C or SPI.
+package bme280
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+const (
+	// Address is the I2C address of the sensor with SDO to ground.
+	Address = 0x76
+	// AltAddress is the I2C address of the sensor with SDO to VDDIO.
+	AltAddress = 0x77
+
+	// ChipBMP280 is the chip id of the BMP280.
+	ChipBMP280 = 0x58
+	// ChipBME280 is the chip id of the BME280.
+	ChipBME280 = 0x60
+
+	regCalib00  = 0x88
+	regCalibH1  = 0xA1
+	regID       = 0xD0
+	regReset    = 0xE0
+	regCalib26  = 0xE1
+	regCtrlHum  = 0xF2
+	regStatus   = 0xF3
+	regCtrlMeas = 0xF4
+	regConfig   = 0xF5
+	regData     = 0xF7
+
+	resetCmd = 0xB6
+
+	statusMeasuring = 0x08
+
+	// The value of a skipped measurement.
+	skipped20 = 0x80000
+	skipped16 = 0x8000
+
+	p0 = 101325
+)
+
+// Mode is the power mode of the sensor.
+type Mode byte
+
+const (
+	// Sleep stops the measurements.
+	Sleep Mode = 0
+	// Forced makes a single measurement for every reading, then sleeps.
+	Forced Mode = 1
+	// Normal measures continuously, pausing for the standby time between
+	// measurements.
+	Normal Mode = 3
+)
+
+// Oversampling is the number of samples averaged in a measurement.
+type Oversampling byte
+
+const (
+	// Skip disables a measurement.
+	Skip Oversampling = iota
+	X1
+	X2
+	X4
+	X8
+	X16
+)
+
+func (o Oversampling) samples() int {
+	if o == Skip {
+		return 0
+	}
+	return 1 << (o - 1)
+}
+
+// Filter is the coefficient of the IIR filter of the pressure and the
+// temperature.
+type Filter byte
+
+const (
+	FilterOff Filter = iota
+	Filter2
+	Filter4
+	Filter8
+	Filter16
+)
+
+// Standby is the pause between two measurements in normal mode.
+type Standby byte
+
+const (
+	Standby0_5ms Standby = iota
+	Standby62_5ms
+	Standby125ms
+	Standby250ms
+	Standby500ms
+	Standby1000ms
+	// Standby10ms is 2000ms on a BMP280.
+	Standby10ms
+	// Standby20ms is 4000ms on a BMP280.
+	Standby20ms
+)
+
+// Settings configure the measurements.
+type Settings struct {
+	Mode Mode
+
+	// Temperature, Pressure and Humidity are the oversampling of each
+	// measurement. The temperature cannot be skipped, as the other two
+	// are compensated with it. Humidity is ignored on a BMP280.
+	Temperature Oversampling
+	Pressure    Oversampling
+	Humidity    Oversampling
+
+	Filter  Filter
+	Standby Standby
+}
+
+// DefaultSettings are the settings recommended by Bosch for weather
+// monitoring: a single sample of everything, without filtering, in forced
+// mode.
+var DefaultSettings = Settings{Mode: Forced, Temperature: X1, Pressure: X1, Humidity: X1, Filter: FilterOff, Standby: Standby1000ms}
+
+func (s Settings) validate() error {
+	switch s.Mode {
+	case Sleep, Forced, Normal:
+	default:
+		return fmt.Errorf("bme280: invalid mode %v", s.Mode)
+	}
+	if s.Temperature == Skip {
+		return errors.New("bme280: the temperature cannot be skipped")
+	}
+	if s.Temperature > X16 || s.Pressure > X16 || s.Humidity > X16 {
+		return errors.New("bme280: invalid oversampling")
+	}
+	if s.Filter > Filter16 {
+		return fmt.Errorf("bme280: invalid filter %v", s.Filter)
+	}
+	if s.Standby > Standby20ms {
+		return fmt.Errorf("bme280: invalid standby %v", s.Standby)
+	}
+	return nil
+}
+
+// MeasurementTime returns the maximum duration of a measurement.
+func (s Settings) MeasurementTime() time.Duration {
+	us := 1250 + 2300*s.Temperature.samples()
+	if n := s.Pressure.samples(); n > 0 {
+		us += 2300*n + 575
+	}
+	if n := s.Humidity.samples(); n > 0 {
+		us += 2300*n + 575
+	}
+	return time.Duration(us) * time.Microsecond
+}
+
+// registers gives access to the registers of the sensor on either bus.
+type registers interface {
+	read(reg byte, buf []byte) error
+	write(reg, value byte) error
+}
+
+type i2cRegisters struct {
+	bus  embd.I2CBus
+	addr byte
+}
+
+func (r i2cRegisters) read(reg byte, buf []byte) error {
+	return r.bus.ReadFromReg(r.addr, reg, buf)
+}
+
+func (r i2cRegisters) write(reg, value byte) error {
+	return r.bus.WriteByteToReg(r.addr, reg, value)
+}
+
+// spiRegisters sets bit 7 of the register to read, and clears it to write.
+type spiRegisters struct {
+	bus embd.SPIBus
+}
+
+func (r spiRegisters) read(reg byte, buf []byte) error {
+	data := make([]byte, len(buf)+1)
+	data[0] = reg | 0x80
+	if err := r.bus.TransferAndReceiveData(data); err != nil {
+		return err
+	}
+	copy(buf, data[1:])
+	return nil
+}
+
+func (r spiRegisters) write(reg, value byte) error {
+	return r.bus.TransferAndReceiveData([]byte{reg &^ 0x80, value})
+}
+
+type calibration struct {
+	t1         uint16
+	t2, t3     int16
+	p1         uint16
+	p2, p3, p4 int16
+	p5, p6, p7 int16
+	p8, p9     int16
+	h1, h3     uint8
+	h2, h4, h5 int16
+	h6         int8
+}
+
+func le16(b []byte) uint16 {
+	return uint16(b[0]) | uint16(b[1])<<8
+}
+
+// Measurement is a compensated reading of the sensor. The values which were
+// skipped, and the humidity on a BMP280, are NaN.
+type Measurement struct {
+	Temperature float64 // °C
+	Pressure    float64 // Pa
+	Humidity    float64 // %
+}
+
+// BME280 represents a Bosch BME280 or BMP280 sensor.
+type BME280 struct {
+	// SeaLevel is the pressure at sea level in Pa, which Altitude is
+	// relative to. Defaults to the standard 101325 Pa.
+	SeaLevel float64
+
+	regs     registers
+	settings Settings
+
+	mu          sync.Mutex
+	initialized bool
+	chip        byte
+	cal         calibration
+}
+
+// New returns a handle to a sensor at the given I2C address, Address or
+// AltAddress, with the default settings.
+func New(bus embd.I2CBus, addr byte) *BME280 {
+	return &BME280{SeaLevel: p0, regs: i2cRegisters{bus, addr}, settings: DefaultSettings}
+}
+
+// NewSPI returns a handle to a sensor on a SPI bus in mode 0 or 3, with the
+// default settings.
+func NewSPI(bus embd.SPIBus) *BME280 {
+	return &BME280{SeaLevel: p0, regs: spiRegisters{bus}, settings: DefaultSettings}
+}
+
+// setup identifies the sensor, reads its calibration and applies the
+// settings. d.mu must be held.
+func (d *BME280) setup() error {
+	if d.initialized {
+		return nil
+	}
+
+	id := make([]byte, 1)
+	if err := d.regs.read(regID, id); err != nil {
+		return err
+	}
+	switch id[0] {
+	case ChipBMP280, ChipBME280:
+	default:
+		return fmt.Errorf("bme280: unknown chip id %#x", id[0])
+	}
+	d.chip = id[0]
+
+	if err := d.readCalibration(); err != nil {
+		return err
+	}
+	if err := d.configure(d.settings); err != nil {
+		return err
+	}
+	d.initialized = true
+
+	glog.V(1).Infof("bme280: chip %#x initialized", d.chip)
+	return nil
+}
+
+func (d *BME280) readCalibration() error {
+	b := make([]byte, 26)
+	if err := d.regs.read(regCalib00, b); err != nil {
+		return err
+	}
+	c := &d.cal
+	c.t1 = le16(b[0:])
+	c.t2 = int16(le16(b[2:]))
+	c.t3 = int16(le16(b[4:]))
+	c.p1 = le16(b[6:])
+	c.p2 = int16(le16(b[8:]))
+	c.p3 = int16(le16(b[10:]))
+	c.p4 = int16(le16(b[12:]))
+	c.p5 = int16(le16(b[14:]))
+	c.p6 = int16(le16(b[16:]))
+	c.p7 = int16(le16(b[18:]))
+	c.p8 = int16(le16(b[20:]))
+	c.p9 = int16(le16(b[22:]))
+
+	if d.chip != ChipBME280 {
+		return nil
+	}
+	c.h1 = b[regCalibH1-regCalib00]
+
+	b = make([]byte, 7)
+	if err := d.regs.read(regCalib26, b); err != nil {
+		return err
+	}
+	c.h2 = int16(le16(b[0:]))
+	c.h3 = b[2]
+	c.h4 = int16(int8(b[3]))<<4 | int16(b[4]&0x0F)
+	c.h5 = int16(int8(b[5]))<<4 | int16(b[4]>>4)
+	c.h6 = int8(b[6])
+
+	glog.V(1).Infof("bme280: calibration %+v", *c)
+	return nil
+}
+
+// configure writes the settings. The sensor is put to sleep first, as the
+// config register is only taken into account in sleep mode, and ctrl_hum
+// only once ctrl_meas is written.
+func (d *BME280) configure(s Settings) error {
+	if err := d.regs.write(regCtrlMeas, byte(Sleep)); err != nil {
+		return err
+	}
+	if d.chip == ChipBME280 {
+		if err := d.regs.write(regCtrlHum, byte(s.Humidity)); err != nil {
+			return err
+		}
+	}
+	if err := d.regs.write(regConfig, byte(s.Standby)<<5|byte(s.Filter)<<2); err != nil {
+		return err
+	}
+	mode := s.Mode
+	if mode == Forced {
+		// The forced measurements are started by Measure.
+		mode = Sleep
+	}
+	if err := d.regs.write(regCtrlMeas, ctrlMeas(s, mode)); err != nil {
+		return err
+	}
+	if mode == Normal {
+		// The data registers hold no measurement until the first
+		// conversion is done.
+		time.Sleep(s.MeasurementTime())
+		return d.wait()
+	}
+	return nil
+}
+
+func ctrlMeas(s Settings, mode Mode) byte {
+	return byte(s.Temperature)<<5 | byte(s.Pressure)<<2 | byte(mode)
+}
+
+// Configure applies new settings.
+func (d *BME280) Configure(s Settings) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.settings = s
+	if !d.initialized {
+		return d.setup()
+	}
+	return d.configure(s)
+}
+
+// Chip returns the chip id of the sensor, ChipBMP280 or ChipBME280.
+func (d *BME280) Chip() (byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.setup(); err != nil {
+		return 0, err
+	}
+	return d.chip, nil
+}
+
+// Reset makes a power-on reset of the sensor. It is set up again on the next
+// reading.
+func (d *BME280) Reset() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.initialized = false
+	if err := d.regs.write(regReset, resetCmd); err != nil {
+		return err
+	}
+	// The start-up time of the sensor.
+	time.Sleep(2 * time.Millisecond)
+	return nil
+}
+
+// Measure reads the temperature, pressure and humidity. In forced mode, or
+// if the sensor sleeps, it starts a measurement and waits for it. In normal
+// mode, it reads the last one, the first being awaited by the setup.
+func (d *BME280) Measure() (Measurement, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.setup(); err != nil {
+		return Measurement{}, err
+	}
+
+	if d.settings.Mode != Normal {
+		if err := d.regs.write(regCtrlMeas, ctrlMeas(d.settings, Forced)); err != nil {
+			return Measurement{}, err
+		}
+		time.Sleep(d.settings.MeasurementTime())
+		if err := d.wait(); err != nil {
+			return Measurement{}, err
+		}
+	}
+
+	n := 6
+	if d.chip == ChipBME280 {
+		n = 8
+	}
+	b := make([]byte, n)
+	if err := d.regs.read(regData, b); err != nil {
+		return Measurement{}, err
+	}
+	adcP := int32(b[0])<<12 | int32(b[1])<<4 | int32(b[2])>>4
+	adcT := int32(b[3])<<12 | int32(b[4])<<4 | int32(b[5])>>4
+	adcH := int32(skipped16)
+	if n == 8 {
+		adcH = int32(b[6])<<8 | int32(b[7])
+	}
+	glog.V(2).Infof("bme280: raw readings T=%v P=%v H=%v", adcT, adcP, adcH)
+	if adcT == skipped20 {
+		// The temperature is always measured: the sensor has not
+		// converted anything since its reset.
+		return Measurement{}, errors.New("bme280: no measurement available")
+	}
+
+	return d.compensate(adcT, adcP, adcH), nil
+}
+
+// MeasureQuantities implements sensor.Measurer.
+func (d *BME280) MeasureQuantities() (sensor.Quantities, error) {
+	m, err := d.Measure()
+	if err != nil {
+		return sensor.Quantities{}, err
+	}
+	q := sensor.NoQuantities()
+	q.Temperature, q.Pressure, q.Humidity = m.Temperature, m.Pressure, m.Humidity
+	return q, nil
+}
+
+// wait polls the status until the measurement is done.
+func (d *BME280) wait() error {
+	status := make([]byte, 1)
+	for i := 0; i < 10; i++ {
+		if err := d.regs.read(regStatus, status); err != nil {
+			return err
+		}
+		if status[0]&statusMeasuring == 0 {
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return errors.New("bme280: measurement timed out")
+}
+
+// compensate converts the raw readings with the integer formulas of the
+// datasheet.
+func (d *BME280) compensate(adcT, adcP, adcH int32) Measurement {
+	c := &d.cal
+	m := Measurement{Pressure: math.NaN(), Humidity: math.NaN()}
+	var1 := (((adcT >> 3) - int32(c.t1)<<1) * int32(c.t2)) >> 11
+	var2 := (((((adcT >> 4) - int32(c.t1)) * ((adcT >> 4) - int32(c.t1))) >> 12) * int32(c.t3)) >> 14
+	tFine := var1 + var2
+	m.Temperature = float64((tFine*5+128)>>8) / 100
+
+	if adcP != skipped20 {
+		m.Pressure = float64(compensatePressure(c, tFine, adcP)) / 256
+	}
+	if d.chip == ChipBME280 && adcH != skipped16 {
+		m.Humidity = float64(compensateHumidity(c, tFine, adcH)) / 1024
+	}
+	return m
+}
+
+// compensatePressure returns the pressure in Pa as a Q24.8 fixed point.
+func compensatePressure(c *calibration, tFine, adcP int32) uint32 {
+	var1 := int64(tFine) - 128000
+	var2 := var1 * var1 * int64(c.p6)
+	var2 += (var1 * int64(c.p5)) << 17
+	var2 += int64(c.p4) << 35
+	var1 = ((var1 * var1 * int64(c.p3)) >> 8) + ((var1 * int64(c.p2)) << 12)
+	var1 = ((int64(1)<<47 + var1) * int64(c.p1)) >> 33
+	if var1 == 0 {
+		return 0
+	}
+	p := 1048576 - int64(adcP)
+	p = (((p << 31) - var2) * 3125) / var1
+	var1 = (int64(c.p9) * (p >> 13) * (p >> 13)) >> 25
+	var2 = (int64(c.p8) * p) >> 19
+	p = ((p + var1 + var2) >> 8) + int64(c.p7)<<4
+	return uint32(p)
+}
+
+// compensateHumidity returns the relative humidity in % as a Q22.10 fixed
+// point.
+func compensateHumidity(c *calibration, tFine, adcH int32) uint32 {
+	v := tFine - 76800
+	v = ((((adcH << 14) - int32(c.h4)<<20 - int32(c.h5)*v) + 16384) >> 15) *
+		(((((((v*int32(c.h6))>>10)*(((v*int32(c.h3))>>11)+32768))>>10)+2097152)*int32(c.h2) + 8192) >> 14)
+	v -= ((((v >> 15) * (v >> 15)) >> 7) * int32(c.h1)) >> 4
+	if v < 0 {
+		v = 0
+	}
+	if v > 419430400 {
+		v = 419430400
+	}
+	return uint32(v >> 12)
+}
+
+// Temperature returns the temperature in °C.
+func (d *BME280) Temperature() (float64, error) {
+	m, err := d.Measure()
+	if err != nil {
+		return 0, err
+	}
+	return m.Temperature, nil
+}
+
+// Pressure returns the pressure in Pa.
+func (d *BME280) Pressure() (float64, error) {
+	m, err := d.Measure()
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(m.Pressure) {
+		return 0, errors.New("bme280: pressure measurement skipped")
+	}
+	return m.Pressure, nil
+}
+
+// Humidity returns the relative humidity in %.
+func (d *BME280) Humidity() (float64, error) {
+	m, err := d.Measure()
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(m.Humidity) {
+		if chip, _ := d.Chip(); chip == ChipBMP280 {
+			return 0, errors.New("bme280: a BMP280 has no humidity sensor")
+		}
+		return 0, errors.New("bme280: humidity measurement skipped")
+	}
+	return m.Humidity, nil
+}
+
+// Altitude returns the altitude in m, from the pressure and SeaLevel.
+func (d *BME280) Altitude() (float64, error) {
+	p, err := d.Pressure()
+	if err != nil {
+		return 0, err
+	}
+	return Altitude(p, d.SeaLevel), nil
+}
+
+// Altitude returns the altitude in m at which the pressure is p, given the
+// pressure at sea level, both in Pa.
+func Altitude(p, seaLevel float64) float64 {
+	return 44330 * (1 - math.Pow(p/seaLevel, 1/5.255))
+}
+
+// SeaLevel returns the pressure at sea level, given the pressure p at an
+// altitude in m, e.g. to calibrate SeaLevel from a known altitude.
+func SeaLevel(p, altitude float64) float64 {
+	return p / math.Pow(1-altitude/44330, 5.255)
+}
+
+func (d *BME280) sample() (interface{}, error) {
+	return d.Measure()
+}
+
+// Readings takes a Measurement every period until ctx is done.
+func (d *BME280) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	return sensor.Sample(ctx, period, d.sample)
+}
+
+// Close puts the sensor to sleep.
+func (d *BME280) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.initialized {
+		return nil
+	}
+	return d.regs.write(regCtrlMeas, byte(Sleep))
+}
+
+var (
+	oversamplings = map[string]Oversampling{"1": X1, "2": X2, "4": X4, "8": X8, "16": X16}
+	filters       = map[string]Filter{"0": FilterOff, "2": Filter2, "4": Filter4, "8": Filter8, "16": Filter16}
+	standbys      = map[string]Standby{
+		"0.5": Standby0_5ms, "62.5": Standby62_5ms, "125": Standby125ms, "250": Standby250ms,
+		"500": Standby500ms, "1000": Standby1000ms, "10": Standby10ms, "20": Standby20ms,
+	}
+)
+
+// parseSettings reads the settings from the options of the registry: mode
+// (forced or normal), oversampling (1 to 16, of all the measurements),
+// filter (0 to 16) and standby (in ms).
+func parseSettings(opts map[string]string) (Settings, error) {
+	s := DefaultSettings
+	for k, v := range opts {
+		var ok bool
+		switch k {
+		case "mode":
+			switch v {
+			case "forced":
+				s.Mode, ok = Forced, true
+			case "normal":
+				s.Mode, ok = Normal, true
+			}
+		case "oversampling":
+			var o Oversampling
+			if o, ok = oversamplings[v]; ok {
+				s.Temperature, s.Pressure, s.Humidity = o, o, o
+			}
+		case "filter":
+			s.Filter, ok = filters[v]
+		case "standby":
+			s.Standby, ok = standbys[v]
+		default:
+			return s, fmt.Errorf("bme280: unknown option %q", k)
+		}
+		if !ok {
+			return s, fmt.Errorf("bme280: invalid %v %q", k, v)
+		}
+	}
+	return s, nil
+}
+
+func open(c sensor.Config) (sensor.Device, error) {
+	s, err := parseSettings(c.Options)
+	if err != nil {
+		return nil, err
+	}
+	var d *BME280
+	if c.SPI != nil {
+		d = NewSPI(c.SPI)
+	} else {
+		bus, addr, err := c.I2C(Address, AltAddress)
+		if err != nil {
+			return nil, err
+		}
+		d = New(bus, addr)
+	}
+	// The settings are applied on the first reading.
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	d.settings = s
+	return d, nil
+}
+
+func init() {
+	sensor.Register("bme280", open)
+	sensor.Register("bmp280", open)
+}
@@ -0,0 +1,265 @@
+package bme280
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kidoman/embd"
+)
+
+// loadRegisters reads a register dump of testdata: "reg: byte byte..."
+// lines, the bytes being at consecutive registers.
+func loadRegisters(t *testing.T, name string) *[256]byte {
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	regs := new([256]byte)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.Replace(line, ":", " ", 1))
+		reg, err := strconv.ParseUint(fields[0], 16, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, f := range fields[1:] {
+			b, err := strconv.ParseUint(f, 16, 8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			regs[int(reg)+i] = byte(b)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return regs
+}
+
+type fakeI2CBus struct {
+	embd.I2CBus
+	addr byte
+	regs *[256]byte
+}
+
+func (b *fakeI2CBus) ReadFromReg(addr, reg byte, value []byte) error {
+	if addr != b.addr {
+		return os.ErrNotExist
+	}
+	copy(value, b.regs[reg:])
+	return nil
+}
+
+func (b *fakeI2CBus) WriteByteToReg(addr, reg, value byte) error {
+	if addr != b.addr {
+		return os.ErrNotExist
+	}
+	b.regs[reg] = value
+	return nil
+}
+
+// fakeSPIBus decodes the register accesses like the sensor: bit 7 of the
+// first byte tells a read from a write, and is replaced by 1 in the
+// register address.
+type fakeSPIBus struct {
+	embd.SPIBus
+	regs *[256]byte
+}
+
+func (b *fakeSPIBus) TransferAndReceiveData(data []byte) error {
+	reg := data[0] | 0x80
+	if data[0]&0x80 != 0 {
+		copy(data[1:], b.regs[reg:])
+		return nil
+	}
+	b.regs[reg] = data[1]
+	return nil
+}
+
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		fixture            string
+		chip               byte
+		temp, press, humid float64
+	}{
+		// The values of the floating point formulas in the fixtures.
+		{"bmp280.regs", ChipBMP280, 25.0825, 100653.2668, math.NaN()},
+		{"bme280.regs", ChipBME280, 24.4114, 100166.2271, 59.8603},
+	}
+	for _, test := range tests {
+		for _, bus := range []string{"i2c", "spi"} {
+			regs := loadRegisters(t, test.fixture)
+			d := NewSPI(&fakeSPIBus{regs: regs})
+			if bus == "i2c" {
+				d = New(&fakeI2CBus{addr: AltAddress, regs: regs}, AltAddress)
+			}
+
+			m, err := d.Measure()
+			if err != nil {
+				t.Errorf("%v over %v: %v", test.fixture, bus, err)
+				continue
+			}
+			if chip, _ := d.Chip(); chip != test.chip {
+				t.Errorf("%v over %v: got chip %#x", test.fixture, bus, chip)
+			}
+			if !near(m.Temperature, test.temp, 0.01) {
+				t.Errorf("%v over %v: got temperature %v, want %v", test.fixture, bus, m.Temperature, test.temp)
+			}
+			if !near(m.Pressure, test.press, 0.1) {
+				t.Errorf("%v over %v: got pressure %v, want %v", test.fixture, bus, m.Pressure, test.press)
+			}
+			if math.IsNaN(test.humid) != math.IsNaN(m.Humidity) || !math.IsNaN(test.humid) && !near(m.Humidity, test.humid, 0.01) {
+				t.Errorf("%v over %v: got humidity %v, want %v", test.fixture, bus, m.Humidity, test.humid)
+			}
+
+			// A forced measurement of a single sample of everything, with a
+			// standby of 1s and no filter.
+			if regs[regCtrlMeas] != 0x25 || regs[regConfig] != 0xa0 {
+				t.Errorf("%v over %v: got ctrl_meas %#x and config %#x", test.fixture, bus, regs[regCtrlMeas], regs[regConfig])
+			}
+			if test.chip == ChipBME280 && regs[regCtrlHum] != 0x01 {
+				t.Errorf("%v over %v: got ctrl_hum %#x", test.fixture, bus, regs[regCtrlHum])
+			}
+
+			if err := d.Close(); err != nil || regs[regCtrlMeas] != 0 {
+				t.Errorf("%v over %v: Close: %v, ctrl_meas %#x", test.fixture, bus, err, regs[regCtrlMeas])
+			}
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	regs := loadRegisters(t, "bme280.regs")
+	d := New(&fakeI2CBus{addr: Address, regs: regs}, Address)
+	s := Settings{Mode: Normal, Temperature: X2, Pressure: X16, Humidity: X1, Filter: Filter16, Standby: Standby0_5ms}
+	if err := d.Configure(s); err != nil {
+		t.Fatal(err)
+	}
+	if regs[regCtrlHum] != 0x01 || regs[regConfig] != 0x10 || regs[regCtrlMeas] != 0x57 {
+		t.Errorf("got ctrl_hum %#x, config %#x and ctrl_meas %#x", regs[regCtrlHum], regs[regConfig], regs[regCtrlMeas])
+	}
+
+	// Normal mode reads the last measurement without starting one.
+	regs[regCtrlMeas] = 0
+	if _, err := d.Measure(); err != nil {
+		t.Fatal(err)
+	}
+	if regs[regCtrlMeas] != 0 {
+		t.Errorf("Measure wrote ctrl_meas %#x in normal mode", regs[regCtrlMeas])
+	}
+
+	for _, s := range []Settings{
+		{Mode: Forced, Temperature: Skip, Pressure: X1},
+		{Mode: 2, Temperature: X1},
+		{Mode: Forced, Temperature: X1, Pressure: 6},
+		{Mode: Forced, Temperature: X1, Filter: 5},
+	} {
+		if err := d.Configure(s); err == nil {
+			t.Errorf("Configure(%+v): expected an error", s)
+		}
+	}
+}
+
+func TestSkipped(t *testing.T) {
+	regs := loadRegisters(t, "bme280.regs")
+	d := New(&fakeI2CBus{addr: Address, regs: regs}, Address)
+	if err := d.Configure(Settings{Mode: Forced, Temperature: X1}); err != nil {
+		t.Fatal(err)
+	}
+	// The sensor reports the skipped measurements as 0x80000 and 0x8000.
+	copy(regs[regData:], []byte{0x80, 0x00, 0x00})
+	copy(regs[regData+6:], []byte{0x80, 0x00})
+
+	if _, err := d.Temperature(); err != nil {
+		t.Error(err)
+	}
+	if _, err := d.Pressure(); err == nil {
+		t.Error("Pressure: expected an error")
+	}
+	if _, err := d.Humidity(); err == nil {
+		t.Error("Humidity: expected an error")
+	}
+
+	d = New(&fakeI2CBus{addr: Address, regs: loadRegisters(t, "bmp280.regs")}, Address)
+	if _, err := d.Humidity(); err == nil || !strings.Contains(err.Error(), "BMP280") {
+		t.Errorf("Humidity of a BMP280: got %v", err)
+	}
+}
+
+func TestNormalStartup(t *testing.T) {
+	regs := loadRegisters(t, "bme280.regs")
+	d := New(&fakeI2CBus{addr: Address, regs: regs}, Address)
+
+	// The first conversion is awaited before reading the data.
+	regs[regStatus] = statusMeasuring
+	if err := d.Configure(Settings{Mode: Normal, Temperature: X1}); err == nil {
+		t.Error("Configure: expected a timeout while measuring")
+	}
+
+	// The data registers hold 0x80000 after a reset.
+	regs[regStatus] = 0
+	copy(regs[regData:], []byte{0x80, 0x00, 0x00, 0x80, 0x00, 0x00})
+	if _, err := d.Temperature(); err == nil {
+		t.Error("Temperature: expected an error without a measurement")
+	}
+}
+
+func TestUnknownChip(t *testing.T) {
+	d := New(&fakeI2CBus{addr: Address, regs: new([256]byte)}, Address)
+	if _, err := d.Measure(); err == nil {
+		t.Error("expected an error for chip id 0")
+	}
+}
+
+func TestParseSettings(t *testing.T) {
+	tests := []struct {
+		opts map[string]string
+		want Settings
+		ok   bool
+	}{
+		{nil, DefaultSettings, true},
+		{map[string]string{"mode": "normal", "oversampling": "16", "filter": "4", "standby": "62.5"},
+			Settings{Mode: Normal, Temperature: X16, Pressure: X16, Humidity: X16, Filter: Filter4, Standby: Standby62_5ms}, true},
+		{map[string]string{"mode": "sleep"}, DefaultSettings, false},
+		{map[string]string{"oversampling": "3"}, DefaultSettings, false},
+		{map[string]string{"resolution": "high"}, DefaultSettings, false},
+	}
+	for _, test := range tests {
+		s, err := parseSettings(test.opts)
+		if (err == nil) != test.ok || test.ok && s != test.want {
+			t.Errorf("parseSettings(%v): got %+v, %v", test.opts, s, err)
+		}
+	}
+}
+
+func TestAltitude(t *testing.T) {
+	if a := Altitude(p0, p0); a != 0 {
+		t.Errorf("got altitude %v at sea level", a)
+	}
+	if a := Altitude(89875, p0); !near(a, 1000, 1) {
+		t.Errorf("got altitude %v, want about 1000m", a)
+	}
+	if p := SeaLevel(95000, Altitude(95000, 100500)); !near(p, 100500, 0.01) {
+		t.Errorf("got sea level %v, want 100500", p)
+	}
+}
+
+func TestMeasurementTime(t *testing.T) {
+	if got := DefaultSettings.MeasurementTime().Nanoseconds() / 1000; got != 9300 {
+		t.Errorf("got %vus, want 9300us", got)
+	}
+}
@@ -0,0 +1,401 @@
+// Package bmp18x allows interfacing with the Bosch BMP085 and BMP180 barometric
+// pressure sensors, which share their registers and compensation formulas. The
+// sensors provide compensated temperature and pressure readings.
+//
+// The bmp085 and bmp180 packages wrap this package under the name of each
+// sensor.
+package bmp18x
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+const (
+	// Address is the I2C address of the sensors.
+	Address = 0x77
+
+	regCalibration = 0xAA
+	regControl     = 0xF4
+	regData        = 0xF6
+
+	readTempCmd     = 0x2E
+	readPressureCmd = 0x34
+
+	tempReadDelay = 5 * time.Millisecond
+
+	p0 = 101325
+
+	pollDelay = 250
+)
+
+// Mode is the oversampling setting of the pressure measurement, trading
+// conversion time and power for resolution.
+type Mode uint
+
+const (
+	// UltraLowPower takes a single sample, in 4.5ms.
+	UltraLowPower Mode = iota
+	// Standard takes 2 samples, in 7.5ms.
+	Standard
+	// HighResolution takes 4 samples, in 13.5ms.
+	HighResolution
+	// UltraHighResolution takes 8 samples, in 25.5ms.
+	UltraHighResolution
+)
+
+var modeNames = [...]string{"ultra low power", "standard", "high resolution", "ultra high resolution"}
+
+func (m Mode) String() string {
+	if m > UltraHighResolution {
+		return fmt.Sprintf("Mode(%d)", uint(m))
+	}
+	return modeNames[m]
+}
+
+// ConversionTime returns the time the sensor takes to measure the pressure
+// in the mode, rounded up to the ms.
+func (m Mode) ConversionTime() time.Duration {
+	return time.Duration(2+(3<<m)) * time.Millisecond
+}
+
+// calibration holds the coefficients stored in the EEPROM of the sensor.
+type calibration struct {
+	ac1, ac2, ac3      int16
+	ac4, ac5, ac6      uint16
+	b1, b2, mb, mc, md int16
+}
+
+func parseCalibration(data []byte) (*calibration, error) {
+	word := func(i int) uint16 {
+		return uint16(data[2*i])<<8 | uint16(data[2*i+1])
+	}
+	// A word of 0 or 0xFFFF means the communication failed.
+	for i := 0; i < len(data)/2; i++ {
+		if w := word(i); w == 0 || w == 0xFFFF {
+			return nil, fmt.Errorf("bmp18x: invalid calibration word %#x at %#x", w, regCalibration+2*i)
+		}
+	}
+	return &calibration{
+		ac1: int16(word(0)),
+		ac2: int16(word(1)),
+		ac3: int16(word(2)),
+		ac4: word(3),
+		ac5: word(4),
+		ac6: word(5),
+		b1:  int16(word(6)),
+		b2:  int16(word(7)),
+		mb:  int16(word(8)),
+		mc:  int16(word(9)),
+		md:  int16(word(10)),
+	}, nil
+}
+
+// temperature returns the temperature in 0.1°C from the uncompensated
+// temperature, and the B5 intermediate value of the pressure compensation.
+func (c *calibration) temperature(ut int32) (t, b5 int32) {
+	x1 := ((ut - int32(c.ac6)) * int32(c.ac5)) >> 15
+	x2 := (int32(c.mc) << 11) / (x1 + int32(c.md))
+	b5 = x1 + x2
+	return (b5 + 8) >> 4, b5
+}
+
+// pressure returns the pressure in Pa from the uncompensated pressure,
+// measured with the oversampling setting oss, and B5 of the temperature.
+func (c *calibration) pressure(up, b5 int32, oss uint) int32 {
+	b6 := b5 - 4000
+	x1 := (int32(c.b2) * ((b6 * b6) >> 12)) >> 11
+	x2 := (int32(c.ac2) * b6) >> 11
+	x3 := x1 + x2
+	b3 := (((int32(c.ac1)*4 + x3) << oss) + 2) >> 2
+
+	x1 = (int32(c.ac3) * b6) >> 13
+	x2 = (int32(c.b1) * ((b6 * b6) >> 12)) >> 16
+	x3 = ((x1 + x2) + 2) >> 2
+	b4 := (uint32(c.ac4) * uint32(x3+32768)) >> 15
+
+	b7 := uint32(up-b3) * (50000 >> oss)
+	var p int32
+	if b7 < 0x80000000 {
+		p = int32((b7 << 1) / b4)
+	} else {
+		p = int32((b7 / b4) << 1)
+	}
+
+	x1 = (p >> 8) * (p >> 8)
+	x1 = (x1 * 3038) >> 16
+	x2 = (-7357 * p) >> 16
+	return p + (x1+x2+3791)>>4
+}
+
+// BMP18x represents a Bosch BMP085 or BMP180 barometric sensor.
+type BMP18x struct {
+	Bus embd.I2CBus
+
+	// Poll is the period of the data acquisition loop in ms.
+	Poll int
+
+	// Mode is the oversampling setting of the pressure measurements.
+	// Defaults to UltraLowPower.
+	Mode Mode
+
+	// SeaLevel is the pressure at sea level in Pa, which Altitude is
+	// relative to. Defaults to the standard 101325 Pa.
+	SeaLevel float64
+
+	mu  sync.Mutex
+	cal *calibration
+
+	sampler sensor.Sampler
+}
+
+// Measurement is a sample of all the readings of the sensor.
+type Measurement struct {
+	Temperature float64 // °C
+	Pressure    float64 // Pa
+	Altitude    float64 // m
+}
+
+// New returns a handle to a BMP085 or BMP180 sensor.
+func New(bus embd.I2CBus) *BMP18x {
+	return &BMP18x{Bus: bus, Poll: pollDelay, SeaLevel: p0}
+}
+
+// calibrate reads the calibration of the sensor once. d.mu must be held.
+func (d *BMP18x) calibrate() error {
+	if d.cal != nil {
+		return nil
+	}
+	data := make([]byte, 22)
+	if err := d.Bus.ReadFromReg(Address, regCalibration, data); err != nil {
+		return err
+	}
+	cal, err := parseCalibration(data)
+	if err != nil {
+		return err
+	}
+	d.cal = cal
+
+	if glog.V(1) {
+		glog.Info("bmp18x: calibration data retrieved")
+		glog.Infof("bmp18x: param AC1 = %v", cal.ac1)
+		glog.Infof("bmp18x: param AC2 = %v", cal.ac2)
+		glog.Infof("bmp18x: param AC3 = %v", cal.ac3)
+		glog.Infof("bmp18x: param AC4 = %v", cal.ac4)
+		glog.Infof("bmp18x: param AC5 = %v", cal.ac5)
+		glog.Infof("bmp18x: param AC6 = %v", cal.ac6)
+		glog.Infof("bmp18x: param B1 = %v", cal.b1)
+		glog.Infof("bmp18x: param B2 = %v", cal.b2)
+		glog.Infof("bmp18x: param MB = %v", cal.mb)
+		glog.Infof("bmp18x: param MC = %v", cal.mc)
+		glog.Infof("bmp18x: param MD = %v", cal.md)
+	}
+
+	return nil
+}
+
+func (d *BMP18x) readUncompensatedTemp() (int32, error) {
+	if err := d.Bus.WriteByteToReg(Address, regControl, readTempCmd); err != nil {
+		return 0, err
+	}
+	time.Sleep(tempReadDelay)
+	temp, err := d.Bus.ReadWordFromReg(Address, regData)
+	if err != nil {
+		return 0, err
+	}
+	return int32(temp), nil
+}
+
+func (d *BMP18x) readUncompensatedPressure(mode Mode) (int32, error) {
+	if err := d.Bus.WriteByteToReg(Address, regControl, byte(readPressureCmd+(mode<<6))); err != nil {
+		return 0, err
+	}
+	time.Sleep(mode.ConversionTime())
+
+	data := make([]byte, 3)
+	if err := d.Bus.ReadFromReg(Address, regData, data); err != nil {
+		return 0, err
+	}
+	return int32(uint32(data[0])<<16|uint32(data[1])<<8|uint32(data[2])) >> (8 - mode), nil
+}
+
+// measure converts the temperature, in 0.1°C, and the pressure, in Pa,
+// when withPressure is set. The pressure compensation depends on the
+// temperature, which is always measured first.
+func (d *BMP18x) measure(withPressure bool) (temp, pressure int32, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.calibrate(); err != nil {
+		return 0, 0, err
+	}
+	ut, err := d.readUncompensatedTemp()
+	if err != nil {
+		return 0, 0, err
+	}
+	temp, b5 := d.cal.temperature(ut)
+	glog.V(1).Infof("bmp18x: uncompensated temp %v, compensated temp %v", ut, temp)
+	if !withPressure {
+		return temp, 0, nil
+	}
+
+	mode := d.Mode
+	if mode > UltraHighResolution {
+		return 0, 0, fmt.Errorf("bmp18x: invalid mode %v", mode)
+	}
+	up, err := d.readUncompensatedPressure(mode)
+	if err != nil {
+		return 0, 0, err
+	}
+	pressure = d.cal.pressure(up, b5, uint(mode))
+	glog.V(1).Infof("bmp18x: uncompensated pressure %v, compensated pressure %v", up, pressure)
+	return temp, pressure, nil
+}
+
+// Temperature returns the current temperature reading in °C.
+func (d *BMP18x) Temperature() (float64, error) {
+	if r, ok := d.sampler.Latest(); ok {
+		if r.Err != nil {
+			return 0, r.Err
+		}
+		return r.Value.(Measurement).Temperature, nil
+	}
+	t, _, err := d.measure(false)
+	if err != nil {
+		return 0, err
+	}
+	return float64(t) / 10, nil
+}
+
+// Pressure returns the current pressure reading in Pa.
+func (d *BMP18x) Pressure() (float64, error) {
+	if r, ok := d.sampler.Latest(); ok {
+		if r.Err != nil {
+			return 0, r.Err
+		}
+		return r.Value.(Measurement).Pressure, nil
+	}
+	_, p, err := d.measure(true)
+	if err != nil {
+		return 0, err
+	}
+	return float64(p), nil
+}
+
+// Altitude returns the current altitude reading in m, from the pressure and
+// SeaLevel.
+func (d *BMP18x) Altitude() (float64, error) {
+	if r, ok := d.sampler.Latest(); ok {
+		if r.Err != nil {
+			return 0, r.Err
+		}
+		return r.Value.(Measurement).Altitude, nil
+	}
+	p, err := d.Pressure()
+	if err != nil {
+		return 0, err
+	}
+	return Altitude(p, d.SeaLevel), nil
+}
+
+// Measure takes a sample of all the readings.
+func (d *BMP18x) Measure() (Measurement, error) {
+	t, p, err := d.measure(true)
+	if err != nil {
+		return Measurement{}, err
+	}
+	return Measurement{
+		Temperature: float64(t) / 10,
+		Pressure:    float64(p),
+		Altitude:    Altitude(float64(p), d.SeaLevel),
+	}, nil
+}
+
+// MeasureQuantities implements sensor.Measurer.
+func (d *BMP18x) MeasureQuantities() (sensor.Quantities, error) {
+	m, err := d.Measure()
+	if err != nil {
+		return sensor.Quantities{}, err
+	}
+	q := sensor.NoQuantities()
+	q.Temperature, q.Pressure = m.Temperature, m.Pressure
+	return q, nil
+}
+
+// Altitude returns the altitude in m at which the pressure is p, given the
+// pressure at sea level, both in Pa.
+func Altitude(p, seaLevel float64) float64 {
+	return 44330 * (1 - math.Pow(p/seaLevel, 0.190295))
+}
+
+// SeaLevel returns the pressure at sea level, given the pressure p at an
+// altitude in m, e.g. to calibrate SeaLevel from a known altitude.
+func SeaLevel(p, altitude float64) float64 {
+	return p / math.Pow(1-altitude/44330, 1/0.190295)
+}
+
+func (d *BMP18x) sample() (interface{}, error) {
+	return d.Measure()
+}
+
+// Readings takes a Measurement every period until ctx is done.
+func (d *BMP18x) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	return sensor.Sample(ctx, period, d.sample)
+}
+
+// Run starts the sensor data acquisition loop, which Temperature, Pressure
+// and Altitude then return the latest readings of.
+func (d *BMP18x) Run() {
+	d.sampler.Start(time.Duration(d.Poll)*time.Millisecond, d.sample)
+}
+
+// Close stops the data acquisition loop.
+func (d *BMP18x) Close() error {
+	d.sampler.Stop()
+	return nil
+}
+
+var modes = map[string]Mode{
+	"1": UltraLowPower,
+	"2": Standard,
+	"4": HighResolution,
+	"8": UltraHighResolution,
+}
+
+// Open creates a sensor from its registry configuration, for the packages
+// registering the sensors. The options are oversampling (1, 2, 4 or 8
+// samples of the pressure) and sea-level (the pressure at sea level in Pa).
+func Open(c sensor.Config) (*BMP18x, error) {
+	bus, _, err := c.I2C(Address)
+	if err != nil {
+		return nil, err
+	}
+	d := New(bus)
+	for k, v := range c.Options {
+		switch k {
+		case "oversampling":
+			m, ok := modes[v]
+			if !ok {
+				return nil, fmt.Errorf("bmp18x: invalid oversampling %q, expected 1, 2, 4 or 8", v)
+			}
+			d.Mode = m
+		case "sea-level":
+			p, err := strconv.ParseFloat(v, 64)
+			if err != nil || p <= 0 {
+				return nil, fmt.Errorf("bmp18x: invalid sea-level %q", v)
+			}
+			d.SeaLevel = p
+		default:
+			return nil, fmt.Errorf("bmp18x: unknown option %q", k)
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,153 @@
+package bmp18x
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+// The calibration of the example of the datasheet.
+var datasheet = []byte{
+	0x01, 0x98, 0xFF, 0xB8, 0xC7, 0xD1, 0x7F, 0xE5, 0x7F, 0xF5, 0x5A, 0x71,
+	0x18, 0x2E, 0x00, 0x04, 0x80, 0x00, 0xDD, 0xF9, 0x0B, 0x34,
+}
+
+// fakeBus converts the uncompensated temperature ut and pressure up on
+// command, the pressure having the resolution of the oversampling setting.
+type fakeBus struct {
+	embd.I2CBus
+	regs   [256]byte
+	ut, up int32
+	cmds   []byte
+}
+
+func newFakeBus(ut, up int32) *fakeBus {
+	b := &fakeBus{ut: ut, up: up}
+	copy(b.regs[regCalibration:], datasheet)
+	return b
+}
+
+func (b *fakeBus) WriteByteToReg(addr, reg, value byte) error {
+	if addr != Address || reg != regControl {
+		return os.ErrInvalid
+	}
+	b.cmds = append(b.cmds, value)
+	if value == readTempCmd {
+		b.regs[regData], b.regs[regData+1] = byte(b.ut>>8), byte(b.ut)
+		return nil
+	}
+	raw := b.up << (8 - value>>6)
+	b.regs[regData], b.regs[regData+1], b.regs[regData+2] = byte(raw>>16), byte(raw>>8), byte(raw)
+	return nil
+}
+
+func (b *fakeBus) ReadFromReg(addr, reg byte, value []byte) error {
+	if addr != Address {
+		return os.ErrInvalid
+	}
+	copy(value, b.regs[reg:])
+	return nil
+}
+
+func (b *fakeBus) ReadWordFromReg(addr, reg byte) (uint16, error) {
+	if addr != Address {
+		return 0, os.ErrInvalid
+	}
+	return uint16(b.regs[reg])<<8 | uint16(b.regs[reg+1]), nil
+}
+
+func TestCompensation(t *testing.T) {
+	cal, err := parseCalibration(datasheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ut, up int32
+		oss    uint
+		t, p   int32
+	}{
+		{27898, 23843, 0, 150, 69964}, // the example of the datasheet
+		{27898, 23843 << 3, 3, 150, 69963},
+		{25000, 23843, 0, -121, 65732},
+		{24000, 23843 << 1, 1, -247, 63796},
+	}
+	for _, test := range tests {
+		temp, b5 := cal.temperature(test.ut)
+		if temp != test.t {
+			t.Errorf("temperature(%v): got %v, want %v", test.ut, temp, test.t)
+		}
+		if p := cal.pressure(test.up, b5, test.oss); p != test.p {
+			t.Errorf("pressure(%v, %v, %v): got %v, want %v", test.up, b5, test.oss, p, test.p)
+		}
+	}
+
+	if _, err := parseCalibration(make([]byte, 22)); err == nil {
+		t.Error("parseCalibration: expected an error for a blank calibration")
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	for mode := UltraLowPower; mode <= UltraHighResolution; mode++ {
+		bus := newFakeBus(27898, 23843<<mode)
+		d := New(bus)
+		d.Mode = mode
+		m, err := d.Measure()
+		if err != nil {
+			t.Fatalf("%v: %v", mode, err)
+		}
+		if m.Temperature != 15 || math.Abs(m.Pressure-69964) > 2 {
+			t.Errorf("%v: got %+v", mode, m)
+		}
+		if want := byte(0x34 | mode<<6); len(bus.cmds) != 2 || bus.cmds[0] != 0x2E || bus.cmds[1] != want {
+			t.Errorf("%v: got commands %#x, want 0x2e %#x", mode, bus.cmds, want)
+		}
+	}
+
+	d := New(newFakeBus(25000, 23843))
+	if temp, err := d.Temperature(); err != nil || temp != -12.1 {
+		t.Errorf("Temperature below 0°C: got %v, %v", temp, err)
+	}
+
+	d.Mode = 4
+	if _, err := d.Pressure(); err == nil {
+		t.Error("Pressure: expected an error for an invalid mode")
+	}
+}
+
+func TestAltitude(t *testing.T) {
+	d := New(newFakeBus(27898, 23843))
+	d.SeaLevel = 69964
+	if a, err := d.Altitude(); err != nil || a != 0 {
+		t.Errorf("got altitude %v, %v at the sea level pressure", a, err)
+	}
+	if a := Altitude(89875, p0); math.Abs(a-1000) > 1 {
+		t.Errorf("got altitude %v, want about 1000m", a)
+	}
+	if p := SeaLevel(95000, Altitude(95000, 100500)); math.Abs(p-100500) > 0.01 {
+		t.Errorf("got sea level %v, want 100500", p)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	bus := newFakeBus(27898, 23843)
+	d, err := Open(sensor.Config{Bus: bus, Options: map[string]string{"oversampling": "8", "sea-level": "100500"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Mode != UltraHighResolution || d.SeaLevel != 100500 {
+		t.Errorf("got mode %v and sea level %v", d.Mode, d.SeaLevel)
+	}
+
+	for _, opts := range []map[string]string{
+		{"oversampling": "3"},
+		{"sea-level": "-1"},
+		{"mode": "standard"},
+	} {
+		if _, err := Open(sensor.Config{Bus: bus, Options: opts}); err == nil {
+			t.Errorf("Open(%v): expected an error", opts)
+		}
+	}
+}
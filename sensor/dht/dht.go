@@ -0,0 +1,381 @@
+// Package dht allows interfacing with the Aosong DHT11 and DHT22 (AM2302)
+// humidity and temperature sensors, over their single wire protocol.
+//
+// The host pulls the data line low to start a measurement, then the sensor
+// answers with a 40 bit frame: 16 bits of humidity, 16 bits of temperature
+// and a checksum. A bit is a 50µs low level followed by a high level of
+// 26-28µs for a 0 or 70µs for a 1. The driver decodes the frame from the
+// timestamped edges captured by a Line, the events of the gpio character
+// device by default.
+package dht
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/host/generic"
+	"github.com/kidoman/embd/sensor"
+)
+
+const (
+	// MinInterval is the minimum interval between two reads of the sensor,
+	// which returns stale values when read more often.
+	MinInterval = 2 * time.Second
+
+	// bitThreshold separates the high levels of the 0 and 1 bits.
+	bitThreshold = 50 * time.Microsecond
+
+	// maxEdges is the number of edges of a response: 2 for the
+	// acknowledgement, 2 per bit and 2 for the end of the frame.
+	maxEdges = 84
+
+	// idleTimeout is the time after which a line without edges is
+	// considered released by the sensor, the longest level being 80µs.
+	idleTimeout = time.Millisecond
+
+	defaultRetries = 3
+)
+
+// Model is the model of the sensor, which sets the start signal and the
+// scaling of the frame.
+type Model int
+
+const (
+	// DHT11 measures 20-90% and 0-50°C with a resolution of 1% and 1°C.
+	DHT11 Model = iota
+	// DHT22 measures 0-100% and -40-80°C with a resolution of 0.1.
+	DHT22
+)
+
+func (m Model) String() string {
+	switch m {
+	case DHT11:
+		return "DHT11"
+	case DHT22:
+		return "DHT22"
+	}
+	return fmt.Sprintf("Model(%d)", int(m))
+}
+
+// start returns how long the host holds the line low to start a
+// measurement.
+func (m Model) start() time.Duration {
+	if m == DHT11 {
+		return 18 * time.Millisecond
+	}
+	return 1100 * time.Microsecond
+}
+
+// Edge is a transition of the data line.
+type Edge struct {
+	// Level is the level of the line after the edge.
+	Level int
+	// Time is the time of the edge, from any reference.
+	Time time.Duration
+}
+
+// Line is the data line of a sensor.
+type Line interface {
+	// Capture holds the line low for start, releases it, and returns the
+	// edges of the response of the sensor.
+	Capture(start time.Duration) ([]Edge, error)
+}
+
+// pinLine captures the edges by polling a digital pin.
+type pinLine struct {
+	pin embd.DigitalPin
+}
+
+// NewPinLine returns a Line capturing the edges by polling the pin. The
+// levels of a frame being a few tens of µs long, only the memory mapped
+// pins, e.g. those of the Raspberry Pi, are read fast enough.
+func NewPinLine(pin embd.DigitalPin) Line {
+	return &pinLine{pin: pin}
+}
+
+// eventLine captures the edges as line events of the gpio character device.
+type eventLine struct {
+	dev    string
+	offset int
+}
+
+// NewEventLine returns a Line capturing the edges of the global gpio number
+// n through the character device of its gpio chip, which timestamps them
+// in the kernel. It works with any pin, on kernels 4.8 and newer.
+func NewEventLine(n int) (Line, error) {
+	dev, offset, err := generic.LineChip(n)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLine{dev: dev, offset: offset}, nil
+}
+
+func (l *eventLine) Capture(start time.Duration) ([]Edge, error) {
+	events, err := generic.PulseLine(l.dev, l.offset, start, maxEdges, idleTimeout)
+	if err != nil {
+		return nil, err
+	}
+	edges := make([]Edge, len(events))
+	for i, e := range events {
+		edges[i] = Edge{Level: embd.Low, Time: e.Time}
+		if e.Rising {
+			edges[i].Level = embd.High
+		}
+	}
+	return edges, nil
+}
+
+func (l *pinLine) Capture(start time.Duration) ([]Edge, error) {
+	if err := l.pin.SetDirection(embd.Out); err != nil {
+		return nil, err
+	}
+	if err := l.pin.Write(embd.Low); err != nil {
+		return nil, err
+	}
+	time.Sleep(start)
+
+	// The goroutine must not be moved to another thread while polling.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := l.pin.SetDirection(embd.In); err != nil {
+		return nil, err
+	}
+	edges := make([]Edge, 0, maxEdges)
+	t0 := time.Now()
+	level, last := embd.High, t0
+	for len(edges) < maxEdges {
+		v, err := l.pin.Read()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if v != level {
+			level, last = v, now
+			edges = append(edges, Edge{Level: v, Time: now.Sub(t0)})
+		} else if now.Sub(last) > idleTimeout {
+			break
+		}
+	}
+	return edges, nil
+}
+
+// ErrChecksum is returned when the checksum of a frame does not match its
+// data.
+var ErrChecksum = errors.New("dht: checksum mismatch")
+
+// Decode decodes the 5 bytes of the frame from the edges of a response,
+// and verifies its checksum. The bits are the last 40 complete high levels,
+// the edges of the start of the response being possibly missed.
+func Decode(edges []Edge) ([5]byte, error) {
+	var frame [5]byte
+	var highs []time.Duration
+	for i := 1; i < len(edges); i++ {
+		if edges[i-1].Level == embd.High && edges[i].Level == embd.Low {
+			highs = append(highs, edges[i].Time-edges[i-1].Time)
+		}
+	}
+	if len(highs) < 40 {
+		return frame, fmt.Errorf("dht: got %v bits, want 40", len(highs))
+	}
+	for i, d := range highs[len(highs)-40:] {
+		if d > bitThreshold {
+			frame[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	if frame[0]+frame[1]+frame[2]+frame[3] != frame[4] {
+		return frame, ErrChecksum
+	}
+	return frame, nil
+}
+
+// Measurement is a sample of all the readings of the sensor.
+type Measurement struct {
+	Temperature float64 // °C
+	Humidity    float64 // %
+	DewPoint    float64 // °C
+}
+
+// parse scales the frame according to the model.
+func (m Model) parse(frame [5]byte) Measurement {
+	var temp, humidity float64
+	switch m {
+	case DHT11:
+		// The decimals are 0 except on the latest revisions.
+		humidity = float64(frame[0]) + float64(frame[1])/10
+		temp = float64(frame[2]) + float64(frame[3]&0x7F)/10
+		if frame[3]&0x80 != 0 {
+			temp = -temp
+		}
+	default:
+		humidity = float64(uint16(frame[0])<<8|uint16(frame[1])) / 10
+		temp = float64(uint16(frame[2]&0x7F)<<8|uint16(frame[3])) / 10
+		if frame[2]&0x80 != 0 {
+			temp = -temp
+		}
+	}
+	return Measurement{Temperature: temp, Humidity: humidity, DewPoint: sensor.DewPoint(temp, humidity)}
+}
+
+// DHT represents a DHT11 or DHT22 sensor.
+type DHT struct {
+	Line  Line
+	Model Model
+
+	// Poll is the period of the data acquisition loop in ms.
+	Poll int
+
+	// Retries is the number of reads after a failed one, MinInterval
+	// apart.
+	Retries int
+
+	mu    sync.Mutex
+	last  time.Time // of the last read
+	m     Measurement
+	valid bool
+
+	// now and sleep are replaced by the tests.
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	sampler sensor.Sampler
+}
+
+// New returns a handle to a sensor on the pin, which edges are captured by
+// polling.
+func New(pin embd.DigitalPin, model Model) *DHT {
+	return NewLine(NewPinLine(pin), model)
+}
+
+// NewLine returns a handle to a sensor on the line.
+func NewLine(line Line, model Model) *DHT {
+	return &DHT{
+		Line:    line,
+		Model:   model,
+		Poll:    int(MinInterval / time.Millisecond),
+		Retries: defaultRetries,
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}
+}
+
+// Measure reads the sensor, retrying Retries times on failure. The reads
+// are at least MinInterval apart: within MinInterval of a successful read,
+// it returns the measurement of that read.
+func (d *DHT) Measure() (Measurement, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var err error
+	for i := 0; i <= d.Retries; i++ {
+		if wait := MinInterval - d.now().Sub(d.last); !d.last.IsZero() && wait > 0 {
+			if d.valid {
+				return d.m, nil
+			}
+			d.sleep(wait)
+		}
+		var frame [5]byte
+		frame, err = d.read()
+		d.last = d.now()
+		if err == nil {
+			d.m, d.valid = d.Model.parse(frame), true
+			return d.m, nil
+		}
+		d.valid = false
+		glog.V(1).Infof("dht: read %v failed: %v", i+1, err)
+	}
+	return Measurement{}, err
+}
+
+// MeasureQuantities implements sensor.Measurer.
+func (d *DHT) MeasureQuantities() (sensor.Quantities, error) {
+	m, err := d.Measure()
+	if err != nil {
+		return sensor.Quantities{}, err
+	}
+	q := sensor.NoQuantities()
+	q.Temperature, q.Humidity, q.DewPoint = m.Temperature, m.Humidity, m.DewPoint
+	return q, nil
+}
+
+func (d *DHT) read() ([5]byte, error) {
+	edges, err := d.Line.Capture(d.Model.start())
+	if err != nil {
+		return [5]byte{}, err
+	}
+	return Decode(edges)
+}
+
+// Temperature returns the current temperature reading in °C.
+func (d *DHT) Temperature() (float64, error) {
+	m, err := d.latest()
+	return m.Temperature, err
+}
+
+// Humidity returns the current relative humidity reading in %.
+func (d *DHT) Humidity() (float64, error) {
+	m, err := d.latest()
+	return m.Humidity, err
+}
+
+// DewPoint returns the current dew point in °C.
+func (d *DHT) DewPoint() (float64, error) {
+	m, err := d.latest()
+	return m.DewPoint, err
+}
+
+func (d *DHT) latest() (Measurement, error) {
+	if r, ok := d.sampler.Latest(); ok {
+		if r.Err != nil {
+			return Measurement{}, r.Err
+		}
+		return r.Value.(Measurement), nil
+	}
+	return d.Measure()
+}
+
+func (d *DHT) sample() (interface{}, error) {
+	return d.Measure()
+}
+
+// Readings takes a Measurement every period until ctx is done.
+func (d *DHT) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	return sensor.Sample(ctx, period, d.sample)
+}
+
+// Run starts the sensor data acquisition loop, which Temperature, Humidity
+// and DewPoint then return the latest readings of.
+func (d *DHT) Run() {
+	d.sampler.Start(time.Duration(d.Poll)*time.Millisecond, d.sample)
+}
+
+// Close stops the data acquisition loop.
+func (d *DHT) Close() error {
+	d.sampler.Stop()
+	return nil
+}
+
+// The sensor needs a "data" pin, which edges are captured through the gpio
+// character device: polling the pin is too slow unless it is memory mapped.
+func init() {
+	for name, model := range map[string]Model{"dht11": DHT11, "dht22": DHT22} {
+		model := model
+		sensor.Register(name, func(c sensor.Config) (sensor.Device, error) {
+			pin, err := c.Pin("data")
+			if err != nil {
+				return nil, err
+			}
+			line, err := NewEventLine(pin.N())
+			if err != nil {
+				return nil, fmt.Errorf("dht: cannot capture the edges of pin %v through its gpio chip: %v", pin.N(), err)
+			}
+			return NewLine(line, model), nil
+		})
+	}
+}
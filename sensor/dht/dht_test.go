@@ -0,0 +1,184 @@
+package dht
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakefs"
+	"github.com/kidoman/embd/sensor"
+)
+
+// edges returns the edges of the response of a sensor sending the frame.
+func edges(frame [5]byte) []Edge {
+	var es []Edge
+	var t time.Duration
+	level := func(l int, d time.Duration) {
+		es = append(es, Edge{Level: l, Time: t})
+		t += d
+	}
+	t = 30 * time.Microsecond
+	level(embd.Low, 80*time.Microsecond)
+	level(embd.High, 80*time.Microsecond)
+	for i := uint(0); i < 40; i++ {
+		level(embd.Low, 50*time.Microsecond)
+		if frame[i/8]&(0x80>>(i%8)) != 0 {
+			level(embd.High, 70*time.Microsecond)
+		} else {
+			level(embd.High, 27*time.Microsecond)
+		}
+	}
+	level(embd.Low, 50*time.Microsecond)
+	level(embd.High, 0)
+	return es
+}
+
+func TestDecode(t *testing.T) {
+	frame := [5]byte{0x02, 0x8C, 0x01, 0x5F, 0xEE}
+	got, err := Decode(edges(frame))
+	if err != nil || got != frame {
+		t.Errorf("got %#x, %v, want %#x", got, err, frame)
+	}
+
+	// The acknowledgement of the sensor may be missed.
+	if got, err := Decode(edges(frame)[2:]); err != nil || got != frame {
+		t.Errorf("without the acknowledgement: got %#x, %v", got, err)
+	}
+
+	bad := frame
+	bad[4]++
+	if _, err := Decode(edges(bad)); err != ErrChecksum {
+		t.Errorf("got %v, want ErrChecksum", err)
+	}
+
+	if _, err := Decode(edges(frame)[:40]); err == nil {
+		t.Error("expected an error for a truncated frame")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		model       Model
+		frame       [5]byte
+		temp, humid float64
+	}{
+		{DHT22, [5]byte{0x02, 0x8C, 0x01, 0x5F}, 35.1, 65.2}, // the example of the datasheet
+		{DHT22, [5]byte{0x02, 0x8C, 0x80, 0x65}, -10.1, 65.2},
+		{DHT11, [5]byte{45, 0, 23, 0}, 23, 45},
+		{DHT11, [5]byte{45, 5, 2, 0x83}, -2.3, 45.5},
+	}
+	for _, test := range tests {
+		m := test.model.parse(test.frame)
+		if math.Abs(m.Temperature-test.temp) > 1e-9 || math.Abs(m.Humidity-test.humid) > 1e-9 {
+			t.Errorf("%v %#x: got %+v", test.model, test.frame, m)
+		}
+	}
+}
+
+// fakeLine returns the responses in turn, and records the start signals.
+type fakeLine struct {
+	responses [][]Edge
+	starts    []time.Duration
+}
+
+func (l *fakeLine) Capture(start time.Duration) ([]Edge, error) {
+	l.starts = append(l.starts, start)
+	if len(l.responses) == 0 {
+		return nil, errors.New("no response")
+	}
+	r := l.responses[0]
+	l.responses = l.responses[1:]
+	return r, nil
+}
+
+// clock is a fake time, which sleep advances.
+type clock struct {
+	t     time.Time
+	slept []time.Duration
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func (c *clock) sleep(d time.Duration) {
+	c.slept = append(c.slept, d)
+	c.t = c.t.Add(d)
+}
+
+func TestMeasure(t *testing.T) {
+	good := edges([5]byte{0x02, 0x8C, 0x01, 0x5F, 0xEE})
+	bad := edges([5]byte{0x02, 0x8C, 0x01, 0x5F, 0xEF})
+	line := &fakeLine{responses: [][]Edge{bad, good, good}}
+	c := &clock{t: time.Unix(1426325213, 0)}
+	d := NewLine(line, DHT22)
+	d.now, d.sleep = c.now, c.sleep
+
+	m, err := d.Measure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Temperature != 35.1 || m.Humidity != 65.2 {
+		t.Errorf("got %+v", m)
+	}
+	if len(c.slept) != 1 || c.slept[0] != MinInterval {
+		t.Errorf("got sleeps %v, want a retry after %v", c.slept, MinInterval)
+	}
+	if len(line.starts) != 2 || line.starts[0] != 1100*time.Microsecond {
+		t.Errorf("got start signals %v", line.starts)
+	}
+
+	// Within MinInterval, the last measurement is returned.
+	c.t = c.t.Add(time.Second)
+	if m2, err := d.Measure(); err != nil || m2 != m || len(line.starts) != 2 {
+		t.Errorf("got %+v, %v after %v reads", m2, err, len(line.starts))
+	}
+
+	c.t = c.t.Add(time.Second)
+	if _, err := d.Measure(); err != nil || len(line.starts) != 3 {
+		t.Errorf("got %v after %v reads", err, len(line.starts))
+	}
+
+	c.t = c.t.Add(MinInterval)
+	if _, err := d.Measure(); err == nil || len(line.starts) != 3+defaultRetries+1 {
+		t.Errorf("got %v after %v reads", err, len(line.starts))
+	}
+}
+
+type fakePin struct {
+	embd.DigitalPin
+	n int
+}
+
+func (p fakePin) N() int { return p.n }
+
+func TestOpen(t *testing.T) {
+	restore, err := fakefs.Setup(fakefs.Tree{
+		"sys/class/gpio/gpiochip0/device/gpiochip0/": "",
+		"sys/class/gpio/gpiochip0/base":              "0\n",
+		"sys/class/gpio/gpiochip0/ngpio":             "54\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+
+	d, err := sensor.New("dht11", sensor.Config{Pins: map[string]embd.DigitalPin{"data": fakePin{n: 4}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.(*DHT).Model != DHT11 {
+		t.Errorf("got model %v", d.(*DHT).Model)
+	}
+	if l, ok := d.(*DHT).Line.(*eventLine); !ok || l.dev != embd.FSPath("/dev/gpiochip0") || l.offset != 4 {
+		t.Errorf("got line %+v, want the events of line 4 of gpiochip0", d.(*DHT).Line)
+	}
+
+	// A pin without a gpio chip, e.g. on an emulated host.
+	if _, err := sensor.New("dht22", sensor.Config{Pins: map[string]embd.DigitalPin{"data": fakePin{n: 60}}}); err == nil {
+		t.Error("expected an error for a pin without a gpio chip")
+	}
+	if _, err := sensor.New("dht22", sensor.Config{}); err == nil {
+		t.Error("expected an error without a data pin")
+	}
+}
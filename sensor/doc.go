@@ -1,2 +1,14 @@
 // Package sensor contains the various sensors modules for use on your platform.
+//
+// The drivers implement the quantity interfaces of what they measure
+// (Thermometer, Barometer, Luxmeter...), so that code can work with any of
+// them. The drivers register themselves by name when imported; New then
+// creates one from its bus, address and pins:
+//
+//	import _ "github.com/kidoman/embd/sensor/all"
+//
+//	d, err := sensor.New("bmp180", sensor.Config{Bus: embd.NewI2CBus(1)})
+//	if t, ok := d.(sensor.Thermometer); ok {
+//		temp, err := t.Temperature()
+//	}
 package sensor
@@ -0,0 +1,403 @@
+// Package htu21d allows interfacing with the TE Connectivity HTU21D and the
+// Silicon Labs Si7021 humidity and temperature sensors through I2C, which
+// share their commands.
+//
+// The sensor either holds the bus by stretching the clock while it measures
+// (hold master mode), or does not acknowledge its address until the
+// measurement is ready (no hold master mode, the default).
+package htu21d
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+const (
+	// Address is the I2C address of the sensor.
+	Address = 0x40
+
+	cmdHumidityHold     = 0xE5
+	cmdHumidityNoHold   = 0xF5
+	cmdTempHold         = 0xE3
+	cmdTempNoHold       = 0xF3
+	cmdTempFromHumidity = 0xE0 // Si7021 only
+	cmdReset            = 0xFE
+	cmdWriteUser        = 0xE6
+	cmdReadUser         = 0xE7
+
+	resetDelay = 15 * time.Millisecond
+	retryDelay = 5 * time.Millisecond
+	maxRetries = 10
+
+	userResolution = 0x81
+
+	pollDelay = 1000
+)
+
+var (
+	cmdSerialA = []byte{0xFA, 0x0F}
+	cmdSerialB = []byte{0xFC, 0xC9}
+)
+
+// Resolution is the resolution of the humidity and temperature
+// measurements.
+type Resolution byte
+
+// The resolutions, as set in the user register.
+const (
+	// RH12T14 measures the humidity on 12 bits and the temperature on 14
+	// bits, in 16ms and 50ms.
+	RH12T14 Resolution = 0x00
+	// RH8T12 measures in 3ms and 13ms.
+	RH8T12 Resolution = 0x01
+	// RH10T13 measures in 5ms and 25ms.
+	RH10T13 Resolution = 0x80
+	// RH11T11 measures in 8ms and 7ms.
+	RH11T11 Resolution = 0x81
+)
+
+// times returns the maximum durations of the humidity and temperature
+// measurements.
+func (r Resolution) times() (humidity, temp time.Duration) {
+	switch r {
+	case RH8T12:
+		return 3 * time.Millisecond, 13 * time.Millisecond
+	case RH10T13:
+		return 5 * time.Millisecond, 25 * time.Millisecond
+	case RH11T11:
+		return 8 * time.Millisecond, 7 * time.Millisecond
+	}
+	return 16 * time.Millisecond, 50 * time.Millisecond
+}
+
+// Measurement is a sample of all the readings of the sensor.
+type Measurement struct {
+	Temperature float64 // °C
+	Humidity    float64 // %
+	DewPoint    float64 // °C
+}
+
+// HTU21D represents a HTU21D or Si7021 sensor.
+type HTU21D struct {
+	Bus embd.I2CBus
+
+	// Poll is the period of the data acquisition loop in ms.
+	Poll int
+
+	// Hold selects the hold master mode, for the buses supporting clock
+	// stretching.
+	Hold bool
+
+	si7021 bool
+
+	mu         sync.Mutex
+	resolution Resolution
+	// configured tells whether the resolution was written to the sensor.
+	configured bool
+
+	sampler sensor.Sampler
+}
+
+// New returns a handle to a HTU21D sensor.
+func New(bus embd.I2CBus) *HTU21D {
+	return &HTU21D{Bus: bus, Poll: pollDelay, configured: true}
+}
+
+// NewSi7021 returns a handle to a Si7021 sensor, which measures the
+// temperature along with the humidity.
+func NewSi7021(bus embd.I2CBus) *HTU21D {
+	d := New(bus)
+	d.si7021 = true
+	return d
+}
+
+// crc8 is the checksum of the sensor: polynomial 0x31, initialized to 0.
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x31
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// read sends the measurement command and reads the result, CRC checked,
+// without its status bits.
+func (d *HTU21D) read(cmd byte, delay time.Duration) (uint16, error) {
+	data := make([]byte, 3)
+	if cmd == cmdHumidityHold || cmd == cmdTempHold {
+		if err := d.Bus.ReadFromReg(Address, cmd, data); err != nil {
+			return 0, err
+		}
+	} else {
+		if err := d.Bus.WriteByte(Address, cmd); err != nil {
+			return 0, err
+		}
+		time.Sleep(delay)
+		// The sensor does not acknowledge the reads until it is done.
+		var err error
+		for i := 0; ; i++ {
+			var b []byte
+			if b, err = d.Bus.ReadBytes(Address, 3); err == nil {
+				copy(data, b)
+				break
+			}
+			if i == maxRetries {
+				return 0, err
+			}
+			time.Sleep(retryDelay)
+		}
+	}
+	if crc := crc8(data[:2]); crc != data[2] {
+		return 0, fmt.Errorf("htu21d: crc mismatch, got %#02x, want %#02x", data[2], crc)
+	}
+	return (uint16(data[0])<<8 | uint16(data[1])) &^ 0x3, nil
+}
+
+// configure writes the resolution to the user register, keeping its other
+// bits. d.mu must be held.
+func (d *HTU21D) configure() error {
+	if d.configured {
+		return nil
+	}
+	user, err := d.Bus.ReadByteFromReg(Address, cmdReadUser)
+	if err != nil {
+		return err
+	}
+	user = user&^userResolution | byte(d.resolution)
+	if err := d.Bus.WriteByteToReg(Address, cmdWriteUser, user); err != nil {
+		return err
+	}
+	d.configured = true
+	return nil
+}
+
+// SetResolution sets the resolution of the measurements.
+func (d *HTU21D) SetResolution(r Resolution) error {
+	switch r {
+	case RH12T14, RH8T12, RH10T13, RH11T11:
+	default:
+		return fmt.Errorf("htu21d: invalid resolution %#02x", byte(r))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.resolution, d.configured = r, false
+	return d.configure()
+}
+
+// Measure takes a sample of all the readings.
+func (d *HTU21D) Measure() (Measurement, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.configure(); err != nil {
+		return Measurement{}, err
+	}
+	humidityTime, tempTime := d.resolution.times()
+	cmdHumidity, cmdTemp := byte(cmdHumidityNoHold), byte(cmdTempNoHold)
+	if d.Hold {
+		cmdHumidity, cmdTemp = cmdHumidityHold, cmdTempHold
+	}
+
+	srh, err := d.read(cmdHumidity, humidityTime)
+	if err != nil {
+		return Measurement{}, err
+	}
+	var st uint16
+	if d.si7021 {
+		// The Si7021 measures the temperature to compensate the humidity.
+		var data []byte
+		if data, err = d.readFromReg(cmdTempFromHumidity, 2); err == nil {
+			st = (uint16(data[0])<<8 | uint16(data[1])) &^ 0x3
+		}
+	} else {
+		st, err = d.read(cmdTemp, tempTime)
+	}
+	if err != nil {
+		return Measurement{}, err
+	}
+	return newMeasurement(st, srh), nil
+}
+
+// MeasureQuantities implements sensor.Measurer.
+func (d *HTU21D) MeasureQuantities() (sensor.Quantities, error) {
+	m, err := d.Measure()
+	if err != nil {
+		return sensor.Quantities{}, err
+	}
+	q := sensor.NoQuantities()
+	q.Temperature, q.Humidity, q.DewPoint = m.Temperature, m.Humidity, m.DewPoint
+	return q, nil
+}
+
+func (d *HTU21D) readFromReg(reg byte, n int) ([]byte, error) {
+	data := make([]byte, n)
+	if err := d.Bus.ReadFromReg(Address, reg, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func newMeasurement(st, srh uint16) Measurement {
+	m := Measurement{
+		Temperature: -46.85 + 175.72*float64(st)/65536,
+		Humidity:    -6 + 125*float64(srh)/65536,
+	}
+	// The humidity formula goes a little beyond 0% and 100%.
+	if m.Humidity < 0 {
+		m.Humidity = 0
+	} else if m.Humidity > 100 {
+		m.Humidity = 100
+	}
+	m.DewPoint = sensor.DewPoint(m.Temperature, m.Humidity)
+	return m
+}
+
+// Temperature returns the current temperature reading in °C.
+func (d *HTU21D) Temperature() (float64, error) {
+	m, err := d.latest()
+	return m.Temperature, err
+}
+
+// Humidity returns the current relative humidity reading in %.
+func (d *HTU21D) Humidity() (float64, error) {
+	m, err := d.latest()
+	return m.Humidity, err
+}
+
+// DewPoint returns the current dew point in °C.
+func (d *HTU21D) DewPoint() (float64, error) {
+	m, err := d.latest()
+	return m.DewPoint, err
+}
+
+func (d *HTU21D) latest() (Measurement, error) {
+	if r, ok := d.sampler.Latest(); ok {
+		if r.Err != nil {
+			return Measurement{}, r.Err
+		}
+		return r.Value.(Measurement), nil
+	}
+	return d.Measure()
+}
+
+// Serial returns the electronic serial number of the sensor, the data bytes
+// of its two parts in the order they are read. Byte 3 is the model on a
+// Si7021: 0x15. The checksums are not verified.
+func (d *HTU21D) Serial() (uint64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var serial uint64
+	// The first part has a checksum after each byte, the second one after
+	// every two bytes.
+	for _, part := range []struct {
+		cmd   []byte
+		bytes []int
+	}{
+		{cmdSerialA, []int{0, 2, 4, 6}},
+		{cmdSerialB, []int{0, 1, 3, 4}},
+	} {
+		if err := d.Bus.WriteBytes(Address, part.cmd); err != nil {
+			return 0, err
+		}
+		data, err := d.Bus.ReadBytes(Address, part.bytes[3]+2)
+		if err != nil {
+			return 0, err
+		}
+		for _, i := range part.bytes {
+			serial = serial<<8 | uint64(data[i])
+		}
+	}
+	return serial, nil
+}
+
+// Reset resets the sensor, which restores the default resolution.
+func (d *HTU21D) Reset() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.Bus.WriteByte(Address, cmdReset); err != nil {
+		return err
+	}
+	time.Sleep(resetDelay)
+	d.configured = d.resolution == RH12T14
+	return nil
+}
+
+func (d *HTU21D) sample() (interface{}, error) {
+	return d.Measure()
+}
+
+// Readings takes a Measurement every period until ctx is done.
+func (d *HTU21D) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	return sensor.Sample(ctx, period, d.sample)
+}
+
+// Run starts the sensor data acquisition loop, which Temperature, Humidity
+// and DewPoint then return the latest readings of.
+func (d *HTU21D) Run() {
+	d.sampler.Start(time.Duration(d.Poll)*time.Millisecond, d.sample)
+}
+
+// Close stops the data acquisition loop.
+func (d *HTU21D) Close() error {
+	d.sampler.Stop()
+	return nil
+}
+
+var resolutions = map[string]Resolution{"12": RH12T14, "8": RH8T12, "10": RH10T13, "11": RH11T11}
+
+func open(si7021 bool) sensor.Factory {
+	return func(c sensor.Config) (sensor.Device, error) {
+		bus, _, err := c.I2C(Address)
+		if err != nil {
+			return nil, err
+		}
+		d := New(bus)
+		d.si7021 = si7021
+		for k, v := range c.Options {
+			switch k {
+			case "resolution":
+				r, ok := resolutions[v]
+				if !ok {
+					return nil, fmt.Errorf("htu21d: invalid resolution %q, expected 12, 11, 10 or 8", v)
+				}
+				// The resolution is written on the first reading.
+				d.resolution, d.configured = r, r == RH12T14
+			case "master":
+				switch v {
+				case "hold":
+					d.Hold = true
+				case "no-hold":
+					d.Hold = false
+				default:
+					return nil, fmt.Errorf("htu21d: invalid master %q, expected hold or no-hold", v)
+				}
+			default:
+				return nil, fmt.Errorf("htu21d: unknown option %q", k)
+			}
+		}
+		return d, nil
+	}
+}
+
+// The options are resolution (the bits of the humidity: 12, 11, 10 or 8)
+// and master (hold or no-hold).
+func init() {
+	sensor.Register("htu21d", open(false))
+	sensor.Register("si7021", open(true))
+}
@@ -0,0 +1,168 @@
+package htu21d
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+// The examples of the datasheet: 24.7°C and 32.3%.
+var (
+	tempData     = []byte{0x68, 0x3A, 0x7C}
+	humidityData = []byte{0x4E, 0x85, 0x6B}
+)
+
+// fakeBus measures on command, and is busy for busy reads in no hold
+// master mode.
+type fakeBus struct {
+	embd.I2CBus
+	user   byte
+	busy   int
+	last   byte
+	cmds   []byte
+	serial [][]byte
+}
+
+func (b *fakeBus) result(cmd byte) []byte {
+	switch cmd {
+	case cmdHumidityHold, cmdHumidityNoHold:
+		return humidityData
+	case cmdTempHold, cmdTempNoHold, cmdTempFromHumidity:
+		return tempData
+	}
+	return nil
+}
+
+func (b *fakeBus) WriteByte(addr, value byte) error {
+	b.cmds = append(b.cmds, value)
+	b.last = value
+	return nil
+}
+
+func (b *fakeBus) WriteBytes(addr byte, value []byte) error {
+	b.cmds = append(b.cmds, value[0])
+	return nil
+}
+
+func (b *fakeBus) ReadBytes(addr byte, num int) ([]byte, error) {
+	if len(b.serial) > 0 {
+		data := b.serial[0]
+		b.serial = b.serial[1:]
+		return data, nil
+	}
+	if b.busy > 0 {
+		b.busy--
+		return nil, errors.New("nack")
+	}
+	return b.result(b.last), nil
+}
+
+func (b *fakeBus) ReadFromReg(addr, reg byte, value []byte) error {
+	b.cmds = append(b.cmds, reg)
+	copy(value, b.result(reg))
+	return nil
+}
+
+func (b *fakeBus) ReadByteFromReg(addr, reg byte) (byte, error) {
+	b.cmds = append(b.cmds, reg)
+	return b.user, nil
+}
+
+func (b *fakeBus) WriteByteToReg(addr, reg, value byte) error {
+	b.cmds = append(b.cmds, reg)
+	b.user = value
+	return nil
+}
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		name string
+		d    func(bus embd.I2CBus) *HTU21D
+		hold bool
+		cmds []byte
+	}{
+		{"htu21d", New, false, []byte{cmdHumidityNoHold, cmdTempNoHold}},
+		{"htu21d hold", New, true, []byte{cmdHumidityHold, cmdTempHold}},
+		{"si7021", NewSi7021, false, []byte{cmdHumidityNoHold, cmdTempFromHumidity}},
+	}
+	for _, test := range tests {
+		bus := &fakeBus{busy: 2}
+		d := test.d(bus)
+		d.Hold = test.hold
+		m, err := d.Measure()
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if math.Abs(m.Temperature-24.69) > 0.01 || math.Abs(m.Humidity-32.34) > 0.01 || math.Abs(m.DewPoint-7.03) > 0.01 {
+			t.Errorf("%v: got %+v", test.name, m)
+		}
+		if !reflect.DeepEqual(bus.cmds, test.cmds) {
+			t.Errorf("%v: got commands %#x, want %#x", test.name, bus.cmds, test.cmds)
+		}
+	}
+
+	bus := &fakeBus{busy: maxRetries + 1}
+	if _, err := New(bus).Measure(); err == nil {
+		t.Error("expected an error from a busy sensor")
+	}
+}
+
+func TestCRC(t *testing.T) {
+	for _, data := range [][]byte{tempData, humidityData, {0xDC, 0x79}} {
+		if crc := crc8(data[:len(data)-1]); crc != data[len(data)-1] {
+			t.Errorf("crc8(%#x): got %#x", data[:len(data)-1], crc)
+		}
+	}
+}
+
+func TestSetResolution(t *testing.T) {
+	bus := &fakeBus{user: 0x02}
+	d := New(bus)
+	if err := d.SetResolution(RH11T11); err != nil {
+		t.Fatal(err)
+	}
+	if bus.user != 0x83 {
+		t.Errorf("got user register %#x, want 0x83", bus.user)
+	}
+	if err := d.SetResolution(0x02); err == nil {
+		t.Error("expected an error for an invalid resolution")
+	}
+}
+
+func TestSerial(t *testing.T) {
+	bus := &fakeBus{serial: [][]byte{
+		{0x01, 0, 0x23, 0, 0x45, 0, 0x67, 0},
+		{0x15, 0xFF, 0, 0xB0, 0xFF, 0},
+	}}
+	serial, err := NewSi7021(bus).Serial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial != 0x0123456715FFB0FF {
+		t.Errorf("got serial %#x", serial)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	bus := &fakeBus{}
+	d, err := sensor.New("si7021", sensor.Config{Bus: bus, Options: map[string]string{"resolution": "8", "master": "hold"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := d.(*HTU21D); !d.si7021 || !d.Hold || d.resolution != RH8T12 || d.configured {
+		t.Errorf("got %+v", d)
+	}
+	if len(bus.cmds) != 0 {
+		t.Errorf("Open accessed the bus: %#x", bus.cmds)
+	}
+	for _, opts := range []map[string]string{{"resolution": "14"}, {"master": "yes"}, {"heater": "on"}} {
+		if _, err := sensor.New("htu21d", sensor.Config{Bus: bus, Options: opts}); err == nil {
+			t.Errorf("%v: expected an error", opts)
+		}
+	}
+}
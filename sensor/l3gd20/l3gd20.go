@@ -2,6 +2,7 @@
 package l3gd20
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sync"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
 )
 
 const (
@@ -121,7 +123,8 @@ type L3GD20 struct {
 	xac, yac, zac axisCalibration
 
 	orientations chan Orientation
-	closing      chan chan struct{}
+	cancel       context.CancelFunc
+	done         chan struct{}
 }
 
 // New creates a new L3GD20 interface. The bus variable controls
@@ -299,6 +302,15 @@ func (d *L3GD20) OrientationDelta() (float64, float64, float64, error) {
 	return d.measureOrientationDelta()
 }
 
+// AngularVelocity returns the calibrated angular velocity in rad/s.
+func (d *L3GD20) AngularVelocity() (sensor.Vector, error) {
+	dx, dy, dz, err := d.measureOrientationDelta()
+	if err != nil {
+		return sensor.Vector{}, err
+	}
+	return sensor.Vector{X: dx * dpsToRps, Y: dy * dpsToRps, Z: dz * dpsToRps}, nil
+}
+
 // Temperature returns the current temperature reading.
 func (d *L3GD20) Temperature() (int, error) {
 	if err := d.setup(); err != nil {
@@ -324,53 +336,70 @@ func (d *L3GD20) Orientations() (<-chan Orientation, error) {
 	return d.orientations, nil
 }
 
+// Readings integrates the angular velocity every period until ctx is done.
+// The values are Orientations in degrees, relative to the first reading.
+func (d *L3GD20) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	var o Orientation
+	var last time.Time
+	return sensor.Sample(ctx, period, func() (interface{}, error) {
+		dx, dy, dz, err := d.measureOrientationDelta()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if !last.IsZero() {
+			dt := now.Sub(last).Seconds()
+			o.X += dx * dt
+			o.Y += dy * dt
+			o.Z += dz * dt
+		}
+		last = now
+		return o, nil
+	})
+}
+
 // Start starts the data acquisition loop.
 func (d *L3GD20) Start() error {
 	if err := d.setup(); err != nil {
 		return err
 	}
 
-	d.closing = make(chan chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel, d.done = cancel, make(chan struct{})
+	readings := d.Readings(ctx, time.Duration(math.Floor(pollDelay))*time.Microsecond)
 
-	go func() {
-		var x, y, z float64
-		var orientations chan Orientation
-
-		timer := time.Tick(time.Duration(math.Floor(pollDelay)) * time.Microsecond)
+	go func(orientations chan Orientation, done chan struct{}) {
+		defer close(done)
+		defer close(orientations)
 
+		var pending Orientation
+		var out chan Orientation
 		for {
 			select {
-			case <-timer:
-				dx, dy, dz, err := d.measureOrientationDelta()
-				if err != nil {
-					glog.Errorf("l3gd20: %v", err)
-				} else {
-					x += dx * mult
-					y += dy * mult
-					z += dz * mult
-					orientations = d.orientations
+			case r, ok := <-readings:
+				if !ok {
+					return
+				}
+				if r.Err != nil {
+					glog.Errorf("l3gd20: %v", r.Err)
+					continue
 				}
-			case orientations <- Orientation{x, y, z}:
-				orientations = nil
-			case waitc := <-d.closing:
-				waitc <- struct{}{}
-				close(d.orientations)
-				return
+				pending, out = r.Value.(Orientation), orientations
+			case out <- pending:
+				out = nil
 			}
-
 		}
-	}()
+	}(d.orientations, d.done)
 
 	return nil
 }
 
 // Stop the data acquisition loop.
 func (d *L3GD20) Stop() error {
-	if d.closing != nil {
-		waitc := make(chan struct{})
-		d.closing <- waitc
-		<-waitc
-		d.closing = nil
+	if d.cancel != nil {
+		d.cancel()
+		<-d.done
+		d.cancel = nil
 	}
 	if err := d.Bus.WriteByteToReg(address, ctrlReg1, ctrlReg1Finished); err != nil {
 		return err
@@ -383,3 +412,21 @@ func (d *L3GD20) Stop() error {
 func (d *L3GD20) Close() error {
 	return d.Stop()
 }
+
+var ranges = map[string]*Range{"": R250DPS, "250": R250DPS, "500": R500DPS, "2000": R2000DPS}
+
+// The "range" option selects the full scale in dps: 250 (the default), 500
+// or 2000.
+func init() {
+	sensor.Register("l3gd20", func(c sensor.Config) (sensor.Device, error) {
+		bus, _, err := c.I2C(address)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := ranges[c.Options["range"]]
+		if !ok {
+			return nil, fmt.Errorf("l3gd20: invalid range %q", c.Options["range"])
+		}
+		return New(bus, r), nil
+	})
+}
@@ -2,12 +2,14 @@
 package lsm303
 
 import (
+	"context"
 	"math"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
 )
 
 const (
@@ -39,6 +41,10 @@ const (
 	magDataSignal = 0x02
 	magData       = 0x03
 
+	magGainXY    = 1100 // LSB/gauss at ±1.3 gauss
+	magGainZ     = 980
+	gaussToTesla = 1e-4
+
 	pollDelay = 250
 )
 
@@ -50,9 +56,7 @@ type LSM303 struct {
 	initialized bool
 	mu          sync.RWMutex
 
-	headings chan float64
-
-	quit chan struct{}
+	sampler sensor.Sampler
 }
 
 // New creates a new LSM303 interface. The bus variable controls
@@ -110,52 +114,69 @@ func (d *LSM303) measureHeading() (float64, error) {
 	return heading, nil
 }
 
+// MagneticField returns the magnetic flux density in T, at the default
+// gain of ±1.3 gauss.
+func (d *LSM303) MagneticField() (sensor.Vector, error) {
+	if err := d.setup(); err != nil {
+		return sensor.Vector{}, err
+	}
+
+	data := make([]byte, 6)
+	if err := d.Bus.ReadFromReg(magAddress, magData, data); err != nil {
+		return sensor.Vector{}, err
+	}
+
+	// The output registers are ordered X, Z, Y.
+	x := int16(data[0])<<8 | int16(data[1])
+	z := int16(data[2])<<8 | int16(data[3])
+	y := int16(data[4])<<8 | int16(data[5])
+
+	return sensor.Vector{
+		X: float64(x) / magGainXY * gaussToTesla,
+		Y: float64(y) / magGainXY * gaussToTesla,
+		Z: float64(z) / magGainZ * gaussToTesla,
+	}, nil
+}
+
 // Heading returns the current heading [0, 360).
 func (d *LSM303) Heading() (float64, error) {
-	select {
-	case heading := <-d.headings:
-		return heading, nil
-	default:
-		glog.V(2).Infof("lsm303: no headings available... measuring")
-		return d.measureHeading()
+	if r, ok := d.sampler.Latest(); ok {
+		if r.Err != nil {
+			return 0, r.Err
+		}
+		return r.Value.(float64), nil
 	}
+	glog.V(2).Infof("lsm303: no headings available... measuring")
+	return d.measureHeading()
 }
 
-// Run starts the sensor data acquisition loop.
-func (d *LSM303) Run() error {
-	go func() {
-		d.quit = make(chan struct{})
-
-		timer := time.Tick(time.Duration(d.Poll) * time.Millisecond)
-
-		var heading float64
-
-		for {
-			select {
-			case <-timer:
-				h, err := d.measureHeading()
-				if err == nil {
-					heading = h
-				}
-				if err == nil && d.headings == nil {
-					d.headings = make(chan float64)
-				}
-			case d.headings <- heading:
-			case <-d.quit:
-				d.headings = nil
-				return
-			}
+func (d *LSM303) sample() (interface{}, error) {
+	return d.measureHeading()
+}
 
-		}
-	}()
+// Readings measures the heading every period until ctx is done.
+func (d *LSM303) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	return sensor.Sample(ctx, period, d.sample)
+}
 
+// Run starts the sensor data acquisition loop.
+func (d *LSM303) Run() error {
+	d.sampler.Start(time.Duration(d.Poll)*time.Millisecond, d.sample)
 	return nil
 }
 
 // Close the sensor data acquisition loop and put the LSM303 into sleep mode.
 func (d *LSM303) Close() error {
-	if d.quit != nil {
-		d.quit <- struct{}{}
-	}
+	d.sampler.Stop()
 	return d.Bus.WriteByteToReg(magAddress, magModeReg, MagSleep)
 }
+
+func init() {
+	sensor.Register("lsm303", func(c sensor.Config) (sensor.Device, error) {
+		bus, _, err := c.I2C(magAddress)
+		if err != nil {
+			return nil, err
+		}
+		return New(bus), nil
+	})
+}
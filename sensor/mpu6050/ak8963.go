@@ -0,0 +1,137 @@
+// AK8963 magnetometer of the MPU-9250.
+
+package mpu6050
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+const (
+	// magAddress is the I2C address of the AK8963, reached through the
+	// I2C bypass of the MPU-9250.
+	magAddress = 0x0C
+
+	magWIA   = 0x00
+	magST1   = 0x02
+	magCNTL1 = 0x0A
+	magASA   = 0x10
+
+	magID = 0x48
+
+	magPowerDown     = 0x00
+	magFuseROM       = 0x0F
+	magContinuous100 = 0x16 // 100Hz, 16 bit output
+
+	magDataReady = 0x01
+	magOverflow  = 0x08
+
+	// magScale is the value of the least significant bit in T, with a 16
+	// bit output.
+	magScale = 0.15e-6
+
+	intBypassEnable = 0x02
+
+	magModeDelay = 10 * time.Millisecond
+)
+
+// ErrMagOverflow is returned when the magnetic field exceeds the range of
+// the magnetometer.
+var ErrMagOverflow = errors.New("mpu6050: magnetic sensor overflow")
+
+type ak8963 struct {
+	bus embd.I2CBus
+
+	// adjust are the sensitivity adjustments of the axes.
+	adjust [3]float64
+	last   sensor.Vector
+}
+
+// setupMag enables the I2C bypass, and starts the AK8963 in continuous
+// mode. d.mu must be held.
+func (d *MPU6050) setupMag() error {
+	d.intPinCfg |= intBypassEnable
+	if err := d.write(regIntPinCfg, d.intPinCfg); err != nil {
+		return err
+	}
+	m := &ak8963{bus: d.Bus}
+	id, err := m.bus.ReadByteFromReg(magAddress, magWIA)
+	if err != nil {
+		return err
+	}
+	if id != magID {
+		return fmt.Errorf("mpu6050: unexpected magnetometer identity %#02x", id)
+	}
+	if err := m.setMode(magFuseROM); err != nil {
+		return err
+	}
+	asa := make([]byte, 3)
+	if err := m.bus.ReadFromReg(magAddress, magASA, asa); err != nil {
+		return err
+	}
+	for i, a := range asa {
+		m.adjust[i] = (float64(a)-128)/256 + 1
+	}
+	if err := m.setMode(magPowerDown); err != nil {
+		return err
+	}
+	if err := m.setMode(magContinuous100); err != nil {
+		return err
+	}
+	d.mag = m
+	return nil
+}
+
+func (m *ak8963) setMode(mode byte) error {
+	err := m.bus.WriteByteToReg(magAddress, magCNTL1, mode)
+	time.Sleep(magModeDelay)
+	return err
+}
+
+func (m *ak8963) powerDown() error {
+	return m.setMode(magPowerDown)
+}
+
+// measure returns the last magnetic field in T, in the axes of the
+// accelerometer: those of the AK8963 have X and Y swapped and Z inverted.
+func (m *ak8963) measure() (sensor.Vector, error) {
+	// Reading ST2 after the data releases them for the next measurement.
+	data := make([]byte, 8)
+	if err := m.bus.ReadFromReg(magAddress, magST1, data); err != nil {
+		return sensor.Vector{}, err
+	}
+	if data[0]&magDataReady == 0 {
+		return m.last, nil
+	}
+	if data[7]&magOverflow != 0 {
+		return sensor.Vector{}, ErrMagOverflow
+	}
+	axis := func(i int) float64 {
+		v := int16(uint16(data[1+2*i]) | uint16(data[2+2*i])<<8)
+		return float64(v) * m.adjust[i] * magScale
+	}
+	m.last = sensor.Vector{X: axis(1), Y: axis(0), Z: -axis(2)}
+	return m.last, nil
+}
+
+// MPU9250 represents an InvenSense MPU-9250 sensor, a MPU-6050 with a
+// magnetometer.
+type MPU9250 struct {
+	*MPU6050
+}
+
+// NewMPU9250 returns a handle to a MPU-9250 at the given address, Address
+// or AltAddress, with the default settings.
+func NewMPU9250(bus embd.I2CBus, addr byte) *MPU9250 {
+	return &MPU9250{newMPU(bus, addr, mpu9250)}
+}
+
+// MagneticField returns the current magnetic flux density in T.
+func (d *MPU9250) MagneticField() (sensor.Vector, error) {
+	m, err := d.latest()
+	return m.Mag, err
+}
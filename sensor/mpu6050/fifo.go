@@ -0,0 +1,222 @@
+// FIFO and data ready interrupt.
+
+package mpu6050
+
+import (
+	"errors"
+
+	"github.com/kidoman/embd"
+)
+
+const (
+	userFIFOEnable = 0x40
+	userFIFOReset  = 0x04
+
+	intFIFOOverflow = 0x10
+	intDataReady    = 0x01
+
+	// intActiveHighPulse makes the INT pin active high, push-pull, with
+	// 50µs pulses cleared by any read.
+	intActiveHighPulse = 0x10
+
+	// fifoBurst is the maximum length of a burst read of the FIFO.
+	fifoBurst = 252
+)
+
+// FIFOSource is a set of measurements stored in the FIFO.
+type FIFOSource byte
+
+const (
+	FIFOAccel FIFOSource = 0x08
+	FIFOGyro  FIFOSource = 0x70
+	FIFOTemp  FIFOSource = 0x80
+)
+
+// frameSize returns the size of the set of measurements of a sample.
+func (s FIFOSource) frameSize() int {
+	n := 0
+	if s&FIFOAccel != 0 {
+		n += 6
+	}
+	if s&FIFOTemp != 0 {
+		n += 2
+	}
+	if s&FIFOGyro != 0 {
+		n += 6
+	}
+	return n
+}
+
+// ErrFIFOOverflow is returned when the FIFO overflowed, the oldest samples
+// being lost. The FIFO is reset.
+var ErrFIFOOverflow = errors.New("mpu6050: fifo overflow")
+
+// EnableFIFO resets the FIFO, and starts storing the sources at the sample
+// rate.
+func (d *MPU6050) EnableFIFO(sources FIFOSource) error {
+	if sources&^(FIFOAccel|FIFOGyro|FIFOTemp) != 0 || sources == 0 {
+		return errors.New("mpu6050: invalid fifo sources")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.setup(); err != nil {
+		return err
+	}
+	if err := d.resetFIFO(); err != nil {
+		return err
+	}
+	if err := d.write(regFIFOEn, byte(sources)); err != nil {
+		return err
+	}
+	d.fifo = sources
+	return nil
+}
+
+// resetFIFO empties the FIFO, and enables it. d.mu must be held.
+func (d *MPU6050) resetFIFO() error {
+	if err := d.write(regUserCtrl, userFIFOReset); err != nil {
+		return err
+	}
+	return d.write(regUserCtrl, userFIFOEnable)
+}
+
+// DisableFIFO stops storing the measurements in the FIFO.
+func (d *MPU6050) DisableFIFO() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.fifo == 0 {
+		return nil
+	}
+	if err := d.write(regFIFOEn, 0); err != nil {
+		return err
+	}
+	d.fifo = 0
+	return d.write(regUserCtrl, 0)
+}
+
+// ReadFIFO reads the samples stored in the FIFO, oldest first, in burst
+// reads. The measurements which are not sources of the FIFO are zero.
+func (d *MPU6050) ReadFIFO() ([]Measurement, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.fifo == 0 {
+		return nil, errors.New("mpu6050: fifo not enabled")
+	}
+	status, err := d.Bus.ReadByteFromReg(d.addr, regIntStatus)
+	if err != nil {
+		return nil, err
+	}
+	if status&intFIFOOverflow != 0 {
+		if err := d.resetFIFO(); err != nil {
+			return nil, err
+		}
+		return nil, ErrFIFOOverflow
+	}
+	count, err := d.read(regFIFOCount, 2)
+	if err != nil {
+		return nil, err
+	}
+	size := d.fifo.frameSize()
+	frames := int(uint16(count[0])<<8|uint16(count[1])) / size
+
+	// Whole frames are read, for the FIFO to stay aligned on them.
+	burst := fifoBurst / size * size
+	data := make([]byte, 0, frames*size)
+	for remaining := frames * size; remaining > 0; {
+		n := remaining
+		if n > burst {
+			n = burst
+		}
+		b, err := d.read(regFIFORW, n)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b...)
+		remaining -= n
+	}
+
+	ms := make([]Measurement, frames)
+	for i := range ms {
+		frame := data[i*size : (i+1)*size]
+		if d.fifo&FIFOAccel != 0 {
+			ms[i].Accel = d.accel(frame)
+			frame = frame[6:]
+		}
+		if d.fifo&FIFOTemp != 0 {
+			ms[i].Temperature = d.temperature(frame)
+			frame = frame[2:]
+		}
+		if d.fifo&FIFOGyro != 0 {
+			ms[i].Gyro = d.gyro(frame)
+		}
+	}
+	return ms, nil
+}
+
+// WatchDataReady calls handler with a new Measurement each time the sensor
+// signals new data, at the sample rate, on its INT pin wired to pin.
+func (d *MPU6050) WatchDataReady(pin embd.DigitalPin, handler func(Measurement, error)) error {
+	if err := d.StopWatching(); err != nil {
+		return err
+	}
+	if err := d.setupInterrupt(); err != nil {
+		return err
+	}
+	if err := pin.SetDirection(embd.In); err != nil {
+		return err
+	}
+	err := pin.Watch(embd.EdgeRising, func(embd.DigitalPin) {
+		handler(d.Measure())
+	})
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	err = d.write(regIntEnable, intDataReady)
+	if err == nil {
+		d.watched = pin
+	}
+	d.mu.Unlock()
+
+	if err != nil {
+		pin.StopWatching()
+	}
+	return err
+}
+
+// setupInterrupt configures the INT pin, keeping the I2C bypass.
+func (d *MPU6050) setupInterrupt() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.setup(); err != nil {
+		return err
+	}
+	d.intPinCfg = d.intPinCfg&intBypassEnable | intActiveHighPulse
+	return d.write(regIntPinCfg, d.intPinCfg)
+}
+
+// StopWatching disables the data ready interrupt, and stops watching its
+// pin.
+func (d *MPU6050) StopWatching() error {
+	d.mu.Lock()
+	pin := d.watched
+	var err error
+	if pin != nil {
+		if err = d.write(regIntEnable, 0); err == nil {
+			d.watched = nil
+		}
+	}
+	d.mu.Unlock()
+
+	// The handler may be waiting for the lock.
+	if pin == nil || err != nil {
+		return err
+	}
+	return pin.StopWatching()
+}
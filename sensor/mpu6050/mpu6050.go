@@ -0,0 +1,536 @@
+// Package mpu6050 allows interfacing with the InvenSense MPU-6050 and MPU-9250
+// motion sensors through I2C.
+//
+// Both sensors measure the acceleration, the angular velocity and their die
+// temperature. The MPU-9250 also embeds an AK8963 magnetometer, which the
+// MPU9250 type reads through the I2C bypass of the sensor. The readings are
+// in SI units: m/s², rad/s, T and °C.
+package mpu6050
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+const (
+	// Address is the I2C address of the sensor when its AD0 pin is low.
+	Address = 0x68
+	// AltAddress is the I2C address of the sensor when its AD0 pin is high.
+	AltAddress = 0x69
+
+	regSelfTestX      = 0x0D
+	regSelfTestA      = 0x10
+	regSmplrtDiv      = 0x19
+	regConfig         = 0x1A
+	regGyroConfig     = 0x1B
+	regAccelConfig    = 0x1C
+	regAccelConfig2   = 0x1D // MPU-9250 only
+	regFIFOEn         = 0x23
+	regIntPinCfg      = 0x37
+	regIntEnable      = 0x38
+	regIntStatus      = 0x3A
+	regAccelOut       = 0x3B
+	regUserCtrl       = 0x6A
+	regPwrMgmt1       = 0x6B
+	regFIFOCount      = 0x72
+	regFIFORW         = 0x74
+	regWhoAmI         = 0x75
+	regSelfTestXGyro  = 0x00 // MPU-9250 only
+	regSelfTestXAccel = 0x0D // MPU-9250 only
+
+	pwrReset = 0x80
+	pwrSleep = 0x40
+	pwrPLL   = 0x01 // clocked by the X gyroscope
+
+	resetDelay = 100 * time.Millisecond
+
+	// g is the standard acceleration of gravity in m/s².
+	g = 9.80665
+
+	pollDelay = 100
+)
+
+// model is the model of the sensor.
+type model int
+
+const (
+	mpu6050 model = iota
+	mpu9250
+)
+
+func (m model) String() string {
+	if m == mpu9250 {
+		return "MPU-9250"
+	}
+	return "MPU-6050"
+}
+
+// whoAmI tells whether the identity is that of the model. The MPU-9255 is
+// a MPU-9250 with another identity.
+func (m model) whoAmI(id byte) bool {
+	if m == mpu9250 {
+		return id == 0x71 || id == 0x73
+	}
+	return id == 0x68
+}
+
+// AccelRange is the full scale range of the accelerometer.
+type AccelRange byte
+
+const (
+	Accel2G AccelRange = iota
+	Accel4G
+	Accel8G
+	Accel16G
+)
+
+// scale returns the value of the least significant bit in m/s².
+func (r AccelRange) scale() float64 {
+	return g / float64(int(16384)>>r)
+}
+
+// GyroRange is the full scale range of the gyroscope.
+type GyroRange byte
+
+const (
+	Gyro250DPS GyroRange = iota
+	Gyro500DPS
+	Gyro1000DPS
+	Gyro2000DPS
+)
+
+// scale returns the value of the least significant bit in rad/s.
+func (r GyroRange) scale() float64 {
+	return math.Pi / 180 / (131 / float64(uint(1)<<r))
+}
+
+// DLPF is the setting of the digital low pass filter of the accelerometer
+// and the gyroscope, named after the bandwidth of the MPU-6050
+// accelerometer. The other bandwidths are close to it.
+type DLPF byte
+
+const (
+	DLPF260Hz DLPF = iota
+	DLPF184Hz
+	DLPF94Hz
+	DLPF44Hz
+	DLPF21Hz
+	DLPF10Hz
+	DLPF5Hz
+)
+
+// Settings configure the measurements.
+type Settings struct {
+	Accel AccelRange
+	Gyro  GyroRange
+	DLPF  DLPF
+
+	// Divider divides the output rate of the gyroscope, 8kHz without the
+	// low pass filter and 1kHz with it, into the sample rate: the rate of
+	// the data registers, the FIFO and the data ready interrupt.
+	Divider byte
+}
+
+// DefaultSettings measure ±2g and ±250°/s, with a bandwidth of 44Hz at
+// 100Hz.
+var DefaultSettings = Settings{Accel: Accel2G, Gyro: Gyro250DPS, DLPF: DLPF44Hz, Divider: 9}
+
+// SampleRate returns the sample rate in Hz.
+func (s Settings) SampleRate() float64 {
+	rate := 1000.0
+	if s.DLPF == DLPF260Hz {
+		rate = 8000
+	}
+	return rate / (1 + float64(s.Divider))
+}
+
+func (s Settings) validate() error {
+	if s.Accel > Accel16G {
+		return fmt.Errorf("mpu6050: invalid accelerometer range %v", s.Accel)
+	}
+	if s.Gyro > Gyro2000DPS {
+		return fmt.Errorf("mpu6050: invalid gyroscope range %v", s.Gyro)
+	}
+	if s.DLPF > DLPF5Hz {
+		return fmt.Errorf("mpu6050: invalid low pass filter %v", s.DLPF)
+	}
+	return nil
+}
+
+// Measurement is a sample of all the readings of the sensor.
+type Measurement struct {
+	Accel       sensor.Vector // m/s²
+	Gyro        sensor.Vector // rad/s
+	Mag         sensor.Vector // T, of the MPU-9250
+	Temperature float64       // °C
+}
+
+// Offsets are subtracted from the readings, to compensate the bias of the
+// sensor.
+type Offsets struct {
+	Accel sensor.Vector // m/s²
+	Gyro  sensor.Vector // rad/s
+}
+
+// MPU6050 represents an InvenSense MPU-6050 or MPU-9250 sensor.
+type MPU6050 struct {
+	Bus embd.I2CBus
+
+	// Poll is the period of the data acquisition loop in ms.
+	Poll int
+
+	addr  byte
+	model model
+
+	mu          sync.Mutex
+	initialized bool
+	settings    Settings
+	offsets     Offsets
+	fifo        FIFOSource
+	intPinCfg   byte
+	mag         *ak8963
+
+	watched embd.DigitalPin
+
+	sampler sensor.Sampler
+}
+
+// New returns a handle to a MPU-6050 at the given address, Address or
+// AltAddress, with the default settings.
+func New(bus embd.I2CBus, addr byte) *MPU6050 {
+	return newMPU(bus, addr, mpu6050)
+}
+
+func newMPU(bus embd.I2CBus, addr byte, m model) *MPU6050 {
+	return &MPU6050{Bus: bus, Poll: pollDelay, addr: addr, model: m, settings: DefaultSettings}
+}
+
+func (d *MPU6050) write(reg, value byte) error {
+	return d.Bus.WriteByteToReg(d.addr, reg, value)
+}
+
+func (d *MPU6050) read(reg byte, n int) ([]byte, error) {
+	data := make([]byte, n)
+	if err := d.Bus.ReadFromReg(d.addr, reg, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// setup identifies and wakes the sensor up, and applies the settings. d.mu
+// must be held.
+func (d *MPU6050) setup() error {
+	if d.initialized {
+		return nil
+	}
+	id, err := d.Bus.ReadByteFromReg(d.addr, regWhoAmI)
+	if err != nil {
+		return err
+	}
+	if !d.model.whoAmI(id) {
+		return fmt.Errorf("mpu6050: unexpected identity %#02x for a %v", id, d.model)
+	}
+	if err := d.write(regPwrMgmt1, pwrReset); err != nil {
+		return err
+	}
+	time.Sleep(resetDelay)
+	if err := d.write(regPwrMgmt1, pwrPLL); err != nil {
+		return err
+	}
+	if err := d.configure(d.settings); err != nil {
+		return err
+	}
+	d.intPinCfg = 0
+	if d.model == mpu9250 {
+		if err := d.setupMag(); err != nil {
+			return err
+		}
+	}
+	d.initialized = true
+	return nil
+}
+
+// configure writes the settings. d.mu must be held.
+func (d *MPU6050) configure(s Settings) error {
+	if err := d.write(regSmplrtDiv, s.Divider); err != nil {
+		return err
+	}
+	if err := d.write(regConfig, byte(s.DLPF)); err != nil {
+		return err
+	}
+	if err := d.write(regGyroConfig, byte(s.Gyro)<<3); err != nil {
+		return err
+	}
+	if err := d.write(regAccelConfig, byte(s.Accel)<<3); err != nil {
+		return err
+	}
+	if d.model == mpu9250 {
+		// The accelerometer of the MPU-9250 has its own filter.
+		if err := d.write(regAccelConfig2, byte(s.DLPF)); err != nil {
+			return err
+		}
+	}
+	d.settings = s
+	return nil
+}
+
+// Configure changes the settings.
+func (d *MPU6050) Configure(s Settings) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.initialized {
+		d.settings = s
+		return d.setup()
+	}
+	return d.configure(s)
+}
+
+// Settings returns the current settings.
+func (d *MPU6050) Settings() Settings {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.settings
+}
+
+// Offsets returns the offsets subtracted from the readings.
+func (d *MPU6050) Offsets() Offsets {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.offsets
+}
+
+// SetOffsets sets the offsets subtracted from the readings, e.g. those of a
+// previous Calibrate.
+func (d *MPU6050) SetOffsets(o Offsets) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.offsets = o
+}
+
+func word(data []byte) int16 {
+	return int16(uint16(data[0])<<8 | uint16(data[1]))
+}
+
+func (d *MPU6050) accel(data []byte) sensor.Vector {
+	scale, o := d.settings.Accel.scale(), d.offsets.Accel
+	return sensor.Vector{
+		X: float64(word(data[0:]))*scale - o.X,
+		Y: float64(word(data[2:]))*scale - o.Y,
+		Z: float64(word(data[4:]))*scale - o.Z,
+	}
+}
+
+func (d *MPU6050) gyro(data []byte) sensor.Vector {
+	scale, o := d.settings.Gyro.scale(), d.offsets.Gyro
+	return sensor.Vector{
+		X: float64(word(data[0:]))*scale - o.X,
+		Y: float64(word(data[2:]))*scale - o.Y,
+		Z: float64(word(data[4:]))*scale - o.Z,
+	}
+}
+
+func (d *MPU6050) temperature(data []byte) float64 {
+	if d.model == mpu9250 {
+		return float64(word(data))/333.87 + 21
+	}
+	return float64(word(data))/340 + 36.53
+}
+
+// measure reads the data registers. d.mu must be held.
+func (d *MPU6050) measure() (Measurement, error) {
+	if err := d.setup(); err != nil {
+		return Measurement{}, err
+	}
+	data, err := d.read(regAccelOut, 14)
+	if err != nil {
+		return Measurement{}, err
+	}
+	m := Measurement{
+		Accel:       d.accel(data[0:6]),
+		Temperature: d.temperature(data[6:8]),
+		Gyro:        d.gyro(data[8:14]),
+	}
+	if d.mag != nil {
+		if m.Mag, err = d.mag.measure(); err != nil {
+			return Measurement{}, err
+		}
+	}
+	return m, nil
+}
+
+// Measure takes a sample of all the readings.
+func (d *MPU6050) Measure() (Measurement, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.measure()
+}
+
+// MeasureQuantities implements sensor.Measurer.
+func (d *MPU6050) MeasureQuantities() (sensor.Quantities, error) {
+	m, err := d.Measure()
+	if err != nil {
+		return sensor.Quantities{}, err
+	}
+	q := sensor.NoQuantities()
+	q.Acceleration, q.AngularVelocity, q.Temperature = m.Accel, m.Gyro, m.Temperature
+	if d.model == mpu9250 {
+		q.MagneticField = m.Mag
+	}
+	return q, nil
+}
+
+func (d *MPU6050) latest() (Measurement, error) {
+	if r, ok := d.sampler.Latest(); ok {
+		if r.Err != nil {
+			return Measurement{}, r.Err
+		}
+		return r.Value.(Measurement), nil
+	}
+	return d.Measure()
+}
+
+// Acceleration returns the current acceleration in m/s².
+func (d *MPU6050) Acceleration() (sensor.Vector, error) {
+	m, err := d.latest()
+	return m.Accel, err
+}
+
+// AngularVelocity returns the current angular velocity in rad/s.
+func (d *MPU6050) AngularVelocity() (sensor.Vector, error) {
+	m, err := d.latest()
+	return m.Gyro, err
+}
+
+// Temperature returns the current die temperature in °C.
+func (d *MPU6050) Temperature() (float64, error) {
+	m, err := d.latest()
+	return m.Temperature, err
+}
+
+func (d *MPU6050) sample() (interface{}, error) {
+	return d.Measure()
+}
+
+// Readings takes a Measurement every period until ctx is done.
+func (d *MPU6050) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	return sensor.Sample(ctx, period, d.sample)
+}
+
+// Run starts the sensor data acquisition loop, which Acceleration,
+// AngularVelocity, Temperature and MagneticField then return the latest
+// readings of.
+func (d *MPU6050) Run() {
+	d.sampler.Start(time.Duration(d.Poll)*time.Millisecond, d.sample)
+}
+
+// Close stops the data acquisition loop and the interrupts, and puts the
+// sensor to sleep.
+func (d *MPU6050) Close() error {
+	d.sampler.Stop()
+	if err := d.StopWatching(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.initialized {
+		return nil
+	}
+	if d.mag != nil {
+		if err := d.mag.powerDown(); err != nil {
+			return err
+		}
+	}
+	d.initialized = false
+	return d.write(regPwrMgmt1, pwrSleep)
+}
+
+// parseSettings reads the settings from the options of the registry:
+// accel-range (2, 4, 8 or 16 g), gyro-range (250, 500, 1000 or 2000 °/s),
+// dlpf (260, 184, 94, 44, 21, 10 or 5 Hz) and rate (the sample rate in Hz).
+func parseSettings(opts map[string]string) (Settings, error) {
+	s := DefaultSettings
+	rate := s.SampleRate()
+	for k, v := range opts {
+		var ok bool
+		switch k {
+		case "accel-range":
+			s.Accel, ok = accelRanges[v]
+		case "gyro-range":
+			s.Gyro, ok = gyroRanges[v]
+		case "dlpf":
+			s.DLPF, ok = dlpfs[v]
+		case "rate":
+			r, err := strconv.ParseFloat(v, 64)
+			rate, ok = r, err == nil && r > 0
+		default:
+			return s, fmt.Errorf("mpu6050: unknown option %q", k)
+		}
+		if !ok {
+			return s, fmt.Errorf("mpu6050: invalid %v %q", k, v)
+		}
+	}
+	s.Divider = 0
+	divider := math.Floor((s.SampleRate() / rate) + 0.5)
+	if divider < 1 || divider > 256 {
+		return s, fmt.Errorf("mpu6050: invalid rate %v, expected %.4g to %v Hz", rate, s.SampleRate()/256, s.SampleRate())
+	}
+	s.Divider = byte(divider - 1)
+	return s, nil
+}
+
+var (
+	accelRanges = map[string]AccelRange{"2": Accel2G, "4": Accel4G, "8": Accel8G, "16": Accel16G}
+	gyroRanges  = map[string]GyroRange{"250": Gyro250DPS, "500": Gyro500DPS, "1000": Gyro1000DPS, "2000": Gyro2000DPS}
+	dlpfs       = map[string]DLPF{
+		"260": DLPF260Hz, "184": DLPF184Hz, "94": DLPF94Hz, "44": DLPF44Hz,
+		"21": DLPF21Hz, "10": DLPF10Hz, "5": DLPF5Hz,
+	}
+)
+
+func init() {
+	sensor.Register("mpu6050", func(c sensor.Config) (sensor.Device, error) {
+		s, err := parseSettings(c.Options)
+		if err != nil {
+			return nil, err
+		}
+		bus, addr, err := c.I2C(Address, AltAddress)
+		if err != nil {
+			return nil, err
+		}
+		// The settings are applied on the first reading.
+		d := New(bus, addr)
+		d.settings = s
+		return d, nil
+	})
+	sensor.Register("mpu9250", func(c sensor.Config) (sensor.Device, error) {
+		s, err := parseSettings(c.Options)
+		if err != nil {
+			return nil, err
+		}
+		bus, addr, err := c.I2C(Address, AltAddress)
+		if err != nil {
+			return nil, err
+		}
+		d := NewMPU9250(bus, addr)
+		d.settings = s
+		return d, nil
+	})
+}
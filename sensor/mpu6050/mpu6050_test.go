@@ -0,0 +1,385 @@
+package mpu6050
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+// fakeBus holds the registers of a sensor at Address and of its
+// magnetometer. The outputs have the self-test responses added when the
+// self-test is enabled.
+type fakeBus struct {
+	embd.I2CBus
+
+	mu              sync.Mutex
+	regs            [128]byte
+	mag             [32]byte
+	fifo            []byte
+	accelST, gyroST [3]int16
+}
+
+func newFakeBus(id byte) *fakeBus {
+	b := &fakeBus{}
+	b.regs[regWhoAmI] = id
+	b.mag[magWIA] = magID
+	return b
+}
+
+func put(data []byte, vs ...int16) {
+	for i, v := range vs {
+		data[2*i], data[2*i+1] = byte(uint16(v)>>8), byte(v)
+	}
+}
+
+// setOutputs sets the raw outputs of the sensor.
+func (b *fakeBus) setOutputs(accel [3]int16, temp int16, gyro [3]int16) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	put(b.regs[regAccelOut:], accel[0], accel[1], accel[2], temp, gyro[0], gyro[1], gyro[2])
+}
+
+func (b *fakeBus) ReadByteFromReg(addr, reg byte) (byte, error) {
+	data := make([]byte, 1)
+	err := b.ReadFromReg(addr, reg, data)
+	return data[0], err
+}
+
+func (b *fakeBus) ReadFromReg(addr, reg byte, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case addr == magAddress:
+		copy(value, b.mag[reg:])
+	case addr != Address:
+		return errors.New("nack")
+	case reg == regFIFORW:
+		if len(value) > len(b.fifo) {
+			return errors.New("fifo underflow")
+		}
+		copy(value, b.fifo)
+		b.fifo = b.fifo[len(value):]
+	case reg == regFIFOCount:
+		put(value, int16(len(b.fifo)))
+	case reg == regAccelOut:
+		copy(value, b.regs[reg:])
+		for i := 0; i < 3; i++ {
+			if b.regs[regAccelConfig]&selfTestEnable != 0 {
+				put(value[2*i:], word(value[2*i:])+b.accelST[i])
+			}
+			if b.regs[regGyroConfig]&selfTestEnable != 0 {
+				put(value[8+2*i:], word(value[8+2*i:])+b.gyroST[i])
+			}
+		}
+	default:
+		copy(value, b.regs[reg:])
+	}
+	return nil
+}
+
+func (b *fakeBus) WriteByteToReg(addr, reg, value byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case addr == magAddress:
+		b.mag[reg] = value
+	case addr != Address:
+		return errors.New("nack")
+	case reg == regPwrMgmt1:
+		b.regs[reg] = value &^ pwrReset
+	case reg == regUserCtrl && value&userFIFOReset != 0:
+		b.fifo = nil
+	default:
+		b.regs[reg] = value
+	}
+	return nil
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func nearVector(a, b sensor.Vector) bool {
+	return near(a.X, b.X) && near(a.Y, b.Y) && near(a.Z, b.Z)
+}
+
+const deg = math.Pi / 180
+
+func TestMeasure(t *testing.T) {
+	bus := newFakeBus(0x68)
+	bus.setOutputs([3]int16{0, 8192, 16384}, -3581, [3]int16{131, -262, 0})
+	d := New(bus, Address)
+
+	m, err := d.Measure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nearVector(m.Accel, sensor.Vector{X: 0, Y: g / 2, Z: g}) {
+		t.Errorf("got acceleration %v", m.Accel)
+	}
+	if !nearVector(m.Gyro, sensor.Vector{X: deg, Y: -2 * deg, Z: 0}) {
+		t.Errorf("got angular velocity %v", m.Gyro)
+	}
+	if math.Abs(m.Temperature-26) > 0.01 {
+		t.Errorf("got temperature %v", m.Temperature)
+	}
+	if bus.regs[regPwrMgmt1] != pwrPLL || bus.regs[regSmplrtDiv] != 9 || bus.regs[regConfig] != 3 {
+		t.Errorf("got pwr_mgmt_1 %#x, smplrt_div %v and config %#x", bus.regs[regPwrMgmt1], bus.regs[regSmplrtDiv], bus.regs[regConfig])
+	}
+
+	if err := d.Configure(Settings{Accel: Accel16G, Gyro: Gyro2000DPS, DLPF: DLPF260Hz, Divider: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if bus.regs[regAccelConfig] != 0x18 || bus.regs[regGyroConfig] != 0x18 {
+		t.Errorf("got accel_config %#x and gyro_config %#x", bus.regs[regAccelConfig], bus.regs[regGyroConfig])
+	}
+	if a, err := d.Acceleration(); err != nil || !near(a.Z, 8*g) {
+		t.Errorf("got acceleration %v, %v at ±16g", a, err)
+	}
+	if r := d.Settings().SampleRate(); r != 1000 {
+		t.Errorf("got sample rate %v", r)
+	}
+	if err := d.Configure(Settings{Accel: 4}); err == nil {
+		t.Error("expected an error for an invalid range")
+	}
+
+	if err := d.Close(); err != nil || bus.regs[regPwrMgmt1] != pwrSleep {
+		t.Errorf("Close: %v, pwr_mgmt_1 %#x", err, bus.regs[regPwrMgmt1])
+	}
+
+	if _, err := New(newFakeBus(0x71), Address).Measure(); err == nil {
+		t.Error("expected an error for a MPU-9250 identity")
+	}
+}
+
+func TestMPU9250(t *testing.T) {
+	bus := newFakeBus(0x71)
+	bus.setOutputs([3]int16{0, 0, 16384}, 0, [3]int16{})
+	bus.mag[magASA], bus.mag[magASA+1], bus.mag[magASA+2] = 176, 128, 128
+	copy(bus.mag[magST1:], []byte{magDataReady, 100, 0, 200, 0, 0x2C, 0x01, 0x10})
+	d := NewMPU9250(bus, Address)
+
+	m, err := d.Measure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(m.Temperature, 21) {
+		t.Errorf("got temperature %v", m.Temperature)
+	}
+	// X and Y are swapped, Z inverted, and X of the AK8963 adjusted.
+	if want := (sensor.Vector{X: 200 * magScale, Y: 100 * 1.1875 * magScale, Z: -300 * magScale}); !nearVector(m.Mag, want) {
+		t.Errorf("got magnetic field %v, want %v", m.Mag, want)
+	}
+	if bus.regs[regIntPinCfg] != intBypassEnable || bus.mag[magCNTL1] != magContinuous100 || bus.regs[regAccelConfig2] != 3 {
+		t.Errorf("got int_pin_cfg %#x, cntl1 %#x and accel_config2 %#x", bus.regs[regIntPinCfg], bus.mag[magCNTL1], bus.regs[regAccelConfig2])
+	}
+
+	// Without new data, the last field is returned.
+	bus.mag[magST1] = 0
+	if f, err := d.MagneticField(); err != nil || f != m.Mag {
+		t.Errorf("got %v, %v without new data", f, err)
+	}
+
+	bus.mag[magST1], bus.mag[magST1+7] = magDataReady, magOverflow
+	if _, err := d.MagneticField(); err != ErrMagOverflow {
+		t.Errorf("got %v, want ErrMagOverflow", err)
+	}
+
+	if err := d.Close(); err != nil || bus.mag[magCNTL1] != magPowerDown {
+		t.Errorf("Close: %v, cntl1 %#x", err, bus.mag[magCNTL1])
+	}
+}
+
+func TestFIFO(t *testing.T) {
+	bus := newFakeBus(0x68)
+	d := New(bus, Address)
+	if _, err := d.ReadFIFO(); err == nil {
+		t.Error("expected an error with the fifo disabled")
+	}
+	if err := d.EnableFIFO(FIFOAccel | FIFOGyro); err != nil {
+		t.Fatal(err)
+	}
+	if bus.regs[regFIFOEn] != 0x78 || bus.regs[regUserCtrl] != userFIFOEnable {
+		t.Errorf("got fifo_en %#x and user_ctrl %#x", bus.regs[regFIFOEn], bus.regs[regUserCtrl])
+	}
+
+	// More frames than a burst, and a partial one.
+	frame := make([]byte, 12)
+	for i := 0; i < 25; i++ {
+		put(frame, int16(i), 0, 16384, int16(-131*i), 0, 0)
+		bus.fifo = append(bus.fifo, frame...)
+	}
+	bus.fifo = append(bus.fifo, frame[:5]...)
+
+	ms, err := d.ReadFIFO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 25 || len(bus.fifo) != 5 {
+		t.Fatalf("got %v samples, %v bytes left", len(ms), len(bus.fifo))
+	}
+	for i, m := range ms {
+		if !near(m.Accel.X, float64(i)*g/16384) || !near(m.Accel.Z, g) || !near(m.Gyro.X, -float64(i)*deg) || m.Temperature != 0 {
+			t.Errorf("sample %v: got %+v", i, m)
+		}
+	}
+
+	bus.regs[regIntStatus] = intFIFOOverflow
+	if _, err := d.ReadFIFO(); err != ErrFIFOOverflow || len(bus.fifo) != 0 {
+		t.Errorf("got %v with %v bytes left, want ErrFIFOOverflow and a reset", err, len(bus.fifo))
+	}
+
+	if err := d.DisableFIFO(); err != nil || bus.regs[regFIFOEn] != 0 || bus.regs[regUserCtrl] != 0 {
+		t.Errorf("DisableFIFO: %v, fifo_en %#x and user_ctrl %#x", err, bus.regs[regFIFOEn], bus.regs[regUserCtrl])
+	}
+}
+
+type fakePin struct {
+	embd.DigitalPin
+	handler func(embd.DigitalPin)
+}
+
+func (p *fakePin) SetDirection(dir embd.Direction) error { return nil }
+
+func (p *fakePin) Watch(edge embd.Edge, handler func(embd.DigitalPin)) error {
+	if edge != embd.EdgeRising {
+		return errors.New("unexpected edge")
+	}
+	p.handler = handler
+	return nil
+}
+
+func (p *fakePin) StopWatching() error {
+	p.handler = nil
+	return nil
+}
+
+func TestWatchDataReady(t *testing.T) {
+	bus := newFakeBus(0x71)
+	bus.mag[magASA], bus.mag[magASA+1], bus.mag[magASA+2] = 128, 128, 128
+	bus.setOutputs([3]int16{0, 0, 16384}, 0, [3]int16{})
+	d := NewMPU9250(bus, Address)
+	pin := &fakePin{}
+
+	var got []Measurement
+	err := d.WatchDataReady(pin, func(m Measurement, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		got = append(got, m)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bus.regs[regIntEnable] != intDataReady || bus.regs[regIntPinCfg] != intActiveHighPulse|intBypassEnable {
+		t.Errorf("got int_enable %#x and int_pin_cfg %#x", bus.regs[regIntEnable], bus.regs[regIntPinCfg])
+	}
+	pin.handler(pin)
+	pin.handler(pin)
+	if len(got) != 2 || !near(got[1].Accel.Z, g) {
+		t.Errorf("got %+v", got)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pin.handler != nil || bus.regs[regIntEnable] != 0 {
+		t.Errorf("Close: still watching, int_enable %#x", bus.regs[regIntEnable])
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	tests := []struct {
+		name            string
+		id              byte
+		codes           map[byte]byte
+		accelST, gyroST [3]int16
+		passed          bool
+	}{
+		// Codes of 16: a factory trim of 2290.8 for the accelerometer and
+		// 6429.8 for the gyroscope.
+		{"mpu6050", 0x68, map[byte]byte{0x0D: 0x90, 0x0E: 0x90, 0x0F: 0x90, 0x10: 0},
+			[3]int16{2300, 2300, 2300}, [3]int16{6400, -6400, 6400}, true},
+		{"mpu6050 failing gyro", 0x68, map[byte]byte{0x0D: 0x90, 0x0E: 0x90, 0x0F: 0x90, 0x10: 0},
+			[3]int16{2300, 2300, 2300}, [3]int16{6400, -6400, 3000}, false},
+		// Codes of 100: a factory trim of 7016.
+		{"mpu9250", 0x71, map[byte]byte{0x00: 100, 0x01: 100, 0x02: 100, 0x0D: 100, 0x0E: 100, 0x0F: 100},
+			[3]int16{7000, 7000, 7000}, [3]int16{7000, 7000, 7000}, true},
+		{"mpu9250 failing accel", 0x71, map[byte]byte{0x00: 100, 0x01: 100, 0x02: 100, 0x0D: 100, 0x0E: 100, 0x0F: 100},
+			[3]int16{7000, 14000, 7000}, [3]int16{7000, 7000, 7000}, false},
+	}
+	for _, test := range tests {
+		bus := newFakeBus(test.id)
+		bus.mag[magASA], bus.mag[magASA+1], bus.mag[magASA+2] = 128, 128, 128
+		for reg, code := range test.codes {
+			bus.regs[reg] = code
+		}
+		bus.setOutputs([3]int16{10, -20, 16384}, 0, [3]int16{5, 6, 7})
+		bus.accelST, bus.gyroST = test.accelST, test.gyroST
+
+		d := newMPU(bus, Address, mpu6050)
+		if test.id == 0x71 {
+			d = NewMPU9250(bus, Address).MPU6050
+		}
+		r, err := d.SelfTest()
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if r.Passed != test.passed {
+			t.Errorf("%v: got %+v", test.name, r)
+		}
+		if bus.regs[regAccelConfig] != 0 || bus.regs[regGyroConfig] != 0 || bus.regs[regSmplrtDiv] != 9 {
+			t.Errorf("%v: the settings were not restored", test.name)
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	bus := newFakeBus(0x68)
+	bus.setOutputs([3]int16{164, -82, 16384 + 328}, 0, [3]int16{13, -26, 5})
+	d := New(bus, Address)
+	d.Configure(Settings{Accel: Accel2G, Gyro: Gyro250DPS, DLPF: DLPF260Hz})
+	if _, err := d.Calibrate(5); err != nil {
+		t.Fatal(err)
+	}
+	m, err := d.Measure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nearVector(m.Accel, sensor.Vector{Z: g}) || !nearVector(m.Gyro, sensor.Vector{}) {
+		t.Errorf("got %+v after the calibration", m)
+	}
+	if o := d.Offsets(); !near(o.Accel.X, 164*g/16384) || !near(o.Gyro.Y, -26*deg/131) {
+		t.Errorf("got offsets %+v", o)
+	}
+}
+
+func TestParseSettings(t *testing.T) {
+	tests := []struct {
+		opts map[string]string
+		want Settings
+		ok   bool
+	}{
+		{nil, DefaultSettings, true},
+		{map[string]string{"accel-range": "8", "gyro-range": "1000", "dlpf": "260", "rate": "1000"},
+			Settings{Accel: Accel8G, Gyro: Gyro1000DPS, DLPF: DLPF260Hz, Divider: 7}, true},
+		{map[string]string{"dlpf": "5", "rate": "4"}, Settings{DLPF: DLPF5Hz, Divider: 249}, true},
+		{map[string]string{"rate": "2"}, Settings{}, false},
+		{map[string]string{"accel-range": "3"}, Settings{}, false},
+		{map[string]string{"fifo": "on"}, Settings{}, false},
+	}
+	for _, test := range tests {
+		s, err := parseSettings(test.opts)
+		if (err == nil) != test.ok || test.ok && s != test.want {
+			t.Errorf("parseSettings(%v): got %+v, %v", test.opts, s, err)
+		}
+	}
+}
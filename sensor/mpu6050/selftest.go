@@ -0,0 +1,182 @@
+// Self-test and offset calibration.
+
+package mpu6050
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/kidoman/embd/sensor"
+)
+
+const (
+	selfTestEnable  = 0xE0
+	selfTestSamples = 50
+	selfTestDelay   = 20 * time.Millisecond
+)
+
+// SelfTestResult is the result of a self-test.
+type SelfTestResult struct {
+	// Accel and Gyro are the self-test responses of the axes, relative to
+	// the factory trim: 1 is a perfect match.
+	Accel, Gyro sensor.Vector
+
+	// Passed tells whether all the responses are within the tolerances of
+	// the datasheet: ±14% on the MPU-6050, more than 50% for the gyroscope
+	// and 50-150% for the accelerometer on the MPU-9250.
+	Passed bool
+}
+
+// average returns the raw accelerometer and gyroscope outputs averaged over
+// n samples. d.mu must be held.
+func (d *MPU6050) average(n int) (accel, gyro [3]float64, err error) {
+	period := time.Duration(float64(time.Second) / d.settings.SampleRate())
+	for i := 0; i < n; i++ {
+		data, err := d.read(regAccelOut, 14)
+		if err != nil {
+			return accel, gyro, err
+		}
+		for a := 0; a < 3; a++ {
+			accel[a] += float64(word(data[2*a:])) / float64(n)
+			gyro[a] += float64(word(data[8+2*a:])) / float64(n)
+		}
+		time.Sleep(period)
+	}
+	return accel, gyro, nil
+}
+
+// factoryTrim returns the expected self-test responses of the axes, read
+// from the sensor, and their settings.
+func (d *MPU6050) factoryTrim() (accel, gyro [3]float64, err error) {
+	if d.model == mpu9250 {
+		g, err := d.read(regSelfTestXGyro, 3)
+		if err != nil {
+			return accel, gyro, err
+		}
+		a, err := d.read(regSelfTestXAccel, 3)
+		if err != nil {
+			return accel, gyro, err
+		}
+		otp := func(code byte) float64 {
+			if code == 0 {
+				return 0
+			}
+			return 2620 * math.Pow(1.01, float64(code)-1)
+		}
+		for i := 0; i < 3; i++ {
+			accel[i], gyro[i] = otp(a[i]), otp(g[i])
+		}
+		return accel, gyro, nil
+	}
+
+	codes, err := d.read(regSelfTestX, 4)
+	if err != nil {
+		return accel, gyro, err
+	}
+	for i := uint(0); i < 3; i++ {
+		if code := codes[i] & 0x1F; code != 0 {
+			gyro[i] = 25 * 131 * math.Pow(1.046, float64(code)-1)
+		}
+		if code := codes[i]>>5<<2 | codes[regSelfTestA-regSelfTestX]>>(4-2*i)&0x3; code != 0 {
+			accel[i] = 4096 * 0.34 * math.Pow(0.92/0.34, (float64(code)-1)/30)
+		}
+	}
+	// The response of the Y axis of the gyroscope is negative.
+	gyro[1] = -gyro[1]
+	return accel, gyro, nil
+}
+
+// SelfTest actuates the accelerometer and the gyroscope, which must be at
+// rest, and compares their responses to the factory trim. The settings are
+// restored afterwards.
+func (d *MPU6050) SelfTest() (SelfTestResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.setup(); err != nil {
+		return SelfTestResult{}, err
+	}
+	saved := d.settings
+	st := Settings{Accel: Accel8G, Gyro: Gyro250DPS, DLPF: DLPF94Hz}
+	if d.model == mpu9250 {
+		st.Accel = Accel2G
+	}
+	result, err := d.selfTest(st)
+	if e := d.configure(saved); err == nil {
+		err = e
+	}
+	return result, err
+}
+
+func (d *MPU6050) selfTest(st Settings) (SelfTestResult, error) {
+	var result SelfTestResult
+	if err := d.configure(st); err != nil {
+		return result, err
+	}
+	time.Sleep(selfTestDelay)
+	accel, gyro, err := d.average(selfTestSamples)
+	if err != nil {
+		return result, err
+	}
+
+	if err := d.write(regGyroConfig, byte(st.Gyro)<<3|selfTestEnable); err != nil {
+		return result, err
+	}
+	if err := d.write(regAccelConfig, byte(st.Accel)<<3|selfTestEnable); err != nil {
+		return result, err
+	}
+	time.Sleep(selfTestDelay)
+	accelST, gyroST, err := d.average(selfTestSamples)
+	if err != nil {
+		return result, err
+	}
+
+	accelFT, gyroFT, err := d.factoryTrim()
+	if err != nil {
+		return result, err
+	}
+	var accelRatio, gyroRatio [3]float64
+	result.Passed = true
+	for i := 0; i < 3; i++ {
+		if accelFT[i] != 0 {
+			accelRatio[i] = (accelST[i] - accel[i]) / accelFT[i]
+		}
+		if gyroFT[i] != 0 {
+			gyroRatio[i] = (gyroST[i] - gyro[i]) / gyroFT[i]
+		}
+		ok := math.Abs(accelRatio[i]-1) <= 0.14 && math.Abs(gyroRatio[i]-1) <= 0.14
+		if d.model == mpu9250 {
+			ok = accelRatio[i] >= 0.5 && accelRatio[i] <= 1.5 && gyroRatio[i] >= 0.5
+		}
+		result.Passed = result.Passed && ok
+	}
+	result.Accel = sensor.Vector{X: accelRatio[0], Y: accelRatio[1], Z: accelRatio[2]}
+	result.Gyro = sensor.Vector{X: gyroRatio[0], Y: gyroRatio[1], Z: gyroRatio[2]}
+	return result, nil
+}
+
+// Calibrate measures the offsets of the sensor over n samples, which must
+// be at rest with its Z axis up, and subtracts them from the next readings.
+func (d *MPU6050) Calibrate(n int) (Offsets, error) {
+	if n <= 0 {
+		return Offsets{}, errors.New("mpu6050: no calibration samples")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.setup(); err != nil {
+		return Offsets{}, err
+	}
+	accel, gyro, err := d.average(n)
+	if err != nil {
+		return Offsets{}, err
+	}
+	as, gs := d.settings.Accel.scale(), d.settings.Gyro.scale()
+	d.offsets = Offsets{
+		Accel: sensor.Vector{X: accel[0] * as, Y: accel[1] * as, Z: accel[2]*as - g},
+		Gyro:  sensor.Vector{X: gyro[0] * gs, Y: gyro[1] * gs, Z: gyro[2] * gs},
+	}
+	return d.offsets, nil
+}
@@ -0,0 +1,105 @@
+// Quantity interfaces.
+
+package sensor
+
+import "math"
+
+// Values are in SI units, except temperatures which are in degrees Celsius.
+
+// Vector is a reading along the three axes of a sensor.
+type Vector struct {
+	X, Y, Z float64
+}
+
+// Thermometer is implemented by the sensors measuring a temperature.
+type Thermometer interface {
+	// Temperature returns the temperature in °C.
+	Temperature() (float64, error)
+}
+
+// Barometer is implemented by the sensors measuring the air pressure.
+type Barometer interface {
+	// Pressure returns the pressure in Pa.
+	Pressure() (float64, error)
+}
+
+// Hygrometer is implemented by the sensors measuring the humidity.
+type Hygrometer interface {
+	// Humidity returns the relative humidity in %.
+	Humidity() (float64, error)
+}
+
+// DewPoint returns the temperature in °C at which air at temperature t in
+// °C and relative humidity rh in % would saturate, by the Magnus formula.
+// It is accurate to 0.35°C from -45°C to 60°C. Humidities below 0.1%, the
+// resolution of the hygrometers, are taken as 0.1% as the dew point of dry
+// air is not finite.
+func DewPoint(t, rh float64) float64 {
+	const a, b = 17.62, 243.12
+	if rh < 0.1 {
+		rh = 0.1
+	}
+	g := math.Log(rh/100) + a*t/(b+t)
+	return b * g / (a - g)
+}
+
+// Luxmeter is implemented by the sensors measuring the ambient light.
+type Luxmeter interface {
+	// Illuminance returns the illuminance in lx.
+	Illuminance() (float64, error)
+}
+
+// Gyroscope is implemented by the sensors measuring rotation.
+type Gyroscope interface {
+	// AngularVelocity returns the angular velocity around each axis in
+	// rad/s.
+	AngularVelocity() (Vector, error)
+}
+
+// Accelerometer is implemented by the sensors measuring acceleration.
+type Accelerometer interface {
+	// Acceleration returns the acceleration along each axis in m/s².
+	Acceleration() (Vector, error)
+}
+
+// Magnetometer is implemented by the sensors measuring a magnetic field.
+type Magnetometer interface {
+	// MagneticField returns the magnetic flux density along each axis in T.
+	MagneticField() (Vector, error)
+}
+
+// RangeFinder is implemented by the sensors measuring a distance.
+type RangeFinder interface {
+	// Range returns the distance to the closest obstacle in m.
+	Range() (float64, error)
+}
+
+// Quantities holds the quantities of a single measurement, named after the
+// methods of their interfaces. Those which the sensor does not measure, or
+// which were skipped, are NaN.
+type Quantities struct {
+	Temperature     float64 // °C
+	Pressure        float64 // Pa
+	Humidity        float64 // %
+	DewPoint        float64 // °C
+	Illuminance     float64 // lx
+	AngularVelocity Vector  // rad/s
+	Acceleration    Vector  // m/s²
+	MagneticField   Vector  // T
+	Range           float64 // m
+}
+
+// NoQuantities returns Quantities holding no quantity, to be filled in by
+// the drivers.
+func NoQuantities() Quantities {
+	nan := math.NaN()
+	v := Vector{nan, nan, nan}
+	return Quantities{nan, nan, nan, nan, nan, v, v, v, nan}
+}
+
+// Measurer is implemented by the sensors which take all their quantities
+// in a single measurement, for them to be read at once and consistent.
+type Measurer interface {
+	// MeasureQuantities takes a measurement of all the quantities.
+	MeasureQuantities() (Quantities, error)
+}
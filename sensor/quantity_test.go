@@ -0,0 +1,24 @@
+package sensor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDewPoint(t *testing.T) {
+	tests := []struct {
+		t, rh, want float64
+	}{
+		{20, 100, 20},
+		{25, 50, 13.85},
+		{30, 80, 26.17},
+		{-10, 60, -16.31},
+		{25, 0, -55.93},
+		{25, -2, -55.93},
+	}
+	for _, test := range tests {
+		if got := DewPoint(test.t, test.rh); math.Abs(got-test.want) > 0.01 {
+			t.Errorf("DewPoint(%v, %v): got %v, want %v", test.t, test.rh, got, test.want)
+		}
+	}
+}
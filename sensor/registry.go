@@ -0,0 +1,106 @@
+// Sensor driver registry.
+
+package sensor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kidoman/embd"
+)
+
+// Device is a sensor created by New. It implements the quantity interfaces
+// (Thermometer, Barometer...) of what it measures.
+type Device interface {
+	// Close releases the resources associated with the sensor.
+	Close() error
+}
+
+// Config describes how a sensor is wired.
+type Config struct {
+	// Bus is the I2C bus of the sensor.
+	Bus embd.I2CBus
+
+	// Addr is the I2C address of the sensor, 0 for its default address.
+	Addr byte
+
+	// SPI is the SPI bus of the sensors which can be wired to either bus.
+	// It takes precedence over Bus when set.
+	SPI embd.SPIBus
+
+	// Pins are the digital pins of the sensor by role, e.g. "echo" and
+	// "trigger".
+	Pins map[string]embd.DigitalPin
+
+	// Options are the driver specific settings, e.g. the resolution.
+	Options map[string]string
+}
+
+// I2C returns the bus and the address of an I2C sensor. addrs lists the
+// addresses the sensor can be strapped to, the first one being the default.
+func (c Config) I2C(addrs ...byte) (embd.I2CBus, byte, error) {
+	if c.Bus == nil {
+		return nil, 0, fmt.Errorf("sensor: no i2c bus")
+	}
+	if c.Addr == 0 {
+		return c.Bus, addrs[0], nil
+	}
+	for _, a := range addrs {
+		if c.Addr == a {
+			return c.Bus, a, nil
+		}
+	}
+	valid := make([]string, len(addrs))
+	for i, a := range addrs {
+		valid[i] = fmt.Sprintf("%#x", a)
+	}
+	return nil, 0, fmt.Errorf("sensor: invalid address %#x, expected %v", c.Addr, strings.Join(valid, " or "))
+}
+
+// Pin returns the pin with the given role.
+func (c Config) Pin(role string) (embd.DigitalPin, error) {
+	pin, ok := c.Pins[role]
+	if !ok || pin == nil {
+		return nil, fmt.Errorf("sensor: no %v pin", role)
+	}
+	return pin, nil
+}
+
+// The Factory type creates a sensor from its configuration.
+type Factory func(c Config) (Device, error)
+
+var factories = make(map[string]Factory)
+
+// Register makes a sensor driver available by the provided name.
+// If Register is called twice with the same name or if factory is nil,
+// it panics.
+func Register(name string, factory Factory) {
+	if factory == nil {
+		panic("sensor: factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("sensor: driver " + name + " already registered")
+	}
+	factories[name] = factory
+}
+
+// New creates a sensor with the named driver, which must have been
+// registered, typically by importing its package.
+func New(name string, c Config) (Device, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("sensor: unknown driver %q", name)
+	}
+	return factory(c)
+}
+
+// Drivers returns the sorted names of the registered drivers.
+func Drivers() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,72 @@
+package sensor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kidoman/embd"
+)
+
+type fakeDevice struct{}
+
+func (fakeDevice) Close() error { return nil }
+
+type fakeBus struct {
+	embd.I2CBus
+}
+
+func TestRegistry(t *testing.T) {
+	defer func(f map[string]Factory) { factories = f }(factories)
+	factories = make(map[string]Factory)
+
+	var got Config
+	Register("b", func(c Config) (Device, error) { got = c; return fakeDevice{}, nil })
+	Register("a", func(c Config) (Device, error) { return fakeDevice{}, nil })
+
+	if names := Drivers(); !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("Drivers: got %v", names)
+	}
+	if _, err := New("b", Config{Addr: 0x40}); err != nil || got.Addr != 0x40 {
+		t.Errorf("New: got %+v, %v", got, err)
+	}
+	if _, err := New("c", Config{}); err == nil {
+		t.Error("New: expected an error for an unknown driver")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Register: expected a panic for a duplicate driver")
+		}
+	}()
+	Register("a", func(c Config) (Device, error) { return fakeDevice{}, nil })
+}
+
+func TestConfigI2C(t *testing.T) {
+	bus := fakeBus{}
+	var tests = []struct {
+		c    Config
+		addr byte
+		err  bool
+	}{
+		{Config{Bus: bus}, 0x40, false},
+		{Config{Bus: bus, Addr: 0x41}, 0x41, false},
+		{Config{Bus: bus, Addr: 0x50}, 0, true},
+		{Config{Addr: 0x40}, 0, true},
+	}
+	for _, test := range tests {
+		_, addr, err := test.c.I2C(0x40, 0x41)
+		if (err != nil) != test.err || addr != test.addr {
+			t.Errorf("%+v: got %#x, %v", test.c, addr, err)
+		}
+	}
+}
+
+func TestConfigPin(t *testing.T) {
+	c := Config{Pins: map[string]embd.DigitalPin{"echo": nil}}
+	if _, err := c.Pin("echo"); err == nil {
+		t.Error("expected an error for a nil pin")
+	}
+	if _, err := c.Pin("trigger"); err == nil {
+		t.Error("expected an error for a missing pin")
+	}
+}
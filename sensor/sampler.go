@@ -0,0 +1,113 @@
+// Continuous acquisition.
+
+package sensor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Reading is a timestamped sample, or the error which prevented it.
+type Reading struct {
+	Time  time.Time
+	Value interface{}
+	Err   error
+}
+
+// SampleFunc takes a sample.
+type SampleFunc func() (interface{}, error)
+
+// Sample calls f every period until ctx is done, and delivers the readings
+// on the returned channel. The channel is closed once sampling has stopped.
+// Sampling goes on while a reading waits to be received; a newer reading
+// replaces it, so that slow receivers always get the latest one.
+func Sample(ctx context.Context, period time.Duration, f SampleFunc) <-chan Reading {
+	readings := make(chan Reading)
+	go func() {
+		defer close(readings)
+
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		var pending Reading
+		var out chan Reading
+		sample := func() {
+			v, err := f()
+			pending = Reading{Time: time.Now(), Value: v, Err: err}
+			out = readings
+		}
+		if ctx.Err() == nil {
+			sample()
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sample()
+			case out <- pending:
+				out = nil
+			}
+		}
+	}()
+	return readings
+}
+
+// Sampler runs Sample in the background and keeps the latest value, for
+// the drivers which take readings continuously between Run and Close. The
+// zero value is a stopped sampler.
+type Sampler struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	latest Reading
+	ok     bool
+}
+
+// Start samples f every period until Stop. A running sampler is restarted.
+func (s *Sampler) Start(period time.Duration, f SampleFunc) {
+	s.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.cancel, s.done = cancel, done
+	s.mu.Unlock()
+
+	readings := Sample(ctx, period, f)
+	go func() {
+		defer close(done)
+		for r := range readings {
+			s.mu.Lock()
+			if s.done == done {
+				s.latest, s.ok = r, true
+			}
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// Latest returns the last reading, if the sampler is running and has one.
+// A failed sample replaces the previous value by its error, for the drivers
+// not to serve a stale value while the sensor cannot be read.
+func (s *Sampler) Latest() (Reading, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest, s.ok
+}
+
+// Stop stops the sampler and waits for it to be done. It does nothing if
+// the sampler is not running.
+func (s *Sampler) Stop() {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done, s.latest, s.ok = nil, nil, Reading{}, false
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,134 @@
+package sensor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func counter(fail int32) SampleFunc {
+	var n int32
+	return func() (interface{}, error) {
+		i := atomic.AddInt32(&n, 1)
+		if i == fail {
+			return nil, errors.New("failed")
+		}
+		return int(i), nil
+	}
+}
+
+func TestSample(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Now()
+	readings := Sample(ctx, time.Millisecond, counter(2))
+
+	r := <-readings
+	if r.Err != nil || r.Value != 1 {
+		t.Fatalf("first reading: got %+v", r)
+	}
+	if r.Time.Before(start) {
+		t.Errorf("first reading: time %v is before the start %v", r.Time, start)
+	}
+
+	var sawErr bool
+	for i := 0; i < 10; i++ {
+		r = <-readings
+		if r.Err != nil {
+			sawErr = true
+		}
+	}
+	if !sawErr {
+		t.Error("expected the failed sample to be delivered as an error")
+	}
+
+	cancel()
+	for range readings {
+	}
+}
+
+func TestSampleLatest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	readings := Sample(ctx, time.Millisecond, counter(0))
+	first := <-readings
+	time.Sleep(20 * time.Millisecond)
+	if r := <-readings; r.Value.(int) <= first.Value.(int)+1 {
+		t.Errorf("got %v after %v, expected a newer reading to replace the pending one", r.Value, first.Value)
+	}
+}
+
+func TestSampleCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls int32
+	readings := Sample(ctx, time.Millisecond, func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, nil
+	})
+	for range readings {
+	}
+	if calls != 0 {
+		t.Errorf("sampled %v times with a cancelled context", calls)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	var s Sampler
+	s.Stop()
+	if _, ok := s.Latest(); ok {
+		t.Fatal("Latest: got a value from a stopped sampler")
+	}
+
+	// The first sample fails, the next ones succeed.
+	s.Start(time.Millisecond, counter(1))
+	deadline := time.Now().Add(time.Second)
+	for {
+		if r, ok := s.Latest(); ok && r.Err == nil {
+			if r.Value.(int) < 2 {
+				t.Errorf("Latest: got %v, expected the value of a successful sample", r.Value)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Latest: no value after 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	s.Stop()
+	if _, ok := s.Latest(); ok {
+		t.Error("Latest: got a value after Stop")
+	}
+	s.Stop()
+
+	// A failing sensor does not leave the last value in place.
+	var fail int32
+	s.Start(time.Millisecond, func() (interface{}, error) {
+		if atomic.LoadInt32(&fail) != 0 {
+			return nil, errors.New("failed")
+		}
+		return 1, nil
+	})
+	defer s.Stop()
+	waitLatest := func(cond func(Reading) bool) {
+		deadline := time.Now().Add(time.Second)
+		for {
+			if r, ok := s.Latest(); ok && cond(r) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Latest: no matching reading after 1s")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitLatest(func(r Reading) bool { return r.Err == nil })
+	atomic.StoreInt32(&fail, 1)
+	waitLatest(func(r Reading) bool { return r.Err != nil && r.Value == nil })
+}
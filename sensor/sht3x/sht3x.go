@@ -0,0 +1,401 @@
+// Package sht3x allows interfacing with the Sensirion SHT30, SHT31 and SHT35
+// humidity and temperature sensors through I2C.
+//
+// The sensor measures either on command (single shot) or continuously at a
+// Rate (periodic), and has a heater to check its plausibility or evaporate
+// condensation. All the readings are CRC checked.
+package sht3x
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+const (
+	// Address is the I2C address of the sensor when its ADDR pin is low.
+	Address = 0x44
+	// AltAddress is the I2C address of the sensor when its ADDR pin is high.
+	AltAddress = 0x45
+
+	cmdFetch       = 0xE000
+	cmdBreak       = 0x3093
+	cmdSoftReset   = 0x30A2
+	cmdHeaterOn    = 0x306D
+	cmdHeaterOff   = 0x3066
+	cmdStatus      = 0xF32D
+	cmdClearStatus = 0x3041
+
+	statusHeater = 1 << 13
+
+	// The sensor needs 1ms after a command before accepting the next one.
+	commandDelay = time.Millisecond
+	resetDelay   = 2 * time.Millisecond
+
+	pollDelay = 1000
+)
+
+// Repeatability trades the duration and power of a measurement for its
+// noise.
+type Repeatability int
+
+const (
+	// High repeatability measures in 15ms.
+	High Repeatability = iota
+	// Medium repeatability measures in 6ms.
+	Medium
+	// Low repeatability measures in 4ms.
+	Low
+)
+
+var (
+	singleShotCmds  = [...]uint16{0x2400, 0x240B, 0x2416}
+	measurementTime = [...]time.Duration{15 * time.Millisecond, 6 * time.Millisecond, 4 * time.Millisecond}
+)
+
+// Rate is the number of measurements per second of the periodic mode.
+type Rate int
+
+const (
+	// SingleShot measures on each reading instead of periodically.
+	SingleShot Rate = iota
+	Rate0_5Hz
+	Rate1Hz
+	Rate2Hz
+	Rate4Hz
+	Rate10Hz
+)
+
+// periods are the intervals between two measurements by rate.
+var periods = [...]time.Duration{
+	Rate0_5Hz: 2 * time.Second,
+	Rate1Hz:   time.Second,
+	Rate2Hz:   500 * time.Millisecond,
+	Rate4Hz:   250 * time.Millisecond,
+	Rate10Hz:  100 * time.Millisecond,
+}
+
+// periodicCmds are the commands starting the periodic mode by rate and
+// repeatability.
+var periodicCmds = [...][3]uint16{
+	Rate0_5Hz: {0x2032, 0x2024, 0x202F},
+	Rate1Hz:   {0x2130, 0x2126, 0x212D},
+	Rate2Hz:   {0x2236, 0x2220, 0x222B},
+	Rate4Hz:   {0x2334, 0x2322, 0x2329},
+	Rate10Hz:  {0x2737, 0x2721, 0x272A},
+}
+
+// Measurement is a sample of all the readings of the sensor.
+type Measurement struct {
+	Temperature float64 // °C
+	Humidity    float64 // %
+	DewPoint    float64 // °C
+}
+
+// SHT3x represents a Sensirion SHT3x sensor.
+type SHT3x struct {
+	Bus embd.I2CBus
+
+	// Poll is the period of the data acquisition loop in ms.
+	Poll int
+
+	// Repeatability of the measurements. Defaults to High.
+	Repeatability Repeatability
+
+	// Rate is the rate of the periodic mode, which the sensor is switched
+	// to on the next reading. Defaults to SingleShot.
+	Rate Rate
+
+	addr byte
+
+	mu sync.Mutex
+	// periodic is the command of the running periodic mode, if any.
+	periodic uint16
+	// last is the last measurement fetched in periodic mode, at fetched.
+	last    Measurement
+	fetched time.Time
+	// now is replaced by the tests.
+	now func() time.Time
+
+	sampler sensor.Sampler
+}
+
+// New returns a handle to a SHT3x sensor at the given address, Address or
+// AltAddress.
+func New(bus embd.I2CBus, addr byte) *SHT3x {
+	return &SHT3x{Bus: bus, Poll: pollDelay, addr: addr, now: time.Now}
+}
+
+// crc8 is the checksum of the sensor: polynomial 0x31, initialized to 0xFF.
+func crc8(data []byte) byte {
+	crc := byte(0xFF)
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x31
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// words checks the CRC of each word of data, a word being followed by its
+// checksum, and returns the words.
+func words(data []byte) ([]uint16, error) {
+	ws := make([]uint16, len(data)/3)
+	for i := range ws {
+		w := data[3*i : 3*i+3]
+		if crc := crc8(w[:2]); crc != w[2] {
+			return nil, fmt.Errorf("sht3x: crc mismatch, got %#02x, want %#02x", w[2], crc)
+		}
+		ws[i] = uint16(w[0])<<8 | uint16(w[1])
+	}
+	return ws, nil
+}
+
+func (d *SHT3x) command(cmd uint16) error {
+	err := d.Bus.WriteBytes(d.addr, []byte{byte(cmd >> 8), byte(cmd)})
+	time.Sleep(commandDelay)
+	return err
+}
+
+// read sends the command and reads n words.
+func (d *SHT3x) read(cmd uint16, delay time.Duration, n int) ([]uint16, error) {
+	if err := d.Bus.WriteBytes(d.addr, []byte{byte(cmd >> 8), byte(cmd)}); err != nil {
+		return nil, err
+	}
+	time.Sleep(delay)
+	data, err := d.Bus.ReadBytes(d.addr, 3*n)
+	if err != nil {
+		return nil, err
+	}
+	return words(data)
+}
+
+// stop breaks the periodic mode. d.mu must be held.
+func (d *SHT3x) stop() error {
+	if d.periodic == 0 {
+		return nil
+	}
+	if err := d.command(cmdBreak); err != nil {
+		return err
+	}
+	d.periodic = 0
+	return nil
+}
+
+// Measure takes a sample of all the readings. In periodic mode, it fetches
+// the last measurement, which the sensor returns only once: it is returned
+// again until the next one is due.
+func (d *SHT3x) Measure() (Measurement, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Repeatability < High || d.Repeatability > Low {
+		return Measurement{}, fmt.Errorf("sht3x: invalid repeatability %v", d.Repeatability)
+	}
+	if d.Rate < SingleShot || d.Rate > Rate10Hz {
+		return Measurement{}, fmt.Errorf("sht3x: invalid rate %v", d.Rate)
+	}
+
+	var ws []uint16
+	var err error
+	if d.Rate == SingleShot {
+		if err := d.stop(); err != nil {
+			return Measurement{}, err
+		}
+		ws, err = d.read(singleShotCmds[d.Repeatability], measurementTime[d.Repeatability], 2)
+	} else {
+		delay := time.Duration(0)
+		cmd := periodicCmds[d.Rate][d.Repeatability]
+		if cmd == d.periodic && d.now().Sub(d.fetched) < periods[d.Rate] {
+			return d.last, nil
+		}
+		if cmd != d.periodic {
+			if err := d.stop(); err != nil {
+				return Measurement{}, err
+			}
+			if err := d.command(cmd); err != nil {
+				return Measurement{}, err
+			}
+			d.periodic = cmd
+			// The first measurement starts right away.
+			delay = measurementTime[d.Repeatability]
+		}
+		ws, err = d.read(cmdFetch, delay, 2)
+	}
+	if err != nil {
+		return Measurement{}, err
+	}
+	m := newMeasurement(ws[0], ws[1])
+	if d.periodic != 0 {
+		d.last, d.fetched = m, d.now()
+	}
+	return m, nil
+}
+
+// MeasureQuantities implements sensor.Measurer.
+func (d *SHT3x) MeasureQuantities() (sensor.Quantities, error) {
+	m, err := d.Measure()
+	if err != nil {
+		return sensor.Quantities{}, err
+	}
+	q := sensor.NoQuantities()
+	q.Temperature, q.Humidity, q.DewPoint = m.Temperature, m.Humidity, m.DewPoint
+	return q, nil
+}
+
+func newMeasurement(st, srh uint16) Measurement {
+	m := Measurement{
+		Temperature: -45 + 175*float64(st)/65535,
+		Humidity:    100 * float64(srh) / 65535,
+	}
+	m.DewPoint = sensor.DewPoint(m.Temperature, m.Humidity)
+	return m
+}
+
+// Temperature returns the current temperature reading in °C.
+func (d *SHT3x) Temperature() (float64, error) {
+	m, err := d.latest()
+	return m.Temperature, err
+}
+
+// Humidity returns the current relative humidity reading in %.
+func (d *SHT3x) Humidity() (float64, error) {
+	m, err := d.latest()
+	return m.Humidity, err
+}
+
+// DewPoint returns the current dew point in °C.
+func (d *SHT3x) DewPoint() (float64, error) {
+	m, err := d.latest()
+	return m.DewPoint, err
+}
+
+func (d *SHT3x) latest() (Measurement, error) {
+	if r, ok := d.sampler.Latest(); ok {
+		if r.Err != nil {
+			return Measurement{}, r.Err
+		}
+		return r.Value.(Measurement), nil
+	}
+	return d.Measure()
+}
+
+// Status returns the status register of the sensor.
+func (d *SHT3x) Status() (uint16, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ws, err := d.read(cmdStatus, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	return ws[0], nil
+}
+
+// ClearStatus clears the alert flags of the status register.
+func (d *SHT3x) ClearStatus() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.command(cmdClearStatus)
+}
+
+// SetHeater switches the heater on or off. The heater warms the sensor by a
+// few °C, which the readings then reflect.
+func (d *SHT3x) SetHeater(on bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if on {
+		return d.command(cmdHeaterOn)
+	}
+	return d.command(cmdHeaterOff)
+}
+
+// Heater tells whether the heater is on.
+func (d *SHT3x) Heater() (bool, error) {
+	status, err := d.Status()
+	return status&statusHeater != 0, err
+}
+
+// Reset stops the periodic mode and resets the sensor, which switches the
+// heater off.
+func (d *SHT3x) Reset() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.stop(); err != nil {
+		return err
+	}
+	if err := d.command(cmdSoftReset); err != nil {
+		return err
+	}
+	time.Sleep(resetDelay)
+	return nil
+}
+
+func (d *SHT3x) sample() (interface{}, error) {
+	return d.Measure()
+}
+
+// Readings takes a Measurement every period until ctx is done.
+func (d *SHT3x) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	return sensor.Sample(ctx, period, d.sample)
+}
+
+// Run starts the sensor data acquisition loop, which Temperature, Humidity
+// and DewPoint then return the latest readings of.
+func (d *SHT3x) Run() {
+	d.sampler.Start(time.Duration(d.Poll)*time.Millisecond, d.sample)
+}
+
+// Close stops the data acquisition loop and the periodic mode.
+func (d *SHT3x) Close() error {
+	d.sampler.Stop()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.stop()
+}
+
+var (
+	repeatabilities = map[string]Repeatability{"high": High, "medium": Medium, "low": Low}
+	rates           = map[string]Rate{"0.5": Rate0_5Hz, "1": Rate1Hz, "2": Rate2Hz, "4": Rate4Hz, "10": Rate10Hz}
+)
+
+// The options are repeatability (high, medium or low) and rate (0.5, 1, 2,
+// 4 or 10 measurements per second, for the periodic mode).
+func init() {
+	sensor.Register("sht3x", func(c sensor.Config) (sensor.Device, error) {
+		bus, addr, err := c.I2C(Address, AltAddress)
+		if err != nil {
+			return nil, err
+		}
+		d := New(bus, addr)
+		for k, v := range c.Options {
+			var ok bool
+			switch k {
+			case "repeatability":
+				d.Repeatability, ok = repeatabilities[v]
+			case "rate":
+				d.Rate, ok = rates[v]
+			default:
+				return nil, fmt.Errorf("sht3x: unknown option %q", k)
+			}
+			if !ok {
+				return nil, fmt.Errorf("sht3x: invalid %v %q", k, v)
+			}
+		}
+		return d, nil
+	})
+}
@@ -0,0 +1,166 @@
+package sht3x
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
+)
+
+// fakeBus answers the reads with the words, followed by their checksums,
+// and records the commands.
+type fakeBus struct {
+	embd.I2CBus
+	words  []uint16
+	badCRC bool
+	cmds   []uint16
+}
+
+func (b *fakeBus) WriteBytes(addr byte, value []byte) error {
+	if addr != Address || len(value) != 2 {
+		return errors.New("unexpected write")
+	}
+	b.cmds = append(b.cmds, uint16(value[0])<<8|uint16(value[1]))
+	return nil
+}
+
+func (b *fakeBus) ReadBytes(addr byte, num int) ([]byte, error) {
+	if addr != Address || num != 3*len(b.words) {
+		return nil, errors.New("unexpected read")
+	}
+	var data []byte
+	for _, w := range b.words {
+		word := []byte{byte(w >> 8), byte(w)}
+		data = append(data, word[0], word[1], crc8(word))
+	}
+	if b.badCRC {
+		data[len(data)-1]++
+	}
+	return data, nil
+}
+
+func TestCRC(t *testing.T) {
+	// The example of the datasheet.
+	if crc := crc8([]byte{0xBE, 0xEF}); crc != 0x92 {
+		t.Errorf("got %#x, want 0x92", crc)
+	}
+}
+
+// clock is a fake time source.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func TestMeasure(t *testing.T) {
+	bus := &fakeBus{words: []uint16{0x6666, 0x8000}}
+	c := &clock{time.Unix(0, 0)}
+	d := New(bus, Address)
+	d.now = c.now
+	m, err := d.Measure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(m.Temperature-25) > 0.01 || math.Abs(m.Humidity-50) > 0.01 || math.Abs(m.DewPoint-13.85) > 0.01 {
+		t.Errorf("got %+v", m)
+	}
+
+	d.Repeatability = Low
+	d.Measure()
+	d.Rate = Rate10Hz
+	d.Measure()
+	c.t = c.t.Add(100 * time.Millisecond)
+	d.Measure()
+	d.Repeatability = Medium
+	d.Measure()
+	d.Rate = SingleShot
+	d.Measure()
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{
+		0x2400, 0x2416, // single shot
+		0x272A, 0xE000, 0xE000, // periodic
+		0x3093, 0x2721, 0xE000, // periodic, with another repeatability
+		0x3093, 0x240B, // single shot
+	}
+	if !reflect.DeepEqual(bus.cmds, want) {
+		t.Errorf("got commands %#x, want %#x", bus.cmds, want)
+	}
+
+	bus.badCRC = true
+	if _, err := d.Measure(); err == nil {
+		t.Error("expected a crc error")
+	}
+}
+
+func TestPeriodicCache(t *testing.T) {
+	bus := &fakeBus{words: []uint16{0x6666, 0x8000}}
+	c := &clock{time.Unix(0, 0)}
+	d := New(bus, Address)
+	d.now = c.now
+	d.Rate = Rate1Hz
+
+	// The readings of a measurement are served by a single fetch.
+	if _, err := d.Temperature(); err != nil {
+		t.Fatal(err)
+	}
+	c.t = c.t.Add(500 * time.Millisecond)
+	if h, err := d.Humidity(); err != nil || math.Abs(h-50) > 0.01 {
+		t.Errorf("Humidity: got %v, %v", h, err)
+	}
+	if _, err := d.DewPoint(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint16{0x2130, 0xE000}; !reflect.DeepEqual(bus.cmds, want) {
+		t.Errorf("got commands %#x, want %#x", bus.cmds, want)
+	}
+
+	// The next measurement is fetched once due.
+	c.t = c.t.Add(500 * time.Millisecond)
+	bus.words = []uint16{0x6666, 0x4000}
+	if h, err := d.Humidity(); err != nil || math.Abs(h-25) > 0.01 {
+		t.Errorf("Humidity: got %v, %v", h, err)
+	}
+	if want := []uint16{0x2130, 0xE000, 0xE000}; !reflect.DeepEqual(bus.cmds, want) {
+		t.Errorf("got commands %#x, want %#x", bus.cmds, want)
+	}
+}
+
+func TestHeater(t *testing.T) {
+	bus := &fakeBus{words: []uint16{0x2000}}
+	d := New(bus, Address)
+	if err := d.SetHeater(true); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := d.Heater(); err != nil || !on {
+		t.Errorf("Heater: got %v, %v", on, err)
+	}
+	if err := d.SetHeater(false); err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint16{0x306D, 0xF32D, 0x3066}; !reflect.DeepEqual(bus.cmds, want) {
+		t.Errorf("got commands %#x, want %#x", bus.cmds, want)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	bus := &fakeBus{}
+	d, err := sensor.New("sht3x", sensor.Config{Bus: bus, Options: map[string]string{"repeatability": "low", "rate": "0.5"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := d.(*SHT3x); s.Repeatability != Low || s.Rate != Rate0_5Hz {
+		t.Errorf("got repeatability %v and rate %v", s.Repeatability, s.Rate)
+	}
+	for _, opts := range []map[string]string{{"rate": "3"}, {"repeatability": "max"}, {"heater": "on"}} {
+		if _, err := sensor.New("sht3x", sensor.Config{Bus: bus, Options: opts}); err == nil {
+			t.Errorf("%v: expected an error", opts)
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package tmp006
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
 )
 
 const (
@@ -65,7 +67,14 @@ type TMP006 struct {
 
 	rawDieTemps chan float64
 	objTemps    chan float64
-	closing     chan chan struct{}
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+// Measurement is a reading of both temperatures, in °C.
+type Measurement struct {
+	Object float64
+	Die    float64
 }
 
 // New creates a new TMP006 sensor.
@@ -91,10 +100,10 @@ func (d *TMP006) Close() error {
 	if err := d.setup(); err != nil {
 		return err
 	}
-	if d.closing != nil {
-		waitc := make(chan struct{})
-		d.closing <- waitc
-		<-waitc
+	if d.cancel != nil {
+		d.cancel()
+		<-d.done
+		d.cancel = nil
 	}
 	glog.V(1).Infof("tmp006: resetting")
 	if err := d.Bus.WriteWordToReg(d.Addr, configReg, reset); err != nil {
@@ -246,11 +255,33 @@ func (d *TMP006) ObjTemp() (float64, error) {
 	}
 }
 
+// Temperature returns the temperature of the object in view in °C, the same
+// as ObjTemp.
+func (d *TMP006) Temperature() (float64, error) {
+	return d.ObjTemp()
+}
+
 // ObjTemps returns a channel to fetch obj temps from.
 func (d *TMP006) ObjTemps() <-chan float64 {
 	return d.objTemps
 }
 
+// Readings measures both temperatures every period until ctx is done. The
+// values are Measurements.
+func (d *TMP006) Readings(ctx context.Context, period time.Duration) <-chan sensor.Reading {
+	return sensor.Sample(ctx, period, func() (interface{}, error) {
+		var m Measurement
+		var err error
+		if m.Die, err = d.measureRawDieTemp(); err != nil {
+			return nil, err
+		}
+		if m.Object, err = d.measureObjTemp(); err != nil {
+			return nil, err
+		}
+		return m, nil
+	})
+}
+
 // Start starts the data acquisition loop.
 func (d *TMP006) Start() error {
 	if err := d.setup(); err != nil {
@@ -260,55 +291,46 @@ func (d *TMP006) Start() error {
 	d.rawDieTemps = make(chan float64)
 	d.objTemps = make(chan float64)
 
-	go func() {
-		var rawDieTemp, objTemp float64
-		var rdtAvlb, otAvlb bool
-		var err error
-		var timer <-chan time.Time
-		resetTimer := func() {
-			timer = time.After(time.Duration(d.SampleRate.timeRequired*1000) * time.Millisecond)
-		}
-		resetTimer()
-
-		for {
-			var rawDieTemps, objTemps chan float64
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel, d.done = cancel, make(chan struct{})
+	readings := d.Readings(ctx, time.Duration(d.SampleRate.timeRequired*1000)*time.Millisecond)
 
-			if rdtAvlb {
-				rawDieTemps = d.rawDieTemps
-			}
-			if otAvlb {
-				objTemps = d.objTemps
-			}
+	go func(rawDieTemps, objTemps chan float64, done chan struct{}) {
+		defer close(done)
+		defer close(objTemps)
+		defer close(rawDieTemps)
 
+		var m Measurement
+		var rdtOut, otOut chan float64
+		for {
 			select {
-			case <-timer:
-				var rdt float64
-				if rdt, err = d.measureRawDieTemp(); err != nil {
-					glog.Errorf("tmp006: %v", err)
-				} else {
-					rawDieTemp = rdt
-					rdtAvlb = true
+			case r, ok := <-readings:
+				if !ok {
+					return
 				}
-				var ot float64
-				if ot, err = d.measureObjTemp(); err != nil {
-					glog.Errorf("tmp006: %v", err)
-				} else {
-					objTemp = ot
-					otAvlb = true
+				if r.Err != nil {
+					glog.Errorf("tmp006: %v", r.Err)
+					continue
 				}
-				resetTimer()
-			case rawDieTemps <- rawDieTemp:
-				rdtAvlb = false
-			case objTemps <- objTemp:
-				otAvlb = false
-			case waitc := <-d.closing:
-				waitc <- struct{}{}
-				close(d.rawDieTemps)
-				close(d.objTemps)
-				return
+				m = r.Value.(Measurement)
+				rdtOut, otOut = rawDieTemps, objTemps
+			case rdtOut <- m.Die:
+				rdtOut = nil
+			case otOut <- m.Object:
+				otOut = nil
 			}
 		}
-	}()
+	}(d.rawDieTemps, d.objTemps, d.done)
 
 	return nil
 }
+
+func init() {
+	sensor.Register("tmp006", func(c sensor.Config) (sensor.Device, error) {
+		bus, addr, err := c.I2C(0x40, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47)
+		if err != nil {
+			return nil, err
+		}
+		return New(bus, addr), nil
+	})
+}
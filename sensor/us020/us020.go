@@ -7,6 +7,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
 )
 
 const (
@@ -76,7 +77,7 @@ func (d *US020) setup() error {
 	return nil
 }
 
-// Distance computes the distance of the bot from the closest obstruction.
+// Distance computes the distance of the bot from the closest obstruction in cm.
 func (d *US020) Distance() (float64, error) {
 	if err := d.setup(); err != nil {
 		return 0, err
@@ -102,7 +103,28 @@ func (d *US020) Distance() (float64, error) {
 	return distance, nil
 }
 
+// Range returns the distance to the closest obstruction in m.
+func (d *US020) Range() (float64, error) {
+	cm, err := d.Distance()
+	return cm / 100, err
+}
+
 // Close.
 func (d *US020) Close() error {
 	return d.EchoPin.SetDirection(embd.Out)
 }
+
+// The sensor needs an "echo" and a "trigger" pin.
+func init() {
+	sensor.Register("us020", func(c sensor.Config) (sensor.Device, error) {
+		echo, err := c.Pin("echo")
+		if err != nil {
+			return nil, err
+		}
+		trigger, err := c.Pin("trigger")
+		if err != nil {
+			return nil, err
+		}
+		return New(echo, trigger, nil), nil
+	})
+}
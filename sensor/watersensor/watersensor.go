@@ -6,6 +6,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/sensor"
 )
 
 // WaterSensor represents a water sensor.
@@ -58,3 +59,19 @@ func (d *WaterSensor) IsWet() (bool, error) {
 		return false, nil
 	}
 }
+
+// Close releases nothing, the pin belongs to the caller.
+func (d *WaterSensor) Close() error {
+	return nil
+}
+
+// The sensor needs a "data" pin.
+func init() {
+	sensor.Register("watersensor", func(c sensor.Config) (sensor.Device, error) {
+		pin, err := c.Pin("data")
+		if err != nil {
+			return nil, err
+		}
+		return New(pin), nil
+	})
+}
@@ -0,0 +1,156 @@
+// I²C and SPI handlers.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kidoman/embd"
+)
+
+// maxTransfer bounds the length of the reads and writes on the buses.
+const maxTransfer = 4096
+
+// Bytes is a list of bytes, encoded in JSON as an array of numbers rather
+// than as a base64 string.
+type Bytes []byte
+
+// MarshalJSON implements json.Marshaler.
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	ints := make([]int, len(b))
+	for i, v := range b {
+		ints[i] = int(v)
+	}
+	return json.Marshal(ints)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var ints []int
+	if err := json.Unmarshal(data, &ints); err != nil {
+		return err
+	}
+	*b = make(Bytes, len(ints))
+	for i, v := range ints {
+		if v < 0 || v > 255 {
+			return fmt.Errorf("invalid byte %v", v)
+		}
+		(*b)[i] = byte(v)
+	}
+	return nil
+}
+
+// I2CTransaction is the JSON representation of an I²C transaction. Write is
+// written to the device (to register Reg if set), then Read bytes are read
+// back (from register Reg if set).
+type I2CTransaction struct {
+	Addr  byte  `json:"addr"`
+	Reg   *byte `json:"reg,omitempty"`
+	Write Bytes `json:"write,omitempty"`
+	Read  int   `json:"read,omitempty"`
+}
+
+// Data is the JSON representation of the bytes read from a bus.
+type Data struct {
+	Data Bytes `json:"data"`
+}
+
+func (s *Server) handleI2C(w http.ResponseWriter, r *http.Request, busKey string) error {
+	if err := checkMethod(r, "POST"); err != nil {
+		return err
+	}
+	l, err := parseByte(busKey)
+	if err != nil {
+		return err
+	}
+	if !allowed(s.cfg.I2CBuses, l) {
+		return errForbidden
+	}
+
+	var t I2CTransaction
+	if err := readJSON(r, &t); err != nil {
+		return err
+	}
+	if t.Read < 0 || t.Read > maxTransfer {
+		return badRequest("invalid read length %v", t.Read)
+	}
+	if len(t.Write) > maxTransfer {
+		return badRequest("invalid write length %v", len(t.Write))
+	}
+
+	if err := embd.InitI2C(); err != nil {
+		return err
+	}
+	bus := embd.NewI2CBus(l)
+
+	if len(t.Write) > 0 {
+		if t.Reg != nil {
+			err = bus.WriteToReg(t.Addr, *t.Reg, t.Write)
+		} else {
+			err = bus.WriteBytes(t.Addr, t.Write)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	data := Bytes{}
+	if t.Read > 0 {
+		if t.Reg != nil {
+			data = make(Bytes, t.Read)
+			err = bus.ReadFromReg(t.Addr, *t.Reg, data)
+		} else {
+			data, err = bus.ReadBytes(t.Addr, t.Read)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writeJSON(w, Data{data})
+}
+
+// SPITransaction is the JSON representation of a full duplex SPI transfer.
+type SPITransaction struct {
+	Mode  byte  `json:"mode"`
+	Speed int   `json:"speed"`
+	BPW   int   `json:"bpw"`
+	Delay int   `json:"delay"`
+	Data  Bytes `json:"data"`
+}
+
+func (s *Server) handleSPI(w http.ResponseWriter, r *http.Request, channelKey string) error {
+	if err := checkMethod(r, "POST"); err != nil {
+		return err
+	}
+	channel, err := parseByte(channelKey)
+	if err != nil {
+		return err
+	}
+	if !allowed(s.cfg.SPIChannels, channel) {
+		return errForbidden
+	}
+
+	var t SPITransaction
+	if err := readJSON(r, &t); err != nil {
+		return err
+	}
+	if t.Mode > embd.SPIMode3 {
+		return badRequest("invalid spi mode %v", t.Mode)
+	}
+	if len(t.Data) > maxTransfer {
+		return badRequest("invalid transfer length %v", len(t.Data))
+	}
+
+	if err := embd.InitSPI(); err != nil {
+		return err
+	}
+	bus := embd.NewSPIBus(t.Mode, channel, t.Speed, t.BPW, t.Delay)
+	defer bus.Close()
+
+	if err := bus.TransferAndReceiveData(t.Data); err != nil {
+		return err
+	}
+	return writeJSON(w, Data{t.Data})
+}
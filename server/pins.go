@@ -0,0 +1,294 @@
+// Pin and LED handlers.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/kidoman/embd"
+)
+
+var capNames = []struct {
+	cap  int
+	name string
+}{
+	{embd.CapDigital, "digital"},
+	{embd.CapI2C, "i2c"},
+	{embd.CapUART, "uart"},
+	{embd.CapSPI, "spi"},
+	{embd.CapGPMC, "gpmc"},
+	{embd.CapLCD, "lcd"},
+	{embd.CapPWM, "pwm"},
+	{embd.CapAnalog, "analog"},
+}
+
+// Pin is the JSON representation of a pin description.
+type Pin struct {
+	ID      string   `json:"id"`
+	Aliases []string `json:"aliases"`
+	Caps    []string `json:"caps"`
+	Digital int      `json:"digital"`
+	Analog  int      `json:"analog"`
+}
+
+func newPin(pd *embd.PinDesc) Pin {
+	p := Pin{ID: pd.ID, Aliases: pd.Aliases, Caps: []string{}, Digital: pd.DigitalLogical, Analog: pd.AnalogLogical}
+	if p.Aliases == nil {
+		p.Aliases = []string{}
+	}
+	for _, c := range capNames {
+		if pd.Caps&c.cap != 0 {
+			p.Caps = append(p.Caps, c.name)
+		}
+	}
+	return p
+}
+
+// Value is the JSON representation of a digital or analog value.
+type Value struct {
+	Value int `json:"value"`
+}
+
+// lookup finds the pin identified by key, checking that it may be accessed
+// and that it has the capability cap.
+func (s *Server) lookup(key string, cap int) (*embd.PinDesc, error) {
+	pd, found := s.pinMap.Lookup(key, allCaps)
+	if !found {
+		return nil, errNotFound
+	}
+	if s.pinIDs != nil && !s.pinIDs[pd.ID] {
+		return nil, errForbidden
+	}
+	if pd.Caps&cap == 0 {
+		return nil, badRequest("pin %v does not support this operation", pd.ID)
+	}
+	return pd, nil
+}
+
+func (s *Server) digitalPin(key string) (embd.DigitalPin, *embd.PinDesc, error) {
+	pd, err := s.lookup(key, embd.CapDigital)
+	if err != nil {
+		return nil, nil, err
+	}
+	pin, err := embd.NewDigitalPin(pd.ID)
+	return pin, pd, err
+}
+
+func (s *Server) handlePins(w http.ResponseWriter, r *http.Request) error {
+	if err := checkMethod(r, "GET"); err != nil {
+		return err
+	}
+	pins := []Pin{}
+	for _, pd := range s.pinMap {
+		if s.pinIDs != nil && !s.pinIDs[pd.ID] {
+			continue
+		}
+		pins = append(pins, newPin(pd))
+	}
+	return writeJSON(w, pins)
+}
+
+func (s *Server) handlePin(w http.ResponseWriter, r *http.Request, key string) error {
+	if err := checkMethod(r, "GET"); err != nil {
+		return err
+	}
+	pd, err := s.lookup(key, allCaps)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, newPin(pd))
+}
+
+func (s *Server) handlePinFeature(w http.ResponseWriter, r *http.Request, key, feature string) error {
+	switch feature {
+	case "digital":
+		return s.handleDigital(w, r, key)
+	case "direction":
+		return s.handleDirection(w, r, key)
+	case "pwm":
+		return s.handlePWM(w, r, key)
+	case "analog":
+		return s.handleAnalog(w, r, key)
+	}
+	return errNotFound
+}
+
+func (s *Server) handleDigital(w http.ResponseWriter, r *http.Request, key string) error {
+	if err := checkMethod(r, "GET", "PUT"); err != nil {
+		return err
+	}
+	pin, _, err := s.digitalPin(key)
+	if err != nil {
+		return err
+	}
+
+	if r.Method == "PUT" {
+		var v Value
+		if err := readJSON(r, &v); err != nil {
+			return err
+		}
+		if v.Value != embd.Low && v.Value != embd.High {
+			return badRequest("invalid digital value %v", v.Value)
+		}
+		if err := pin.Write(v.Value); err != nil {
+			return err
+		}
+		return writeJSON(w, v)
+	}
+
+	val, err := pin.Read()
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, Value{val})
+}
+
+// Direction is the JSON representation of a pin direction.
+type Direction struct {
+	Direction string `json:"direction"`
+}
+
+func (s *Server) handleDirection(w http.ResponseWriter, r *http.Request, key string) error {
+	if err := checkMethod(r, "PUT"); err != nil {
+		return err
+	}
+	pin, _, err := s.digitalPin(key)
+	if err != nil {
+		return err
+	}
+
+	var d Direction
+	if err := readJSON(r, &d); err != nil {
+		return err
+	}
+	var dir embd.Direction
+	switch d.Direction {
+	case "in":
+		dir = embd.In
+	case "out":
+		dir = embd.Out
+	default:
+		return badRequest("invalid direction %q", d.Direction)
+	}
+	if err := pin.SetDirection(dir); err != nil {
+		return err
+	}
+	return writeJSON(w, d)
+}
+
+// PWM is the JSON representation of a PWM update. Only the fields which are
+// set are applied, in the order period, polarity, duty, microseconds.
+type PWM struct {
+	Period       *int    `json:"period,omitempty"`
+	Duty         *int    `json:"duty,omitempty"`
+	Microseconds *int    `json:"microseconds,omitempty"`
+	Polarity     *string `json:"polarity,omitempty"`
+}
+
+func (s *Server) handlePWM(w http.ResponseWriter, r *http.Request, key string) error {
+	if err := checkMethod(r, "PUT"); err != nil {
+		return err
+	}
+	pd, err := s.lookup(key, embd.CapPWM)
+	if err != nil {
+		return err
+	}
+
+	var p PWM
+	if err := readJSON(r, &p); err != nil {
+		return err
+	}
+	var pol embd.Polarity
+	if p.Polarity != nil {
+		switch *p.Polarity {
+		case "positive":
+			pol = embd.Positive
+		case "negative":
+			pol = embd.Negative
+		default:
+			return badRequest("invalid polarity %q", *p.Polarity)
+		}
+	}
+
+	pin, err := embd.NewPWMPin(pd.ID)
+	if err != nil {
+		return err
+	}
+	if p.Period != nil {
+		if err := pin.SetPeriod(*p.Period); err != nil {
+			return err
+		}
+	}
+	if p.Polarity != nil {
+		if err := pin.SetPolarity(pol); err != nil {
+			return err
+		}
+	}
+	if p.Duty != nil {
+		if err := pin.SetDuty(*p.Duty); err != nil {
+			return err
+		}
+	}
+	if p.Microseconds != nil {
+		if err := pin.SetMicroseconds(*p.Microseconds); err != nil {
+			return err
+		}
+	}
+	return writeJSON(w, p)
+}
+
+func (s *Server) handleAnalog(w http.ResponseWriter, r *http.Request, key string) error {
+	if err := checkMethod(r, "GET"); err != nil {
+		return err
+	}
+	pd, err := s.lookup(key, embd.CapAnalog)
+	if err != nil {
+		return err
+	}
+	pin, err := embd.NewAnalogPin(pd.ID)
+	if err != nil {
+		return err
+	}
+	val, err := pin.Read()
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, Value{val})
+}
+
+// LEDState is the JSON representation of a LED update.
+type LEDState struct {
+	State string `json:"state"`
+}
+
+func (s *Server) handleLED(w http.ResponseWriter, r *http.Request, key string) error {
+	if err := checkMethod(r, "PUT"); err != nil {
+		return err
+	}
+	if s.ledKeys != nil && !s.ledKeys[key] {
+		return errForbidden
+	}
+
+	var st LEDState
+	if err := readJSON(r, &st); err != nil {
+		return err
+	}
+	led, err := embd.NewLED(key)
+	if err != nil {
+		return err
+	}
+	switch st.State {
+	case "on":
+		err = led.On()
+	case "off":
+		err = led.Off()
+	case "toggle":
+		err = led.Toggle()
+	default:
+		return badRequest("invalid led state %q", st.State)
+	}
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, st)
+}
@@ -0,0 +1,280 @@
+// Package server allows remote instrumentation of the host over the network.
+//
+// It exposes the pins, LEDs and buses of the host as a JSON REST API:
+//
+//	GET  /api/pins                  pin map
+//	GET  /api/pins/{pin}            pin description
+//	GET  /api/pins/{pin}/digital    {"value": 1}
+//	PUT  /api/pins/{pin}/digital    {"value": 1}
+//	PUT  /api/pins/{pin}/direction  {"direction": "out"}
+//	PUT  /api/pins/{pin}/pwm        {"period": 20000000, "duty": 1500000, "polarity": "positive"}
+//	GET  /api/pins/{pin}/analog     {"value": 512}
+//	PUT  /api/leds/{led}            {"state": "on"}
+//	POST /api/i2c/{bus}             {"addr": 119, "reg": 208, "read": 1}
+//	POST /api/spi/{channel}         {"mode": 0, "speed": 1000000, "data": [1, 128, 0]}
+//	GET  /api/stream?pins=P1_11,P1_12&edge=both&interval=1s
+//
+// The stream endpoint is a WebSocket which carries edge events for the
+// requested pins along with periodic snapshots of their state.
+//
+// Access can be restricted with a token and to a subset of the pins, LEDs
+// and buses, see Config.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kidoman/embd"
+)
+
+// Config holds the access control options of a Server. A nil list allows
+// everything, an empty one nothing.
+type Config struct {
+	// Pins lists the pins which may be accessed, by ID or alias.
+	Pins []string
+
+	// LEDs lists the LEDs which may be accessed.
+	LEDs []string
+
+	// I2CBuses and SPIChannels list the buses on which transactions may be
+	// performed.
+	I2CBuses    []byte
+	SPIChannels []byte
+
+	// ReadOnly only allows GET requests, which never change the state of
+	// the host. Bus transactions are rejected as well.
+	ReadOnly bool
+
+	// Token, when set, must be presented by clients either as a bearer
+	// token in the Authorization header or as the token query parameter.
+	Token string
+
+	// SnapshotInterval is the default interval between two snapshots on a
+	// stream. Defaults to 1s.
+	SnapshotInterval time.Duration
+}
+
+// Server serves the API. It implements http.Handler.
+type Server struct {
+	cfg Config
+
+	pinMap  embd.PinMap
+	pinIDs  map[string]bool
+	ledKeys map[string]bool
+
+	// hwM serializes the accesses to the drivers, which lazily initialize
+	// themselves and are not safe for concurrent use. It is held by all the
+	// handlers but the stream one, which only takes it around its accesses.
+	hwM sync.Mutex
+
+	watches  map[string]*watch
+	watchesM sync.Mutex
+}
+
+var (
+	errForbidden = errors.New("server: access denied")
+	errReadOnly  = errors.New("server: server is read only")
+	errNotFound  = errors.New("server: not found")
+)
+
+// allCaps matches a pin with any capability.
+const allCaps = embd.CapDigital | embd.CapI2C | embd.CapUART | embd.CapSPI | embd.CapGPMC | embd.CapLCD | embd.CapPWM | embd.CapAnalog
+
+// New returns a server for the detected host.
+func New(cfg Config) (*Server, error) {
+	desc, err := embd.DescribeHost()
+	if err != nil {
+		return nil, err
+	}
+	var pinMap embd.PinMap
+	if desc.GPIODriver != nil {
+		pinMap = desc.GPIODriver().PinMap()
+	}
+
+	if cfg.SnapshotInterval == 0 {
+		cfg.SnapshotInterval = time.Second
+	}
+
+	s := &Server{
+		cfg:     cfg,
+		pinMap:  pinMap,
+		watches: make(map[string]*watch),
+	}
+	if cfg.Pins != nil {
+		s.pinIDs = make(map[string]bool)
+		for _, key := range cfg.Pins {
+			pd, found := pinMap.Lookup(key, allCaps)
+			if !found {
+				return nil, fmt.Errorf("server: no pin found for %q", key)
+			}
+			s.pinIDs[pd.ID] = true
+		}
+	}
+	if cfg.LEDs != nil {
+		s.ledKeys = make(map[string]bool)
+		for _, key := range cfg.LEDs {
+			s.ledKeys[key] = true
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.cfg.Token == "" {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) == 1
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	glog.V(2).Infof("server: %v %v", r.Method, r.URL)
+
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, errors.New("server: invalid token"))
+		return
+	}
+	if s.cfg.ReadOnly && r.Method != "GET" {
+		writeError(w, http.StatusForbidden, errReadOnly)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "api" {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+
+	route := parts[1:]
+	if len(route) != 1 || route[0] != "stream" {
+		s.hwM.Lock()
+		defer s.hwM.Unlock()
+	}
+
+	var err error
+	switch {
+	case len(route) == 1 && route[0] == "pins":
+		err = s.handlePins(w, r)
+	case len(route) == 2 && route[0] == "pins":
+		err = s.handlePin(w, r, route[1])
+	case len(route) == 3 && route[0] == "pins":
+		err = s.handlePinFeature(w, r, route[1], route[2])
+	case len(route) == 2 && route[0] == "leds":
+		err = s.handleLED(w, r, route[1])
+	case len(route) == 2 && route[0] == "i2c":
+		err = s.handleI2C(w, r, route[1])
+	case len(route) == 2 && route[0] == "spi":
+		err = s.handleSPI(w, r, route[1])
+	case len(route) == 1 && route[0] == "stream":
+		err = s.handleStream(w, r)
+	default:
+		err = errNotFound
+	}
+	if err != nil {
+		writeError(w, statusCode(err), err)
+	}
+}
+
+// requestError is an error caused by a malformed request.
+type requestError struct {
+	msg string
+}
+
+func (e *requestError) Error() string {
+	return "server: " + e.msg
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &requestError{fmt.Sprintf(format, args...)}
+}
+
+type methodError struct {
+	method string
+}
+
+func (e *methodError) Error() string {
+	return fmt.Sprintf("server: method %v not allowed", e.method)
+}
+
+func statusCode(err error) int {
+	switch err.(type) {
+	case *requestError:
+		return http.StatusBadRequest
+	case *methodError:
+		return http.StatusMethodNotAllowed
+	}
+	switch err {
+	case errForbidden, errReadOnly:
+		return http.StatusForbidden
+	case errNotFound:
+		return http.StatusNotFound
+	case embd.ErrFeatureNotSupported, embd.ErrFeatureNotImplemented:
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	glog.V(1).Infof("server: %v", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest("invalid body: %v", err)
+	}
+	return nil
+}
+
+func checkMethod(r *http.Request, methods ...string) error {
+	for _, m := range methods {
+		if r.Method == m {
+			return nil
+		}
+	}
+	return &methodError{r.Method}
+}
+
+// parseByte parses a bus number or an I²C address, in decimal or in hex
+// with a 0x prefix.
+func parseByte(s string) (byte, error) {
+	n, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, badRequest("invalid number %q", s)
+	}
+	return byte(n), nil
+}
+
+func allowed(list []byte, b byte) bool {
+	if list == nil {
+		return true
+	}
+	for _, l := range list {
+		if l == b {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,332 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kidoman/embd"
+	"github.com/kidoman/embd/fakehost"
+)
+
+const testHost embd.Host = "server test"
+
+var testPins = embd.PinMap{
+	&embd.PinDesc{ID: "P1_3", Aliases: []string{"2", "GPIO_2", "SDA"}, Caps: embd.CapDigital | embd.CapI2C, DigitalLogical: 2},
+	&embd.PinDesc{ID: "P1_11", Aliases: []string{"17", "GPIO_17"}, Caps: embd.CapDigital, DigitalLogical: 17},
+	&embd.PinDesc{ID: "P1_12", Aliases: []string{"18", "GPIO_18"}, Caps: embd.CapDigital | embd.CapPWM, DigitalLogical: 18},
+	&embd.PinDesc{ID: "P1_13", Aliases: []string{"27", "GPIO_27"}, Caps: embd.CapDigital, DigitalLogical: 27},
+	&embd.PinDesc{ID: "AIN0", Aliases: []string{"0"}, Caps: embd.CapAnalog, AnalogLogical: 0},
+}
+
+// host records what the server does to the hardware.
+var host = fakehost.New(testPins)
+
+func init() {
+	host.Register(testHost)
+	embd.SetHost(testHost, 0)
+}
+
+// calls returns the calls made to the hardware which start with prefix.
+func calls(prefix string) []string {
+	var calls []string
+	for _, c := range host.Calls() {
+		if strings.HasPrefix(c, prefix) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+func newTestServer(t *testing.T, cfg Config) *httptest.Server {
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func do(t *testing.T, ts *httptest.Server, method, path, body string) (int, string) {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(buf.String())
+}
+
+func pin(t *testing.T, n int) *fakehost.DigitalPin {
+	p, err := embd.NewDigitalPin(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*fakehost.DigitalPin)
+}
+
+func TestRequests(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	host.Reset()
+
+	var tests = []struct {
+		method, path, body string
+		code               int
+		resp               string
+	}{
+		{"GET", "/api/pins/17", "", 200, `{"id":"P1_11","aliases":["17","GPIO_17"],"caps":["digital"],"digital":17,"analog":0}`},
+		{"GET", "/api/pins/P1_3", "", 200, `{"id":"P1_3","aliases":["2","GPIO_2","SDA"],"caps":["digital","i2c"],"digital":2,"analog":0}`},
+		{"GET", "/api/pins/P9_99", "", 404, `{"error":"server: not found"}`},
+		{"PUT", "/api/pins/P1_11/digital", `{"value":1}`, 200, `{"value":1}`},
+		{"GET", "/api/pins/GPIO_17/digital", "", 200, `{"value":1}`},
+		{"PUT", "/api/pins/P1_11/digital", `{"value":2}`, 400, `{"error":"server: invalid digital value 2"}`},
+		{"PUT", "/api/pins/P1_11/digital", `{"value":`, 400, `{"error":"server: invalid body: unexpected EOF"}`},
+		{"POST", "/api/pins/P1_11/digital", `{"value":1}`, 405, `{"error":"server: method POST not allowed"}`},
+		{"PUT", "/api/pins/P1_11/direction", `{"direction":"out"}`, 200, `{"direction":"out"}`},
+		{"PUT", "/api/pins/P1_11/direction", `{"direction":"sideways"}`, 400, `{"error":"server: invalid direction \"sideways\""}`},
+		{"PUT", "/api/pins/P1_11/pwm", `{"period":20000000}`, 400, `{"error":"server: pin P1_11 does not support this operation"}`},
+		{"PUT", "/api/pins/P1_12/pwm", `{"period":20000000,"microseconds":1500,"polarity":"negative"}`, 200, `{"period":20000000,"microseconds":1500,"polarity":"negative"}`},
+		{"GET", "/api/pins/AIN0/analog", "", 200, `{"value":512}`},
+		{"PUT", "/api/leds/led0", `{"state":"on"}`, 200, `{"state":"on"}`},
+		{"PUT", "/api/leds/led0", `{"state":"dim"}`, 400, `{"error":"server: invalid led state \"dim\""}`},
+		{"POST", "/api/i2c/1", `{"addr":119,"reg":208,"write":[1,2],"read":2}`, 200, `{"data":[208,209]}`},
+		{"POST", "/api/i2c/0x1", `{"addr":119,"read":1}`, 200, `{"data":[0]}`},
+		{"POST", "/api/i2c/1", `{"addr":119,"write":[256]}`, 400, `{"error":"server: invalid body: invalid byte 256"}`},
+		{"POST", "/api/i2c/1", `{"addr":119,"read":4097}`, 400, `{"error":"server: invalid read length 4097"}`},
+		{"POST", "/api/i2c/1", `{"addr":119,"write":[` + strings.Repeat("0,", 4096) + `0]}`, 400, `{"error":"server: invalid write length 4097"}`},
+		{"POST", "/api/i2c/bus", `{}`, 400, `{"error":"server: invalid number \"bus\""}`},
+		{"POST", "/api/spi/0", `{"data":[0,255,15]}`, 200, `{"data":[255,0,240]}`},
+		{"POST", "/api/spi/0", `{"mode":4}`, 400, `{"error":"server: invalid spi mode 4"}`},
+		{"POST", "/api/spi/0", `{"data":[` + strings.Repeat("0,", 4096) + `0]}`, 400, `{"error":"server: invalid transfer length 4097"}`},
+		{"GET", "/api/bogus", "", 404, `{"error":"server: not found"}`},
+	}
+	for _, test := range tests {
+		code, resp := do(t, ts, test.method, test.path, test.body)
+		if code != test.code || resp != test.resp {
+			t.Errorf("%v %v %v: got %v %v, want %v %v", test.method, test.path, test.body, code, resp, test.code, test.resp)
+		}
+	}
+
+	if p := pin(t, 17); p.Dir() != embd.Out {
+		t.Errorf("direction of P1_11: got %v, want %v", p.Dir(), embd.Out)
+	}
+	if pwm := host.PWM("P1_12"); pwm.Period() != 20000000 || pwm.Duty() != 1500000 || pwm.Polarity() != embd.Negative {
+		t.Errorf("pwm: got period %v, duty %v and polarity %v", pwm.Period(), pwm.Duty(), pwm.Polarity())
+	}
+	if !host.LED().Lit() {
+		t.Errorf("led0 is off, want on")
+	}
+	if want := []string{"i2c1 write 0x77 reg 0xd0 [1 2]", "i2c1 read 0x77 reg 0xd0 2", "i2c1 read 0x77 1"}; !reflect.DeepEqual(calls("i2c1 "), want) {
+		t.Errorf("i2c transactions: got %q, want %q", calls("i2c1 "), want)
+	}
+	if want := []string{"spi transfer [0 255 15]"}; !reflect.DeepEqual(calls("spi transfer"), want) {
+		t.Errorf("spi transfers: got %q, want %q", calls("spi transfer"), want)
+	}
+}
+
+func TestPins(t *testing.T) {
+	ts := newTestServer(t, Config{Pins: []string{"17", "AIN0"}})
+
+	code, resp := do(t, ts, "GET", "/api/pins", "")
+	if code != 200 {
+		t.Fatalf("got %v %v", code, resp)
+	}
+	var pins []Pin
+	if err := json.Unmarshal([]byte(resp), &pins); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range pins {
+		ids = append(ids, p.ID)
+	}
+	if want := []string{"P1_11", "AIN0"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got pins %v, want %v", ids, want)
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	var tests = []struct {
+		cfg                Config
+		method, path, body string
+		header             string
+		code               int
+	}{
+		{Config{Pins: []string{"P1_11"}}, "GET", "/api/pins/P1_11/digital", "", "", 200},
+		{Config{Pins: []string{"P1_11"}}, "GET", "/api/pins/P1_12/digital", "", "", 403},
+		{Config{Pins: []string{}}, "GET", "/api/pins/P1_11", "", "", 403},
+		{Config{LEDs: []string{}}, "PUT", "/api/leds/led0", `{"state":"off"}`, "", 403},
+		{Config{I2CBuses: []byte{1}}, "POST", "/api/i2c/2", `{"addr":1}`, "", 403},
+		{Config{SPIChannels: []byte{1}}, "POST", "/api/spi/0", `{}`, "", 403},
+		{Config{ReadOnly: true}, "GET", "/api/pins/P1_11/digital", "", "", 200},
+		{Config{ReadOnly: true}, "PUT", "/api/pins/P1_11/digital", `{"value":0}`, "", 403},
+		{Config{ReadOnly: true}, "POST", "/api/i2c/1", `{"addr":1}`, "", 403},
+		{Config{Token: "secret"}, "GET", "/api/pins", "", "", 401},
+		{Config{Token: "secret"}, "GET", "/api/pins", "", "Bearer wrong", 401},
+		{Config{Token: "secret"}, "GET", "/api/pins", "", "Bearer secret", 200},
+		{Config{Token: "secret"}, "GET", "/api/pins?token=secret", "", "", 200},
+	}
+	for _, test := range tests {
+		s, err := New(test.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%+v %v %v: got %v, want %v", test.cfg, test.method, test.path, w.Code, test.code)
+		}
+	}
+}
+
+func TestNewUnknownPin(t *testing.T) {
+	if _, err := New(Config{Pins: []string{"P9_99"}}); err == nil {
+		t.Errorf("New with an unknown pin: got nil error")
+	}
+}
+
+func TestStream(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	p := pin(t, 27)
+	p.Write(embd.Low)
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/stream?pins=P1_13&edge=rising&interval=0"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	waitFor(t, p.Watched)
+	p.Set(embd.Low)
+	p.Set(embd.High)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var ev EdgeEvent
+	if err := conn.ReadJSON(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != "edge" || ev.Pin != "P1_13" || ev.Value != embd.High {
+		t.Errorf("got event %+v, want a rising edge on P1_13", ev)
+	}
+
+	conn.Close()
+	waitFor(t, func() bool { return !p.Watched() })
+}
+
+func TestStreamSnapshot(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	pin(t, 17).Write(embd.High)
+	pin(t, 27).Write(embd.Low)
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/stream?pins=17,27&edge=none&interval=10ms"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var ev SnapshotEvent
+	if err := conn.ReadJSON(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"P1_11": 1, "P1_13": 0}; ev.Type != "snapshot" || !reflect.DeepEqual(ev.Pins, want) {
+		t.Errorf("got event %+v, want a snapshot of %v", ev, want)
+	}
+}
+
+func TestStreamEdgesWhileClosing(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	p := pin(t, 27)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for val := embd.Low; ; val ^= 1 {
+			select {
+			case <-stop:
+				return
+			default:
+				p.Set(val)
+			}
+		}
+	}()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/stream?pins=P1_13&interval=0"
+	for i := 0; i < 20; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, p.Watched)
+		conn.Close()
+		waitFor(t, func() bool { return !p.Watched() })
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	s, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs := []struct{ method, path, body string }{
+		{"GET", "/api/pins/P1_3/digital", ""},
+		{"PUT", "/api/pins/P1_11/digital", `{"value":1}`},
+		{"PUT", "/api/pins/P1_12/pwm", `{"duty":1000}`},
+		{"PUT", "/api/leds/led0", `{"state":"toggle"}`},
+		{"POST", "/api/i2c/2", `{"addr":119,"read":1}`},
+		{"POST", "/api/spi/1", `{"data":[1]}`},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		for _, r := range reqs {
+			wg.Add(1)
+			go func(method, path, body string) {
+				defer wg.Done()
+				w := httptest.NewRecorder()
+				s.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+				if w.Code != 200 {
+					t.Errorf("%v %v: got %v %v", method, path, w.Code, w.Body)
+				}
+			}(r.method, r.path, r.body)
+		}
+	}
+	wg.Wait()
+}
+
+func TestStreamBadRequest(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	for _, q := range []string{"", "pins=P9_99", "pins=AIN0", "pins=17&edge=up", "pins=17&interval=soon"} {
+		code, _ := do(t, ts, "GET", "/api/stream?"+q, "")
+		if code == 200 || code == 101 {
+			t.Errorf("stream?%v: got %v, want an error", q, code)
+		}
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
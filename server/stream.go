@@ -0,0 +1,236 @@
+// WebSocket streaming of pin events.
+
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+	"github.com/kidoman/embd"
+)
+
+// EdgeEvent is sent on a stream when a watched pin changes state.
+type EdgeEvent struct {
+	Type  string    `json:"type"`
+	Pin   string    `json:"pin"`
+	Value int       `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// SnapshotEvent is sent periodically on a stream with the state of all the
+// pins of the stream.
+type SnapshotEvent struct {
+	Type string         `json:"type"`
+	Pins map[string]int `json:"pins"`
+	Time time.Time      `json:"time"`
+}
+
+// watch fans the edge events of a pin out to the streams subscribed to it,
+// as a pin only accepts a single handler.
+type watch struct {
+	pin  embd.DigitalPin
+	subs map[chan EdgeEvent]bool
+}
+
+// subscribe and unsubscribe must be called with s.hwM held, which orders
+// the calls to Watch and StopWatching. s.watchesM is not held while calling
+// them, as the pin handlers run under the lock of the interrupt listener and
+// take it to broadcast.
+
+func (s *Server) subscribe(id string, pin embd.DigitalPin, ch chan EdgeEvent) error {
+	s.watchesM.Lock()
+	wt, ok := s.watches[id]
+	if ok {
+		wt.subs[ch] = true
+	}
+	s.watchesM.Unlock()
+	if ok {
+		return nil
+	}
+
+	wt = &watch{pin: pin, subs: map[chan EdgeEvent]bool{ch: true}}
+	s.watchesM.Lock()
+	s.watches[id] = wt
+	s.watchesM.Unlock()
+
+	err := pin.Watch(embd.EdgeBoth, func(p embd.DigitalPin) {
+		val, err := p.Read()
+		if err != nil {
+			glog.Errorf("server: reading %v: %v", id, err)
+			return
+		}
+		s.broadcast(id, EdgeEvent{Type: "edge", Pin: id, Value: val, Time: time.Now()})
+	})
+	if err != nil {
+		s.watchesM.Lock()
+		delete(s.watches, id)
+		s.watchesM.Unlock()
+	}
+	return err
+}
+
+func (s *Server) unsubscribe(id string, ch chan EdgeEvent) {
+	s.watchesM.Lock()
+	wt, ok := s.watches[id]
+	if ok {
+		delete(wt.subs, ch)
+		ok = len(wt.subs) == 0
+		if ok {
+			delete(s.watches, id)
+		}
+	}
+	s.watchesM.Unlock()
+	if !ok {
+		return
+	}
+
+	if err := wt.pin.StopWatching(); err != nil {
+		glog.Errorf("server: stop watching %v: %v", id, err)
+	}
+}
+
+func (s *Server) broadcast(id string, ev EdgeEvent) {
+	s.watchesM.Lock()
+	var subs []chan EdgeEvent
+	if wt, ok := s.watches[id]; ok {
+		for ch := range wt.subs {
+			subs = append(subs, ch)
+		}
+	}
+	s.watchesM.Unlock()
+
+	for _, ch := range subs {
+		select {
+		case ch <- ev:
+		default:
+			glog.V(1).Infof("server: dropping edge event of %v for a slow client", id)
+		}
+	}
+}
+
+var upgrader = websocket.Upgrader{}
+
+type streamPin struct {
+	id  string
+	pin embd.DigitalPin
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) error {
+	if err := checkMethod(r, "GET"); err != nil {
+		return err
+	}
+
+	q := r.URL.Query()
+	var pins []streamPin
+	for _, key := range strings.Split(q.Get("pins"), ",") {
+		if key == "" {
+			continue
+		}
+		s.hwM.Lock()
+		pin, pd, err := s.digitalPin(key)
+		s.hwM.Unlock()
+		if err != nil {
+			return err
+		}
+		pins = append(pins, streamPin{pd.ID, pin})
+	}
+	if len(pins) == 0 {
+		return badRequest("no pins to stream")
+	}
+
+	edge := embd.EdgeBoth
+	if e := q.Get("edge"); e != "" {
+		edge = embd.Edge(e)
+		if edge != embd.EdgeNone && edge != embd.EdgeRising && edge != embd.EdgeFalling && edge != embd.EdgeBoth {
+			return badRequest("invalid edge %q", e)
+		}
+	}
+	interval := s.cfg.SnapshotInterval
+	if i := q.Get("interval"); i != "" {
+		var err error
+		if interval, err = time.ParseDuration(i); err != nil || interval < 0 {
+			return badRequest("invalid interval %q", i)
+		}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied.
+		glog.V(1).Infof("server: %v", err)
+		return nil
+	}
+	defer conn.Close()
+
+	events := make(chan EdgeEvent, 16)
+	if edge != embd.EdgeNone {
+		for _, p := range pins {
+			s.hwM.Lock()
+			err := s.subscribe(p.id, p.pin, events)
+			s.hwM.Unlock()
+			if err != nil {
+				glog.Errorf("server: watching %v: %v", p.id, err)
+				conn.WriteJSON(struct {
+					Error string `json:"error"`
+				}{err.Error()})
+				return nil
+			}
+			defer func(id string) {
+				s.hwM.Lock()
+				defer s.hwM.Unlock()
+				s.unsubscribe(id, events)
+			}(p.id)
+		}
+	}
+
+	// The client is not expected to send anything, reading is only needed
+	// to notice when it goes away.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var msg interface{}
+		select {
+		case ev := <-events:
+			if edge == embd.EdgeRising && ev.Value != embd.High || edge == embd.EdgeFalling && ev.Value != embd.Low {
+				continue
+			}
+			msg = ev
+		case <-tick:
+			snap := SnapshotEvent{Type: "snapshot", Pins: make(map[string]int), Time: time.Now()}
+			s.hwM.Lock()
+			for _, p := range pins {
+				val, err := p.pin.Read()
+				if err != nil {
+					glog.Errorf("server: reading %v: %v", p.id, err)
+					continue
+				}
+				snap.Pins[p.id] = val
+			}
+			s.hwM.Unlock()
+			msg = snap
+		case <-done:
+			return nil
+		}
+		if err := conn.WriteJSON(msg); err != nil {
+			glog.V(1).Infof("server: %v", err)
+			return nil
+		}
+	}
+}